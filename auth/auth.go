@@ -10,9 +10,12 @@ package auth
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -24,6 +27,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 )
 
 const (
@@ -31,6 +36,8 @@ const (
 	docURL        = "https://docs.aws.amazon.com/eks/latest/userguide/iam-roles-for-service-accounts.html"
 	tokenAudience = "sts.amazonaws.com"
 	ProviderName  = "secrets-store-csi-driver-provider-aws"
+
+	maxSourceIdentity = 64 // Longest source identity allowed by STS
 )
 
 // Private implementation of stscreds.TokenFetcher interface to fetch a token
@@ -38,8 +45,8 @@ const (
 // account.
 //
 type authTokenFetcher struct {
-	nameSpace, svcAcc string
-	k8sClient         k8sv1.CoreV1Interface
+	nameSpace, svcAcc, audience string
+	k8sClient                   k8sv1.CoreV1Interface
 }
 
 // Private helper to fetch a JWT token for a given namespace and service account.
@@ -51,7 +58,7 @@ func (p authTokenFetcher) FetchToken(ctx credentials.Context) ([]byte, error) {
 	// Use the K8s API to fetch the token from the OIDC provider.
 	tokRsp, err := p.k8sClient.ServiceAccounts(p.nameSpace).CreateToken(ctx, p.svcAcc, &authv1.TokenRequest{
 		Spec: authv1.TokenRequestSpec{
-			Audiences: []string{tokenAudience},
+			Audiences: []string{p.audience},
 		},
 	}, metav1.CreateOptions{})
 	if err != nil {
@@ -62,13 +69,15 @@ func (p authTokenFetcher) FetchToken(ctx credentials.Context) ([]byte, error) {
 }
 
 // Auth is the main entry point to retrive an AWS session. The caller
-// initializes a new Auth object with NewAuth passing the region, namespace, and
-// K8s service account (and request context). The caller can then obtain AWS
-// sessions by calling GetAWSSession.
+// initializes a new Auth object with NewAuth passing the region, namespace,
+// K8s service account, and role session name (and request context). The caller
+// can then obtain AWS sessions by calling GetAWSSession.
 //
 type Auth struct {
 	region, nameSpace, svcAcc string
+	roleSessionName           string // Session name for AssumeRoleWithWebIdentity (empty for the default)
 	k8sClient                 k8sv1.CoreV1Interface
+	credCache                 *CredentialCache // Credentials shared between mounts (nil for none)
 	stsClient                 stsiface.STSAPI
 	ctx                       context.Context
 }
@@ -77,8 +86,9 @@ type Auth struct {
 //
 func NewAuth(
 	ctx context.Context,
-	region, nameSpace, svcAcc string,
+	region, nameSpace, svcAcc, roleSessionName string,
 	k8sClient k8sv1.CoreV1Interface,
+	credCache *CredentialCache,
 ) (auth *Auth, e error) {
 
 	// Get an initial session to use for STS calls.
@@ -91,12 +101,14 @@ func NewAuth(
 	}
 
 	return &Auth{
-		region:    region,
-		nameSpace: nameSpace,
-		svcAcc:    svcAcc,
-		k8sClient: k8sClient,
-		stsClient: sts.New(sess),
-		ctx:       ctx,
+		region:          region,
+		nameSpace:       nameSpace,
+		svcAcc:          svcAcc,
+		roleSessionName: roleSessionName,
+		k8sClient:       k8sClient,
+		credCache:       credCache,
+		stsClient:       newSTSClient(sess),
+		ctx:             ctx,
 	}, nil
 
 }
@@ -117,9 +129,14 @@ func (p Auth) getRoleARN() (arn *string, e error) {
 
 	roleArn := rsp.Annotations[arnAnno]
 	if len(roleArn) <= 0 {
-		klog.Errorf("Need IAM role for service account %s (namespace: %s) - %s", p.svcAcc, p.nameSpace, docURL)
+		utils.Errorf("Need IAM role for service account %s (namespace: %s) - %s", p.svcAcc, p.nameSpace, docURL)
 		return nil, fmt.Errorf("An IAM role must be associated with service account %s (namespace: %s)", p.svcAcc, p.nameSpace)
 	}
+	if strings.HasPrefix(roleArn, "arn:") {
+		if err := ValidateRoleARN(roleArn, p.region); err != nil {
+			return nil, fmt.Errorf("service account %s (namespace: %s): %w", p.svcAcc, p.nameSpace, err)
+		}
+	}
 	klog.Infof("Role ARN for %s:%s is %s", p.nameSpace, p.svcAcc, roleArn)
 
 	return &roleArn, nil
@@ -131,27 +148,165 @@ func (p Auth) getRoleARN() (arn *string, e error) {
 // by using a private TokenFetcher helper.
 //
 func (p Auth) GetAWSSession() (awsSession *session.Session, e error) {
+	awsSession, _, e = p.GetAWSSessionAndRole()
+	return awsSession, e
+}
+
+// Get the AWS session of a pod's service account and the IAM role it is
+// annotated with.
+//
+// The role identifies the credentials of the session, so callers sharing
+// responses between mounts can stop sharing them as soon as the service
+// account is annotated with another role.
+//
+func (p Auth) GetAWSSessionAndRole() (awsSession *session.Session, role string, e error) {
 
 	roleArn, err := p.getRoleARN()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	fetcher := &authTokenFetcher{p.nameSpace, p.svcAcc, p.k8sClient}
-	ar := stscreds.NewWebIdentityRoleProviderWithToken(p.stsClient, *roleArn, ProviderName, fetcher)
+	sessionName := p.roleSessionName
+	if len(sessionName) == 0 {
+		sessionName = ProviderName
+	}
+
+	// Reuse the credentials of earlier mounts when caching is enabled.
+	key := credentialKey{p.nameSpace, p.svcAcc, *roleArn, p.region, sessionName}
+	creds := p.credCache.get(key, func() *credentials.Credentials {
+		fetcher := &authTokenFetcher{p.nameSpace, p.svcAcc, tokenAudience, p.k8sClient}
+		ar := stscreds.NewWebIdentityRoleProviderWithToken(p.stsClient, *roleArn, sessionName, fetcher)
+		ar.ExpiryWindow = credentialExpiryWindow
+		return credentials.NewCredentials(ar)
+	})
 	config := aws.NewConfig().
 		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint). // Use regional STS endpoint
 		WithRegion(p.region).
-		WithCredentials(credentials.NewCredentials(ar))
+		WithCredentials(creds)
 
 	// Include the provider in the user agent string.
 	sess, err := session.NewSession(config)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	sess.Handlers.Build.PushFront(func(r *request.Request) {
 		request.AddToUserAgent(r, ProviderName)
 	})
 
-	return session.Must(sess, err), nil
+	return session.Must(sess, err), *roleArn, nil
+}
+
+// Chain from an existing session into another role.
+//
+// The role is assumed with sts:AssumeRole using the credentials of the given
+// session. The source identity is recorded in CloudTrail for every call made
+// with the chained credentials, so audits can tell which workload accessed
+// which secret. The trust policy of the role must allow sts:SetSourceIdentity.
+//
+// The role session name defaults to the provider name when empty. Any session
+// tags are passed to AssumeRole (requiring sts:TagSession in the trust policy)
+// so access to secrets can be scoped with attribute based access control.
+//
+func GetChainedSession(sess *session.Session, roleArn, sourceIdentity, roleSessionName string, tags map[string]string) (awsSession *session.Session, e error) {
+
+	if !arn.IsARN(roleArn) {
+		return nil, fmt.Errorf("invalid role ARN for role chaining: %s", roleArn)
+	}
+
+	stsClient := newSTSClient(sess)
+	creds := stscreds.NewCredentialsWithClient(stsClient, roleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = ProviderName
+		if len(roleSessionName) > 0 {
+			p.RoleSessionName = roleSessionName
+		}
+		p.SourceIdentity = aws.String(sourceIdentity)
+		p.Tags = stsTags(tags)
+	})
+
+	return sess.Copy(aws.NewConfig().WithCredentials(creds)), nil
+}
+
+// Check that a role ARN is an IAM role in the partition of a region.
+//
+// STS only issues credentials for roles in its own partition, so a role
+// copied from a commercial account (arn:aws:) fails in GovCloud
+// (arn:aws-us-gov:) or China (arn:aws-cn:) regions with an access denied
+// error that does not mention the partition. The partition is not checked for
+// regions the SDK does not recognize.
+//
+func ValidateRoleARN(roleArn, region string) error {
+
+	roleARN, err := arn.Parse(roleArn)
+	if err != nil || roleARN.Service != "iam" || !strings.HasPrefix(roleARN.Resource, "role/") {
+		return fmt.Errorf("invalid IAM role ARN: %s", roleArn)
+	}
+	if partition := utils.PartitionOf(region); len(partition) > 0 && roleARN.Partition != partition {
+		return fmt.Errorf("role ARN partition must be %s in region %s: %s", partition, region, roleArn)
+	}
+	return nil
+}
+
+// Returns the CloudTrail source identity for a pod.
+//
+// Source identities may only contain letters, digits, and the characters
+// +=,.@- so the pod is written as <pod>@<namespace> (@ can not appear in
+// either name) and truncated to the 64 character limit.
+//
+func SourceIdentity(nameSpace, podName string) string {
+
+	identity := podName + "@" + nameSpace
+	if len(identity) > maxSourceIdentity {
+		identity = identity[:maxSourceIdentity]
+	}
+	return identity
+}
+
+// Get an AWS session using cached AWS IAM Identity Center (SSO) credentials.
+//
+// This is intended only for development clusters (kind, minikube, etc.) that
+// can not use IAM roles for service accounts. The named profile is read from
+// the shared AWS config file and must use a cached SSO token (created with aws
+// sso login) that has been made available to the provider. All pods share the
+// same credentials, so this must never be used in production clusters.
+//
+func GetSSOSession(ctx context.Context, region, profile string) (awsSession *session.Session, e error) {
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+		Config: *aws.NewConfig().
+			WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+			WithRegion(region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSO profile %s: %w", profile, err)
+	}
+
+	// Make sure the credentials really come from SSO. The SDK silently falls
+	// back to the default credential chain (e.g. the node's role) when the
+	// profile does not exist.
+	creds, err := sess.Config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO credentials for profile %s: %w", profile, err)
+	}
+	if creds.ProviderName != ssocreds.ProviderName {
+		return nil, fmt.Errorf("profile %s does not use SSO credentials (got %s)", profile, creds.ProviderName)
+	}
+
+	// Include the provider in the user agent string.
+	sess.Handlers.Build.PushFront(func(r *request.Request) {
+		request.AddToUserAgent(r, ProviderName)
+	})
+
+	return sess, nil
+}
+
+// Private helper to create an STS client that records the result of its calls
+// for the health endpoint.
+//
+func newSTSClient(sess *session.Session) *sts.STS {
+
+	client := sts.New(sess, utils.ServiceConfig(utils.STSService, aws.StringValue(sess.Config.Region)))
+	client.Handlers.Complete.PushBack(func(r *request.Request) { utils.RecordSTSCall(r.Error) })
+	return client
 }
@@ -3,9 +3,17 @@ package auth
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 
 	authv1 "k8s.io/api/authentication/v1"
@@ -102,11 +110,14 @@ func TestAuth(t *testing.T) {
 		t.Run(tstData.testName, func(t *testing.T) {
 
 			tstAuth := newAuthWithMocks(tstData.k8SAGetOneShotError, tstData.roleARN)
-			sess, err := tstAuth.GetAWSSession()
+			sess, role, err := tstAuth.GetAWSSessionAndRole()
 
 			if len(tstData.expError) == 0 && err != nil {
 				t.Errorf("%s case: got unexpected auth error: %s", tstData.testName, err)
 			}
+			if len(tstData.expError) == 0 && role != tstData.roleARN {
+				t.Errorf("%s case: expected role %s but got %s", tstData.testName, tstData.roleARN, role)
+			}
 			if len(tstData.expError) == 0 && sess == nil {
 				t.Errorf("%s case: got empty session", tstData.testName)
 			}
@@ -128,6 +139,55 @@ var tokenTests []authTest = []authTest{
 	{"Fetch JWT fail", false, true, "myRoleARN", "Fake create token"},
 }
 
+func TestCredentialCache(t *testing.T) {
+
+	cache := NewCredentialCache()
+	tstAuth := newAuthWithMocks(false, "arn:aws:iam::123456789012:role/secrets")
+	tstAuth.credCache = cache
+
+	sess1, err := tstAuth.GetAWSSession()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sess2, err := tstAuth.GetAWSSession()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sess1.Config.Credentials != sess2.Config.Credentials {
+		t.Fatalf("Expected mounts of the same service account to share credentials")
+	}
+
+	// Other regions and session names get their own credentials.
+	tstAuth.region = "otherRegion"
+	sess3, _ := tstAuth.GetAWSSession()
+	tstAuth.roleSessionName = "myPod"
+	sess4, _ := tstAuth.GetAWSSession()
+	if sess3.Config.Credentials == sess1.Config.Credentials || sess4.Config.Credentials == sess3.Config.Credentials {
+		t.Fatalf("Expected new credentials for another region or session name")
+	}
+	if len(cache.entries) != 3 {
+		t.Fatalf("Expected 3 cached credentials, got %d", len(cache.entries))
+	}
+
+	// Credentials not used for a while are dropped.
+	for _, entry := range cache.entries {
+		entry.lastUsed = time.Now().Add(-2 * credentialIdleTimeout)
+	}
+	cache.nextSweep = time.Time{}
+	sess5, _ := tstAuth.GetAWSSession()
+	if sess5.Config.Credentials == sess4.Config.Credentials || len(cache.entries) != 1 {
+		t.Fatalf("Expected idle credentials to be dropped, got %d cached", len(cache.entries))
+	}
+
+	// Without a cache every mount gets new credentials.
+	tstAuth.credCache = nil
+	sess6, _ := tstAuth.GetAWSSession()
+	sess7, _ := tstAuth.GetAWSSession()
+	if sess6.Config.Credentials == sess7.Config.Credentials {
+		t.Fatalf("Expected new credentials without a cache")
+	}
+}
+
 func TestToken(t *testing.T) {
 
 	for _, tstData := range tokenTests {
@@ -135,7 +195,7 @@ func TestToken(t *testing.T) {
 		t.Run(tstData.testName, func(t *testing.T) {
 
 			tstAuth := newAuthWithMocks(tstData.k8SAGetOneShotError, tstData.roleARN)
-			fetcher := &authTokenFetcher{tstAuth.nameSpace, tstAuth.svcAcc, &mockK8sV1{k8CTOneShotError: tstData.k8CTOneShotError}}
+			fetcher := &authTokenFetcher{tstAuth.nameSpace, tstAuth.svcAcc, tokenAudience, &mockK8sV1{k8CTOneShotError: tstData.k8CTOneShotError}}
 			tokenOut, err := fetcher.FetchToken(nil)
 
 			if len(tstData.expError) == 0 && err != nil {
@@ -160,3 +220,171 @@ func TestToken(t *testing.T) {
 	}
 
 }
+
+func TestSSOSession(t *testing.T) {
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "config")
+	err := os.WriteFile(cfgFile, []byte(`[profile dev]
+sso_start_url = https://example.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 123456789012
+sso_role_name = Developer
+`), 0600)
+	if err != nil {
+		t.Fatalf("Can not write config: %v", err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", cfgFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("HOME", dir) // No cached SSO token
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRETEXAMPLE")
+
+	// The SSO profile is used, but there is no token cached.
+	_, err = GetSSOSession(context.Background(), "us-west-2", "dev")
+	if err == nil || !strings.Contains(err.Error(), "failed to get SSO credentials for profile dev") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Never fall back to other credentials.
+	_, err = GetSSOSession(context.Background(), "us-west-2", "missing")
+	if err == nil || !strings.Contains(err.Error(), "profile missing") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestChainedSession(t *testing.T) {
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
+
+	_, err := GetChainedSession(sess, "not-a-role", "pod@ns", "", nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid role ARN for role chaining") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	chained, err := GetChainedSession(sess, "arn:aws:iam::123456789012:role/secrets", "pod@ns", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if chained.Config.Credentials == sess.Config.Credentials || *chained.Config.Region != "us-west-2" {
+		t.Fatalf("Chained session does not use new credentials")
+	}
+}
+
+func TestValidateRoleARN(t *testing.T) {
+
+	for _, tst := range []struct{ roleArn, region, expError string }{
+		{"arn:aws:iam::123456789012:role/secrets", "us-west-2", ""},
+		{"arn:aws-us-gov:iam::123456789012:role/secrets", "us-gov-west-1", ""},
+		{"arn:aws-cn:iam::123456789012:role/path/secrets", "cn-north-1", ""},
+		{"arn:aws:iam::123456789012:role/secrets", "fakeRegion", ""},
+		{"arn:aws:iam::123456789012:role/secrets", "us-gov-west-1", "role ARN partition must be aws-us-gov in region us-gov-west-1"},
+		{"arn:aws-us-gov:iam::123456789012:role/secrets", "cn-north-1", "role ARN partition must be aws-cn in region cn-north-1"},
+		{"arn:aws:iam::123456789012:user/secrets", "us-west-2", "invalid IAM role ARN"},
+		{"arn:aws:sts::123456789012:role/secrets", "us-west-2", "invalid IAM role ARN"},
+		{"not-a-role", "us-west-2", "invalid IAM role ARN"},
+	} {
+		err := ValidateRoleARN(tst.roleArn, tst.region)
+		if len(tst.expError) == 0 && err != nil {
+			t.Errorf("%s in %s: unexpected error: %v", tst.roleArn, tst.region, err)
+		}
+		if len(tst.expError) != 0 && (err == nil || !strings.Contains(err.Error(), tst.expError)) {
+			t.Errorf("%s in %s: expected error %q but got %v", tst.roleArn, tst.region, tst.expError, err)
+		}
+	}
+}
+
+func TestSourceIdentity(t *testing.T) {
+
+	if id := SourceIdentity("someNamespace", "somePod"); id != "somePod@someNamespace" {
+		t.Fatalf("Wrong source identity: %s", id)
+	}
+	if id := SourceIdentity("ns", strings.Repeat("p", 100)); len(id) != maxSourceIdentity {
+		t.Fatalf("Source identity not truncated: %s", id)
+	}
+}
+
+func TestChainedSessionTags(t *testing.T) {
+
+	// Capture the AssumeRole request instead of sending it.
+	var input *sts.AssumeRoleInput
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", "")).
+		WithMaxRetries(0)))
+	sess.Handlers.Send.Clear()
+	sess.Handlers.Send.PushBack(func(r *request.Request) {
+		input, _ = r.Params.(*sts.AssumeRoleInput)
+		r.Error = fmt.Errorf("not sent")
+	})
+
+	tags := map[string]string{"team": "payments", "namespace": "ns"}
+	chained, err := GetChainedSession(sess, "arn:aws:iam::123456789012:role/secrets", "pod@ns", "pod-ns", tags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	chained.Config.Credentials.Get() // Fails after the request is built
+	if input == nil || *input.RoleSessionName != "pod-ns" || *input.SourceIdentity != "pod@ns" {
+		t.Fatalf("Wrong AssumeRole request: %v", input)
+	}
+	if len(input.Tags) != 2 || *input.Tags[0].Key != "namespace" || *input.Tags[1].Value != "payments" {
+		t.Fatalf("Wrong session tags: %v", input.Tags)
+	}
+}
+
+func TestRoleSessionName(t *testing.T) {
+
+	name, err := RoleSessionName("", "ns", "sa", "pod")
+	if err != nil || name != ProviderName {
+		t.Fatalf("Wrong default session name: %s %v", name, err)
+	}
+	name, err = RoleSessionName("{pod}@{namespace}.{serviceaccount}", "ns", "sa", "pod")
+	if err != nil || name != "pod@ns.sa" {
+		t.Fatalf("Wrong session name: %s %v", name, err)
+	}
+	name, err = RoleSessionName("{pod}", "ns", "sa", strings.Repeat("p", 100))
+	if err != nil || len(name) != 64 {
+		t.Fatalf("Session name not truncated: %s %v", name, err)
+	}
+	_, err = RoleSessionName("bad name", "ns", "sa", "pod")
+	if err == nil || !strings.Contains(err.Error(), "roleSessionName must be") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseSessionTags(t *testing.T) {
+
+	tags, err := ParseSessionTags(" team=payments, namespace={namespace},empty= ", "ns", "sa", "pod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tags) != 6 || tags["team"] != "payments" || tags["namespace"] != "ns" || tags["empty"] != "" {
+		t.Fatalf("Wrong tags: %v", tags)
+	}
+	if tags[NamespaceTag] != "ns" || tags[ServiceAccountTag] != "sa" || tags[PodNameTag] != "pod" {
+		t.Fatalf("Missing pod tags: %v", tags)
+	}
+	if tags, err = ParseSessionTags("", "ns", "sa", "pod"); err != nil || tags != nil {
+		t.Fatalf("Expected no tags: %v %v", tags, err)
+	}
+
+	tooMany := make([]string, maxSessionTags-2)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("k%d=v", i)
+	}
+	badTags := map[string]string{
+		"team":                         "sessionTags must be",
+		"=value":                       "sessionTags must be",
+		"team=a,Team=b":                "is repeated",
+		"team=a;b":                     "can only contain",
+		strings.Repeat("k", 129) + "=": "are limited to",
+		strings.Join(tooMany, ","):     "at most 47",
+		"Kubernetes-Namespace=prod":    "is set by the provider",
+	}
+	for spec, expErr := range badTags {
+		_, err := ParseSessionTags(spec, "ns", "sa", "pod")
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Errorf("Expected error %s for %s but got %v", expErr, spec, err)
+		}
+	}
+}
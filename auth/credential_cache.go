@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Refresh cached credentials this long before they expire, so a mount never
+// starts with credentials about to expire.
+const credentialExpiryWindow = 5 * time.Minute
+
+// Drop cached credentials not used by any mount for this long.
+const credentialIdleTimeout = time.Hour
+
+// Cache of the IRSA credentials of service accounts shared by all mounts.
+//
+// Without the cache every mount requests a service account token and calls
+// AssumeRoleWithWebIdentity, so on a busy node each pod start and rotation
+// reconcile adds STS calls and latency. Credentials are shared between mounts
+// using the same namespace, service account, role, region, and role session
+// name, and the SDK refreshes them shortly before they expire. A service
+// account moved to another role gets new credentials on its next mount since
+// the role is part of the key.
+//
+// Only the web identity credentials are cached. Roles chained into with
+// assumeRoleArn record the pod as the source identity, so they are still
+// assumed for each mount.
+//
+type CredentialCache struct {
+	mu        sync.Mutex
+	entries   map[credentialKey]*cachedCredentials
+	nextSweep time.Time
+}
+
+// Private key of the cached credentials of a service account role.
+type credentialKey struct {
+	nameSpace, svcAcc, roleArn, region, sessionName string
+}
+
+// Private cache entry holding credentials and when they were last used.
+type cachedCredentials struct {
+	creds    *credentials.Credentials
+	lastUsed time.Time
+}
+
+// Creates a new, empty credential cache.
+func NewCredentialCache() *CredentialCache {
+	return &CredentialCache{entries: make(map[credentialKey]*cachedCredentials)}
+}
+
+// Private helper to get the cached credentials of a key, creating them when
+// there are none (or always when the cache is disabled). Credentials unused
+// for an hour are dropped now and then.
+func (c *CredentialCache) get(key credentialKey, create func() *credentials.Credentials) *credentials.Credentials {
+
+	if c == nil { // Caching disabled
+		return create()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if now.Sub(entry.lastUsed) > credentialIdleTimeout {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(credentialIdleTimeout)
+	}
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedCredentials{creds: create()}
+		c.entries[key] = entry
+	}
+	entry.lastUsed = now
+	return entry.creds
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eksauth"
+	"github.com/aws/aws-sdk-go/service/eksauth/eksauthiface"
+
+	k8sv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+const (
+	podIdentityAudience = "pods.eks.amazonaws.com"
+	podIdentityAgentURI = "http://169.254.170.23/v1/credentials" // Default EKS Pod Identity agent endpoint
+	containerCredsEnv   = "AWS_CONTAINER_CREDENTIALS_FULL_URI"   // ECS style override of the agent endpoint
+	agentTimeout        = 5 * time.Second
+	podIdentityExpiry   = 5 * time.Minute // Refresh credentials this long before they expire
+)
+
+// Private implementation of credentials.Provider for EKS Pod Identity.
+//
+// Credentials are normally fetched from the Pod Identity agent (or the
+// container credentials endpoint given by AWS_CONTAINER_CREDENTIALS_FULL_URI)
+// using the pod's service account token. When the agent can not be reached
+// (for example on Fargate or clusters without the agent add-on) and a cluster
+// name is known, the provider calls the EKS Auth AssumeRoleForPodIdentity API
+// directly, signing the request with the provider's own credentials.
+//
+type podIdentityProvider struct {
+	credentials.Expiry
+	fetcher     authTokenFetcher
+	endpoint    string
+	clusterName string
+	eksAuth     eksauthiface.EKSAuthAPI
+}
+
+func (p *podIdentityProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(aws.BackgroundContext())
+}
+
+func (p *podIdentityProvider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+
+	token, err := p.fetcher.FetchToken(ctx)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	creds, err := p.retrieveFromAgent(ctx, string(token))
+	if err == nil || len(p.clusterName) == 0 || !isConnectionError(err) {
+		return creds, err
+	}
+
+	utils.Warningf("Pod Identity agent at %s is not reachable, calling EKS Auth directly: %v", p.endpoint, err)
+	return p.retrieveFromEKSAuth(ctx, string(token))
+}
+
+// Private helper to get the pod's credentials from the Pod Identity agent.
+func (p *podIdentityProvider) retrieveFromAgent(ctx credentials.Context, token string) (credentials.Value, error) {
+
+	cfg := aws.NewConfig().WithHTTPClient(&http.Client{Timeout: agentTimeout}).WithMaxRetries(0)
+	agent := endpointcreds.NewProviderClient(*cfg, defaults.Handlers(), p.endpoint, func(ep *endpointcreds.Provider) {
+		ep.AuthorizationToken = token
+	}).(*endpointcreds.Provider)
+
+	creds, err := agent.RetrieveWithContext(ctx)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if exp := agent.ExpiresAt(); !exp.IsZero() {
+		p.SetExpiration(exp, podIdentityExpiry)
+	}
+	return creds, nil
+}
+
+// Private helper to get the pod's credentials from the EKS Auth API.
+func (p *podIdentityProvider) retrieveFromEKSAuth(ctx credentials.Context, token string) (credentials.Value, error) {
+
+	rsp, err := p.eksAuth.AssumeRoleForPodIdentityWithContext(ctx, &eksauth.AssumeRoleForPodIdentityInput{
+		ClusterName: aws.String(p.clusterName),
+		Token:       aws.String(token),
+	})
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("AssumeRoleForPodIdentity failed for cluster %s: %w", p.clusterName, err)
+	}
+
+	p.SetExpiration(aws.TimeValue(rsp.Credentials.Expiration), podIdentityExpiry)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(rsp.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(rsp.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(rsp.Credentials.SessionToken),
+		ProviderName:    eksauth.ServiceName,
+	}, nil
+}
+
+// Private helper to tell if the agent could not be reached at all (as
+// opposed to rejecting the request).
+//
+func isConnectionError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	if aerr.Code() == request.ErrCodeRequestError {
+		return true
+	}
+	if aerr.OrigErr() != nil {
+		return isConnectionError(aerr.OrigErr())
+	}
+	return false
+}
+
+// Get the AWS session credentials for a pod using EKS Pod Identity.
+//
+// When clusterName is empty the Pod Identity agent must be available. The
+// returned session refreshes credentials as needed.
+//
+func GetPodIdentitySession(
+	region, nameSpace, svcAcc, clusterName string,
+	k8sClient k8sv1.CoreV1Interface,
+) (awsSession *session.Session, e error) {
+
+	endpoint := os.Getenv(containerCredsEnv)
+	if len(endpoint) == 0 {
+		endpoint = podIdentityAgentURI
+	}
+
+	// The fallback path signs EKS Auth requests with the provider's own
+	// (regional) credentials.
+	providerSess, err := session.NewSession(aws.NewConfig().
+		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+		WithRegion(region),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &podIdentityProvider{
+		fetcher:     authTokenFetcher{nameSpace, svcAcc, podIdentityAudience, k8sClient},
+		endpoint:    endpoint,
+		clusterName: clusterName,
+		eksAuth:     eksauth.New(providerSess),
+	}
+
+	// Include the provider in the user agent string.
+	sess, err := session.NewSession(aws.NewConfig().
+		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+		WithRegion(region).
+		WithCredentials(credentials.NewCredentials(provider)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sess.Handlers.Build.PushFront(func(r *request.Request) {
+		request.AddToUserAgent(r, ProviderName)
+	})
+
+	return sess, nil
+}
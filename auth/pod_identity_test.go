@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eksauth"
+	"github.com/aws/aws-sdk-go/service/eksauth/eksauthiface"
+)
+
+// Mock EKS Auth client
+type mockEKSAuth struct {
+	eksauthiface.EKSAuthAPI
+	input *eksauth.AssumeRoleForPodIdentityInput
+}
+
+func (m *mockEKSAuth) AssumeRoleForPodIdentityWithContext(
+	ctx context.Context, input *eksauth.AssumeRoleForPodIdentityInput, options ...request.Option,
+) (*eksauth.AssumeRoleForPodIdentityOutput, error) {
+	m.input = input
+	return &eksauth.AssumeRoleForPodIdentityOutput{
+		Credentials: &eksauth.Credentials{
+			AccessKeyId:     aws.String("EKSAUTHKEY"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func newPodIdentityProvider(endpoint, clusterName string) (*podIdentityProvider, *mockEKSAuth) {
+	eksAuth := &mockEKSAuth{}
+	return &podIdentityProvider{
+		fetcher:     authTokenFetcher{"someNamespace", "someServiceAccount", podIdentityAudience, &mockK8sV1{}},
+		endpoint:    endpoint,
+		clusterName: clusterName,
+		eksAuth:     eksAuth,
+	}, eksAuth
+}
+
+func TestPodIdentityAgent(t *testing.T) {
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "FAKETOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code": "AccessDenied", "message": "bad token"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"AccessKeyId": "AGENTKEY", "SecretAccessKey": "secret", "Token": "token", "Expiration": "%s"}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer agent.Close()
+
+	provider, eksAuth := newPodIdentityProvider(agent.URL, "someCluster")
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != "AGENTKEY" || eksAuth.input != nil {
+		t.Fatalf("Credentials not fetched from the agent: %+v", creds)
+	}
+	if provider.IsExpired() {
+		t.Fatalf("Credentials expired")
+	}
+}
+
+func TestPodIdentityAgentRejects(t *testing.T) {
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"code": "AccessDenied", "message": "no association"}`)
+	}))
+	defer agent.Close()
+
+	// Do not fall back when the agent is there but refuses the request.
+	provider, eksAuth := newPodIdentityProvider(agent.URL, "someCluster")
+	_, err := provider.Retrieve()
+	if err == nil || !strings.Contains(err.Error(), "no association") || eksAuth.input != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPodIdentityNoAgent(t *testing.T) {
+
+	agent := httptest.NewServer(http.NotFoundHandler())
+	agent.Close() // Nothing listening
+
+	// Without a cluster name the agent is required.
+	provider, _ := newPodIdentityProvider(agent.URL, "")
+	_, err := provider.Retrieve()
+	if err == nil {
+		t.Fatalf("Expected error but got none")
+	}
+
+	provider, eksAuth := newPodIdentityProvider(agent.URL, "someCluster")
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != "EKSAUTHKEY" || *eksAuth.input.ClusterName != "someCluster" || *eksAuth.input.Token != "FAKETOKEN" {
+		t.Fatalf("Credentials not fetched from EKS Auth: %+v", creds)
+	}
+}
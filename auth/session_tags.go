@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	maxSessionTags    = 50  // Most session tags STS accepts
+	maxTagKeyLength   = 128 // Longest session tag key STS accepts
+	maxTagValueLength = 256 // Longest session tag value STS accepts
+)
+
+// Session tags the provider sets from the pod being mounted (the same keys EKS
+// Pod Identity uses). Users can not set them, so policies can trust them.
+const (
+	NamespaceTag      = "kubernetes-namespace"
+	ServiceAccountTag = "kubernetes-service-account"
+	PodNameTag        = "kubernetes-pod-name"
+)
+
+// Role session names allowed by STS.
+var roleSessionNameRE = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// Session tag keys and values allowed by STS.
+var sessionTagRE = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// Private helper to replace the {namespace}, {serviceaccount}, and {pod}
+// placeholders with the values for the pod being mounted.
+//
+func expandPodPlaceholders(value, nameSpace, svcAcc, podName string) string {
+	return strings.NewReplacer(
+		"{namespace}", nameSpace,
+		"{serviceaccount}", svcAcc,
+		"{pod}", podName,
+	).Replace(value)
+}
+
+// Returns the role session name to use for a pod.
+//
+// The pattern may use the {namespace}, {serviceaccount}, and {pod}
+// placeholders so that CloudTrail and IAM policies (through the
+// aws:userid and sts:RoleSessionName keys) can tell pods apart. An empty
+// pattern returns the default session name (the provider name). Names longer
+// than STS allows are truncated.
+//
+func RoleSessionName(pattern, nameSpace, svcAcc, podName string) (string, error) {
+
+	if len(pattern) == 0 {
+		return ProviderName, nil
+	}
+
+	name := expandPodPlaceholders(pattern, nameSpace, svcAcc, podName)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if !roleSessionNameRE.MatchString(name) {
+		return "", fmt.Errorf("roleSessionName must be 2 to 64 letters, digits, or the characters _+=,.@-: %s", name)
+	}
+	return name, nil
+}
+
+// Parses the session tags to apply to a pod's role session.
+//
+// Tags are given as a comma separated list of key=value pairs, for example
+// team=payments,owner={serviceaccount}. Values may use the same placeholders
+// as RoleSessionName. Keys must be unique (ignoring case, as in STS).
+//
+// The namespace, service account, and pod name tags (see NamespaceTag) are
+// always added from the pod being mounted, and user tags with those keys are
+// rejected, so a SecretProviderClass can not claim to be another workload.
+//
+func ParseSessionTags(spec, nameSpace, svcAcc, podName string) (tags map[string]string, e error) {
+
+	if len(strings.TrimSpace(spec)) == 0 {
+		return nil, nil
+	}
+
+	tags = make(map[string]string)
+	keys := make(map[string]bool)
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		key = strings.TrimSpace(key)
+		value = expandPodPlaceholders(strings.TrimSpace(value), nameSpace, svcAcc, podName)
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("sessionTags must be a comma separated list of key=value pairs: %s", pair)
+		}
+		if len(key) > maxTagKeyLength || len(value) > maxTagValueLength {
+			return nil, fmt.Errorf("session tag keys are limited to %d and values to %d characters: %s",
+				maxTagKeyLength, maxTagValueLength, key)
+		}
+		if !sessionTagRE.MatchString(key) || !sessionTagRE.MatchString(value) {
+			return nil, fmt.Errorf("session tag %s can only contain letters, digits, spaces, and the characters _.:/=+-@", key)
+		}
+		if keys[strings.ToLower(key)] {
+			return nil, fmt.Errorf("session tag %s is repeated", key)
+		}
+		keys[strings.ToLower(key)] = true
+		tags[key] = value
+	}
+
+	podTags := map[string]string{NamespaceTag: nameSpace, ServiceAccountTag: svcAcc, PodNameTag: podName}
+	for key, value := range podTags {
+		if keys[key] {
+			return nil, fmt.Errorf("session tag %s is set by the provider and can not be used in sessionTags", key)
+		}
+		tags[key] = value
+	}
+
+	if len(tags) > maxSessionTags {
+		return nil, fmt.Errorf("at most %d session tags are allowed", maxSessionTags-len(podTags))
+	}
+	return tags, nil
+}
+
+// Private helper to convert session tags to STS tags (sorted by key).
+func stsTags(tags map[string]string) []*sts.Tag {
+
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var stsTags []*sts.Tag
+	for _, key := range keys {
+		stsTags = append(stsTags, &sts.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return stsTags
+}
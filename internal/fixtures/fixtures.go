@@ -0,0 +1,286 @@
+// Package fixtures builds mock Secrets Manager and SSM responses for tests
+// from declarative YAML fixtures.
+//
+// Mount scenario tests need the exact sequence of responses each mock client
+// returns in the primary and failover regions. Written as Go literals these
+// tables are long and easy to get wrong, so a fixture describes a scenario
+// (the mount attributes, the objects, the responses of each region, and the
+// expected result) in YAML instead, for example:
+//
+//	fixtures:
+//	- name: Failover Success
+//	  attributes: {namespace: fakeNS, accName: fakeSvcAcc, podName: fakePod, failoverRegion: fakeBackupRegion}
+//	  objects:
+//	  - {objectName: TestSecret1, objectType: secretsmanager}
+//	  primary:
+//	    getSecretValue: [{fail: true}]
+//	    secretsManagerError: {code: InternalServiceError, statusCode: 500}
+//	  failover:
+//	    getSecretValue: [{secretString: secret1, versionId: "1"}]
+//	  expSecrets: {TestSecret1: secret1}
+//
+// Responses are returned in the order listed, and a response with fail set is
+// returned as a nil response (which the mocks turn into an error). A list
+// given as [] is kept empty rather than left out, so the test can tell a
+// client with no responses from no client at all.
+//
+// The package is internal since the fixtures follow the mocks of this
+// repository's tests.
+//
+package fixtures
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"sigs.k8s.io/yaml"
+)
+
+// A mount scenario and the responses the mock clients return for it.
+//
+type Fixture struct {
+	Name             string                   `json:"name"`
+	Attributes       map[string]string        `json:"attributes,omitempty"` // Mount attributes (the tests supply defaults when empty)
+	Objects          []map[string]interface{} `json:"objects"`              // The objects of the SecretProviderClass
+	Primary          Responses                `json:"primary,omitempty"`    // Responses in the region of the mount
+	Failover         Responses                `json:"failover,omitempty"`   // Responses in the failover region
+	ExpError         string                   `json:"expError,omitempty"`   // Regular expression matching the expected error
+	ExpFailoverError string                   `json:"expFailoverError,omitempty"`
+	ExpSecrets       map[string]string        `json:"expSecrets,omitempty"` // Expected file contents by file name
+	Perms            string                   `json:"perms,omitempty"`      // File permission of the mount (decimal)
+}
+
+// The responses of the mock clients in one region.
+//
+type Responses struct {
+	GetSecretValue      []SecretValue    `json:"getSecretValue,omitempty"`
+	DescribeSecret      []Description    `json:"describeSecret,omitempty"`
+	GetParameters       []ParameterBatch `json:"getParameters,omitempty"`
+	SecretsManagerError *RequestError    `json:"secretsManagerError,omitempty"` // Returned by every Secrets Manager call
+	SSMError            *RequestError    `json:"ssmError,omitempty"`            // Returned by every SSM call
+}
+
+// A GetSecretValue response.
+//
+type SecretValue struct {
+	Fail          bool     `json:"fail,omitempty"`
+	ARN           string   `json:"arn,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	SecretString  *string  `json:"secretString,omitempty"`
+	SecretBinary  string   `json:"secretBinary,omitempty"` // Base64 encoded
+	VersionID     string   `json:"versionId,omitempty"`
+	VersionStages []string `json:"versionStages,omitempty"`
+}
+
+// A DescribeSecret response.
+//
+type Description struct {
+	Fail               bool                `json:"fail,omitempty"`
+	ARN                string              `json:"arn,omitempty"`
+	Name               string              `json:"name,omitempty"`
+	VersionIdsToStages map[string][]string `json:"versionIdsToStages,omitempty"`
+	LastChangedDate    *time.Time          `json:"lastChangedDate,omitempty"`
+	Tags               map[string]string   `json:"tags,omitempty"`
+}
+
+// A GetParameters response.
+//
+type ParameterBatch struct {
+	Fail              bool        `json:"fail,omitempty"`
+	Parameters        []Parameter `json:"parameters,omitempty"`
+	InvalidParameters []string    `json:"invalidParameters,omitempty"`
+}
+
+// A parameter in a GetParameters response.
+//
+type Parameter struct {
+	Name             string     `json:"name"`
+	Value            string     `json:"value"`
+	Type             string     `json:"type,omitempty"`
+	Version          int64      `json:"version,omitempty"`
+	ARN              string     `json:"arn,omitempty"`
+	LastModifiedDate *time.Time `json:"lastModifiedDate,omitempty"`
+}
+
+// An AWS request failure.
+//
+type RequestError struct {
+	Code       string `json:"code"`
+	Message    string `json:"message,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"` // HTTP status (400 when not given)
+}
+
+// Private top level of a fixture file.
+type fixtureFile struct {
+	Fixtures []*Fixture `json:"fixtures"`
+}
+
+// Load the fixtures of a YAML file.
+//
+func Load(path string) ([]*Fixture, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixtures, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// Parse YAML fixtures. Unknown fields are rejected so typos do not silently
+// drop a response.
+//
+func Parse(data []byte) ([]*Fixture, error) {
+
+	var file fixtureFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+	names := make(map[string]bool)
+	for i, fixture := range file.Fixtures {
+		if len(fixture.Name) == 0 {
+			return nil, fmt.Errorf("fixtures[%d]: name is required", i)
+		}
+		if names[fixture.Name] {
+			return nil, fmt.Errorf("fixtures[%d]: duplicate name %q", i, fixture.Name)
+		}
+		names[fixture.Name] = true
+		for _, responses := range []*Responses{&fixture.Primary, &fixture.Failover} {
+			for j, value := range responses.GetSecretValue {
+				if _, err := base64.StdEncoding.DecodeString(value.SecretBinary); err != nil {
+					return nil, fmt.Errorf("%s: getSecretValue[%d]: secretBinary is not base64: %w", fixture.Name, j, err)
+				}
+			}
+		}
+	}
+	return file.Fixtures, nil
+}
+
+// Returns the GetSecretValue responses (nil when none are listed).
+//
+func (r *Responses) GetSecretValueOutputs() []*secretsmanager.GetSecretValueOutput {
+
+	if r.GetSecretValue == nil {
+		return nil
+	}
+	outputs := make([]*secretsmanager.GetSecretValueOutput, len(r.GetSecretValue))
+	for i, value := range r.GetSecretValue {
+		if value.Fail {
+			continue
+		}
+		binary, _ := base64.StdEncoding.DecodeString(value.SecretBinary) // Checked by Parse
+		outputs[i] = &secretsmanager.GetSecretValueOutput{
+			ARN:           optionalString(value.ARN),
+			Name:          optionalString(value.Name),
+			SecretString:  value.SecretString,
+			VersionId:     optionalString(value.VersionID),
+			VersionStages: aws.StringSlice(value.VersionStages),
+		}
+		if len(binary) > 0 {
+			outputs[i].SecretBinary = binary
+		}
+	}
+	return outputs
+}
+
+// Returns the DescribeSecret responses (nil when none are listed).
+//
+func (r *Responses) DescribeSecretOutputs() []*secretsmanager.DescribeSecretOutput {
+
+	if r.DescribeSecret == nil {
+		return nil
+	}
+	outputs := make([]*secretsmanager.DescribeSecretOutput, len(r.DescribeSecret))
+	for i, desc := range r.DescribeSecret {
+		if desc.Fail {
+			continue
+		}
+		outputs[i] = &secretsmanager.DescribeSecretOutput{
+			ARN:             optionalString(desc.ARN),
+			Name:            optionalString(desc.Name),
+			LastChangedDate: desc.LastChangedDate,
+		}
+		if desc.VersionIdsToStages != nil {
+			outputs[i].VersionIdsToStages = make(map[string][]*string)
+			for id, stages := range desc.VersionIdsToStages {
+				outputs[i].VersionIdsToStages[id] = aws.StringSlice(stages)
+			}
+		}
+		for key, value := range desc.Tags {
+			outputs[i].Tags = append(outputs[i].Tags, &secretsmanager.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+	return outputs
+}
+
+// Returns the GetParameters responses (nil when none are listed).
+//
+func (r *Responses) GetParametersOutputs() []*ssm.GetParametersOutput {
+
+	if r.GetParameters == nil {
+		return nil
+	}
+	outputs := make([]*ssm.GetParametersOutput, len(r.GetParameters))
+	for i, batch := range r.GetParameters {
+		if batch.Fail {
+			continue
+		}
+		outputs[i] = &ssm.GetParametersOutput{Parameters: []*ssm.Parameter{}}
+		for _, param := range batch.Parameters {
+			outputs[i].Parameters = append(outputs[i].Parameters, &ssm.Parameter{
+				ARN:              optionalString(param.ARN),
+				Name:             aws.String(param.Name),
+				Value:            aws.String(param.Value),
+				Type:             optionalString(param.Type),
+				Version:          aws.Int64(param.Version),
+				LastModifiedDate: param.LastModifiedDate,
+			})
+		}
+		if len(batch.InvalidParameters) > 0 {
+			outputs[i].InvalidParameters = aws.StringSlice(batch.InvalidParameters)
+		}
+	}
+	return outputs
+}
+
+// Returns the error of every Secrets Manager call (nil for none).
+//
+func (r *Responses) SecretsManagerErr() error {
+	return r.SecretsManagerError.err()
+}
+
+// Returns the error of every SSM call (nil for none).
+//
+func (r *Responses) SSMErr() error {
+	return r.SSMError.err()
+}
+
+// Private helper to build the AWS request failure (nil for none).
+func (e *RequestError) err() error {
+
+	if e == nil {
+		return nil
+	}
+	status := e.StatusCode
+	if status == 0 {
+		status = 400
+	}
+	return awserr.NewRequestFailure(awserr.New(e.Code, e.Message, nil), status, "")
+}
+
+// Private helper to leave empty strings out of a response.
+func optionalString(value string) *string {
+	if len(value) == 0 {
+		return nil
+	}
+	return aws.String(value)
+}
@@ -0,0 +1,92 @@
+package fixtures
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestParse(t *testing.T) {
+
+	loaded, err := Parse([]byte(`
+fixtures:
+- name: Scenario
+  objects:
+  - {objectName: TestSecret1, objectType: secretsmanager}
+  primary:
+    getSecretValue:
+    - {secretString: secret1, versionId: "1", versionStages: [AWSCURRENT]}
+    - {fail: true}
+    describeSecret:
+    - versionIdsToStages: {"1": [AWSCURRENT]}
+      tags: {team: payments}
+    getParameters:
+    - parameters:
+      - {name: TestParm1, value: parm1, version: 2}
+      invalidParameters: [TestParm2]
+    secretsManagerError: {code: AccessDeniedException, message: denied}
+  failover:
+    getSecretValue: []
+    getParameters: [{fail: true}]
+    ssmError: {code: InternalServerError, statusCode: 500}
+  expSecrets: {TestSecret1: secret1}
+`))
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("Unexpected result: %v %v", loaded, err)
+	}
+	fixture := loaded[0]
+
+	gsv := fixture.Primary.GetSecretValueOutputs()
+	if len(gsv) != 2 || aws.StringValue(gsv[0].SecretString) != "secret1" || aws.StringValue(gsv[0].VersionId) != "1" || gsv[1] != nil {
+		t.Fatalf("Bad GetSecretValue responses: %v", gsv)
+	}
+	desc := fixture.Primary.DescribeSecretOutputs()
+	if len(desc) != 1 || aws.StringValue(desc[0].VersionIdsToStages["1"][0]) != "AWSCURRENT" || aws.StringValue(desc[0].Tags[0].Value) != "payments" {
+		t.Fatalf("Bad DescribeSecret responses: %v", desc)
+	}
+	params := fixture.Primary.GetParametersOutputs()
+	if len(params) != 1 || aws.Int64Value(params[0].Parameters[0].Version) != 2 || aws.StringValue(params[0].InvalidParameters[0]) != "TestParm2" {
+		t.Fatalf("Bad GetParameters responses: %v", params)
+	}
+	if reqErr, ok := fixture.Primary.SecretsManagerErr().(awserr.RequestFailure); !ok || reqErr.Code() != "AccessDeniedException" || reqErr.StatusCode() != 400 {
+		t.Fatalf("Bad Secrets Manager error: %v", fixture.Primary.SecretsManagerErr())
+	}
+	if fixture.Primary.SSMErr() != nil {
+		t.Fatalf("Unexpected SSM error: %v", fixture.Primary.SSMErr())
+	}
+
+	// Empty lists are kept apart from missing ones.
+	if gsv := fixture.Failover.GetSecretValueOutputs(); gsv == nil || len(gsv) != 0 {
+		t.Fatalf("Expected an empty list of responses, got %v", gsv)
+	}
+	if desc := fixture.Failover.DescribeSecretOutputs(); desc != nil {
+		t.Fatalf("Expected no responses, got %v", desc)
+	}
+	if params := fixture.Failover.GetParametersOutputs(); len(params) != 1 || params[0] != nil {
+		t.Fatalf("Expected a failed response, got %v", params)
+	}
+	if reqErr, ok := fixture.Failover.SSMErr().(awserr.RequestFailure); !ok || reqErr.StatusCode() != 500 {
+		t.Fatalf("Bad SSM error: %v", fixture.Failover.SSMErr())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	for _, tst := range []struct{ yaml, expError string }{
+		{"fixtures:\n- objects: []\n", "name is required"},
+		{"fixtures:\n- name: a\n- name: a\n", `duplicate name "a"`},
+		{"fixtures:\n- name: a\n  primary:\n    getSecretValues: []\n", "unknown field"},
+		{"fixtures:\n- name: a\n  primary:\n    getSecretValue: [{secretBinary: '***'}]\n", "secretBinary is not base64"},
+	} {
+		_, err := Parse([]byte(tst.yaml))
+		if err == nil || !strings.Contains(err.Error(), tst.expError) {
+			t.Errorf("%q: expected error %q but got %v", tst.yaml, tst.expError, err)
+		}
+	}
+
+	if _, err := Load("missing.yaml"); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
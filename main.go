@@ -1,14 +1,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -17,6 +35,7 @@ import (
 	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
 	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
 	"github.com/aws/secrets-store-csi-driver-provider-aws/server"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 )
 
 var (
@@ -24,21 +43,115 @@ var (
 	driverWriteSecrets = flag.Bool("driver-writes-secrets", false, "The driver will do the write instead of the plugin")
 	qps                = flag.Int("qps", 5, "Maximum query per second to the Kubernetes API server. To mount the requested secret on the pod, the AWS CSI provider lookups the region of the pod and the role ARN associated with the service account by calling the K8s APIs. Increase the value if the provider is throttled by client-side limit to the API server.")
 	burst              = flag.Int("burst", 10, "Maximum burst for throttle. To mount the requested secret on the pod, the AWS CSI provider lookups the region of the pod and the role ARN associated with the service account by calling the K8s APIs. Increase the value if the provider is throttled by client-side limit to the API server.")
+	ssmExpiryWarning   = flag.Duration("ssm-expiry-warning", 0, "Warn (log and pod event) when a mounted SSM parameter has an expiration policy that expires within this duration (for example 72h). Requires ssm:DescribeParameters permission. Disabled when 0.")
+	devSSOProfile      = flag.String("dev-sso-profile", "", "Development clusters only: use cached AWS IAM Identity Center (SSO) credentials from this shared config profile for all mounts instead of IAM roles for service accounts.")
+	adminSocket        = flag.String("admin-socket", "", "Optional unix socket on which to serve the admin endpoint used to force a refresh of a mount (or of every mount using an object). Disabled when empty.")
+	freeze             = flag.Bool("freeze", false, "Start frozen for incident response: fetch nothing from AWS, leave mounted files as they are, and fail new mounts until unfrozen with the admin endpoint (or a restart without the flag).")
+	allowInsecureEPs   = flag.Bool("allow-insecure-endpoints", false, "Allow endpoint overrides (AWS_ENDPOINT_URL, AWS_ENDPOINT_URL_STS, AWS_ENDPOINT_URL_SECRETS_MANAGER, AWS_ENDPOINT_URL_SSM) that do not use https. Only intended for testing against local mock services.")
+	soakInterval       = flag.Duration("soak-test-interval", 0, "Testing only: continuously simulate mounts and rotations against mock backends at this interval. Disabled when 0.")
+	soakPods           = flag.Int("soak-test-pods", 100, "Testing only: number of synthetic pods mounted on each soak test pass.")
+	metricsAddr        = flag.String("metrics-addr", "", "Optional address (for example :8080) on which to serve the provider metrics at /metrics. Disabled when empty.")
+	podIdentityCluster = flag.String("pod-identity-cluster-name", "", "Optional EKS cluster name. When set, pods using Pod Identity can still mount secrets if the Pod Identity agent is not reachable (for example on Fargate) by calling the EKS Auth API directly with the provider's own credentials.")
+	namePolicy         = flag.String("object-name-policy", "", "Optional regular expression that every object name (or the name in an object ARN) must fully match, for example /eks/{cluster}/.* where {cluster} is replaced by --cluster-name. Mounts with other names fail. Disabled when empty.")
+	denylist           = flag.String("object-denylist", "", "Optional comma separated list of object names or ARNs that can never be mounted, regardless of IAM permissions. A trailing * matches any name starting with the rest of the entry. Disabled when empty.")
+	clusterName        = flag.String("cluster-name", "", "Name of the cluster substituted for {cluster} in --object-name-policy.")
+	workloadUA         = flag.String("workload-user-agent", server.WorkloadUANone, "How to identify the workload in the user agent of Secrets Manager and SSM requests (visible in CloudTrail). One of none, hashed (a hash of the namespace and SecretProviderClass objects), or namespace (the namespace and a hash of the SecretProviderClass objects).")
+	syncPolicy         = flag.String("sync-policy", server.SyncAlways, "When to sync written secrets (and the mount directory after the rename) to disk. One of always, never, or auto (sync unless the mount is on tmpfs).")
+	maxResponseSize    = flag.Int("max-response-size", server.DefaultMaxResponseSize, "Largest mount response (in bytes) sent to the driver when it writes the secrets. Should match the driver's --max-call-recv-msg-size. Use 0 for no limit.")
+	selfWriteFallback  = flag.Bool("self-write-fallback", false, "When the driver writes the secrets, write the largest files directly to the mount instead of failing when the mount response would exceed --max-response-size.")
+	crossRegionARNs    = flag.Bool("allow-cross-region-arns", false, "Allow an objectName ARN in another region than the mount, which is then read from the region of the ARN (without failover) instead of failing validation.")
+	auditLogPath       = flag.String("audit-log-path", "", "Optional file to append a JSON record of every secret fetched to (object, version, pod, namespace, service account, region, and latency, but never the value). Use - for standard output. Disabled when empty.")
+	maxResponseMemory  = flag.Int64("max-response-memory", 0, "Optional limit (in bytes) on the total size of mount responses held in memory at once when the driver writes the secrets. Responses wait until enough of the limit is free or the mount deadline expires. Disabled when 0.")
+	secretCacheTTL     = flag.Duration("secret-cache-ttl", 0, "Optional time (for example 30s) to cache Secrets Manager and SSM responses so pods using the same service account and objects share them instead of each calling AWS. Rotations are detected up to this much later. Disabled when 0.")
+	credentialCache    = flag.Bool("credential-cache", true, "Share the IRSA credentials of a service account role between mounts until they are about to expire instead of calling AssumeRoleWithWebIdentity for every mount.")
+	objectNameLabels   = flag.String("object-name-node-labels", "", "Optional comma separated node labels (for example topology.kubernetes.io/zone) that object names may use as {label} placeholders, replaced with the label of the pod's node.")
+	maxFilePermission  = flag.String("max-file-permission", "", "Optional octal file mode (for example 0640) that the file permission of every mount must stay within. Mounts asking for any other permission bit are handled as set by --file-permission-action. Disabled when empty.")
+	permissionAction   = flag.String("file-permission-action", server.PermissionActionDeny, "What to do when a mount asks for a broader file permission than --max-file-permission. One of warn (log and pod event), clamp (drop the extra bits, log, and pod event), or deny (fail the mount).")
+	defaultPermission  = flag.String("default-file-permission", "", "Optional octal file mode (for example 0640) of mounted files when the mount request from the driver gives none. Must be within --max-file-permission. Uses 0644 when empty.")
+	cacheMaxBytes      = flag.Int64("secret-cache-max-bytes", 64<<20, "Estimated bytes of responses the secret cache may hold before the least recently used ones are dropped. No limit when 0.")
+	maxFetches         = flag.Int("max-concurrent-fetches", 1, "Maximum number of Secrets Manager secrets fetched at once for each mount. Use 1 to fetch secrets one at a time.")
+	lookupCacheTTL     = flag.Duration("k8s-lookup-cache-ttl", 30*time.Second, "How long to cache the pod and node lookups used to find the region of a pod, so the mounts of a rotation reconcile share them. Use 0 to disable.")
+	awsMaxRetries      = flag.Int("aws-max-retries", -1, "Maximum retries of failed Secrets Manager and SSM calls (0 to 10). Mounts can override this with the awsMaxRetries attribute. Use -1 for the SDK default (3).")
+	awsRetryMode       = flag.String("aws-retry-mode", provider.RetryModeStandard, "How Secrets Manager and SSM calls are retried. One of standard (exponential backoff) or adaptive (standard retries, and calls to a throttled service are spaced out across all mounts until it recovers). Mounts can override this with the awsRetryMode attribute.")
+	ssmAdvancedTier    = flag.String("ssm-advanced-tier", provider.TierPolicyAllow, "What to do when a mounted SSM parameter uses the advanced tier, which is charged per parameter and per API call. One of allow, warn (log and pod event), or deny (fail the mount). Warn and deny require ssm:DescribeParameters permission.")
+	maxMounts          = flag.Int("max-concurrent-mounts", 0, "Maximum number of mount requests serviced at once. Additional requests wait until a mount completes or the request deadline expires. Use 0 for no limit.")
+	inventorySink      = flag.String("inventory-export-sink", "", "Optional destination to periodically export the inventory of secrets and versions mounted on the node: file:///path/inventory.json, s3://bucket/prefix, or cloudwatch://log-group. The S3 and CloudWatch sinks use the provider's own credentials. Disabled when empty.")
+	inventoryInterval  = flag.Duration("inventory-export-interval", 15*time.Minute, "How often the mount inventory is exported to --inventory-export-sink.")
+	healthAddr         = flag.String("health-addr", "", "Optional address (for example :8081) on which to serve the /healthz (liveness) and /readyz (readiness) endpoints. Disabled when empty.")
+	nodeName           = flag.String("node-name", os.Getenv("NODE_NAME"), "Name of the node, used to identify the exported mount inventory. Defaults to the NODE_NAME environment variable or the host name.")
+	configFile         = flag.String("config-file", "", "Optional YAML file (usually a mounted ConfigMap) with settings to apply without a restart: qps, burst, maxConcurrentMounts, secretCacheTTL, k8sLookupCacheTTL, and defaultFailoverRegions. Settings not in the file use the matching flag. Disabled when empty.")
+	configInterval     = flag.Duration("config-reload-interval", 30*time.Second, "How often --config-file is checked for changes.")
+	awsRateLimits      = flag.String("aws-rate-limits", "", "Optional limits on Secrets Manager and SSM calls per second, shared by all mounts on the node, as a comma separated list of service=tps or service/region=tps entries (for example ssmparameter=20,ssmparameter/eu-west-1=5) where the service is secretsmanager or ssmparameter. Calls wait for their turn until the mount deadline. Disabled when empty.")
+	logDedupWindow     = flag.Duration("log-dedup-window", 0, "Optional window (for example 60s) in which repeated identical error and warning messages from mounts are logged once, followed by a count of the repeats (for example \"repeated 240x in last 1m0s\"). Disabled when 0.")
 )
 
+// Timeouts of the HTTP endpoints, so stuck or idle clients do not hold
+// connections (and goroutines) open forever. Admin requests replay mounts, so
+// they are given as long as a rotation of many pods may take.
+const (
+	httpReadTimeout   = 10 * time.Second
+	httpWriteTimeout  = 30 * time.Second
+	adminWriteTimeout = 10 * time.Minute
+)
+
+func init() {
+	flag.Var(utils.DefaultFeatureGate, "feature-gates", "A set of key=value pairs that describe feature gates for alpha/experimental features. Options are:\n"+strings.Join(utils.DefaultFeatureGate.KnownFeatures(), "\n"))
+}
+
 // Main entry point for the Secret Store CSI driver AWS provider. This main
 // rountine starts up the gRPC server that will listen for incoming mount
 // requests.
 func main() {
 
-	klog.Infof("Starting %s version %s", auth.ProviderName, server.Version)
-
 	flag.Parse() // Parse command line flags
 
+	// Check the node prerequisites and exit when run as "self-test" (for
+	// example in an init container).
+	if flag.Arg(0) == "self-test" {
+		if !runSelfTest() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Validate SecretProviderClass manifests and exit when run as "validate"
+	// (for example in a CI pipeline).
+	if flag.Arg(0) == "validate" {
+		if !runValidate(flag.Args()[1:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	klog.Infof("Starting %s version %s", auth.ProviderName, server.GetBuildInfo())
+
+	if gates := utils.DefaultFeatureGate.String(); len(gates) > 0 {
+		klog.Infof("Feature gates: %s", gates)
+	}
+	utils.LogEffectiveConfig(flag.CommandLine, os.Environ())
+
+	// Keep repeated mount errors from flooding the logs during outages.
+	if *logDedupWindow > 0 {
+		utils.DefaultLogDeduplicator.SetWindow(*logDedupWindow)
+		go utils.DefaultLogDeduplicator.Run(context.Background(), *logDedupWindow)
+	}
+
+	if err := utils.ValidateEndpointOverrides(*allowInsecureEPs); err != nil {
+		klog.Fatalf("Invalid endpoint configuration: %v", err)
+	}
+
+	if len(*devSSOProfile) > 0 {
+		klog.Warningf("Using SSO profile %s for all mounts. This is only intended for development clusters.", *devSSOProfile)
+	}
+
 	//socket on which to listen to for driver calls
 	endpoint := fmt.Sprintf("%s/aws.sock", *endpointDir)
 	os.Remove(endpoint) // Make sure to start clean.
-	grpcSrv := grpc.NewServer()
+	grpcSrv := grpc.NewServer(grpc.ChainUnaryInterceptor(server.UnaryInterceptors()...), grpc.StatsHandler(server.ResponseMemoryHandler()))
+
+	// Answer standard gRPC health checks on the provider socket.
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
 
 	//Gracefully terminate server on shutdown unix signals
 	sigs := make(chan os.Signal, 1)
@@ -47,6 +160,7 @@ func main() {
 	go func() {
 		sig := <-sigs
 		klog.Infof("received signal:%s to terminate", sig)
+		healthSrv.Shutdown()
 		grpcSrv.GracefulStop()
 	}()
 
@@ -62,6 +176,8 @@ func main() {
 
 	cfg.QPS = float32(*qps)
 	cfg.Burst = *burst
+	rateLimiter := utils.NewAdjustableRateLimiter(cfg.QPS, cfg.Burst)
+	cfg.RateLimiter = rateLimiter
 
 	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
@@ -73,11 +189,207 @@ func main() {
 		os.Remove(endpoint)
 	}()
 
-	providerSrv, err := server.NewServer(provider.NewSecretProviderFactory, clientset.CoreV1(), *driverWriteSecrets)
+	if err := provider.CheckTierPolicy(*ssmAdvancedTier); err != nil {
+		klog.Fatalf("Invalid SSM advanced tier policy. error: %v", err)
+	}
+	providerOpts := provider.ProviderOptions{
+		ParameterExpiryWarning: *ssmExpiryWarning,
+		MaxConcurrentFetches:   *maxFetches,
+		AdvancedTierPolicy:     *ssmAdvancedTier,
+	}
+	if providerOpts.RateLimits, err = provider.ParseAWSRateLimits(*awsRateLimits); err != nil {
+		klog.Fatalf("Invalid AWS rate limits. error: %v", err)
+	}
+	if *secretCacheTTL > 0 {
+		providerOpts.SecretCache = provider.NewSecretCache(*secretCacheTTL)
+		providerOpts.SecretCache.SetMaxBytes(*cacheMaxBytes)
+	}
+	providerFactory := func(sessions []*session.Session, regions []string) *provider.SecretProviderFactory {
+		return provider.NewSecretProviderFactoryWithOptions(sessions, regions, providerOpts)
+	}
+
+	retries := ""
+	if *awsMaxRetries >= 0 {
+		retries = strconv.Itoa(*awsMaxRetries)
+	}
+	retryConfig, err := provider.NewRetryConfig(retries, *awsRetryMode)
+	if err != nil {
+		klog.Fatalf("Invalid retry configuration. error: %v", err)
+	}
+
+	var objectNamePolicy *provider.ObjectNamePolicy
+	if len(*namePolicy) > 0 {
+		objectNamePolicy, err = provider.NewObjectNamePolicy(*namePolicy, *clusterName)
+		if err != nil {
+			klog.Fatalf("Can not use object name policy. error: %v", err)
+		}
+	}
+
+	var objectDenylist *provider.ObjectDenylist
+	if len(*denylist) > 0 {
+		objectDenylist, err = provider.NewObjectDenylist(*denylist)
+		if err != nil {
+			klog.Fatalf("Can not use object denylist. error: %v", err)
+		}
+	}
+
+	var auditLog *server.AuditLog
+	if len(*auditLogPath) > 0 {
+		auditLog, err = server.NewAuditLog(*auditLogPath)
+		if err != nil {
+			klog.Fatalf("Can not use audit log. error: %v", err)
+		}
+	}
+
+	var credCache *auth.CredentialCache
+	if *credentialCache {
+		credCache = auth.NewCredentialCache()
+	}
+
+	var nameLabels []string
+	for _, label := range strings.Split(*objectNameLabels, ",") {
+		if label = strings.TrimSpace(label); len(label) > 0 {
+			nameLabels = append(nameLabels, label)
+		}
+	}
+
+	var permPolicy *server.FilePermissionPolicy
+	if len(*maxFilePermission) > 0 {
+		permPolicy, err = server.NewFilePermissionPolicy(*maxFilePermission, *permissionAction)
+		if err != nil {
+			klog.Fatalf("Can not use file permission policy. error: %v", err)
+		}
+	}
+
+	providerSrv, err := server.NewServer(providerFactory, clientset.CoreV1(), server.ServerOptions{
+		DriverWriteSecrets:    *driverWriteSecrets,
+		MaxConcurrentMounts:   *maxMounts,
+		SSOProfile:            *devSSOProfile,
+		PodIdentityCluster:    *podIdentityCluster,
+		NamePolicy:            objectNamePolicy,
+		Denylist:              objectDenylist,
+		WorkloadUA:            *workloadUA,
+		SyncPolicy:            *syncPolicy,
+		MaxResponseSize:       *maxResponseSize,
+		SelfWriteFallback:     *selfWriteFallback,
+		LookupCacheTTL:        *lookupCacheTTL,
+		Retry:                 retryConfig,
+		MaxResponseMemory:     *maxResponseMemory,
+		AuditLog:              auditLog,
+		CredentialCache:       credCache,
+		NameLabels:            nameLabels,
+		PermissionPolicy:      permPolicy,
+		DefaultFilePermission: *defaultPermission,
+		AllowCrossRegionARNs:  *crossRegionARNs,
+	})
 	if err != nil {
 		klog.Fatalf("Could not create server. error: %v", err)
 	}
+	providerSrv.SetFrozen(*freeze)
 	csidriver.RegisterCSIDriverProviderServer(grpcSrv, providerSrv)
+	if utils.DefaultFeatureGate.Enabled(utils.OnDemandFetch) {
+		server.RegisterObjectFetcher(grpcSrv, providerSrv)
+	}
+
+	// Apply changes to the runtime configuration file if requested.
+	if len(*configFile) > 0 {
+		if *configInterval <= 0 {
+			klog.Fatalf("Configuration reload interval must be positive: %s", *configInterval)
+		}
+		defaults := server.RuntimeConfig{
+			QPS:                 float32(*qps),
+			Burst:               *burst,
+			MaxConcurrentMounts: *maxMounts,
+			SecretCacheTTL:      metav1.Duration{Duration: *secretCacheTTL},
+			LookupCacheTTL:      metav1.Duration{Duration: *lookupCacheTTL},
+		}
+		if _, err := server.LoadRuntimeConfig(*configFile, defaults); err != nil {
+			klog.Fatalf("Can not load the runtime configuration. error: %v", err)
+		}
+		go server.WatchRuntimeConfig(context.Background(), *configFile, *configInterval, defaults, func(rc server.RuntimeConfig) {
+			rateLimiter.SetRate(rc.QPS, rc.Burst)
+			providerSrv.ApplyRuntimeConfig(rc)
+			if providerOpts.SecretCache != nil {
+				providerOpts.SecretCache.SetTTL(rc.SecretCacheTTL.Duration)
+			} else if rc.SecretCacheTTL.Duration > 0 {
+				klog.Warningf("Ignoring secretCacheTTL since the secret cache was disabled by --secret-cache-ttl")
+			}
+		})
+		klog.Infof("Reloading settings from %s every %s", *configFile, *configInterval)
+	}
+
+	// Serve the admin endpoint if requested (local socket only).
+	if len(*adminSocket) > 0 {
+		os.Remove(*adminSocket) // Make sure to start clean.
+		adminListener, err := net.Listen("unix", *adminSocket)
+		if err != nil {
+			klog.Fatalf("Failed to listen on admin socket. error: %v", err)
+		}
+		defer func() {
+			adminListener.Close()
+			os.Remove(*adminSocket)
+		}()
+		go func() {
+			err := newHTTPServer("", providerSrv.AdminHandler(), adminWriteTimeout).Serve(adminListener)
+			if err != nil {
+				klog.Errorf("Admin endpoint stopped. error: %v", err)
+			}
+		}()
+		klog.Infof("Serving admin endpoint on address: %s", adminListener.Addr())
+	}
+
+	// Serve the liveness and readiness endpoints if requested.
+	if len(*healthAddr) > 0 {
+		handler := server.NewHealthServer(endpoint, clientset.Discovery()).Handler()
+		go func() {
+			err := newHTTPServer(*healthAddr, handler, httpWriteTimeout).ListenAndServe()
+			if err != nil {
+				klog.Errorf("Health endpoint stopped. error: %v", err)
+			}
+		}()
+		klog.Infof("Serving health endpoints on address: %s", *healthAddr)
+	}
+
+	// Serve the metrics endpoint if requested.
+	if len(*metricsAddr) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", server.MetricsHandler())
+		go func() {
+			err := newHTTPServer(*metricsAddr, mux, httpWriteTimeout).ListenAndServe()
+			if err != nil {
+				klog.Errorf("Metrics endpoint stopped. error: %v", err)
+			}
+		}()
+		klog.Infof("Serving metrics on address: %s", *metricsAddr)
+	}
+
+	// Export the inventory of mounted objects if requested.
+	if len(*inventorySink) > 0 {
+		if *inventoryInterval <= 0 {
+			klog.Fatalf("Inventory export interval must be positive: %s", *inventoryInterval)
+		}
+		node := *nodeName
+		if len(node) == 0 {
+			node, _ = os.Hostname()
+		}
+		sink, err := server.NewInventorySink(*inventorySink, nodeSession(aws.NewConfig().WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint)))
+		if err != nil {
+			klog.Fatalf("Can not export the mount inventory. error: %v", err)
+		}
+		go server.RunInventoryExport(context.Background(), providerSrv, sink, node, *inventoryInterval)
+		klog.Infof("Exporting the mount inventory of node %s to %s every %s", node, *inventorySink, *inventoryInterval)
+	}
+
+	// Run the soak test in the background if requested (pre-production only).
+	if *soakInterval > 0 {
+		klog.Warningf("Soak test mode enabled. This is only intended for pre-production clusters.")
+		go func() {
+			err := server.RunSoakTest(context.Background(), *soakInterval, *soakPods)
+			if err != nil {
+				klog.Errorf("Soak test stopped. error: %v", err)
+			}
+		}()
+	}
 
 	klog.Infof("Listening for connections on address: %s", listener.Addr())
 
@@ -87,3 +399,111 @@ func main() {
 	}
 
 }
+
+// Private helper to run the node prerequisite checks with the in-cluster
+// configuration and the provider's own AWS credentials.
+//
+func runSelfTest() bool {
+
+	cfg := server.SelfTestConfig{SocketDir: *endpointDir}
+	restCfg, err := rest.InClusterConfig()
+	if err == nil {
+		var clientset *kubernetes.Clientset
+		clientset, err = kubernetes.NewForConfig(restCfg)
+		if err == nil {
+			cfg.K8sClient = clientset.Discovery()
+		}
+	}
+	cfg.K8sError = err
+
+	sess := nodeSession(aws.NewConfig().
+		WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint).
+		WithMaxRetries(1))
+	cfg.STSClient = sts.New(sess, utils.ServiceConfig(utils.STSService, aws.StringValue(sess.Config.Region)))
+
+	if endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); len(endpoint) > 0 {
+		cfg.PodIdentityEndpoint = endpoint
+	}
+
+	return server.RunSelfTest(context.Background(), os.Stdout, cfg)
+}
+
+// Private helper to validate SecretProviderClass manifests, optionally
+// looking the objects up in AWS with the caller's own credentials.
+//
+func runValidate(args []string) bool {
+
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	file := fs.String("f", "-", "SecretProviderClass manifests (or an objects specification) to validate. Use - for standard input.")
+	region := fs.String("region", os.Getenv("AWS_REGION"), "Region used when a SecretProviderClass does not give one. Defaults to the AWS_REGION environment variable.")
+	checkAWS := fs.Bool("check-aws", false, "Also look up every object in AWS with DescribeSecret and DescribeParameters, using the caller's own credentials.")
+	crossRegion := fs.Bool("allow-cross-region-arns", *crossRegionARNs, "Allow objectName ARNs in another region than the SecretProviderClass, like the provider's flag of the same name.")
+	nodeLabels := fs.String("node-labels", "", "Comma separated label=value pairs replacing the {label} placeholders of object names, as the labels of a node would.")
+	fs.Parse(args)
+
+	cfg := server.ValidateConfig{Region: *region, NodeLabels: make(map[string]string), CrossRegion: *crossRegion}
+	for _, pair := range strings.Split(*nodeLabels, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		label, value, ok := strings.Cut(pair, "=")
+		if !ok || len(strings.TrimSpace(label)) == 0 {
+			fmt.Fprintf(os.Stderr, "Invalid node label %q, use label=value\n", pair)
+			return false
+		}
+		cfg.NodeLabels[strings.TrimSpace(label)] = strings.TrimSpace(value)
+	}
+
+	var manifests []byte
+	var err error
+	if *file == "-" {
+		manifests, err = io.ReadAll(os.Stdin)
+	} else {
+		manifests, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can not read %s: %v\n", *file, err)
+		return false
+	}
+
+	if *checkAWS {
+		sess := session.Must(session.NewSession())
+		cfg.SecretsManager = func(region string) secretsmanageriface.SecretsManagerAPI {
+			return secretsmanager.New(sess, utils.ServiceConfig(utils.SecretsManagerService, region))
+		}
+		cfg.SSM = func(region string) ssmiface.SSMAPI {
+			return ssm.New(sess, utils.ServiceConfig(utils.SSMService, region))
+		}
+	}
+	return server.RunValidate(context.Background(), os.Stdout, manifests, cfg)
+}
+
+// Private helper to create an HTTP server with read and write timeouts.
+//
+func newHTTPServer(addr string, handler http.Handler, writeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       2 * httpWriteTimeout,
+	}
+}
+
+// Private helper to create a session with the provider's own credentials.
+//
+// Uses the region of the node when none is configured.
+//
+func nodeSession(cfg *aws.Config) *session.Session {
+
+	sess := session.Must(session.NewSession(cfg))
+	if len(aws.StringValue(sess.Config.Region)) == 0 {
+		region, err := ec2metadata.New(sess).Region()
+		if err != nil {
+			region = "us-east-1"
+		}
+		sess.Config.Region = aws.String(region)
+	}
+	return sess
+}
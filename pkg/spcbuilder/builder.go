@@ -0,0 +1,166 @@
+// Package spcbuilder builds the objects specification of a SecretProviderClass.
+//
+// It is intended for tools (for example platform operators generating
+// SecretProviderClasses from a service catalog) that need to produce the
+// objects YAML programmatically. The fields are typed so mistakes are caught
+// at compile time, and the generated YAML is validated with the same code the
+// provider uses at mount time.
+//
+package spcbuilder
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+// The service an object is fetched from.
+type ObjectType string
+
+const (
+	SecretsManager ObjectType = "secretsmanager"
+	SSMParameter   ObjectType = "ssmparameter"
+)
+
+// Encoding of a value to decode before it is mounted.
+type ObjectEncoding string
+
+const (
+	EncodingBase64 ObjectEncoding = provider.EncodingBase64
+	EncodingHex    ObjectEncoding = provider.EncodingHex
+)
+
+// Action to take when a JMES path is not found in a secret.
+type OnMissing string
+
+const (
+	OnMissingError OnMissing = provider.OnMissingError // Fail the mount (default)
+	OnMissingSkip  OnMissing = provider.OnMissingSkip  // Do not write the file
+	OnMissingEmpty OnMissing = provider.OnMissingEmpty // Write an empty file
+)
+
+// How the elements of a split StringList parameter are mounted.
+type StringListFormat string
+
+const (
+	StringListFiles StringListFormat = provider.StringListFiles // One file per element (default)
+	StringListLines StringListFormat = provider.StringListLines // One element per line
+)
+
+// A JSON key to extract from a secret and mount as its own file.
+type JMESPath struct {
+	Path               string    `json:"path"`
+	ObjectAlias        string    `json:"objectAlias"`
+	OnMissing          OnMissing `json:"onMissing,omitempty"`
+	ObjectVersion      string    `json:"objectVersion,omitempty"`
+	ObjectVersionLabel string    `json:"objectVersionLabel,omitempty"`
+}
+
+// The object to fetch from a failover region.
+//
+// Objects list one for each failover region, in the order of the regions;
+// failover regions without one use the primary object.
+//
+type FailoverObject struct {
+	ObjectName         string `json:"objectName"`
+	ObjectVersion      string `json:"objectVersion,omitempty"`
+	ObjectVersionLabel string `json:"objectVersionLabel,omitempty"`
+}
+
+// A single entry in the objects specification.
+//
+// See the README for the meaning of each field. Optional fields are left out
+// of the generated YAML when they have their zero value.
+//
+type Object struct {
+	ObjectName          string            `json:"objectName"`
+	ObjectType          ObjectType        `json:"objectType,omitempty"`
+	ObjectAlias         string            `json:"objectAlias,omitempty"`
+	ObjectVersion       string            `json:"objectVersion,omitempty"`
+	ObjectVersionLabel  string            `json:"objectVersionLabel,omitempty"`
+	ObjectVersionStages []string          `json:"objectVersionStages,omitempty"`
+	JMESPath            []JMESPath        `json:"jmesPath,omitempty"`
+	FailoverObject      []FailoverObject  `json:"failoverObject,omitempty"`
+	UseReplica          bool              `json:"useReplica,omitempty"`
+	MaxSize             int               `json:"maxSize,omitempty"`
+	MatchNamePrefix     bool              `json:"matchNamePrefix,omitempty"`
+	DependsOn           []string          `json:"dependsOn,omitempty"`
+	WriteParent         *bool             `json:"writeParent,omitempty"`
+	ObjectEncoding      ObjectEncoding    `json:"objectEncoding,omitempty"`
+	Trim                bool              `json:"trim,omitempty"`
+	WithDecryption      *bool             `json:"withDecryption,omitempty"`
+	ObjectExplode       bool              `json:"objectExplode,omitempty"`
+	SplitStringList     bool              `json:"splitStringList,omitempty"`
+	StringListDelimiter string            `json:"stringListDelimiter,omitempty"`
+	StringListFileName  string            `json:"stringListFileName,omitempty"`
+	StringListFormat    StringListFormat  `json:"stringListFormat,omitempty"`
+	ChunkSize           int               `json:"chunkSize,omitempty"`
+	PreservePath        bool              `json:"preservePath,omitempty"`
+	ObjectTags          map[string]string `json:"objectTags,omitempty"`
+	Region              string            `json:"region,omitempty"`
+	FileOwner           *int              `json:"fileOwner,omitempty"`
+	FileGroup           *int              `json:"fileGroup,omitempty"`
+}
+
+// Builder for the objects specification of a SecretProviderClass.
+//
+// The zero value is ready to use.
+//
+type Builder struct {
+	objects []Object
+}
+
+// Returns a new, empty builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Adds objects to the specification.
+//
+// Returns the builder so calls can be chained.
+//
+func (b *Builder) Add(objects ...Object) *Builder {
+	b.objects = append(b.objects, objects...)
+	return b
+}
+
+// Adds a Secrets Manager secret to the specification.
+func (b *Builder) AddSecret(name string) *Builder {
+	return b.Add(Object{ObjectName: name, ObjectType: SecretsManager})
+}
+
+// Adds an SSM parameter to the specification.
+func (b *Builder) AddParameter(name string) *Builder {
+	return b.Add(Object{ObjectName: name, ObjectType: SSMParameter})
+}
+
+// Returns the objects YAML for the SecretProviderClass.
+//
+// The specification is validated as it would be on a mount in the given
+// regions (the region and, optionally, the failover regions of the
+// SecretProviderClass), so ARN regions and failover objects are checked.
+//
+func (b *Builder) Build(regions ...string) (string, error) {
+
+	if len(b.objects) == 0 {
+		return "", fmt.Errorf("at least one object must be added")
+	}
+	if len(regions) == 0 {
+		return "", fmt.Errorf("a region and optional failover regions must be given")
+	}
+
+	spec, err := yaml.Marshal(b.objects)
+	if err != nil {
+		return "", err
+	}
+
+	// Validate with the default path translation.
+	_, err = provider.NewSecretDescriptorList("/", "", "", string(spec), regions)
+	if err != nil {
+		return "", err
+	}
+
+	return string(spec), nil
+}
@@ -0,0 +1,89 @@
+package spcbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+
+	spec, err := New().
+		AddParameter("MyParm").
+		Add(Object{
+			ObjectName:  "arn:aws:secretsmanager:us-west-2:123456789012:secret:MySecret-a1b2c3",
+			ObjectAlias: "MySecret",
+			JMESPath: []JMESPath{
+				{Path: "username", ObjectAlias: "user", OnMissing: OnMissingSkip},
+			},
+			FailoverObject: []FailoverObject{
+				{ObjectName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:MySecret-d4e5f6"},
+				{ObjectName: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:MySecret-g7h8i9", ObjectVersionLabel: "AWSCURRENT"},
+			},
+			MatchNamePrefix: true,
+			DependsOn:       []string{"MyParm"},
+		}).
+		Build("us-west-2", "us-east-1", "eu-west-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `- objectName: MyParm
+  objectType: ssmparameter
+- dependsOn:
+  - MyParm
+  failoverObject:
+  - objectName: arn:aws:secretsmanager:us-east-1:123456789012:secret:MySecret-d4e5f6
+  - objectName: arn:aws:secretsmanager:eu-west-1:123456789012:secret:MySecret-g7h8i9
+    objectVersionLabel: AWSCURRENT
+  jmesPath:
+  - objectAlias: user
+    onMissing: skip
+    path: username
+  matchNamePrefix: true
+  objectAlias: MySecret
+  objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:MySecret-a1b2c3
+`
+	if spec != expected {
+		t.Fatalf("Unexpected spec:\n%s", spec)
+	}
+}
+
+func TestBuildValidates(t *testing.T) {
+
+	_, err := New().Build("us-west-2")
+	if err == nil || !strings.Contains(err.Error(), "at least one object") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = New().AddSecret("MySecret").Build()
+	if err == nil || !strings.Contains(err.Error(), "a region") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = New().AddSecret("MySecret").AddSecret("MySecret").Build("us-west-2")
+	if err == nil || !strings.Contains(err.Error(), "Name already in use") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = New().Add(Object{
+		ObjectName: "MySecret",
+		ObjectType: SecretsManager,
+		FailoverObject: []FailoverObject{
+			{ObjectName: "MySecret"},
+		},
+	}).Build("us-west-2")
+	if err == nil || !strings.Contains(err.Error(), "object alias must be specified") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// More failover objects than failover regions.
+	_, err = New().Add(Object{
+		ObjectName:     "MySecret",
+		ObjectType:     SecretsManager,
+		ObjectAlias:    "secret",
+		FailoverObject: []FailoverObject{{ObjectName: "MySecret1"}, {ObjectName: "MySecret2"}},
+	}).Build("us-west-2", "us-east-1")
+	if err == nil || !strings.Contains(err.Error(), "2 failover objects given for 1 failover regions") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package version describes the release of the provider and the provider APIs
+// it serves.
+//
+// It is intended for tools (for example operators managing the provider on a
+// fleet of clusters) that need to gate features on the provider version
+// programmatically. Versions are typed semantic versions (https://semver.org)
+// ordered by semantic version precedence, and the compatibility matrix lists
+// the provider API versions served by each release.
+//
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Build stamp filled in by Makefile during build (<major>.<minor>.<git describe>-<date>).
+var Build string
+
+// Provider API versions spoken between the driver and the provider.
+const (
+	APIv1alpha1 = "v1alpha1"
+)
+
+// Semantic version of the form <major>.<minor>.<patch>[-<pre-release>][+<build>].
+var semverRE = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// Build stamp of the Makefile: the release line, then git describe (which
+// starts with the last release tag, if any) and the build date.
+var stampRE = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(.+)$`)
+
+// Release tag at the start of git describe.
+var tagRE = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:[^0-9]|$)`)
+
+// Characters not allowed in build metadata.
+var badBuildRE = regexp.MustCompile(`[^0-9a-zA-Z.-]+`)
+
+// A semantic version.
+//
+// Versions are compared by semantic version precedence, so pre-releases sort
+// before their release and build metadata is ignored.
+//
+type Semver struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease string // Dot separated pre-release identifiers, such as rc.1
+	Metadata   string // Dot separated build metadata, ignored when comparing
+}
+
+// Parse a semantic version, with or without a leading v.
+func Parse(version string) (Semver, error) {
+
+	match := semverRE.FindStringSubmatch(version)
+	if match == nil {
+		return Semver{}, fmt.Errorf("invalid semantic version: %q", version)
+	}
+
+	var parts [3]uint64
+	for i := range parts {
+		n, err := strconv.ParseUint(match[i+1], 10, 64)
+		if err != nil {
+			return Semver{}, fmt.Errorf("invalid semantic version: %q", version)
+		}
+		parts[i] = n
+	}
+	return Semver{Major: parts[0], Minor: parts[1], Patch: parts[2], PreRelease: match[4], Metadata: match[5]}, nil
+}
+
+// Parse a semantic version, panicking when it is not valid.
+//
+// Meant for versions known at compile time, such as the first release with a
+// feature.
+//
+func MustParse(version string) Semver {
+
+	v, err := Parse(version)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Returns the version in semantic version form (without a leading v).
+func (v Semver) String() string {
+
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + v.PreRelease
+	}
+	if len(v.Metadata) > 0 {
+		s += "+" + v.Metadata
+	}
+	return s
+}
+
+// Compare two versions by semantic version precedence.
+//
+// Returns -1, 0, or 1 when the version is lower than, equal to, or higher than
+// the other one.
+//
+func (v Semver) Compare(other Semver) int {
+
+	for _, pair := range [][2]uint64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			return compareUint(pair[0], pair[1])
+		}
+	}
+	return comparePreRelease(v.PreRelease, other.PreRelease)
+}
+
+// Tell if the version is at least the given one, for example the first
+// release with a feature.
+func (v Semver) AtLeast(other Semver) bool {
+	return v.Compare(other) >= 0
+}
+
+// Returns the version of the running provider.
+//
+// See FromBuild.
+//
+func Current() Semver {
+	return FromBuild(Build)
+}
+
+// Returns a stable semantic version for a build stamp.
+//
+// A stamp holding a semantic version is used as is. The Makefile stamp
+// (<major>.<minor>.<git describe>-<date>) is not a semantic version, so the
+// major and minor versions are read from the stamp, the patch version from
+// the release tag git describe starts with (0 when there is no tag of that
+// release line), and the rest of the stamp is kept as build metadata, for
+// example 1.0.4+v1.0.4-2-g1234abc-2026.10.17 for the stamp
+// 1.0.v1.0.4-2-g1234abc-2026.10.17. Builds without a stamp (go build outside
+// of the Makefile) are 0.0.0+dev.
+//
+func FromBuild(stamp string) Semver {
+
+	if v, err := Parse(stamp); err == nil {
+		return v
+	}
+
+	match := stampRE.FindStringSubmatch(stamp)
+	if match == nil {
+		return Semver{Metadata: buildMetadata("dev." + stamp)}
+	}
+	major, errMajor := strconv.ParseUint(match[1], 10, 64)
+	minor, errMinor := strconv.ParseUint(match[2], 10, 64)
+	if errMajor != nil || errMinor != nil {
+		return Semver{Metadata: buildMetadata("dev." + stamp)}
+	}
+
+	v := Semver{Major: major, Minor: minor, Metadata: buildMetadata(match[3])}
+	if tag := tagRE.FindStringSubmatch(match[3]); tag != nil && tag[1] == match[1] && tag[2] == match[2] {
+		v.Patch, _ = strconv.ParseUint(tag[3], 10, 64)
+	}
+	return v
+}
+
+// Private helper to turn a build stamp into build metadata, replacing the
+// characters metadata can not hold and dropping empty identifiers.
+func buildMetadata(stamp string) string {
+
+	var ids []string
+	for _, id := range strings.Split(badBuildRE.ReplaceAllString(stamp, "-"), ".") {
+		if len(id) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, ".")
+}
+
+// Provider API versions served by provider releases.
+//
+// Since is the first release serving the API, and Until (when set) the first
+// release that no longer does.
+//
+type APICompatibility struct {
+	API   string
+	Since Semver
+	Until *Semver
+}
+
+// The provider API versions served by each release, oldest API first.
+var CompatibilityMatrix = []APICompatibility{
+	{API: APIv1alpha1}, // Served since the first release
+}
+
+// Returns the provider API versions served by a release, oldest first.
+func SupportedAPIs(v Semver) (apis []string) {
+
+	for _, entry := range CompatibilityMatrix {
+		if v.Compare(entry.Since) >= 0 && (entry.Until == nil || v.Compare(*entry.Until) < 0) {
+			apis = append(apis, entry.API)
+		}
+	}
+	return apis
+}
+
+// Tell if a release serves a provider API version.
+func Supports(v Semver, api string) bool {
+
+	for _, supported := range SupportedAPIs(v) {
+		if supported == api {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick the provider API version to speak with a peer.
+//
+// Returns the newest of the requested API versions served by the release, or
+// the newest API version served by the release when none are requested. An
+// error is returned when the release serves none of the requested versions.
+//
+func Negotiate(v Semver, requested ...string) (string, error) {
+
+	supported := SupportedAPIs(v)
+	if len(supported) == 0 {
+		return "", fmt.Errorf("provider version %s serves no provider API", v)
+	}
+
+	for i := len(supported) - 1; i >= 0; i-- {
+		if len(requested) == 0 {
+			return supported[i], nil
+		}
+		for _, api := range requested {
+			if api == supported[i] {
+				return api, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("provider version %s serves provider API %s, not %s",
+		v, strings.Join(supported, ", "), strings.Join(requested, ", "))
+}
+
+// Private helper to compare two numbers.
+func compareUint(a, b uint64) int {
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Private helper to compare pre-release identifiers by semantic version
+// precedence: a release sorts after its pre-releases, numeric identifiers are
+// compared as numbers and sort before alphanumeric ones, and a shorter list of
+// otherwise equal identifiers sorts first.
+func comparePreRelease(a, b string) int {
+
+	switch {
+	case a == b:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.ParseUint(aIDs[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bIDs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				return compareUint(aNum, bNum)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case aIDs[i] != bIDs[i]:
+			return strings.Compare(aIDs[i], bIDs[i])
+		}
+	}
+	return compareUint(uint64(len(aIDs)), uint64(len(bIDs)))
+}
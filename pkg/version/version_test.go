@@ -0,0 +1,109 @@
+package version
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	v, err := Parse("v1.2.3-rc.1+build.5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v != (Semver{Major: 1, Minor: 2, Patch: 3, PreRelease: "rc.1", Metadata: "build.5"}) || v.String() != "1.2.3-rc.1+build.5" {
+		t.Fatalf("Bad version: %+v %s", v, v)
+	}
+
+	for _, bad := range []string{"", "1", "1.2", "1.02.3", "1.2.3-", "1.2.3-01", "1.2.3+", "1.2.3+a..b", "1.0.g1234abc-2026.10.17"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+
+	// In increasing order of precedence (from the semantic version spec).
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+	versions := make([]Semver, 0, len(ordered))
+	for i := len(ordered) - 1; i >= 0; i-- {
+		versions = append(versions, MustParse(ordered[i]))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Compare(versions[j]) < 0 })
+	for i, v := range versions {
+		if v.String() != ordered[i] {
+			t.Fatalf("Out of order at %d: %s", i, v)
+		}
+	}
+
+	if MustParse("1.0.0+a").Compare(MustParse("1.0.0+b")) != 0 {
+		t.Errorf("Build metadata must be ignored")
+	}
+	if !MustParse("1.2.0").AtLeast(MustParse("1.1.9")) || MustParse("1.1.0-rc.1").AtLeast(MustParse("1.1.0")) {
+		t.Errorf("Bad AtLeast")
+	}
+}
+
+func TestFromBuild(t *testing.T) {
+
+	for stamp, expected := range map[string]string{
+		"":                                 "0.0.0+dev",
+		"v1.0.4":                           "1.0.4",
+		"1.0.g1234abc-2026.10.17.03.40":    "1.0.0+g1234abc-2026.10.17.03.40",
+		"1.0.1234abc-2026.10.17.03.40":     "1.0.0+1234abc-2026.10.17.03.40",
+		"1.0.v1.0.4-2-g1234abc_dirty":      "1.0.4+v1.0.4-2-g1234abc-dirty",
+		"1.1.v1.0.4-2-g1234abc-2026.10.17": "1.1.0+v1.0.4-2-g1234abc-2026.10.17",
+		"2.3.v2.3.12-2026.10.17.03.40":     "2.3.12+v2.3.12-2026.10.17.03.40",
+		"devbuild":                         "0.0.0+dev.devbuild",
+	} {
+		v := FromBuild(stamp)
+		if v.String() != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, stamp, v)
+		}
+		if _, err := Parse(v.String()); err != nil {
+			t.Errorf("Not a semantic version: %v", err)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+
+	defer func(matrix []APICompatibility) { CompatibilityMatrix = matrix }(CompatibilityMatrix)
+
+	if api, err := Negotiate(Current()); err != nil || api != APIv1alpha1 {
+		t.Fatalf("Expected %s, got %s %v", APIv1alpha1, api, err)
+	}
+
+	until := MustParse("3.0.0")
+	CompatibilityMatrix = []APICompatibility{
+		{API: APIv1alpha1, Until: &until},
+		{API: "v1", Since: MustParse("2.0.0")},
+	}
+	if apis := SupportedAPIs(MustParse("2.1.0")); len(apis) != 2 || !Supports(MustParse("2.1.0"), "v1") {
+		t.Errorf("Expected both APIs, got %v", apis)
+	}
+	for _, tst := range []struct {
+		version   string
+		requested []string
+		expected  string
+	}{
+		{"1.5.0", nil, APIv1alpha1},
+		{"2.0.0", nil, "v1"},
+		{"2.0.0", []string{APIv1alpha1}, APIv1alpha1},
+		{"2.0.0", []string{APIv1alpha1, "v1"}, "v1"},
+		{"3.0.0", []string{"v1"}, "v1"},
+	} {
+		if api, err := Negotiate(MustParse(tst.version), tst.requested...); err != nil || api != tst.expected {
+			t.Errorf("%s %v: expected %s, got %s %v", tst.version, tst.requested, tst.expected, api, err)
+		}
+	}
+
+	_, err := Negotiate(MustParse("3.0.0"), APIv1alpha1)
+	if err == nil || err.Error() != "provider version 3.0.0 serves provider API v1, not v1alpha1" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// Optional settings for reading the objects of a SecretProviderClass.
+//
+type DescriptorOptions struct {
+	// Allow an objectName ARN to name an object in another region than the
+	// mount.
+	//
+	// Some teams read one central secret from clusters in every region, and
+	// otherwise have to template the ARN for each region or set region on the
+	// object. When allowed, an ARN in another region is read from its own
+	// region as if region were set to it, so the failover regions of the mount
+	// do not apply to it. The ARN must still be in the partition of the mount's
+	// region.
+	AllowCrossRegionARNs bool
+}
+
+// Private helper to find the region an objectName ARN in another region than
+// the mount is read from (empty for other objects, and objects that already
+// give a region).
+func (p *SecretDescriptor) arnRegion(regions []string) string {
+
+	if len(p.Region) > 0 || len(regions) == 0 || !strings.HasPrefix(p.ObjectName, "arn:") {
+		return ""
+	}
+	objARN, err := arn.Parse(p.ObjectName)
+	if err != nil || objARN.Region == regions[0] {
+		return "" // Invalid ARNs are reported by the validation.
+	}
+	return objARN.Region
+}
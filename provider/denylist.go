@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// A list of objects that must never be mounted.
+//
+// Lets security teams keep high sensitivity secrets (for example root
+// credentials) out of pods regardless of what IAM allows. Each entry is a name
+// or an ARN, and both match the object by its name in any account and region,
+// whether the SecretProviderClass uses the name or an ARN. A trailing *
+// matches any name starting with the rest of the entry. Secrets Manager ARNs
+// match with or without their random suffix, so objects can not get around
+// the list by using a partial ARN or matchNamePrefix, and a leading slash is
+// ignored since the ARN of an SSM parameter does not tell /name from name.
+//
+type ObjectDenylist struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// Create a new object denylist from a comma separated list of entries.
+//
+// White space around entries is ignored. Returns an error for empty entries
+// and entries that are only a wildcard.
+//
+func NewObjectDenylist(entries string) (*ObjectDenylist, error) {
+
+	list := &ObjectDenylist{exact: make(map[string]bool)}
+	for _, entry := range strings.Split(entries, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case len(entry) == 0:
+			return nil, fmt.Errorf("object denylist can not contain empty entries: %s", entries)
+		case entry == "*":
+			return nil, fmt.Errorf("object denylist can not deny every object")
+		case strings.HasSuffix(entry, "*"):
+			list.prefixes = append(list.prefixes, denylistName(strings.TrimSuffix(entry, "*")))
+		default:
+			for _, name := range denylistNames(entry) {
+				list.exact[name] = true
+			}
+		}
+	}
+	return list, nil
+}
+
+// Checks that no object (or failover object) is on the denylist.
+//
+// Returns an error naming the first denied object.
+//
+func (l *ObjectDenylist) Check(descriptors map[SecretType][]*SecretDescriptor) error {
+
+	for _, sType := range []SecretType{SSMParameter, SecretsManager} {
+		for _, descriptor := range descriptors[sType] {
+			for _, name := range descriptor.GetObjectNames() {
+				if len(name) > 0 && l.denies(name) {
+					return fmt.Errorf("object is on the provider denylist: %s", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Private helper to check an object name (or ARN) against the list.
+func (l *ObjectDenylist) denies(objectName string) bool {
+
+	for _, name := range denylistNames(objectName) {
+		if l.exact[name] {
+			return true
+		}
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Private helper to get the names an object (or entry) is matched on: its
+// name, and for Secrets Manager ARNs also the name without the random suffix.
+func denylistNames(objectName string) []string {
+
+	names := []string{denylistName(objectName)}
+	if _, err := arn.Parse(objectName); err == nil {
+		names = append(names, denylistName(secretSuffixRE.ReplaceAllString(objectName, "$1")))
+	}
+	return names
+}
+
+// Private helper to get the name of an object (taken from the resource of an
+// ARN) without any leading slash.
+func denylistName(objectName string) string {
+	return strings.TrimPrefix(policyName(objectName), "/")
+}
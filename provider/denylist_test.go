@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectDenylist(t *testing.T) {
+
+	denylist, err := NewObjectDenylist(" prod/root , /prod/admin/*, arn:aws:secretsmanager:us-west-2:123456789012:secret:break-glass-AbC123, " +
+		"foo, arn:aws:ssm:us-west-2:123456789012:parameter/bar")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	denied := []string{
+		"prod/root",
+		"arn:aws:secretsmanager:us-west-2:111122223333:secret:prod/root-a1b2c3", // Name in any account
+		"arn:aws:secretsmanager:us-west-2:111122223333:secret:prod/root",        // Partial ARN
+		"/prod/admin/password",
+		"arn:aws:ssm:us-west-2:123456789012:parameter/prod/admin/key",
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:break-glass-AbC123",
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:break-glass",        // Partial ARN
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:break-glass-XyZ789", // Re-created secret
+		"break-glass", // By name
+		"arn:aws:secretsmanager:us-west-2:111122223333:secret:break-glass-AbC123", // Name in any account
+		"arn:aws:ssm:us-west-2:123456789012:parameter/foo",                        // Parameter foo
+		"/foo",
+		"bar",
+		"/bar",
+	}
+	for _, name := range denied {
+		if !denylist.denies(name) {
+			t.Errorf("Expected %s to be denied", name)
+		}
+	}
+
+	allowed := []string{
+		"prod/rootless",
+		"/prod/adminx",
+		"break-glass-2",
+		"foobar",
+		"/bar/baz",
+	}
+	for _, name := range allowed {
+		if denylist.denies(name) {
+			t.Errorf("Expected %s to be allowed", name)
+		}
+	}
+}
+
+func TestObjectDenylistCheck(t *testing.T) {
+
+	denylist, _ := NewObjectDenylist("prod/root")
+	objects := `
+          - objectName: app/db
+            objectType: secretsmanager
+            objectAlias: db
+            failoverObject:
+              objectName: prod/root`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, []string{"us-west-2", "us-east-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = denylist.Check(descriptors)
+	if err == nil || !strings.HasSuffix(err.Error(), "object is on the provider denylist: prod/root") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestObjectDenylistErrors(t *testing.T) {
+
+	for _, entries := range []string{"", "prod/root,,other", "*", " * "} {
+		if _, err := NewObjectDenylist(entries); err == nil {
+			t.Errorf("Expected error for %q", entries)
+		}
+	}
+}
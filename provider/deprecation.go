@@ -0,0 +1,44 @@
+package provider
+
+// A deprecated field or behavior used by a SecretProviderClass object.
+//
+// Deprecated fields still work but are reported so users can move off of them
+// before they are removed.
+//
+type Deprecation struct {
+	ObjectName string // The object using the deprecated field
+	Field      string // The deprecated field or behavior
+	Message    string // What to use instead
+}
+
+// Private table of deprecation checks run against each descriptor.
+//
+// To deprecate a field or behavior add an entry here describing the
+// replacement. Nothing is deprecated yet.
+//
+var deprecationChecks []deprecationCheck
+
+// Private check for a deprecated field or behavior and what to use instead.
+type deprecationCheck struct {
+	field   string
+	message string
+	check   func(p *SecretDescriptor) bool
+}
+
+// Returns the deprecated fields or behaviors used by this descriptor.
+//
+// Should only be called on validated descriptors.
+//
+func (p *SecretDescriptor) GetDeprecations() (deprecations []Deprecation) {
+
+	for _, dep := range deprecationChecks {
+		if dep.check(p) {
+			deprecations = append(deprecations, Deprecation{
+				ObjectName: p.ObjectName,
+				Field:      dep.field,
+				Message:    dep.message,
+			})
+		}
+	}
+	return deprecations
+}
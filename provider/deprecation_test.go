@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestDeprecations(t *testing.T) {
+
+	defer func(checks []deprecationCheck) { deprecationChecks = checks }(deprecationChecks)
+	deprecationChecks = append(deprecationChecks, deprecationCheck{
+		field:   "objectAlias",
+		message: "use something else",
+		check:   func(p *SecretDescriptor) bool { return len(p.ObjectAlias) > 0 },
+	})
+
+	objects := `
+          - objectName: feaw
+            objectType: ssmparameter
+            objectAlias: alias
+          - objectName: other
+            objectType: ssmparameter`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	deps := descriptors[SSMParameter][0].GetDeprecations()
+	if len(deps) != 1 || deps[0] != (Deprecation{ObjectName: "feaw", Field: "objectAlias", Message: "use something else"}) {
+		t.Fatalf("Unexpected deprecations: %+v", deps)
+	}
+	if deps := descriptors[SSMParameter][1].GetDeprecations(); len(deps) != 0 {
+		t.Fatalf("Unexpected deprecations: %+v", deps)
+	}
+}
+
+func TestNoDeprecations(t *testing.T) {
+	objects := `
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw
+          - objectName: arn:aws:ssm:us-west-2:123456789012:parameter/feaw
+            objectAlias: feawArn
+          - objectName: feaw
+            objectType: ssmparameter
+          - objectName: arn:aws:ssm:us-west-2:111122223333:parameter/shared
+            objectType: ssmparameter
+            objectAlias: shared`
+
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, group := range descriptors {
+		for _, descriptor := range group {
+			if deps := descriptor.GetDeprecations(); len(deps) != 0 {
+				t.Fatalf("Unexpected deprecations: %+v", deps)
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package provider
+
+// Per call settings of SecretProvider.GetSecretValues.
+//
+// Settings are added here rather than as new parameters of GetSecretValues so
+// the interface does not change with each of them. The zero value fetches with
+// the settings the provider was created with. The cache scope stays on the
+// context (see WithCacheScope) since it is read by the caching AWS clients
+// rather than by the providers.
+//
+// Only settings a caller actually varies per call belong here. The deadline
+// of a call is the deadline of its context, the number of secrets fetched at
+// once is ProviderOptions.MaxConcurrentFetches, and the regions are tried in
+// the order the provider was created with.
+//
+type FetchOptions struct {
+	// Let access denied errors from the primary region fall through to the
+	// failover regions instead of failing the mount. This supports setups that
+	// intentionally grant access only in the failover region (for example
+	// during disaster recovery drills).
+	AccessDeniedFailover bool
+}
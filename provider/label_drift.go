@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Max history entries SSM allows in a GetParameterHistory page.
+const historyPageSize = 50
+
+// Private helper to read back the mounted parameters pinned to a label whose
+// label has not moved since they were mounted, instead of fetching their
+// values.
+//
+// This is the parameter equivalent of checking the staging labels of a secret
+// with DescribeSecret: the history of each labeled parameter is read with
+// GetParameterHistory (one call per parameter and page of 50 versions) to find
+// the version the label is on now. When that is still the mounted version the
+// mounted file is read back, otherwise the label has moved and the parameter
+// is fetched as usual. Like reloadUnmodifiedParameters this is only done when
+// the LastModifiedGating feature gate is enabled, and parameters named by ARN,
+// not written in full (writeParent is false), or in failover regions are left
+// alone. Any failure is only logged and the parameter is fetched.
+//
+func reloadUnmovedLabels(
+	ctx context.Context,
+	client ParameterStoreClient,
+	descriptors []*SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) (values []*SecretValue, remaining []*SecretDescriptor) {
+
+	if !utils.DefaultFeatureGate.Enabled(utils.LastModifiedGating) || client.FailoverIndex > 0 {
+		return nil, descriptors
+	}
+
+	for _, descriptor := range descriptors {
+		name := descriptor.GetSecretName(client.FailoverIndex)
+		label := descriptor.GetObjectVersionLabel(client.FailoverIndex)
+		mounted := curMap[descriptor.GetFileName()]
+		if len(label) == 0 || mounted == nil || !descriptor.GetWriteParent() || isParameterARN(name) {
+			remaining = append(remaining, descriptor)
+			continue
+		}
+
+		start := time.Now()
+		version, err := labelVersion(ctx, client, name, label)
+		if err != nil {
+			utils.Warningf("%s: Failed to read the history of parameter %s to check label %s: %v", client.Region, name, label, err)
+			remaining = append(remaining, descriptor)
+			continue
+		}
+		if version != mounted.Version {
+			klog.Infof("%s: Label %s of parameter %s moved from version %s to %s", client.Region, label, name, mounted.Version, version)
+			remaining = append(remaining, descriptor)
+			continue
+		}
+
+		parmValues, err := reloadParameter(client, descriptor, version, curMap)
+		if err != nil {
+			utils.Warningf("%s: Failed to read back parameter %s: %v", client.Region, name, err)
+			remaining = append(remaining, descriptor)
+			continue
+		}
+		utils.RecordFetchDecision(client.Region, utils.FetchUnmoved)
+		setLatency(parmValues, time.Since(start))
+		values = append(values, parmValues...)
+	}
+	return values, remaining
+}
+
+// Private helper to find the version of a parameter a label is on, reading
+// every page of its history. An empty version means the label is on no
+// version (the fetch then reports the parameter as invalid).
+func labelVersion(ctx context.Context, client ParameterStoreClient, name, label string) (string, error) {
+
+	input := &ssm.GetParameterHistoryInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(false),
+		MaxResults:     aws.Int64(historyPageSize),
+	}
+	for {
+		start := time.Now()
+		rsp, err := client.Client.GetParameterHistoryWithContext(ctx, input)
+		utils.ObserveAPICall(SSMParameter.String(), "GetParameterHistory", client.Region, time.Since(start))
+		if err != nil {
+			utils.RecordFetchError(SSMParameter.String(), client.Region, "", err)
+			return "", err
+		}
+		for _, history := range rsp.Parameters {
+			for _, historyLabel := range history.Labels {
+				if aws.StringValue(historyLabel) == label {
+					return strconv.FormatInt(aws.Int64Value(history.Version), 10), nil
+				}
+			}
+		}
+		if len(aws.StringValue(rsp.NextToken)) == 0 {
+			return "", nil
+		}
+		input.NextToken = rsp.NextToken
+	}
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Mock SSM client that also returns the history of parameters, one version a
+// page.
+type historySSM struct {
+	mockSSM
+	history []*ssm.ParameterHistory
+	histCnt int
+}
+
+func (m *historySSM) GetParameterHistoryWithContext(
+	ctx context.Context, input *ssm.GetParameterHistoryInput, options ...request.Option,
+) (*ssm.GetParameterHistoryOutput, error) {
+	m.histCnt++
+	var matched []*ssm.ParameterHistory
+	for _, history := range m.history {
+		if aws.StringValue(history.Name) == aws.StringValue(input.Name) {
+			matched = append(matched, history)
+		}
+	}
+	start, _ := strconv.Atoi(aws.StringValue(input.NextToken))
+	if start+1 >= len(matched) {
+		return &ssm.GetParameterHistoryOutput{Parameters: matched[start:]}, nil
+	}
+	return &ssm.GetParameterHistoryOutput{Parameters: matched[start : start+1], NextToken: aws.String(strconv.Itoa(start + 1))}, nil
+}
+
+// Make sure labeled parameters are read back while the label is on the
+// mounted version, and fetched once the label moves.
+func TestLabelDrift(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestLabelDrift")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: Parm1
+            objectType: ssmparameter
+            objectVersionLabel: prod`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = ioutil.WriteFile(descriptors[SSMParameter][0].GetMountPath(), []byte("mounted"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	utils.DefaultFeatureGate.Set("LastModifiedGating=true")
+	defer utils.DefaultFeatureGate.Set("LastModifiedGating=false")
+
+	client := &historySSM{
+		mockSSM: mockSSM{params: []*ssm.Parameter{
+			{Name: aws.String("Parm1"), Value: aws.String("v2"), Version: aws.Int64(2), Selector: aws.String(":prod")},
+		}},
+		history: []*ssm.ParameterHistory{
+			{Name: aws.String("Parm1"), Version: aws.Int64(1), Labels: aws.StringSlice([]string{"prod"})},
+			{Name: aws.String("Parm1"), Version: aws.Int64(2)},
+		},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+	curMap := map[string]*v1alpha1.ObjectVersion{"Parm1": {Id: "Parm1", Version: "1"}}
+
+	values, err := prov.GetSecretValues(context.Background(), descriptors[SSMParameter], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.histCnt != 1 || client.getCnt != 0 || len(values) != 1 || string(values[0].Value) != "mounted" {
+		t.Fatalf("Expected the mounted value to be read back, got %d history and %d fetch calls", client.histCnt, client.getCnt)
+	}
+
+	// Move the label, which is on the last page of the history.
+	client.history[0].Labels, client.history[1].Labels = nil, aws.StringSlice([]string{"prod"})
+	client.histCnt = 0
+	values, err = prov.GetSecretValues(context.Background(), descriptors[SSMParameter], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.histCnt != 2 || client.getCnt != 1 || string(values[0].Value) != "v2" || curMap["Parm1"].Version != "2" {
+		t.Fatalf("Label move not detected: %d history and %d fetch calls, version %s", client.histCnt, client.getCnt, curMap["Parm1"].Version)
+	}
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to check if an object has not been modified since it was
+// mounted (If-Modified-Since semantics).
+//
+// The mount time is the modification time of the mounted file, so objects
+// that are not mounted, or whose whole value is not written (writeParent is
+// false), are always treated as modified. Objects mounted with a staging
+// label are also treated as modified since moving a label to another version
+// does not change the modification date of a parameter, and a new label in
+// the SecretProviderClass does not change the object at all (labels are
+// checked by reloadUnmovedLabels instead).
+//
+func notModifiedSince(descriptor *SecretDescriptor, lastModified *time.Time, curMap map[string]*v1alpha1.ObjectVersion) bool {
+
+	if !utils.DefaultFeatureGate.Enabled(utils.LastModifiedGating) || lastModified == nil {
+		return false
+	}
+	if curMap[descriptor.GetFileName()] == nil || !descriptor.GetWriteParent() || len(descriptor.ObjectVersionLabel) > 0 {
+		return false
+	}
+	info, err := os.Stat(descriptor.GetMountPath())
+	if err != nil {
+		return false
+	}
+	return lastModified.Before(info.ModTime())
+}
+
+// Private helper to read back the mounted parameters that have not been
+// modified since they were mounted, instead of fetching their values.
+//
+// The parameters are described with DescribeParameters (one call for every 50
+// parameters), and a parameter is only read back when its last modified date is before the
+// mount time and its version is still the mounted version. Parameters named
+// by ARN or pinned to a version are left alone, as are parameters in failover
+// regions, since the mounted value may have come from another region. Any
+// failure is only logged and the remaining descriptors are fetched as usual.
+//
+func reloadUnmodifiedParameters(
+	ctx context.Context,
+	client ParameterStoreClient,
+	descriptors []*SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) (values []*SecretValue, remaining []*SecretDescriptor) {
+
+	if !utils.DefaultFeatureGate.Enabled(utils.LastModifiedGating) || client.FailoverIndex > 0 {
+		return nil, descriptors
+	}
+
+	byName := make(map[string]*SecretDescriptor)
+	var names []*string
+	for _, descriptor := range descriptors {
+		name := descriptor.GetSecretName(client.FailoverIndex)
+		if curMap[descriptor.GetFileName()] == nil || isParameterARN(name) || len(descriptor.ObjectVersion) > 0 {
+			continue
+		}
+		byName[name] = descriptor
+		names = append(names, aws.String(name))
+	}
+	if len(names) == 0 {
+		return nil, descriptors
+	}
+
+	start := time.Now()
+	params, err := describeParameters(ctx, client, names)
+	if err != nil {
+		utils.Warningf("%s: Failed to describe parameters to check if they were modified: %v", client.Region, err)
+		return nil, descriptors
+	}
+
+	reloaded := make(map[*SecretDescriptor]bool)
+	for _, meta := range params {
+		descriptor := byName[aws.StringValue(meta.Name)]
+		if descriptor == nil || !notModifiedSince(descriptor, meta.LastModifiedDate, curMap) {
+			continue
+		}
+		version := curMap[descriptor.GetFileName()].Version
+		if version != strconv.FormatInt(aws.Int64Value(meta.Version), 10) {
+			continue
+		}
+		parmValues, err := reloadParameter(client, descriptor, version, curMap)
+		if err != nil {
+			utils.Warningf("%s: Failed to read back parameter %s: %v", client.Region, aws.StringValue(meta.Name), err)
+			continue
+		}
+		utils.RecordFetchDecision(client.Region, utils.FetchUnmodified)
+		setLatency(parmValues, time.Since(start))
+		values = append(values, parmValues...)
+		reloaded[descriptor] = true
+	}
+
+	for _, descriptor := range descriptors {
+		if !reloaded[descriptor] {
+			remaining = append(remaining, descriptor)
+		}
+	}
+	return values, remaining
+}
+
+// Private helper to read back a mounted parameter and its jmesPath entries.
+func reloadParameter(
+	client ParameterStoreClient,
+	descriptor *SecretDescriptor,
+	version string,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) ([]*SecretValue, error) {
+
+	value, err := os.ReadFile(descriptor.GetMountPath())
+	if err != nil {
+		return nil, err
+	}
+	secretValue := &SecretValue{
+		Value:         value,
+		Descriptor:    *descriptor,
+		IsFailover:    client.FailoverIndex > 0,
+		FailoverIndex: client.FailoverIndex,
+		Version:       version,
+	}
+	jsonSecrets, err := secretValue.getJsonSecrets()
+	if err != nil {
+		return nil, err
+	}
+	for _, jsonSecret := range jsonSecrets {
+		jsonDescriptor := jsonSecret.Descriptor
+		curMap[jsonDescriptor.GetFileName()] = &v1alpha1.ObjectVersion{Id: jsonDescriptor.GetFileName(), Version: version}
+	}
+	return append([]*SecretValue{secretValue}, jsonSecrets...), nil
+}
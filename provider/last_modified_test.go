@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Mock Secrets Manager client with a last changed date but no staging labels.
+type modifiedSecretsManager struct {
+	mockSecretsManager
+	lastChanged time.Time
+}
+
+func (m *modifiedSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	m.getCnt++
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("secret"), VersionId: aws.String("v2")}, nil
+}
+
+func (m *modifiedSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+	m.descCnt++
+	return &secretsmanager.DescribeSecretOutput{LastChangedDate: aws.Time(m.lastChanged)}, nil
+}
+
+// Make sure the staging labels decide if a secret is current, whatever its
+// last changed date says.
+func TestLastModifiedGatingSecrets(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestLastModifiedGatingSecrets")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = ioutil.WriteFile(descriptors[SecretsManager][0].GetMountPath(), []byte("mounted"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	utils.DefaultFeatureGate.Set("LastModifiedGating=true")
+	defer utils.DefaultFeatureGate.Set("LastModifiedGating=false")
+
+	// Changed before the mount, but v1 is no longer labeled AWSCURRENT.
+	client := &modifiedSecretsManager{lastChanged: time.Now().Add(-time.Hour)}
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client})
+	curMap := map[string]*v1alpha1.ObjectVersion{"secret1": {Id: "secret1", Version: "v1"}}
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(values[0].Value) != "secret" || client.getCnt != 1 || client.descCnt != 1 {
+		t.Fatalf("Expected the secret to be fetched, got %s after %d calls", values[0].Value, client.getCnt)
+	}
+}
+
+// Make sure parameters not modified since they were mounted are not fetched.
+func TestLastModifiedGatingParameters(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestLastModifiedGatingParameters")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: Parm1
+            objectType: ssmparameter
+            jmesPath:
+              - path: key
+                objectAlias: key
+          - objectName: Parm2
+            objectType: ssmparameter
+          - objectName: Parm3
+            objectType: ssmparameter`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, descriptor := range descriptors[SSMParameter] {
+		if err = ioutil.WriteFile(descriptor.GetMountPath(), []byte(`{"key": "mounted"}`), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	utils.DefaultFeatureGate.Set("LastModifiedGating=true")
+	defer utils.DefaultFeatureGate.Set("LastModifiedGating=false")
+
+	// Parm1 is unchanged, Parm2 was modified after the mount, and Parm3 has a
+	// new version.
+	before, after := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	client := &mockSSM{
+		params: []*ssm.Parameter{
+			{Name: aws.String("Parm2"), Value: aws.String("parm2"), Version: aws.Int64(2)},
+			{Name: aws.String("Parm3"), Value: aws.String("parm3"), Version: aws.Int64(2)},
+		},
+		meta: []*ssm.ParameterMetadata{
+			{Name: aws.String("Parm1"), LastModifiedDate: aws.Time(before), Version: aws.Int64(1)},
+			{Name: aws.String("Parm2"), LastModifiedDate: aws.Time(after), Version: aws.Int64(2)},
+			{Name: aws.String("Parm3"), LastModifiedDate: aws.Time(before), Version: aws.Int64(2)},
+		},
+	}
+	provider := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	curMap := map[string]*v1alpha1.ObjectVersion{
+		"Parm1": {Id: "Parm1", Version: "1"},
+		"Parm2": {Id: "Parm2", Version: "1"},
+		"Parm3": {Id: "Parm3", Version: "1"},
+	}
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SSMParameter], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.descCnt != 1 || client.getCnt != 1 || len(values) != 4 {
+		t.Fatalf("Expected one describe and one fetch for 4 values, got %d, %d, %d", client.descCnt, client.getCnt, len(values))
+	}
+	got := map[string]string{}
+	for _, value := range values {
+		got[value.Descriptor.GetFileName()] = string(value.Value)
+	}
+	if got["Parm1"] != `{"key": "mounted"}` || got["key"] != "mounted" || got["Parm2"] != "parm2" || got["Parm3"] != "parm3" {
+		t.Fatalf("Unexpected values %v", got)
+	}
+	if curMap["Parm1"].Version != "1" || curMap["key"].Version != "1" || curMap["Parm3"].Version != "2" {
+		t.Fatalf("Unexpected versions %v", curMap)
+	}
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Separator between the YAML documents of an objects specification.
+var documentSeparatorRE = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// Merge object lists into a single objects specification.
+//
+// Each specification may hold several YAML documents (separated by ---), each
+// a list of objects, so for example a baseline of secrets provided by the
+// platform team can be combined with those of the application. The lists are
+// merged in order. An object repeated exactly is only mounted once, while two
+// different objects mounted as the same file (objectAlias, or objectName when
+// there is no alias) are reported as a conflict. A single document is
+// returned unchanged, so existing specifications are read exactly as before.
+//
+func MergeObjectSpecs(specs ...string) (string, error) {
+
+	var documents []string
+	size := 0
+	for _, spec := range specs {
+		size += len(spec)
+		for _, doc := range documentSeparatorRE.Split(spec, -1) {
+			if len(strings.TrimSpace(doc)) > 0 {
+				documents = append(documents, doc)
+			}
+		}
+	}
+	if size > maxObjectSpecSize {
+		return "", fmt.Errorf("SecretProviderClass objects exceed %d bytes", maxObjectSpecSize)
+	}
+	if len(documents) <= 1 {
+		return strings.Join(documents, ""), nil
+	}
+
+	merged := make([]map[string]interface{}, 0)
+	seen := make(map[string]int)  // Document each merged object came from, by key
+	index := make(map[string]int) // Position of each merged object, by key
+	for i, doc := range documents {
+
+		var objects []map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &objects); err != nil {
+			return "", fmt.Errorf("Failed to load SecretProviderClass objects document %d: %+v", i+1, err)
+		}
+
+		for _, object := range objects {
+			if object == nil {
+				merged = append(merged, object) // Reported when the specification is read
+				continue
+			}
+
+			key, err := mergeKey(object)
+			if err != nil {
+				return "", err
+			}
+			if pos, ok := index[key]; ok {
+				if !reflect.DeepEqual(merged[pos], object) {
+					return "", fmt.Errorf("object %s is defined differently in objects documents %d and %d", key, seen[key], i+1)
+				}
+				continue // Mounted once
+			}
+			seen[key] = i + 1
+			index[key] = len(merged)
+			merged = append(merged, object)
+		}
+	}
+
+	spec, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(spec), nil
+}
+
+// Private helper to get the key objects are merged on: the file name the
+// object is mounted as, or the whole object when it has no name (for example
+// objects selected with objectTags).
+func mergeKey(object map[string]interface{}) (string, error) {
+
+	for _, field := range []string{"objectAlias", "objectName"} {
+		if name, ok := object[field].(string); ok && len(name) > 0 {
+			return name, nil
+		}
+	}
+	key, err := json.Marshal(object) // Map keys are sorted
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestMergeObjectSpecs(t *testing.T) {
+
+	// A single list is left exactly as written.
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager`
+	if spec, err := MergeObjectSpecs("", objects); err != nil || spec != objects {
+		t.Fatalf("Expected the objects unchanged, got %q %v", spec, err)
+	}
+
+	shared := `
+- objectName: baseline
+  objectType: secretsmanager
+---
+- objectName: /platform/ca
+  objectType: ssmparameter
+  objectAlias: ca`
+	objects = `
+- objectName: app
+  objectType: secretsmanager
+- objectName: baseline
+  objectType: secretsmanager
+---
+- objectTags: {team: payments}
+  objectType: secretsmanager
+- objectTags: {team: payments}
+  objectType: secretsmanager`
+	spec, err := MergeObjectSpecs(shared, objects)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	descriptors, err := NewSecretDescriptorList("/", "", "", spec, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, descriptor := range append(descriptors[SecretsManager], descriptors[SSMParameter]...) {
+		names = append(names, descriptor.GetFileName())
+	}
+	if len(names) != 4 || names[0] != "baseline" || names[1] != "app" || names[2] != "" || names[3] != "ca" {
+		t.Fatalf("Unexpected merged objects: %q", names)
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		"- objectName: baseline\n  objectType: ssmparameter":                      "object baseline is defined differently in objects documents 1 and 3",
+		"---\n- objectName: other\n  objectType: ssmparameter\n  objectAlias: ca": "object ca is defined differently in objects documents 2 and 3",
+		"- objectName: [bad": "Failed to load SecretProviderClass objects document 3: error converting YAML to JSON: yaml: line 1: did not find expected ',' or ']'",
+	} {
+		_, err := MergeObjectSpecs(shared, objects)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Placeholders such as {topology.kubernetes.io/zone} left in an object name.
+var namePlaceholderRE = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Replace placeholders in the object names of an objects specification.
+//
+// Each {name} in the objectName of an object or of its failover objects is
+// replaced with values[name], so a single SecretProviderClass can mount for
+// example the secret of the zone of each node. Other fields are left alone,
+// and placeholders without a value stay in the name (and are then reported
+// when the specification is read).
+//
+func ExpandObjectNames(objectSpec string, values map[string]string) (string, error) {
+
+	var objects []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(objectSpec), &objects); err != nil {
+		return "", fmt.Errorf("Failed to load SecretProviderClass: %+v", err)
+	}
+
+	pairs := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	expand := func(object map[string]interface{}) {
+		if name, ok := object["objectName"].(string); ok {
+			object["objectName"] = replacer.Replace(name)
+		}
+	}
+
+	for _, object := range objects {
+		if object == nil {
+			continue // Reported when the specification is read
+		}
+		expand(object)
+		switch failover := object["failoverObject"].(type) {
+		case map[string]interface{}:
+			expand(failover)
+		case []interface{}:
+			for _, entry := range failover {
+				if entry, ok := entry.(map[string]interface{}); ok {
+					expand(entry)
+				}
+			}
+		}
+	}
+
+	expanded, err := yaml.Marshal(objects)
+	if err != nil {
+		return "", err
+	}
+	return string(expanded), nil
+}
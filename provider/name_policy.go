@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// Placeholder in the policy pattern replaced by the cluster name.
+const clusterPlaceholder = "{cluster}"
+
+// A naming policy that the names of mounted objects must follow.
+//
+// Used to enforce organizational naming standards, for example that every
+// object name starts with /eks/<cluster>/. When an object name is an ARN, the
+// policy applies to the name in the ARN (without the resource type) so the
+// same policy works in every partition and region.
+//
+type ObjectNamePolicy struct {
+	pattern *regexp.Regexp
+}
+
+// Create a new object naming policy.
+//
+// The pattern is a regular expression that must match the whole object name.
+// Any {cluster} placeholders are replaced with the (quoted) cluster name, which
+// must then be given.
+//
+func NewObjectNamePolicy(pattern, clusterName string) (*ObjectNamePolicy, error) {
+
+	if strings.Contains(pattern, clusterPlaceholder) {
+		if len(clusterName) == 0 {
+			return nil, fmt.Errorf("a cluster name is required by the object name policy: %s", pattern)
+		}
+		pattern = strings.ReplaceAll(pattern, clusterPlaceholder, regexp.QuoteMeta(clusterName))
+	}
+
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid object name policy: %w", err)
+	}
+	return &ObjectNamePolicy{pattern: re}, nil
+}
+
+// Checks that every object (and failover object) follows the naming policy.
+//
+// Returns an error naming the first object that does not.
+//
+func (p *ObjectNamePolicy) Check(descriptors map[SecretType][]*SecretDescriptor) error {
+
+	for _, sType := range []SecretType{SSMParameter, SecretsManager} {
+		for _, descriptor := range descriptors[sType] {
+			for _, name := range descriptor.GetObjectNames() {
+				if len(name) == 0 {
+					continue
+				}
+				if !p.pattern.MatchString(policyName(name)) {
+					return fmt.Errorf("object name does not match the naming policy %s: %s", p.pattern, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Private helper to get the name the policy applies to.
+//
+// For ARNs this is the resource without the resource type, so
+// arn:aws:ssm:us-west-2:123456789012:parameter/eks/app/db maps to /eks/app/db
+// and arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:eks/app-a1b2c3
+// maps to eks/app-a1b2c3.
+//
+func policyName(objectName string) string {
+
+	objARN, err := arn.Parse(objectName)
+	if err != nil {
+		return objectName // Not an ARN
+	}
+
+	switch {
+	case strings.HasPrefix(objARN.Resource, "secret:"):
+		return strings.TrimPrefix(objARN.Resource, "secret:")
+	case strings.HasPrefix(objARN.Resource, "parameter/"):
+		return strings.TrimPrefix(objARN.Resource, "parameter") // Keep the leading slash
+	}
+	return objARN.Resource
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectNamePolicy(t *testing.T) {
+
+	policy, err := NewObjectNamePolicy("/?eks/{cluster}/.*", "prod.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	objects := `
+          - objectName: /eks/prod.1/db
+            objectType: ssmparameter
+          - objectName: arn:aws:ssm:us-west-2:123456789012:parameter/eks/prod.1/api
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:eks/prod.1/app-a1b2c3`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := policy.Check(descriptors); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The cluster name is matched literally.
+	objects = `
+          - objectName: eks/prodx1/db
+            objectType: secretsmanager`
+	descriptors, err = NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = policy.Check(descriptors)
+	if err == nil || !strings.HasSuffix(err.Error(), ": eks/prodx1/db") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestObjectNamePolicyErrors(t *testing.T) {
+
+	if _, err := NewObjectNamePolicy("/eks/{cluster}/.*", ""); err == nil {
+		t.Fatalf("Expected error for missing cluster name")
+	}
+	if _, err := NewObjectNamePolicy("/eks/(", ""); err == nil {
+		t.Fatalf("Expected error for bad pattern")
+	}
+}
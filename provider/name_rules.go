@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// Limits of the AWS naming rules checked before anything is fetched.
+const (
+	maxSecretNameLength    = 512  // Secrets Manager secret names
+	maxParameterNameLength = 1011 // SSM parameter names (AWS counts the full ARN)
+	maxParameterLevels     = 15   // SSM parameter hierarchy levels
+)
+
+// Characters allowed in Secrets Manager secret names.
+var secretNameRE = regexp.MustCompile(`^[a-zA-Z0-9/_+=.@-]+$`)
+
+// Characters allowed in SSM parameter names, with an optional version or
+// label selector (name:3 or name:label) as accepted by GetParameters.
+var parameterNameRE = regexp.MustCompile(`^[a-zA-Z0-9/_.-]+(:[a-zA-Z0-9_.-]{1,100})?$`)
+
+// Private helper to check an object name against the AWS naming rules.
+//
+// Names that break the rules would only fail with a ValidationException once
+// the mount calls AWS, often after other objects were fetched, and the error
+// does not say which rule was broken. The name of an ARN is checked as well.
+// Only the rules for reading objects are checked, so for example public
+// parameters under /aws/ are allowed.
+//
+func validateNameRules(objectName string, sType SecretType, objARN *arn.ARN) error {
+
+	name := objectName
+	if objARN != nil {
+		switch sType {
+		case SecretsManager:
+			name = strings.TrimPrefix(objARN.Resource, "secret:")
+		case SSMParameter:
+			name = strings.TrimPrefix(objARN.Resource, "parameter")
+			if strings.Count(name, "/") == 1 {
+				name = name[1:] // parameter/name is the name without a hierarchy
+			}
+		}
+	}
+
+	switch sType {
+	case SecretsManager:
+		if objARN == nil && len(name) > maxSecretNameLength {
+			return validationErrorf(ErrInvalidObjectName, "secret names can be at most %d characters: %s", maxSecretNameLength, objectName)
+		}
+		if !secretNameRE.MatchString(name) {
+			return validationErrorf(ErrInvalidObjectName, "secret names can only contain letters, numbers, and the characters /_+=.@- (found %q): %s", badNameChar(name, "/_+=.@-"), objectName)
+		}
+
+	case SSMParameter:
+		if len(objectName) > maxParameterNameLength {
+			return validationErrorf(ErrInvalidObjectName, "ssm parameter names can be at most %d characters: %s", maxParameterNameLength, objectName)
+		}
+		if c := badNameChar(name, "/_.-:"); len(c) > 0 {
+			return validationErrorf(ErrInvalidObjectName, "ssm parameter names can only contain letters, numbers, and the characters /_.- (found %q): %s", c, objectName)
+		}
+		if !parameterNameRE.MatchString(name) {
+			return validationErrorf(ErrInvalidObjectName, "ssm parameter names can only end with one :version or :label selector of at most 100 characters: %s", objectName)
+		}
+		if levels := strings.Count(name, "/"); levels > maxParameterLevels {
+			return validationErrorf(ErrInvalidObjectName, "ssm parameter names can have at most %d hierarchy levels: %s", maxParameterLevels, objectName)
+		}
+	}
+	return nil
+}
+
+// Private helper to find the first character of a name that is not a letter,
+// a number, or one of the other allowed characters (empty if there is none).
+func badNameChar(name, allowed string) string {
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune(allowed, c)) {
+			return string(c)
+		}
+	}
+	return ""
+}
@@ -2,12 +2,16 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
@@ -18,7 +22,10 @@ import (
 )
 
 const (
-	batchSize = 10 // Max parameters SSM allows in a batch.
+	batchSize           = 10                 // Max parameters SSM allows in a batch.
+	describeBatchSize   = 50                 // Max names SSM allows in a DescribeParameters filter and page.
+	requestIDHeader     = "X-Amzn-Requestid" // Response header holding the AWS request ID.
+	standardTierMaxSize = 4096               // Largest value of a standard tier parameter.
 )
 
 // Implements the provider interface for SSM Parameter Store.
@@ -30,15 +37,62 @@ const (
 // This implementation reduces API calls by batching multiple parameter requests
 // together using the GetParameters call.
 //
+// Parameters named by ARN (required for parameters shared from other accounts)
+// can not be batched and are fetched individually using GetParameter.
+//
+// Parameters pinned to a label are requested as name:label so every fetch
+// resolves the label again. With the LastModifiedGating feature gate, mounted
+// parameters are checked first (see reloadUnmodifiedParameters, and
+// reloadUnmovedLabels which detects label moves with GetParameterHistory) and
+// read back when they have not changed.
+//
 type ParameterStoreProvider struct {
-	clients []ParameterStoreClient
+	clients       []ParameterStoreClient
+	expiryWarning time.Duration // Warn about parameters expiring within this window (0 to disable)
+	tierPolicy    string        // What to do about advanced tier parameters (see TierPolicyAllow)
+}
+
+// Allowed values of the advanced tier policy.
+//
+// Advanced tier parameters are charged per parameter and per API interaction,
+// and mounts fetch them on every rotation, so their use should be deliberate.
+//
+const (
+	TierPolicyAllow = "allow" // Mount advanced tier parameters without checking (default)
+	TierPolicyWarn  = "warn"  // Mount them but log and report them on the pod
+	TierPolicyDeny  = "deny"  // Fail mounts of advanced tier parameters
+)
+
+// Private helper to tell if the tier of parameters must be looked up.
+func (p *ParameterStoreProvider) checksTier() bool {
+	return p.tierPolicy == TierPolicyWarn || p.tierPolicy == TierPolicyDeny
+}
+
+// Check the advanced tier policy is one of allow, warn, or deny.
+func CheckTierPolicy(policy string) error {
+	switch policy {
+	case TierPolicyAllow, TierPolicyWarn, TierPolicyDeny:
+		return nil
+	}
+	return fmt.Errorf("advanced tier policy must be one of allow, warn, or deny: %s", policy)
+}
+
+// The parts of an SSM parameter policy needed to find the expiration time.
+//
+// See also: https://docs.aws.amazon.com/systems-manager/latest/userguide/parameter-store-policies.html
+//
+type parameterPolicy struct {
+	Type       string `json:"Type"`
+	Attributes struct {
+		Timestamp string `json:"Timestamp"`
+	} `json:"Attributes"`
 }
 
 //Parameterstore client with region
 type ParameterStoreClient struct {
-	IsFailover bool
-	Region     string
-	Client     ssmiface.SSMAPI
+	FailoverIndex int // Position of the region in the lookup regions (0 for the primary)
+	Region        string
+	Client        ssmiface.SSMAPI
 }
 
 // Get the secret from Parameter Store.
@@ -51,16 +105,20 @@ func (p *ParameterStoreProvider) GetSecretValues(
 	ctx context.Context,
 	descriptors []*SecretDescriptor,
 	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
 ) (v []*SecretValue, e error) {
 
 	// Fetch parameters in batches and build up the results in values
 	descLen := len(descriptors)
 	for i := 0; i < descLen; i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		end := min(i+batchSize, descLen) // Calculate slice end.
 		batchDescriptors := descriptors[i:end]
 
-		batchValues, batchErrors := p.fetchParameterStoreValue(ctx, batchDescriptors, curMap)
+		batchValues, batchErrors := p.fetchParameterStoreValue(ctx, batchDescriptors, curMap, opts)
 		if batchErrors != nil {
 			return nil, batchErrors
 		}
@@ -79,15 +137,26 @@ func (p *ParameterStoreProvider) fetchParameterStoreValue(
 	ctx context.Context,
 	batchDescriptors []*SecretDescriptor,
 	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
 ) (values []*SecretValue, err error) {
 
+	var names []string
+	for _, descriptor := range batchDescriptors {
+		names = append(names, descriptor.ObjectName)
+	}
+
+	var errs []error
 	for _, client := range p.clients {
+		if ctx.Err() != nil { // Don't try other regions once cancelled.
+			return nil, ctx.Err()
+		}
 		batchValues, err := p.fetchParameterStoreBatch(client, ctx, batchDescriptors, curMap)
 
-		if utils.IsFatalError(err) {
-			return nil, err
+		if isFatalError(opts, client.FailoverIndex > 0, err) {
+			return nil, utils.WithObject(SSMParameter.String(), strings.Join(names, ", "), client.Region, err)
 		} else if err != nil {
 			klog.Warning(err)
+			errs = append(errs, err)
 		}
 
 		if len(values) == 0 {
@@ -95,7 +164,8 @@ func (p *ParameterStoreProvider) fetchParameterStoreValue(
 		}
 	}
 	if values == nil {
-		return nil, fmt.Errorf("Failed to fetch parameters from all regions.")
+		err = fmt.Errorf("Failed to fetch parameters from all regions: %w", utils.JoinRegionErrors(errs))
+		return nil, utils.WithObject(SSMParameter.String(), strings.Join(names, ", "), "", err)
 	}
 
 	return values, nil
@@ -106,6 +176,8 @@ func (p *ParameterStoreProvider) fetchParameterStoreValue(
 // This method builds batch of parameters and fetches the values.
 // if any parameter is failed to fetch, the parameter is returned as invalid parameter
 // and the version information is updated in the current version map.
+// Parameters mounted without decryption are fetched in a separate request
+// since WithDecryption applies to the whole GetParameters call.
 //
 func (p *ParameterStoreProvider) fetchParameterStoreBatch(
 	client ParameterStoreClient,
@@ -114,76 +186,365 @@ func (p *ParameterStoreProvider) fetchParameterStoreBatch(
 	curMap map[string]*v1alpha1.ObjectVersion,
 ) (v []*SecretValue, err error) {
 
-	var values []*SecretValue
+	// Check the tier and expiration first, so parameters the tier policy
+	// denies are never fetched.
+	var meta map[string]*ssm.ParameterMetadata
+	if p.expiryWarning > 0 || p.checksTier() {
+		if meta, err = p.describeParameters(ctx, client, batchDescriptors); err != nil {
+			return nil, err
+		}
+	}
 
-	// Build up the batch of parameter names.
-	var names []*string
-	batchDesc := make(map[string]*SecretDescriptor)
+	// Read back parameters not modified since they were mounted (if enabled).
+	values, batchDescriptors := reloadUnmodifiedParameters(ctx, client, batchDescriptors, curMap)
+	labelValues, batchDescriptors := reloadUnmovedLabels(ctx, client, batchDescriptors, curMap)
+	values = append(values, labelValues...)
+
+	// Build up the batch of parameter names (split by decryption).
+	names := make(map[bool][]*string)
+	batchDesc := make(map[bool]map[string]*SecretDescriptor)
 	for _, descriptor := range batchDescriptors {
 
 		// Use either version or label if specified (but not both)
-		parameterName := descriptor.GetSecretName(client.IsFailover)
-		if len(descriptor.GetObjectVersion(client.IsFailover)) != 0 {
-			parameterName = fmt.Sprintf("%s:%s", parameterName, descriptor.GetObjectVersion(client.IsFailover))
-		} else if len(descriptor.GetObjectVersionLabel(client.IsFailover)) != 0 {
-			parameterName = fmt.Sprintf("%s:%s", parameterName, descriptor.GetObjectVersionLabel(client.IsFailover))
+		parameterName := descriptor.GetSecretName(client.FailoverIndex)
+		if len(descriptor.GetObjectVersion(client.FailoverIndex)) != 0 {
+			parameterName = fmt.Sprintf("%s:%s", parameterName, descriptor.GetObjectVersion(client.FailoverIndex))
+		} else if len(descriptor.GetObjectVersionLabel(client.FailoverIndex)) != 0 {
+			parameterName = fmt.Sprintf("%s:%s", parameterName, descriptor.GetObjectVersionLabel(client.FailoverIndex))
 		}
 
-		names = append(names, aws.String(parameterName))
-		batchDesc[descriptor.GetSecretName(client.IsFailover)] = descriptor // Needed for response
+		// Parameters named by ARN (such as shared parameters) are fetched one at a time.
+		if isParameterARN(descriptor.GetSecretName(client.FailoverIndex)) {
+			sharedValues, err := p.fetchSharedParameter(ctx, client, descriptor, parameterName, curMap)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, sharedValues...)
+			continue
+		}
+
+		decrypt := descriptor.GetWithDecryption()
+		if batchDesc[decrypt] == nil {
+			batchDesc[decrypt] = make(map[string]*SecretDescriptor)
+		}
+		names[decrypt] = append(names[decrypt], aws.String(parameterName))
+		batchDesc[decrypt][descriptor.GetSecretName(client.FailoverIndex)] = descriptor // Needed for response
 	}
 
-	// Fetch the batch of secrets
+	for _, decrypt := range []bool{true, false} {
+		if len(names[decrypt]) == 0 {
+			continue
+		}
+		parmValues, err := fetchParameters(ctx, client, names[decrypt], decrypt, batchDesc[decrypt], curMap)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, parmValues...)
+	}
+
+	p.markParameters(client, values, meta)
+	return values, nil
+}
+
+// Private helper to fetch parameters by name with a single GetParameters call.
+//
+// The descriptors of the parameters are looked up by name in batchDesc to
+// build the results.
+//
+func fetchParameters(
+	ctx context.Context,
+	client ParameterStoreClient,
+	names []*string,
+	decrypt bool,
+	batchDesc map[string]*SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) (values []*SecretValue, err error) {
+
+	// Fetch the batch of secrets, keeping the request ID for error reporting.
+	var requestID string
+	utils.ObserveBatchSize(len(names))
+	start := time.Now()
 	rsp, err := client.Client.GetParametersWithContext(ctx, &ssm.GetParametersInput{
 		Names:          names,
-		WithDecryption: aws.Bool(true),
-	})
+		WithDecryption: aws.Bool(decrypt),
+	}, request.WithGetResponseHeader(requestIDHeader, &requestID))
+	utils.ObserveAPICall(SSMParameter.String(), "GetParameters", client.Region, time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("%s: Failed fetching parameters: %w", client.Region, err)
+		utils.RecordFetchError(SSMParameter.String(), client.Region, "", err)
+		return nil, utils.WithRequestContext(client.Region, requestID, fmt.Errorf("Failed fetching parameters: %w", err))
 	}
 
 	if len(rsp.InvalidParameters) != 0 {
-		err = awserr.NewRequestFailure(awserr.New("", fmt.Sprintf("%s: Invalid parameters: %s", client.Region, strings.Join(aws.StringValueSlice(rsp.InvalidParameters), ", ")), err), 400, "")
-		return nil, err
+		err = awserr.NewRequestFailure(awserr.New("", fmt.Sprintf("%s: Invalid parameters: %s", client.Region, strings.Join(aws.StringValueSlice(rsp.InvalidParameters), ", ")), err), 400, requestID)
+		utils.RecordFetchError(SSMParameter.String(), client.Region, "InvalidParameters", err)
+		return nil, utils.WithCategory(utils.ErrorNotFound, err)
 	}
 
 	// Build up the results from the batch
 	for _, parm := range rsp.Parameters {
 
-		descriptor := batchDesc[*(parm.Name)]
-
-		secretValue := &SecretValue{
-			Value:      []byte(*(parm.Value)),
-			Descriptor: *descriptor,
+		parmValues, err := parameterValues(client, parm, batchDesc[*(parm.Name)], curMap)
+		if err != nil {
+			return nil, err
 		}
-		values = append(values, secretValue)
+		values = append(values, parmValues...)
+	}
 
-		//Fetch individual json key value pairs if jmesPath is specified
-		jsonSecrets, jsonErr := secretValue.getJsonSecrets()
-		if jsonErr != nil {
-			return nil, fmt.Errorf("%s: %s", client.Region, jsonErr)
-		}
+	setLatency(values, time.Since(start))
+	return values, nil
+}
 
-		values = append(values, jsonSecrets...)
+// Private helper to fetch a single parameter named by ARN.
+//
+// Parameters shared from other accounts through AWS RAM can only be accessed
+// by their full ARN, which GetParameters does not accept in a batch of names,
+// so these are fetched using GetParameter. Access errors are reported with the
+// requirements for sharing since they are usually caused by a missing share or
+// KMS key policy rather than the pod's role.
+//
+func (p *ParameterStoreProvider) fetchSharedParameter(
+	ctx context.Context,
+	client ParameterStoreClient,
+	descriptor *SecretDescriptor,
+	parameterName string,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) (v []*SecretValue, err error) {
 
-		// Update the version in the current version map.
-		for _, jsonSecret := range jsonSecrets {
-			jsonDescriptor := jsonSecret.Descriptor
-			curMap[jsonDescriptor.GetFileName()] = &v1alpha1.ObjectVersion{
-				Id:      jsonDescriptor.GetFileName(),
-				Version: strconv.Itoa(int(*(parm.Version))),
-			}
+	var requestID string
+	start := time.Now()
+	rsp, err := client.Client.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(parameterName),
+		WithDecryption: aws.Bool(descriptor.GetWithDecryption()),
+	}, request.WithGetResponseHeader(requestIDHeader, &requestID))
+	utils.ObserveAPICall(SSMParameter.String(), "GetParameter", client.Region, time.Since(start))
+	if err != nil {
+		utils.RecordFetchError(SSMParameter.String(), client.Region, "", err)
+		switch utils.GetErrorCode(err) {
+		case "AccessDeniedException", ssm.ErrCodeParameterNotFound, "AccessDenied":
+			err = fmt.Errorf("Failed fetching shared parameter %s (the parameter must be an advanced parameter shared "+
+				"with this account through AWS RAM, and SecureString parameters must use a customer managed KMS key the "+
+				"role can decrypt): %w", parameterName, err)
+		default:
+			err = fmt.Errorf("Failed fetching parameter %s: %w", parameterName, err)
 		}
+		return nil, utils.WithRequestContext(client.Region, requestID, err)
+	}
 
-		curMap[descriptor.GetFileName()] = &v1alpha1.ObjectVersion{
-			Id:      descriptor.GetFileName(),
+	values, err := parameterValues(client, rsp.Parameter, descriptor, curMap)
+	setLatency(values, time.Since(start))
+	return values, err
+}
+
+// Private helper to build the secret values of a fetched parameter.
+//
+// This method decodes the parameter, extracts any jmesPath entries, and
+// updates the version information in the current version map.
+//
+func parameterValues(
+	client ParameterStoreClient,
+	parm *ssm.Parameter,
+	descriptor *SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+) (v []*SecretValue, err error) {
+
+	if descriptor == nil { // Should never happen
+		return nil, fmt.Errorf("%s: Unexpected parameter in response: %s", client.Region, aws.StringValue(parm.Name))
+	}
+
+	secretValue := &SecretValue{
+		Value:         []byte(*(parm.Value)),
+		Descriptor:    *descriptor,
+		IsFailover:    client.FailoverIndex > 0,
+		FailoverIndex: client.FailoverIndex,
+		Version:       strconv.Itoa(int(*(parm.Version))),
+		ARN:           aws.StringValue(parm.ARN),
+	}
+	if err := secretValue.decode(); err != nil {
+		return nil, fmt.Errorf("%s: %w", client.Region, err)
+	}
+	secretValue.trim()
+	secretValue.listToLines()
+	values := []*SecretValue{secretValue}
+
+	// Large values are logged at V(4) since they are fetched on every
+	// rotation. The tier is only known when the parameters were described
+	// (see markParameters).
+	if size := len(*parm.Value); size > standardTierMaxSize {
+		klog.V(4).Infof("%s: Parameter %s is %d bytes", client.Region, aws.StringValue(parm.Name), size)
+	}
+
+	//Fetch individual json key value pairs if jmesPath is specified
+	jsonSecrets, jsonErr := secretValue.getJsonSecrets()
+	if jsonErr != nil {
+		return nil, fmt.Errorf("%s: %s", client.Region, jsonErr)
+	}
+
+	values = append(values, jsonSecrets...)
+
+	// Update the version in the current version map.
+	for _, jsonSecret := range jsonSecrets {
+		jsonDescriptor := jsonSecret.Descriptor
+		curMap[jsonDescriptor.GetFileName()] = &v1alpha1.ObjectVersion{
+			Id:      jsonDescriptor.GetFileName(),
 			Version: strconv.Itoa(int(*(parm.Version))),
 		}
 	}
 
+	curMap[descriptor.GetFileName()] = &v1alpha1.ObjectVersion{
+		Id:      descriptor.GetFileName(),
+		Version: strconv.Itoa(int(*(parm.Version))),
+	}
 	return values, nil
 }
 
+// Private helper to tell if a parameter is named by ARN.
+func isParameterARN(name string) bool {
+	return strings.HasPrefix(name, "arn:")
+}
+
+// Returns the names to look a parameter up by in a DescribeParameters Name
+// filter, and for parameters named by ARN the ARN (as given in the metadata of
+// the parameter).
+//
+// Any :version or :label selector is dropped. Since the ARN of a parameter
+// does not tell /name from name, both names are returned for ARNs.
+//
+func ParameterNames(objectName string) (names []string, parameterARN string) {
+
+	if !isParameterARN(objectName) {
+		name, _, _ := strings.Cut(objectName, ":")
+		return []string{name}, ""
+	}
+
+	objARN, err := arn.Parse(objectName)
+	if err != nil {
+		return []string{objectName}, ""
+	}
+	objARN.Resource, _, _ = strings.Cut(objARN.Resource, ":")
+	name := strings.TrimPrefix(objARN.Resource, "parameter/")
+	return []string{name, "/" + name}, objARN.String()
+}
+
+// Private helper to check the expiration and tier of parameters before they
+// are fetched.
+//
+// Advanced parameters may have an Expiration policy after which the parameter
+// is deleted. This method looks up the metadata of the parameters, keyed by
+// file name, so the fetched values can be marked (see markParameters). When
+// the tier policy is deny, the mount fails before any advanced tier parameter
+// is fetched (and charged).
+//
+// Parameters named by ARN are looked up by the name in the ARN and matched on
+// the ARN. Those not found in the account are shared with it from another
+// account, which is only possible in the advanced tier. Failures are only
+// logged, unless the tier policy is deny, in which case the mount fails since
+// the tier can not be checked.
+//
+func (p *ParameterStoreProvider) describeParameters(
+	ctx context.Context,
+	client ParameterStoreClient,
+	descriptors []*SecretDescriptor,
+) (map[string]*ssm.ParameterMetadata, error) {
+
+	byName := make(map[string]*SecretDescriptor)
+	byARN := make(map[string]*SecretDescriptor)
+	var names []*string
+	for _, descriptor := range descriptors {
+		lookupNames, parameterARN := ParameterNames(descriptor.GetSecretName(client.FailoverIndex))
+		if len(parameterARN) > 0 {
+			byARN[parameterARN] = descriptor
+		} else {
+			byName[lookupNames[0]] = descriptor
+		}
+		names = append(names, aws.StringSlice(lookupNames)...)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	params, err := describeParameters(ctx, client, names)
+	if err != nil {
+		if p.tierPolicy == TierPolicyDeny {
+			utils.RecordFetchError(SSMParameter.String(), client.Region, "", err)
+			return nil, utils.WithRequestContext(client.Region, "", fmt.Errorf("Failed to describe parameters to check their tier: %w", err))
+		}
+		utils.Warningf("%s: Failed to describe parameters to check expiration and tier: %v", client.Region, err)
+		return nil, nil
+	}
+
+	meta := make(map[string]*ssm.ParameterMetadata)
+	for _, param := range params {
+		descriptor := byName[aws.StringValue(param.Name)]
+		if descriptor == nil {
+			descriptor = byARN[aws.StringValue(param.ARN)]
+		}
+		if descriptor != nil {
+			meta[descriptor.GetFileName()] = param
+		}
+	}
+	for parameterARN, descriptor := range byARN {
+		if meta[descriptor.GetFileName()] == nil { // Shared from another account
+			meta[descriptor.GetFileName()] = &ssm.ParameterMetadata{ARN: aws.String(parameterARN), Tier: aws.String(ssm.ParameterTierAdvanced)}
+		}
+	}
+
+	if p.tierPolicy != TierPolicyDeny {
+		return meta, nil
+	}
+	for _, descriptor := range descriptors {
+		if param := meta[descriptor.GetFileName()]; param != nil && aws.StringValue(param.Tier) == ssm.ParameterTierAdvanced {
+			name := descriptor.GetSecretName(client.FailoverIndex)
+			err := awserr.NewRequestFailure(awserr.New("AdvancedTierDenied",
+				fmt.Sprintf("parameter %s uses the advanced tier, which the provider does not allow", name), nil), 403, "")
+			return nil, utils.WithCategory(utils.ErrorAccessDenied, utils.WithRequestContext(client.Region, "", err))
+		}
+	}
+	return meta, nil
+}
+
+// Private helper to mark the fetched parameters that use the advanced tier
+// (when the tier policy is warn or deny) or expire within the warning window,
+// using the metadata from describeParameters.
+//
+// Expiring parameters are logged and counted so pods do not fail by surprise
+// when the parameter is deleted. Advanced tier parameters are reported by the
+// server.
+//
+func (p *ParameterStoreProvider) markParameters(client ParameterStoreClient, values []*SecretValue, meta map[string]*ssm.ParameterMetadata) {
+
+	for _, value := range values {
+		param := meta[value.Descriptor.GetFileName()]
+		if param == nil || len(value.Descriptor.ObjectName) == 0 { // Skip jmesPath values
+			continue
+		}
+		if p.checksTier() && aws.StringValue(param.Tier) == ssm.ParameterTierAdvanced {
+			value.AdvancedTier = true
+		}
+		if len(value.Value) > standardTierMaxSize {
+			klog.V(4).Infof("%s: Parameter %s is in the %s tier", client.Region, aws.StringValue(param.Name), aws.StringValue(param.Tier))
+		}
+		if p.expiryWarning <= 0 {
+			continue
+		}
+		for _, inline := range param.Policies {
+			var policy parameterPolicy
+			if err := json.Unmarshal([]byte(aws.StringValue(inline.PolicyText)), &policy); err != nil || policy.Type != "Expiration" {
+				continue
+			}
+			expiration, err := time.Parse(time.RFC3339, policy.Attributes.Timestamp)
+			if err != nil {
+				klog.Warningf("%s: Invalid expiration for parameter %s: %s", client.Region, aws.StringValue(param.Name), policy.Attributes.Timestamp)
+				continue
+			}
+			if time.Until(expiration) <= p.expiryWarning {
+				utils.Warningf("%s: Parameter %s expires at %s", client.Region, aws.StringValue(param.Name), expiration.Format(time.RFC3339))
+				utils.RecordParameterExpiring(client.Region)
+				value.Expiration = expiration
+			}
+		}
+	}
+}
+
 // Factory methods to build a new ParameterStoreProvider
 //
 func NewParameterStoreProviderWithClients(clients ...ParameterStoreClient) *ParameterStoreProvider {
@@ -195,10 +556,11 @@ func NewParameterStoreProviderWithClients(clients ...ParameterStoreClient) *Para
 func NewParameterStoreProvider(awsSessions []*session.Session, regions []string) *ParameterStoreProvider {
 	var parameterStoreClients []ParameterStoreClient
 	for i, awsSession := range awsSessions {
+		config := clientConfig(awsSession, utils.SSMService, ssm.EndpointsID, regions[i])
 		client := ParameterStoreClient{
-			Region:     *awsSession.Config.Region,
-			Client:     ssm.New(awsSession, aws.NewConfig().WithRegion(regions[i])),
-			IsFailover: i > 0,
+			Region:        regions[i],
+			Client:        ssm.New(awsSession, config),
+			FailoverIndex: i,
 		}
 		parameterStoreClients = append(parameterStoreClients, client)
 	}
@@ -212,3 +574,36 @@ func min(i, j int) int {
 	}
 	return i
 }
+
+// Private helper to describe parameters by name.
+//
+// SSM allows at most 50 names in a Name filter and returns at most 50
+// parameters a page, so the names are described in groups of 50 and every
+// page of each group is read. Any failure fails the whole call.
+//
+func describeParameters(ctx context.Context, client ParameterStoreClient, names []*string) ([]*ssm.ParameterMetadata, error) {
+
+	var params []*ssm.ParameterMetadata
+	for i := 0; i < len(names); i += describeBatchSize {
+		input := &ssm.DescribeParametersInput{
+			ParameterFilters: []*ssm.ParameterStringFilter{
+				{Key: aws.String("Name"), Option: aws.String("Equals"), Values: names[i:min(i+describeBatchSize, len(names))]},
+			},
+			MaxResults: aws.Int64(describeBatchSize),
+		}
+		for {
+			start := time.Now()
+			rsp, err := client.Client.DescribeParametersWithContext(ctx, input)
+			utils.ObserveAPICall(SSMParameter.String(), "DescribeParameters", client.Region, time.Since(start))
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, rsp.Parameters...)
+			if len(aws.StringValue(rsp.NextToken)) == 0 {
+				break
+			}
+			input.NextToken = rsp.NextToken
+		}
+	}
+	return params, nil
+}
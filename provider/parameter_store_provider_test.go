@@ -0,0 +1,400 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+type mockSSM struct {
+	ssmiface.SSMAPI
+	params    []*ssm.Parameter
+	meta      []*ssm.ParameterMetadata
+	descErr   error
+	descCnt   int
+	descName  []string
+	descPage  int // Parameters returned by each DescribeParameters page (0 for all)
+	getCnt    int
+	shared    map[string]*ssm.Parameter // Parameters returned by GetParameter
+	encrypted []*ssm.Parameter          // Parameters returned by GetParameters without decryption
+	decrypts  []bool                    // WithDecryption of each GetParameters call
+}
+
+func (m *mockSSM) GetParametersWithContext(
+	ctx context.Context, input *ssm.GetParametersInput, options ...request.Option,
+) (*ssm.GetParametersOutput, error) {
+	m.getCnt++
+	m.decrypts = append(m.decrypts, aws.BoolValue(input.WithDecryption))
+	if !aws.BoolValue(input.WithDecryption) {
+		return &ssm.GetParametersOutput{Parameters: m.encrypted}, nil
+	}
+	return &ssm.GetParametersOutput{Parameters: m.params}, nil
+}
+
+func (m *mockSSM) GetParameterWithContext(
+	ctx context.Context, input *ssm.GetParameterInput, options ...request.Option,
+) (*ssm.GetParameterOutput, error) {
+	parm, ok := m.shared[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New("AccessDeniedException", "not authorized", nil), 400, "")
+	}
+	return &ssm.GetParameterOutput{Parameter: parm}, nil
+}
+
+func (m *mockSSM) DescribeParametersWithContext(
+	ctx context.Context, input *ssm.DescribeParametersInput, options ...request.Option,
+) (*ssm.DescribeParametersOutput, error) {
+	m.descCnt++
+	names := aws.StringValueSlice(input.ParameterFilters[0].Values)
+	m.descName = append(m.descName, names...)
+	if m.descErr != nil {
+		return nil, m.descErr
+	}
+	if len(names) > 50 || aws.Int64Value(input.MaxResults) > 50 {
+		return nil, fmt.Errorf("ValidationException")
+	}
+
+	var matched []*ssm.ParameterMetadata
+	for _, meta := range m.meta {
+		for _, name := range names {
+			if aws.StringValue(meta.Name) == name {
+				matched = append(matched, meta)
+			}
+		}
+	}
+	start, _ := strconv.Atoi(aws.StringValue(input.NextToken))
+	if m.descPage == 0 || start+m.descPage >= len(matched) {
+		return &ssm.DescribeParametersOutput{Parameters: matched[start:]}, nil
+	}
+	return &ssm.DescribeParametersOutput{
+		Parameters: matched[start : start+m.descPage],
+		NextToken:  aws.String(strconv.Itoa(start + m.descPage)),
+	}, nil
+}
+
+// Make sure parameters are described 50 at a time and every page is read.
+func TestDescribeParametersPages(t *testing.T) {
+
+	client := &mockSSM{descPage: 20}
+	var names []*string
+	for i := 0; i < 120; i++ {
+		name := fmt.Sprintf("Parm%d", i)
+		names = append(names, aws.String(name))
+		client.meta = append(client.meta, &ssm.ParameterMetadata{Name: aws.String(name)})
+	}
+
+	params, err := describeParameters(context.Background(), ParameterStoreClient{Region: "us-west-2", Client: client}, names)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(params) != 120 || aws.StringValue(params[119].Name) != "Parm119" {
+		t.Fatalf("Expected all 120 parameters, got %d", len(params))
+	}
+	if client.descCnt != 7 { // 3 pages for each of the first 2 groups of 50, and 1 for the last 20
+		t.Fatalf("Expected 7 DescribeParameters calls, got %d", client.descCnt)
+	}
+}
+
+func expirationPolicy(expiration time.Time) *ssm.ParameterInlinePolicy {
+	return &ssm.ParameterInlinePolicy{
+		PolicyType: aws.String("Expiration"),
+		PolicyText: aws.String(fmt.Sprintf(`{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"%s"}}`,
+			expiration.UTC().Format("2006-01-02T15:04:05.000Z"))),
+	}
+}
+
+func TestParameterExpiryWarning(t *testing.T) {
+
+	soon := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	client := &mockSSM{
+		params: []*ssm.Parameter{
+			{Name: aws.String("Parm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+			{Name: aws.String("Parm2"), Value: aws.String("parm2"), Version: aws.Int64(1)},
+		},
+		meta: []*ssm.ParameterMetadata{
+			{Name: aws.String("Parm1"), Policies: []*ssm.ParameterInlinePolicy{expirationPolicy(soon)}},
+			{Name: aws.String("Parm2"), Policies: []*ssm.ParameterInlinePolicy{expirationPolicy(time.Now().Add(30 * 24 * time.Hour))}},
+		},
+	}
+
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "Parm1", ObjectType: "ssmparameter"},
+		{ObjectName: "Parm2", ObjectType: "ssmparameter"},
+	}
+
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+	prov.expiryWarning = 24 * time.Hour
+
+	values, err := prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.descCnt != 1 || len(client.descName) != 2 {
+		t.Fatalf("Expected one DescribeParameters call for 2 names, got %d calls for %v", client.descCnt, client.descName)
+	}
+	if !values[0].Expiration.Equal(soon) {
+		t.Fatalf("Expected expiration %s, got %s", soon, values[0].Expiration)
+	}
+	if !values[1].Expiration.IsZero() {
+		t.Fatalf("Expected no expiration, got %s", values[1].Expiration)
+	}
+}
+
+func TestParameterExpiryWarningErrorsIgnored(t *testing.T) {
+
+	client := &mockSSM{
+		params:  []*ssm.Parameter{{Name: aws.String("Parm1"), Value: aws.String("parm1"), Version: aws.Int64(1)}},
+		descErr: fmt.Errorf("AccessDeniedException"),
+	}
+
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+	prov.expiryWarning = 24 * time.Hour
+
+	values, err := prov.GetSecretValues(context.Background(),
+		[]*SecretDescriptor{{ObjectName: "Parm1", ObjectType: "ssmparameter"}}, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 1 || !values[0].Expiration.IsZero() {
+		t.Fatalf("Unexpected values: %v", values)
+	}
+}
+
+func TestParameterExpiryWarningDisabled(t *testing.T) {
+
+	client := &mockSSM{
+		params: []*ssm.Parameter{{Name: aws.String("Parm1"), Value: aws.String("parm1"), Version: aws.Int64(1)}},
+	}
+
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+	_, err := prov.GetSecretValues(context.Background(),
+		[]*SecretDescriptor{{ObjectName: "Parm1", ObjectType: "ssmparameter"}}, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.descCnt != 0 {
+		t.Fatalf("Expected no DescribeParameters calls, got %d", client.descCnt)
+	}
+}
+
+func TestParameterAdvancedTier(t *testing.T) {
+
+	client := &mockSSM{
+		params: []*ssm.Parameter{
+			{Name: aws.String("Parm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+			{Name: aws.String("Parm2"), Value: aws.String("parm2"), Version: aws.Int64(1)},
+		},
+		meta: []*ssm.ParameterMetadata{
+			{Name: aws.String("Parm1"), Tier: aws.String(ssm.ParameterTierStandard)},
+			{Name: aws.String("Parm2"), Tier: aws.String(ssm.ParameterTierAdvanced)},
+		},
+	}
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "Parm1", ObjectType: "ssmparameter"},
+		{ObjectName: "Parm2", ObjectType: "ssmparameter"},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	prov.tierPolicy = TierPolicyWarn
+	values, err := prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values[0].AdvancedTier || !values[1].AdvancedTier {
+		t.Fatalf("Expected only Parm2 to be marked advanced")
+	}
+
+	// Denied before anything is fetched.
+	prov.tierPolicy = TierPolicyDeny
+	client.getCnt = 0
+	_, err = prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "parameter Parm2 uses the advanced tier") || client.getCnt != 0 {
+		t.Fatalf("Unexpected error %v after %d GetParameters calls", err, client.getCnt)
+	}
+	if utils.ErrorCategory(err) != utils.ErrorAccessDenied {
+		t.Fatalf("Unexpected category: %s", utils.ErrorCategory(err))
+	}
+
+	// The tier must be known to deny it.
+	client.descErr = fmt.Errorf("AccessDeniedException")
+	_, err = prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "Failed to describe parameters to check their tier") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Allowed without describing the parameters.
+	prov.tierPolicy = TierPolicyAllow
+	client.descCnt = 0
+	if _, err = prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{}); err != nil || client.descCnt != 0 {
+		t.Fatalf("Unexpected error %v or DescribeParameters calls %d", err, client.descCnt)
+	}
+}
+
+// Make sure parameters named by ARN are checked by the name in the ARN, and
+// those shared from other accounts count as advanced tier parameters.
+func TestParameterAdvancedTierARN(t *testing.T) {
+
+	ownARN := "arn:aws:ssm:us-west-2:123456789012:parameter/app/db"
+	sharedARN := "arn:aws:ssm:us-west-2:111122223333:parameter/shared/db"
+	client := &mockSSM{
+		meta: []*ssm.ParameterMetadata{
+			{Name: aws.String("/app/db"), ARN: aws.String(ownARN), Tier: aws.String(ssm.ParameterTierStandard)},
+		},
+		shared: map[string]*ssm.Parameter{
+			ownARN:    {Name: aws.String(ownARN), ARN: aws.String(ownARN), Value: aws.String("db"), Version: aws.Int64(1)},
+			sharedARN: {Name: aws.String(sharedARN), ARN: aws.String(sharedARN), Value: aws.String("shared"), Version: aws.Int64(1)},
+		},
+	}
+	descriptors := []*SecretDescriptor{
+		{ObjectName: ownARN, ObjectType: "ssmparameter", ObjectAlias: "db"},
+		{ObjectName: sharedARN, ObjectType: "ssmparameter", ObjectAlias: "shared"},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	prov.tierPolicy = TierPolicyWarn
+	values, err := prov.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values[0].AdvancedTier || !values[1].AdvancedTier {
+		t.Fatalf("Expected only the shared parameter to be marked advanced")
+	}
+	if strings.Join(client.descName, ",") != "app/db,/app/db,shared/db,/shared/db" {
+		t.Fatalf("Unexpected names described: %v", client.descName)
+	}
+
+	prov.tierPolicy = TierPolicyDeny
+	_, err = prov.GetSecretValues(context.Background(), descriptors[1:], map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "parameter "+sharedARN+" uses the advanced tier") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckTierPolicy(t *testing.T) {
+
+	for _, policy := range []string{TierPolicyAllow, TierPolicyWarn, TierPolicyDeny} {
+		if err := CheckTierPolicy(policy); err != nil {
+			t.Errorf("Unexpected error for %s: %v", policy, err)
+		}
+	}
+	if err := CheckTierPolicy("block"); err == nil {
+		t.Errorf("Expected error for block")
+	}
+}
+
+// Make sure moving a label to another version is picked up on the next fetch.
+func TestParameterLabelMove(t *testing.T) {
+
+	client := &mockSSM{
+		params: []*ssm.Parameter{
+			{Name: aws.String("Parm1"), Value: aws.String("v1"), Version: aws.Int64(1), Selector: aws.String(":prod")},
+		},
+	}
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "Parm1", ObjectType: "ssmparameter", ObjectVersionLabel: "prod"},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	curMap := map[string]*v1alpha1.ObjectVersion{}
+	if _, err := prov.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if curMap["Parm1"].Version != "1" {
+		t.Fatalf("Expected version 1, got %s", curMap["Parm1"].Version)
+	}
+
+	// Move the label.
+	client.params = []*ssm.Parameter{
+		{Name: aws.String("Parm1"), Value: aws.String("v2"), Version: aws.Int64(2), Selector: aws.String(":prod")},
+	}
+	values, err := prov.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if curMap["Parm1"].Version != "2" || string(values[0].Value) != "v2" {
+		t.Fatalf("Label move not picked up: version %s value %s", curMap["Parm1"].Version, string(values[0].Value))
+	}
+}
+
+// Make sure parameters named by ARN (shared parameters) use GetParameter.
+func TestSharedParameter(t *testing.T) {
+
+	sharedARN := "arn:aws:ssm:us-west-2:111122223333:parameter/shared/Parm2"
+	client := &mockSSM{
+		params: []*ssm.Parameter{{Name: aws.String("Parm1"), Value: aws.String("parm1"), Version: aws.Int64(1)}},
+		shared: map[string]*ssm.Parameter{
+			sharedARN + ":prod": {Name: aws.String(sharedARN), Value: aws.String("parm2"), Version: aws.Int64(3)},
+		},
+	}
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "Parm1", ObjectType: "ssmparameter"},
+		{ObjectName: sharedARN, ObjectAlias: "Parm2", ObjectVersionLabel: "prod"},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	curMap := map[string]*v1alpha1.ObjectVersion{}
+	values, err := prov.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 2 || client.getCnt != 1 || string(values[0].Value) != "parm2" || curMap["Parm2"].Version != "3" {
+		t.Fatalf("Unexpected values: %v %v", values, curMap)
+	}
+
+	// Batches of only shared parameters skip the GetParameters call.
+	client.getCnt = 0
+	if _, err = prov.GetSecretValues(context.Background(), descriptors[1:], curMap, FetchOptions{}); err != nil || client.getCnt != 0 {
+		t.Fatalf("Unexpected batch call: %d %v", client.getCnt, err)
+	}
+
+	// Access errors explain the sharing requirements.
+	delete(client.shared, sharedARN+":prod")
+	_, err = prov.GetSecretValues(context.Background(), descriptors[1:], curMap, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "shared with this account through AWS RAM") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestWithDecryption(t *testing.T) {
+
+	client := &mockSSM{
+		params:    []*ssm.Parameter{{Name: aws.String("Parm1"), Value: aws.String("plain"), Version: aws.Int64(1)}},
+		encrypted: []*ssm.Parameter{{Name: aws.String("Parm2"), Value: aws.String("AQICAHh..."), Version: aws.Int64(2)}},
+	}
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "Parm1", ObjectType: "ssmparameter"},
+		{ObjectName: "Parm2", ObjectType: "ssmparameter", WithDecryption: aws.Bool(false)},
+	}
+	prov := NewParameterStoreProviderWithClients(ParameterStoreClient{Region: "us-west-2", Client: client})
+
+	curMap := map[string]*v1alpha1.ObjectVersion{}
+	values, err := prov.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.decrypts) != 2 || !client.decrypts[0] || client.decrypts[1] {
+		t.Fatalf("Wrong GetParameters calls: %v", client.decrypts)
+	}
+	if len(values) != 2 || string(values[1].Value) != "AQICAHh..." || curMap["Parm2"].Version != "2" {
+		t.Fatalf("Unexpected values: %v %v", values, curMap)
+	}
+
+	// Without mixed descriptors a single call is made.
+	client.decrypts = nil
+	if _, err = prov.GetSecretValues(context.Background(), descriptors[:1], curMap, FetchOptions{}); err != nil || len(client.decrypts) != 1 {
+		t.Fatalf("Unexpected calls: %v %v", client.decrypts, err)
+	}
+}
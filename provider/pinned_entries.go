@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Private helper to tell if a jmesPath entry reads its path from a version of
+// the secret other than the version of the object.
+func (j *JMESPathEntry) isPinned() bool {
+	return len(j.ObjectVersion) != 0 || len(j.ObjectVersionLabel) != 0
+}
+
+// Private helper to tell if only jmesPath entries pinned to other versions are
+// written, so nothing is read from the version of the object itself.
+func (p *SecretDescriptor) onlyPinnedEntries() bool {
+
+	if p.GetWriteParent() || p.ObjectExplode || p.splitsIntoFiles() || p.ChunkSize > 0 || len(p.JMESPath) == 0 {
+		return false
+	}
+	for i := range p.JMESPath {
+		if !p.JMESPath[i].isPinned() {
+			return false
+		}
+	}
+	return true
+}
+
+// Private helper to return a copy of a descriptor that fetches the given
+// version (or staging label) of the secret and only extracts the given
+// jmesPath entries.
+//
+// The version applies in every region, so any version given for the failover
+// objects is dropped. Replicated secrets keep their version ids and labels.
+//
+func (p *SecretDescriptor) pinnedTo(version, label string, entries []JMESPathEntry) SecretDescriptor {
+
+	pinned := *p
+	pinned.ObjectVersion = version
+	pinned.ObjectVersionLabel = label
+	pinned.ObjectExplode = false
+	pinned.JMESPath = nil
+	for _, entry := range entries {
+		entry.ObjectVersion, entry.ObjectVersionLabel = "", ""
+		pinned.JMESPath = append(pinned.JMESPath, entry)
+	}
+	pinned.FailoverObject = nil
+	for _, entry := range p.FailoverObject {
+		pinned.FailoverObject = append(pinned.FailoverObject, FailoverObjectEntry{ObjectName: entry.ObjectName})
+	}
+	return pinned
+}
+
+// Private helper to fetch the jmesPath entries of a secret that are pinned to
+// their own version or staging label.
+//
+// During a staged credential rollover one file can track AWSCURRENT while
+// another tracks AWSPREVIOUS. Entries pinned to the same version share one
+// GetSecretValue call. Entries pinned to a version id that are already mounted
+// are read back from the mount since versions never change. Labels move, so
+// mounted entries pinned to a label are resolved to the version the label is
+// on using the staging labels from DescribeSecret (the stages isCurrent
+// already described, or described here when nil), and are only fetched again
+// when the label has moved.
+//
+func (p *SecretsManagerProvider) fetchPinnedEntries(
+	ctx context.Context,
+	client SecretsManagerClient,
+	descriptor *SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+	stages map[string][]*string,
+) (values []*SecretValue, e error) {
+
+	type pin struct{ version, label string }
+	var pins []pin
+	groups := make(map[pin][]JMESPathEntry)
+	for _, entry := range descriptor.JMESPath {
+		if !entry.isPinned() {
+			continue
+		}
+		key := pin{entry.ObjectVersion, entry.ObjectVersionLabel}
+		if groups[key] == nil {
+			pins = append(pins, key)
+		}
+		groups[key] = append(groups[key], entry)
+	}
+
+	for _, key := range pins {
+		pinned := descriptor.pinnedTo(key.version, key.label, groups[key])
+
+		version := key.version
+		if len(version) == 0 && isMounted(&pinned, curMap) {
+			if stages == nil {
+				var err error
+				if stages, err = p.describeStages(ctx, client, descriptor); err != nil {
+					return nil, err
+				}
+			}
+			version = versionWithStage(stages, key.label)
+		}
+		if reloaded := reloadPinnedEntries(&pinned, version, curMap); reloaded != nil {
+			for _, value := range reloaded {
+				value.IsFailover = client.FailoverIndex > 0
+				value.FailoverIndex = client.FailoverIndex
+			}
+			values = append(values, reloaded...)
+			continue
+		}
+
+		version, secret, err := p.fetchSecret(ctx, client, &pinned)
+		if err != nil {
+			return nil, err
+		}
+		secret.IsFailover = client.FailoverIndex > 0
+		secret.FailoverIndex = client.FailoverIndex
+		secret.Version = version
+		jsonSecrets, err := secret.getJsonSecrets()
+		if err != nil {
+			return nil, err
+		}
+		for _, jsonSecret := range jsonSecrets {
+			fileName := jsonSecret.Descriptor.GetFileName()
+			curMap[fileName] = &v1alpha1.ObjectVersion{Id: fileName, Version: version}
+		}
+		values = append(values, jsonSecrets...)
+	}
+	return values, nil
+}
+
+// Private helper to read back entries pinned to a version id when that version
+// is already mounted for every entry. Returns nil when they must be fetched.
+func reloadPinnedEntries(pinned *SecretDescriptor, version string, curMap map[string]*v1alpha1.ObjectVersion) []*SecretValue {
+
+	if len(version) == 0 {
+		return nil
+	}
+
+	var values []*SecretValue
+	for i := range pinned.JMESPath {
+		descriptor := pinned.getJmesEntrySecretDescriptor(&pinned.JMESPath[i])
+		curVer := curMap[descriptor.GetFileName()]
+		if curVer == nil || curVer.Version != version {
+			return nil
+		}
+		value, err := ioutil.ReadFile(descriptor.GetMountPath())
+		if err != nil {
+			return nil // Fetch it instead.
+		}
+		values = append(values, &SecretValue{Value: value, Descriptor: descriptor, Version: version})
+	}
+	return values
+}
+
+// Private helper to tell if any of the entries of a pinned descriptor are
+// mounted.
+func isMounted(pinned *SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) bool {
+	for i := range pinned.JMESPath {
+		descriptor := pinned.getJmesEntrySecretDescriptor(&pinned.JMESPath[i])
+		if curMap[descriptor.GetFileName()] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Private helper to find the version a staging label is on (empty when no
+// version has it).
+func versionWithStage(stages map[string][]*string, label string) string {
+	for version, labels := range stages {
+		for _, stage := range labels {
+			if aws.StringValue(stage) == label {
+				return version
+			}
+		}
+	}
+	return ""
+}
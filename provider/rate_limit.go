@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/time/rate"
+)
+
+// Limits the rate of Secrets Manager and SSM calls made by all mounts on the
+// node.
+//
+// Each service in each region has its own token bucket, shared by every
+// mount, so hundreds of pods starting at once are spaced out instead of
+// triggering a ThrottlingException storm that exhausts their retries. Every
+// attempt (including retries) takes a token. Calls wait for a token until the
+// mount request deadline and then fail.
+//
+type AWSRateLimits struct {
+	rates    map[string]float64 // TPS by service or service/region
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter // Keyed by service/region, nil when unlimited
+}
+
+// Parse the rate limits given on the command line.
+//
+// The spec is a comma separated list of service=tps or service/region=tps
+// entries, where the service is secretsmanager or ssmparameter, for example
+// "ssmparameter=20,ssmparameter/eu-west-1=5". Region entries take precedence
+// over service entries. Services without an entry are not limited. Returns
+// nil for an empty spec.
+//
+func ParseAWSRateLimits(spec string) (*AWSRateLimits, error) {
+
+	if len(strings.TrimSpace(spec)) == 0 {
+		return nil, nil
+	}
+
+	limits := &AWSRateLimits{rates: make(map[string]float64), limiters: make(map[string]*rate.Limiter)}
+	for _, entry := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		service, region, _ := strings.Cut(key, "/")
+		if _, ok := typeMap[service]; !found || !ok || service == "ssm" || (strings.Contains(key, "/") && len(region) == 0) {
+			return nil, fmt.Errorf("invalid rate limit %q: must be secretsmanager[/region]=tps or ssmparameter[/region]=tps", entry)
+		}
+		tps, err := strconv.ParseFloat(value, 64)
+		if err != nil || tps <= 0 || math.IsInf(tps, 0) {
+			return nil, fmt.Errorf("invalid rate limit %q: tps must be a positive number", entry)
+		}
+		limits.rates[key] = tps
+	}
+	return limits, nil
+}
+
+// Private helper to get the shared limiter of a service in a region (nil when
+// the service is not limited there).
+//
+// The burst is one second of calls (at least one call).
+//
+func (l *AWSRateLimits) limiter(service SecretType, region string) *rate.Limiter {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := service.String() + "/" + region
+	limiter, ok := l.limiters[key]
+	if ok {
+		return limiter
+	}
+	tps, ok := l.rates[key]
+	if !ok {
+		tps, ok = l.rates[service.String()]
+	}
+	if ok {
+		limiter = rate.NewLimiter(rate.Limit(tps), int(math.Max(1, math.Ceil(tps))))
+	}
+	l.limiters[key] = limiter
+	return limiter
+}
+
+// Private helper to make every attempt of the calls sent with the handlers
+// wait for a token of the service in the region.
+func (l *AWSRateLimits) attach(handlers *request.Handlers, service SecretType, region string) {
+
+	limiter := l.limiter(service, region)
+	if limiter == nil {
+		return
+	}
+	handlers.Send.PushFrontNamed(request.NamedHandler{Name: "provider.rateLimit", Fn: func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil { // Not retried
+			r.Error = awserr.New(request.CanceledErrorCode,
+				fmt.Sprintf("%s calls in %s are limited to %v per second and the request deadline was reached", service, region, limiter.Limit()), err)
+		}
+	}})
+}
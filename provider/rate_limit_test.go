@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+func TestParseAWSRateLimits(t *testing.T) {
+
+	limits, err := ParseAWSRateLimits("")
+	if limits != nil || err != nil {
+		t.Fatalf("Expected no limits, got %v %v", limits, err)
+	}
+
+	limits, err = ParseAWSRateLimits("ssmparameter=20, ssmparameter/eu-west-1=0.5,secretsmanager=100")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		service SecretType
+		region  string
+		limit   float64
+		burst   int
+	}{
+		{SSMParameter, "us-east-1", 20, 20},
+		{SSMParameter, "eu-west-1", 0.5, 1},
+		{SecretsManager, "eu-west-1", 100, 100},
+	} {
+		limiter := limits.limiter(tc.service, tc.region)
+		if limiter == nil || float64(limiter.Limit()) != tc.limit || limiter.Burst() != tc.burst {
+			t.Errorf("Unexpected limiter for %s in %s: %+v", tc.service, tc.region, limiter)
+		}
+		if limits.limiter(tc.service, tc.region) != limiter {
+			t.Errorf("Expected the limiter for %s in %s to be shared", tc.service, tc.region)
+		}
+	}
+
+	limits, _ = ParseAWSRateLimits("ssmparameter/eu-west-1=5")
+	if limits.limiter(SSMParameter, "us-east-1") != nil || limits.limiter(SecretsManager, "eu-west-1") != nil {
+		t.Errorf("Expected services and regions without limits to be unlimited")
+	}
+
+	for _, spec := range []string{"ssm=5", "s3=5", "ssmparameter", "ssmparameter/=5", "ssmparameter=0", "ssmparameter=-1", "ssmparameter=fast", "ssmparameter=+Inf"} {
+		if _, err := ParseAWSRateLimits(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+// Make sure calls wait for a token and fail once the deadline would pass.
+func TestAWSRateLimitsWait(t *testing.T) {
+
+	limits, _ := ParseAWSRateLimits("ssmparameter=1")
+	handlers := request.Handlers{}
+	limits.attach(&handlers, SSMParameter, "us-east-1")
+
+	send := func(timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req := request.New(aws.Config{}, metadata.ClientInfo{}, handlers, nil, &request.Operation{Name: "GetParameters"}, nil, nil)
+		req.SetContext(ctx)
+		handlers.Send.Run(req)
+		return req.Error
+	}
+
+	if err := send(time.Second); err != nil {
+		t.Fatalf("Unexpected error for the first call: %v", err)
+	}
+	err := send(100 * time.Millisecond)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Fatalf("Expected a cancelled request, got %v", err)
+	}
+}
+
+// Make sure the limits apply to the clients of every factory.
+func TestFactoryRateLimits(t *testing.T) {
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", ""))))
+	limits, _ := ParseAWSRateLimits("ssmparameter=5")
+	opts := ProviderOptions{RateLimits: limits}
+
+	for i := 0; i < 2; i++ {
+		factory := NewSecretProviderFactoryWithOptions([]*session.Session{sess}, []string{"us-west-2"}, opts)
+		client := factory.GetSecretProvider(SSMParameter).(*ParameterStoreProvider).clients[0].Client.(*ssm.SSM)
+		if !client.Handlers.Send.Swap("provider.rateLimit", request.NamedHandler{Name: "provider.rateLimit", Fn: func(*request.Request) {}}) {
+			t.Fatalf("Expected the rate limit handler on the SSM client")
+		}
+	}
+	if limits.limiters["ssmparameter/us-west-2"] == nil || limits.limiters["secretsmanager/us-west-2"] != nil {
+		t.Fatalf("Expected one shared limiter, got %v", limits.limiters)
+	}
+}
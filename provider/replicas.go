@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+	"k8s.io/klog/v2"
+)
+
+// Implemented by providers that can find the replicas of a secret.
+type replicaFinder interface {
+	failoverRegions() []string
+}
+
+// Fill in the failover objects of secrets using replicas (useReplica).
+//
+// A secret replicated to other regions has the same name in every region,
+// but its ARN names the region it is in, so a secret given by ARN would
+// otherwise need a failoverObject for each failover region. Replicas only
+// differ in their region, so the replica ARN of each failover region is
+// derived from the objectName without calling AWS. Secrets given by name use
+// the same name in every region. When a replica can not be read, the primary
+// secret is described to explain why (see explainReplicaError).
+//
+func ResolveReplicas(factory *SecretProviderFactory, descriptors map[SecretType][]*SecretDescriptor) error {
+
+	var replicated []*SecretDescriptor
+	for _, descriptor := range descriptors[SecretsManager] {
+		if descriptor.UseReplica {
+			replicated = append(replicated, descriptor)
+		}
+	}
+	if len(replicated) == 0 {
+		return nil
+	}
+
+	finder, ok := factory.GetSecretProvider(SecretsManager).(replicaFinder)
+	if !ok {
+		return utils.InvalidConfiguration(fmt.Errorf("useReplica is not supported by the secretsmanager provider"))
+	}
+	regions := finder.failoverRegions()
+
+	for _, descriptor := range replicated {
+		entries := make(FailoverObjectList, len(regions))
+		for i, region := range regions {
+			if replicaARN, ok := replicaARN(descriptor.ObjectName, region); ok {
+				entries[i].ObjectName = replicaARN
+			}
+		}
+		descriptor.FailoverObject = entries
+	}
+	return nil
+}
+
+// Private helper to name a replica by the ARN of its primary secret with the
+// region replaced. Names that are not ARNs are the same in every region.
+func replicaARN(primaryARN, region string) (string, bool) {
+
+	if !strings.HasPrefix(primaryARN, "arn:") {
+		return "", false
+	}
+	parsed, err := arn.Parse(primaryARN)
+	if err != nil {
+		return "", false
+	}
+	parsed.Region = region
+	return parsed.String(), true
+}
+
+// Private helper to return the failover regions, in lookup order.
+func (p *SecretsManagerProvider) failoverRegions() []string {
+
+	var regions []string
+	for _, client := range p.clients {
+		if client.FailoverIndex > 0 {
+			regions = append(regions, client.Region)
+		}
+	}
+	return regions
+}
+
+// Private helper to explain why the replica of a secret could not be read
+// in a failover region. The primary secret is only described once reading a
+// replica fails, and the error is returned unchanged when the region has an
+// in sync replica or the primary can not be described either.
+func (p *SecretsManagerProvider) explainReplicaError(ctx context.Context, descriptor *SecretDescriptor, region string, err error) error {
+
+	replicas, descErr := p.findReplicas(ctx, descriptor.GetSecretName(0))
+	if descErr != nil {
+		klog.Warningf("Failed to find the replicas of %s: %s", descriptor.ObjectName, descErr)
+		return err
+	}
+	status, found := replicas[region]
+	switch {
+	case !found:
+		return fmt.Errorf("secret %s has no replica in failover region %s: %w", descriptor.ObjectName, region, err)
+	case status == secretsmanager.StatusTypeFailed:
+		return fmt.Errorf("replica of secret %s in failover region %s failed to replicate: %w", descriptor.ObjectName, region, err)
+	}
+	return err
+}
+
+// Private helper to describe a secret in the primary region and return the
+// replication status of each region it is replicated to.
+func (p *SecretsManagerProvider) findReplicas(ctx context.Context, name string) (map[string]string, error) {
+
+	for _, client := range p.clients {
+		if client.FailoverIndex != 0 {
+			continue
+		}
+
+		start := time.Now()
+		rsp, err := client.Client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(name)})
+		utils.ObserveAPICall(SecretsManager.String(), "DescribeSecret", client.Region, time.Since(start))
+		if err != nil {
+			utils.RecordFetchError(SecretsManager.String(), client.Region, "", err)
+			return nil, utils.WithRequestContext(client.Region, "", fmt.Errorf("Failed to describe secret %s: %w", name, err))
+		}
+
+		replicas := make(map[string]string)
+		for _, status := range rsp.ReplicationStatus {
+			replicas[aws.StringValue(status.Region)] = aws.StringValue(status.Status)
+		}
+		return replicas, nil
+	}
+	return nil, fmt.Errorf("no client for the primary region")
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Mock Secrets Manager client describing a replicated secret.
+type replicatedSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	arn      string
+	replicas map[string]string
+	err      error
+	names    []string
+}
+
+func (m *replicatedSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+	m.names = append(m.names, aws.StringValue(input.SecretId))
+	if m.err != nil {
+		return nil, m.err
+	}
+	rsp := &secretsmanager.DescribeSecretOutput{ARN: aws.String(m.arn)}
+	for region, status := range m.replicas {
+		rsp.ReplicationStatus = append(rsp.ReplicationStatus, &secretsmanager.ReplicationStatusType{Region: aws.String(region), Status: aws.String(status)})
+	}
+	return rsp, nil
+}
+
+func TestResolveReplicas(t *testing.T) {
+
+	const primaryARN = "arn:aws:secretsmanager:us-west-2:123456789012:secret:db-AbCdEf"
+	regions := []string{"us-west-2", "us-east-1", "eu-west-1"}
+	objects := `
+          - objectName: ` + primaryARN + `
+            objectAlias: db
+            useReplica: true
+          - objectName: named
+            objectType: secretsmanager
+            useReplica: true
+          - objectName: other
+            objectType: secretsmanager`
+
+	client := &replicatedSecretsManager{arn: primaryARN}
+	var clients []SecretsManagerClient
+	for i, region := range regions {
+		clients = append(clients, SecretsManagerClient{Region: region, Client: client, FailoverIndex: i})
+	}
+	factory := &SecretProviderFactory{Providers: map[SecretType]SecretProvider{
+		SecretsManager: NewSecretsManagerProviderWithClients(clients...),
+	}}
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, regions)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ResolveReplicas(factory, descriptors); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.names) != 0 {
+		t.Errorf("Expected no secrets to be described, got %v", client.names)
+	}
+
+	db, named := descriptors[SecretsManager][0], descriptors[SecretsManager][1]
+	for i, expected := range []string{
+		primaryARN,
+		"arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf",
+		"arn:aws:secretsmanager:eu-west-1:123456789012:secret:db-AbCdEf",
+	} {
+		if name := db.GetSecretName(i); name != expected {
+			t.Errorf("Expected %s in %s, got %s", expected, regions[i], name)
+		}
+		if name := named.GetSecretName(i); name != "named" {
+			t.Errorf("Expected named in %s, got %s", regions[i], name)
+		}
+	}
+	if len(descriptors[SecretsManager][2].FailoverObject) != 0 {
+		t.Errorf("Failover objects set without useReplica")
+	}
+}
+
+func TestExplainReplicaError(t *testing.T) {
+
+	fetchErr := awserr.NewRequestFailure(awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil), 400, "")
+	descriptors, err := NewSecretDescriptorList("/", "", "", "[{objectName: db, objectType: secretsmanager, useReplica: true}]", []string{"us-west-2", "us-east-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	descriptor := descriptors[SecretsManager][0]
+
+	for _, tc := range []struct {
+		client   *replicatedSecretsManager
+		expected string
+	}{
+		{&replicatedSecretsManager{replicas: map[string]string{"eu-west-1": secretsmanager.StatusTypeInSync}}, "secret db has no replica in failover region us-east-1: "},
+		{&replicatedSecretsManager{replicas: map[string]string{"us-east-1": secretsmanager.StatusTypeFailed}}, "replica of secret db in failover region us-east-1 failed to replicate: "},
+		{&replicatedSecretsManager{replicas: map[string]string{"us-east-1": secretsmanager.StatusTypeInSync}}, ""},
+		{&replicatedSecretsManager{err: fmt.Errorf("unavailable")}, ""},
+	} {
+		p := NewSecretsManagerProviderWithClients(
+			SecretsManagerClient{Region: "us-west-2", Client: tc.client},
+			SecretsManagerClient{Region: "us-east-1", Client: tc.client, FailoverIndex: 1},
+		)
+		err := p.explainReplicaError(context.Background(), descriptor, "us-east-1", fetchErr)
+		if err.Error() != tc.expected+fetchErr.Error() {
+			t.Errorf("Expected %q, got %q", tc.expected+fetchErr.Error(), err.Error())
+		}
+		if !utils.IsFatalError(err) {
+			t.Errorf("Expected the explained error to stay fatal: %v", err)
+		}
+		if fmt.Sprint(tc.client.names) != "[db]" {
+			t.Errorf("Expected db to be described once, got %v", tc.client.names)
+		}
+	}
+}
+
+func TestUseReplicaValidation(t *testing.T) {
+
+	regions := []string{"us-west-2", "us-east-1"}
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: parameter1, objectType: ssmparameter, useReplica: true}]`:                                                  "useReplica is only supported for secretsmanager objects: parameter1",
+		`[{objectName: secret1, objectType: secretsmanager, useReplica: true, region: us-east-2}]`:                                "useReplica can not be used with failoverObject or region: secret1",
+		`[{objectName: secret1, objectType: secretsmanager, objectAlias: s, useReplica: true, failoverObject: {objectName: s2}}]`: "useReplica can not be used with failoverObject or region: secret1",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, regions)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+
+	_, err := NewSecretDescriptorList("/", "", "", `[{objectName: secret1, objectType: secretsmanager, useReplica: true}]`, singleRegion)
+	expectedErrorMessage := "useReplica allowed only when failover region is defined: secret1"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Retry modes for Secrets Manager and SSM calls.
+const (
+	RetryModeStandard = "standard" // SDK retries with exponential backoff
+	RetryModeAdaptive = "adaptive" // Standard retries plus client side rate limiting while throttled
+)
+
+const (
+	maxRetriesLimit  = 10                    // Most retries allowed, so mounts do not outlive the driver's deadline
+	minThrottleDelay = 50 * time.Millisecond // Spacing between calls after the first throttle
+	maxThrottleDelay = 5 * time.Second       // Largest spacing between calls while throttled
+)
+
+// How AWS SDK calls are retried.
+//
+// The zero value keeps the SDK defaults (standard mode with 3 retries).
+//
+type RetryConfig struct {
+	MaxRetries *int   // Maximum retries of a failed call (nil for the SDK default)
+	Mode       string // One of RetryModeStandard or RetryModeAdaptive (empty for standard)
+}
+
+// Builds a retry configuration from the string form used in flags and mount
+// attributes.
+//
+// An empty maxRetries keeps the default, and an empty mode means standard.
+//
+func NewRetryConfig(maxRetries, mode string) (cfg RetryConfig, e error) {
+
+	if len(maxRetries) > 0 {
+		retries, err := strconv.Atoi(maxRetries)
+		if err != nil || retries < 0 || retries > maxRetriesLimit {
+			return cfg, fmt.Errorf("max retries must be a number from 0 to %d: %s", maxRetriesLimit, maxRetries)
+		}
+		cfg.MaxRetries = aws.Int(retries)
+	}
+
+	switch mode {
+	case "", RetryModeStandard, RetryModeAdaptive:
+		cfg.Mode = mode
+	default:
+		return cfg, fmt.Errorf("retry mode must be one of standard or adaptive: %s", mode)
+	}
+	return cfg, nil
+}
+
+// Returns the configuration with any settings of the override applied.
+func (c RetryConfig) Merge(override RetryConfig) RetryConfig {
+
+	if override.MaxRetries != nil {
+		c.MaxRetries = override.MaxRetries
+	}
+	if len(override.Mode) > 0 {
+		c.Mode = override.Mode
+	}
+	return c
+}
+
+// Configure how the clients later created from a session retry.
+//
+// Must be called before the Secrets Manager and SSM clients are created from
+// the session. In adaptive mode calls to a service in a region are spaced out
+// while that service throttles, across all mounts, so a fleet restart backs off
+// instead of failing mounts once the retries run out.
+//
+func ApplyRetryConfig(sess *session.Session, cfg RetryConfig) {
+
+	if cfg.MaxRetries != nil {
+		sess.Config.Retryer = client.DefaultRetryer{NumMaxRetries: *cfg.MaxRetries}
+	}
+
+	if cfg.Mode == RetryModeAdaptive {
+		sess.Handlers.Send.PushFrontNamed(request.NamedHandler{Name: "provider.throttleWait", Fn: func(r *request.Request) {
+			getThrottleLimiter(r.ClientInfo.ServiceName, aws.StringValue(r.Config.Region)).wait(r)
+		}})
+		sess.Handlers.Retry.PushBackNamed(request.NamedHandler{Name: "provider.throttled", Fn: func(r *request.Request) {
+			if r.IsErrorThrottle() { // Runs after each failed attempt
+				getThrottleLimiter(r.ClientInfo.ServiceName, aws.StringValue(r.Config.Region)).throttled()
+			}
+		}})
+		sess.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: "provider.succeeded", Fn: func(r *request.Request) {
+			if r.Error == nil {
+				getThrottleLimiter(r.ClientInfo.ServiceName, aws.StringValue(r.Config.Region)).succeeded()
+			}
+		}})
+	}
+}
+
+// Private client side rate limiter for adaptive retries.
+//
+// While calls are throttled the limiter spaces out calls by a delay that
+// doubles on each throttle and halves on each success, until it drops below
+// the minimum and calls are no longer delayed.
+//
+type throttleLimiter struct {
+	mu    sync.Mutex
+	delay time.Duration // Spacing between calls (0 when not throttled)
+	next  time.Time     // Earliest time of the next call
+}
+
+var (
+	throttleLimitersMu sync.Mutex
+	throttleLimiters   = make(map[string]*throttleLimiter) // Keyed by service and region
+)
+
+// Private helper to get the shared limiter of a service in a region.
+func getThrottleLimiter(service, region string) *throttleLimiter {
+
+	throttleLimitersMu.Lock()
+	defer throttleLimitersMu.Unlock()
+
+	key := service + "/" + region
+	limiter := throttleLimiters[key]
+	if limiter == nil {
+		limiter = &throttleLimiter{}
+		throttleLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// Private helper to wait for the next call slot (or the request to be cancelled).
+func (l *throttleLimiter) wait(r *request.Request) {
+
+	l.mu.Lock()
+	if l.delay == 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.delay)
+	l.mu.Unlock()
+
+	if err := aws.SleepWithContext(r.Context(), slot.Sub(now)); err != nil {
+		r.Error = err
+	}
+}
+
+// Private helper to slow down calls after a call is throttled.
+func (l *throttleLimiter) throttled() {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.delay *= 2
+	if l.delay < minThrottleDelay {
+		l.delay = minThrottleDelay
+	} else if l.delay > maxThrottleDelay {
+		l.delay = maxThrottleDelay
+	}
+}
+
+// Private helper to speed up calls after a call succeeds.
+func (l *throttleLimiter) succeeded() {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.delay /= 2
+	if l.delay < minThrottleDelay {
+		l.delay = 0
+	}
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+func TestNewRetryConfig(t *testing.T) {
+
+	cfg, err := NewRetryConfig("", "")
+	if err != nil || cfg.MaxRetries != nil || len(cfg.Mode) != 0 {
+		t.Fatalf("Unexpected default config: %+v %v", cfg, err)
+	}
+
+	cfg, err = NewRetryConfig("5", RetryModeAdaptive)
+	if err != nil || *cfg.MaxRetries != 5 || cfg.Mode != RetryModeAdaptive {
+		t.Fatalf("Unexpected config: %+v %v", cfg, err)
+	}
+
+	for _, retries := range []string{"-1", "11", "many"} {
+		if _, err = NewRetryConfig(retries, ""); err == nil || !strings.Contains(err.Error(), "max retries must be") {
+			t.Fatalf("Expected error for %s but got %v", retries, err)
+		}
+	}
+	if _, err = NewRetryConfig("", "legacy"); err == nil || !strings.Contains(err.Error(), "retry mode must be") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Overrides only replace what they set.
+	merged := cfg.Merge(RetryConfig{Mode: RetryModeStandard})
+	if *merged.MaxRetries != 5 || merged.Mode != RetryModeStandard {
+		t.Fatalf("Unexpected merged config: %+v", merged)
+	}
+	merged = cfg.Merge(RetryConfig{MaxRetries: aws.Int(0)})
+	if *merged.MaxRetries != 0 || merged.Mode != RetryModeAdaptive {
+		t.Fatalf("Unexpected merged config: %+v", merged)
+	}
+}
+
+// Private helper to build a Secrets Manager client calling a mock that always throttles.
+func newThrottledClient(t *testing.T, region string, cfg RetryConfig) (*secretsmanager.SecretsManager, *int) {
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"__type": "ThrottlingException", "message": "Rate exceeded"}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion(region).
+		WithEndpoint(srv.URL).
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", ""))))
+	ApplyRetryConfig(sess, cfg)
+	return secretsmanager.New(sess), &calls
+}
+
+func TestApplyRetryConfig(t *testing.T) {
+
+	client, calls := newThrottledClient(t, "retry-region-1", RetryConfig{MaxRetries: aws.Int(1)})
+	if client.MaxRetries() != 1 {
+		t.Fatalf("Wrong max retries: %d", client.MaxRetries())
+	}
+	if _, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String("secret")}); err == nil || *calls != 2 {
+		t.Fatalf("Expected 2 calls and an error but got %d %v", *calls, err)
+	}
+	if limiter := getThrottleLimiter("secretsmanager", "retry-region-1"); limiter.delay != 0 {
+		t.Fatalf("Standard mode limited calls: %s", limiter.delay)
+	}
+}
+
+func TestAdaptiveRetries(t *testing.T) {
+
+	client, calls := newThrottledClient(t, "retry-region-2", RetryConfig{MaxRetries: aws.Int(0), Mode: RetryModeAdaptive})
+	if _, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String("secret")}); err == nil || *calls != 1 {
+		t.Fatalf("Expected 1 call and an error but got %d %v", *calls, err)
+	}
+
+	// Throttles slow down calls to the service in the region.
+	limiter := getThrottleLimiter("secretsmanager", "retry-region-2")
+	if limiter.delay != minThrottleDelay {
+		t.Fatalf("Wrong delay after throttle: %s", limiter.delay)
+	}
+	start := time.Now()
+	client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String("secret")})
+	client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String("secret")})
+	if time.Since(start) < minThrottleDelay {
+		t.Fatalf("Calls not spaced out: %s", time.Since(start))
+	}
+	if limiter.delay != 4*minThrottleDelay {
+		t.Fatalf("Wrong delay after throttles: %s", limiter.delay)
+	}
+	if other := getThrottleLimiter("secretsmanager", "retry-region-3"); other.delay != 0 {
+		t.Fatalf("Throttles in one region limited another: %s", other.delay)
+	}
+
+	// Successes speed calls back up.
+	for i := 0; i < 3; i++ {
+		limiter.succeeded()
+	}
+	if limiter.delay != 0 {
+		t.Fatalf("Calls still limited: %s", limiter.delay)
+	}
+	for i := 0; i < 20; i++ {
+		limiter.throttled()
+	}
+	if limiter.delay != maxThrottleDelay {
+		t.Fatalf("Delay not capped: %s", limiter.delay)
+	}
+}
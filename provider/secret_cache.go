@@ -0,0 +1,325 @@
+package provider
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Remove expired entries once the cache grows by this many entries.
+const cacheSweepInterval = 1000
+
+// Estimated bytes used by each cache entry besides the secret values (the
+// key, response structs, and bookkeeping).
+const cacheEntryOverhead = 512
+
+// An in-memory cache of AWS responses shared by all mounts.
+//
+// During rotation reconciliation many pods mounting the same
+// SecretProviderClass remount at about the same time. The cache lets them
+// share the DescribeSecret, GetSecretValue, GetParameters, and GetParameter
+// responses for up to the TTL instead of each calling AWS. Errors are never cached.
+//
+// Responses are only shared between mounts with the same cache scope (see
+// WithCacheScope) so a pod never sees a secret fetched with another pod's
+// credentials. Nothing is cached for requests without a scope.
+//
+// The estimated size of the cached responses can be capped (see SetMaxBytes)
+// so nodes mounting many large secrets do not run out of memory. Once the cap
+// is reached the least recently used responses are dropped first.
+//
+type SecretCache struct {
+	ttl       time.Duration
+	maxBytes  int64
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	lru       *list.List // Keys, most recently used first
+	bytes     int64
+	nextSweep int
+}
+
+// Private cache entry holding a response and when it expires.
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+	size    int64
+	elem    *list.Element
+}
+
+// Creates a new cache holding responses for the given time to live.
+func NewSecretCache(ttl time.Duration) *SecretCache {
+	return &SecretCache{
+		ttl:       ttl,
+		entries:   make(map[string]*cacheEntry),
+		lru:       list.New(),
+		nextSweep: cacheSweepInterval,
+	}
+}
+
+// Cap the estimated bytes held by the cache (0 for no cap).
+//
+// Least recently used responses are dropped right away to get under a lower
+// cap, and responses larger than the cap are not cached.
+//
+func (c *SecretCache) SetMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evict(0)
+	c.recordSize()
+}
+
+// Change how long new responses are cached.
+//
+// Responses already cached keep the expiry they were cached with.
+//
+func (c *SecretCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Private helper to look up an unexpired response.
+func (c *SecretCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	c.lru.MoveToFront(entry.elem)
+	return entry.value, true
+}
+
+// Private helper to add a response, dropping the least recently used
+// responses to stay under the size cap and removing expired entries now and
+// then.
+func (c *SecretCache) put(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.recordSize()
+
+	size := int64(len(key)) + cacheEntryOverhead + responseSize(value)
+	if old, ok := c.entries[key]; ok {
+		c.remove(key, old)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	c.evict(size)
+
+	now := time.Now()
+	c.entries[key] = &cacheEntry{value: value, expires: now.Add(c.ttl), size: size, elem: c.lru.PushFront(key)}
+	c.bytes += size
+	if len(c.entries) < c.nextSweep {
+		return
+	}
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			c.remove(k, entry)
+			utils.RecordCacheEviction(utils.CacheEvictedExpired)
+		}
+	}
+	c.nextSweep = len(c.entries) + cacheSweepInterval
+}
+
+// Private helper to drop the least recently used responses until another
+// size bytes fit under the cap. Must be called with the lock held.
+func (c *SecretCache) evict(size int64) {
+	for c.maxBytes > 0 && c.bytes+size > c.maxBytes && c.lru.Len() > 0 {
+		key := c.lru.Back().Value.(string)
+		c.remove(key, c.entries[key])
+		utils.RecordCacheEviction(utils.CacheEvictedSize)
+	}
+}
+
+// Private helper to remove an entry. Must be called with the lock held.
+func (c *SecretCache) remove(key string, entry *cacheEntry) {
+	delete(c.entries, key)
+	c.lru.Remove(entry.elem)
+	c.bytes -= entry.size
+}
+
+// Private helper to publish the size of the cache. Must be called with the
+// lock held.
+func (c *SecretCache) recordSize() {
+	utils.SetCacheSize(len(c.entries), c.bytes)
+}
+
+// Private helper to estimate the bytes of secret data in a cached response.
+// Names, versions, and other metadata are covered by cacheEntryOverhead.
+func responseSize(value interface{}) int64 {
+
+	switch rsp := value.(type) {
+	case *secretsmanager.GetSecretValueOutput:
+		return int64(len(aws.StringValue(rsp.SecretString)) + len(rsp.SecretBinary))
+	case *secretsmanager.DescribeSecretOutput:
+		return int64(len(aws.StringValue(rsp.ARN)) + len(aws.StringValue(rsp.Description)))
+	case *ssm.GetParametersOutput:
+		size := 0
+		for _, param := range rsp.Parameters {
+			size += len(aws.StringValue(param.Name)) + len(aws.StringValue(param.Value))
+		}
+		return int64(size)
+	case *ssm.GetParameterOutput:
+		if rsp.Parameter == nil {
+			return 0
+		}
+		return int64(len(aws.StringValue(rsp.Parameter.Name)) + len(aws.StringValue(rsp.Parameter.Value)))
+	}
+	return 0
+}
+
+// Removes all responses cached for scopes starting with the given prefix.
+//
+// Returns the number of responses removed.
+//
+func (c *SecretCache) InvalidateScope(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, entry := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(key, entry)
+			removed++
+		}
+	}
+	c.recordSize()
+	return removed
+}
+
+// Private context key holding the cache scope.
+type cacheScopeKey struct{}
+
+// Returns a context in which cached responses are shared within the given
+// scope.
+//
+// The scope must identify the credentials used for the mount (for example the
+// namespace, service account, and any role to chain into) since responses are
+// only shared between requests with the same scope.
+//
+func WithCacheScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, cacheScopeKey{}, scope)
+}
+
+// Private helper to build a cache key, returning false when there is no scope.
+func cacheKey(ctx context.Context, parts ...string) (string, bool) {
+	scope, _ := ctx.Value(cacheScopeKey{}).(string)
+	if len(scope) == 0 {
+		return "", false
+	}
+	return strings.Join(append([]string{scope}, parts...), "\x00"), true
+}
+
+// Private Secrets Manager client wrapper that caches responses.
+type cachingSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	cache  *SecretCache
+	region string
+}
+
+func (c *cachingSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+
+	key, ok := cacheKey(ctx, c.region, "GetSecretValue", aws.StringValue(input.SecretId),
+		aws.StringValue(input.VersionId), aws.StringValue(input.VersionStage))
+	if !ok {
+		return c.SecretsManagerAPI.GetSecretValueWithContext(ctx, input, options...)
+	}
+	if rsp, found := c.cache.get(key); found {
+		return rsp.(*secretsmanager.GetSecretValueOutput), nil
+	}
+
+	rsp, err := c.SecretsManagerAPI.GetSecretValueWithContext(ctx, input, options...)
+	if err == nil {
+		c.cache.put(key, rsp)
+	}
+	return rsp, err
+}
+
+func (c *cachingSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+
+	key, ok := cacheKey(ctx, c.region, "DescribeSecret", aws.StringValue(input.SecretId))
+	if !ok {
+		return c.SecretsManagerAPI.DescribeSecretWithContext(ctx, input, options...)
+	}
+	if rsp, found := c.cache.get(key); found {
+		return rsp.(*secretsmanager.DescribeSecretOutput), nil
+	}
+
+	rsp, err := c.SecretsManagerAPI.DescribeSecretWithContext(ctx, input, options...)
+	if err == nil {
+		c.cache.put(key, rsp)
+	}
+	return rsp, err
+}
+
+// Private Parameter Store client wrapper that caches responses.
+//
+// Whole GetParameters batches are cached since pods mounting the same
+// SecretProviderClass request the same batches.
+//
+type cachingSSM struct {
+	ssmiface.SSMAPI
+	cache  *SecretCache
+	region string
+}
+
+func (c *cachingSSM) GetParametersWithContext(
+	ctx context.Context, input *ssm.GetParametersInput, options ...request.Option,
+) (*ssm.GetParametersOutput, error) {
+
+	parts := append([]string{c.region, "GetParameters"}, aws.StringValueSlice(input.Names)...)
+	if aws.BoolValue(input.WithDecryption) {
+		parts = append(parts, "WithDecryption")
+	}
+	key, ok := cacheKey(ctx, parts...)
+	if !ok {
+		return c.SSMAPI.GetParametersWithContext(ctx, input, options...)
+	}
+	if rsp, found := c.cache.get(key); found {
+		return rsp.(*ssm.GetParametersOutput), nil
+	}
+
+	rsp, err := c.SSMAPI.GetParametersWithContext(ctx, input, options...)
+	if err == nil {
+		c.cache.put(key, rsp)
+	}
+	return rsp, err
+}
+
+func (c *cachingSSM) GetParameterWithContext(
+	ctx context.Context, input *ssm.GetParameterInput, options ...request.Option,
+) (*ssm.GetParameterOutput, error) {
+
+	key, ok := cacheKey(ctx, c.region, "GetParameter", aws.StringValue(input.Name), strconv.FormatBool(aws.BoolValue(input.WithDecryption)))
+	if !ok {
+		return c.SSMAPI.GetParameterWithContext(ctx, input, options...)
+	}
+	if rsp, found := c.cache.get(key); found {
+		return rsp.(*ssm.GetParameterOutput), nil
+	}
+
+	rsp, err := c.SSMAPI.GetParameterWithContext(ctx, input, options...)
+	if err == nil {
+		c.cache.put(key, rsp)
+	}
+	return rsp, err
+}
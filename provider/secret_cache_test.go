@@ -0,0 +1,149 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+func TestSecretCacheScope(t *testing.T) {
+
+	client := &mockSecretsManager{}
+	cached := &cachingSecretsManager{client, NewSecretCache(time.Minute), "us-west-2"}
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String("secret1"), VersionStage: aws.String("AWSCURRENT")}
+
+	// Without a scope nothing is cached.
+	for i := 0; i < 2; i++ {
+		if _, err := cached.GetSecretValueWithContext(context.Background(), input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if client.getCnt != 2 {
+		t.Fatalf("Expected 2 calls without a scope, got %d", client.getCnt)
+	}
+
+	// Mounts with the same scope share the response.
+	ctx := WithCacheScope(context.Background(), "ns/sa")
+	for i := 0; i < 3; i++ {
+		cached.GetSecretValueWithContext(ctx, input)
+		cached.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String("secret1")})
+	}
+	if client.getCnt != 3 || client.descCnt != 1 {
+		t.Fatalf("Expected one call per scope, got %d and %d", client.getCnt, client.descCnt)
+	}
+
+	// Other scopes and versions are fetched again.
+	cached.GetSecretValueWithContext(WithCacheScope(context.Background(), "ns/other"), input)
+	cached.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String("secret1"), VersionId: aws.String("v1")})
+	if client.getCnt != 5 {
+		t.Fatalf("Expected calls for new scope and version, got %d", client.getCnt)
+	}
+}
+
+func TestSecretCacheExpiry(t *testing.T) {
+
+	client := &mockSSM{params: []*ssm.Parameter{{Name: aws.String("parm1"), Value: aws.String("value1")}}}
+	cache := NewSecretCache(time.Minute)
+	cached := &cachingSSM{client, cache, "us-west-2"}
+	ctx := WithCacheScope(context.Background(), "ns/sa")
+	input := &ssm.GetParametersInput{Names: aws.StringSlice([]string{"parm1"}), WithDecryption: aws.Bool(true)}
+
+	rsp, err := cached.GetParametersWithContext(ctx, input)
+	if err != nil || aws.StringValue(rsp.Parameters[0].Value) != "value1" {
+		t.Fatalf("Unexpected response: %v %v", rsp, err)
+	}
+
+	client.params = []*ssm.Parameter{{Name: aws.String("parm1"), Value: aws.String("value2")}}
+	rsp, _ = cached.GetParametersWithContext(ctx, input)
+	if aws.StringValue(rsp.Parameters[0].Value) != "value1" {
+		t.Fatalf("Expected cached value, got %s", aws.StringValue(rsp.Parameters[0].Value))
+	}
+
+	// Expire the entry.
+	for key, entry := range cache.entries {
+		entry.expires = time.Now().Add(-time.Second)
+		cache.entries[key] = entry
+	}
+	rsp, _ = cached.GetParametersWithContext(ctx, input)
+	if aws.StringValue(rsp.Parameters[0].Value) != "value2" {
+		t.Fatalf("Expected new value after expiry, got %s", aws.StringValue(rsp.Parameters[0].Value))
+	}
+}
+
+func TestSecretCacheInvalidateScope(t *testing.T) {
+
+	client := &mockSecretsManager{}
+	cache := NewSecretCache(time.Minute)
+	cached := &cachingSecretsManager{client, cache, "us-west-2"}
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String("secret1")}
+	ctx1 := WithCacheScope(context.Background(), "ns/sa/false/")
+	ctx2 := WithCacheScope(context.Background(), "ns/sa2/false/")
+
+	cached.GetSecretValueWithContext(ctx1, input)
+	cached.GetSecretValueWithContext(ctx2, input)
+	if removed := cache.InvalidateScope("ns/sa/"); removed != 1 {
+		t.Fatalf("Expected one response removed, got %d", removed)
+	}
+
+	cached.GetSecretValueWithContext(ctx1, input)
+	cached.GetSecretValueWithContext(ctx2, input)
+	if client.getCnt != 3 {
+		t.Fatalf("Expected only the invalidated scope to be fetched again, got %d calls", client.getCnt)
+	}
+}
+
+func TestSecretCacheMaxBytes(t *testing.T) {
+
+	cache := NewSecretCache(time.Minute)
+	value := func(size int) *secretsmanager.GetSecretValueOutput {
+		return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(strings.Repeat("x", size))}
+	}
+	entrySize := int64(len("a")) + cacheEntryOverhead + 1000
+	cache.SetMaxBytes(3 * entrySize)
+
+	cache.put("a", value(1000))
+	cache.put("b", value(1000))
+	cache.put("c", value(1000))
+	if cache.bytes != 3*entrySize {
+		t.Fatalf("Expected %d bytes, got %d", 3*entrySize, cache.bytes)
+	}
+
+	// Using a makes b the least recently used, so it is dropped for d.
+	if _, found := cache.get("a"); !found {
+		t.Fatalf("Expected a to be cached")
+	}
+	cache.put("d", value(1000))
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, found := cache.get(key); found != want {
+			t.Fatalf("Expected %s cached to be %v", key, want)
+		}
+	}
+	if len(cache.entries) != 3 || cache.lru.Len() != 3 || cache.bytes != 3*entrySize {
+		t.Fatalf("Unexpected cache size: %d entries, %d bytes", len(cache.entries), cache.bytes)
+	}
+
+	// Responses larger than the cap are not cached, and replacing a response
+	// does not count it twice.
+	cache.put("e", value(5000))
+	if _, found := cache.get("e"); found {
+		t.Fatalf("Expected the large response not to be cached")
+	}
+	cache.put("d", value(1000))
+	if len(cache.entries) != 3 || cache.bytes != 3*entrySize {
+		t.Fatalf("Unexpected cache size after replacing: %d entries, %d bytes", len(cache.entries), cache.bytes)
+	}
+
+	// Lowering the cap drops the least recently used responses right away.
+	cache.SetMaxBytes(entrySize)
+	if _, found := cache.get("d"); !found || len(cache.entries) != 1 || cache.bytes != entrySize {
+		t.Fatalf("Expected only d to be kept, got %d entries", len(cache.entries))
+	}
+	if removed := cache.InvalidateScope(""); removed != 1 || cache.bytes != 0 || cache.lru.Len() != 0 {
+		t.Fatalf("Expected an empty cache, got %d bytes", cache.bytes)
+	}
+}
@@ -1,6 +1,8 @@
 package provider
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,11 +11,25 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/arn"
 	"sigs.k8s.io/yaml"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 )
 
 // An RE pattern to check for bad paths
 var badPathRE = regexp.MustCompile("(/\\.\\./)|(^\\.\\./)|(/\\.\\.$)")
 
+// An RE pattern matching the random suffix Secrets Manager adds to secret ARNs
+var secretSuffixRE = regexp.MustCompile("^(arn:[^:]+:secretsmanager:[^:]*:[^:]*:secret:.+)-[a-zA-Z0-9]{6}$")
+
+// An RE pattern matching AWS region names (such as us-east-1 or us-gov-west-1)
+var regionRE = regexp.MustCompile("^[a-z]{2}(-[a-z]+)+-[0-9]+$")
+
+// Upper bound on the size of the objects specification in a SecretProviderClass.
+const maxObjectSpecSize = 256 * 1024
+
+// Largest user or group id that can own a mounted file.
+const maxFileID int64 = 1<<32 - 2
+
 // An individual record from the mount request indicating the secret to be
 // fetched and mounted.
 type SecretDescriptor struct {
@@ -30,20 +46,95 @@ type SecretDescriptor struct {
 	// Optional version/stage label of the secret (defaults to latest).
 	ObjectVersionLabel string `json:"objectVersionLabel"`
 
+	// Optional staging labels of a secretsmanager secret to mount side by side, each to a file named with the label appended.
+	ObjectVersionStages []string `json:"objectVersionStages"`
+
 	// One of secretsmanager or ssmparameter (not required when using full secrets manager ARN).
 	ObjectType string `json:"objectType"`
 
 	// Optional array to specify what json key value pairs to extract from a secret and mount as individual secrets
 	JMESPath []JMESPathEntry `json:"jmesPath"`
 
-	// Optional failover object
-	FailoverObject FailoverObjectEntry `json:"failoverObject"`
+	// Optional failover object, or list of failover objects in the order of the failover regions
+	FailoverObject FailoverObjectList `json:"failoverObject"`
+
+	// Optional flag to read the replica of a replicated secret in each failover region instead of giving failoverObject.
+	UseReplica bool `json:"useReplica"`
+
+	// Optional upper bound on the size in bytes of the fetched value (no limit other than the backend's if 0).
+	MaxSize int `json:"maxSize"`
+
+	// Optional flag to match a Secrets Manager ARN without its random suffix (survives re-creating the secret).
+	MatchNamePrefix bool `json:"matchNamePrefix"`
+
+	// Optional names (objectName or objectAlias) of objects that must be written first.
+	DependsOn []string `json:"dependsOn"`
+
+	// Optional flag to skip writing the full secret when only jmesPath entries are needed (defaults to true).
+	WriteParent *bool `json:"writeParent"`
+
+	// Optional encoding (base64 or hex) of the value to decode before it is mounted.
+	ObjectEncoding string `json:"objectEncoding"`
+
+	// Optional flag to strip trailing white space (such as a pasted newline) from the value.
+	Trim bool `json:"trim"`
+
+	// Optional flag to decrypt SecureString parameters (defaults to true; false mounts the encrypted value).
+	WithDecryption *bool `json:"withDecryption"`
+
+	// Optional flag to mount every top-level key of a JSON value as its own file.
+	ObjectExplode bool `json:"objectExplode"`
+
+	// Optional flag to split a StringList parameter into its elements.
+	SplitStringList bool `json:"splitStringList"`
+
+	// Optional delimiter of the list elements when splitStringList is set (defaults to a comma).
+	StringListDelimiter string `json:"stringListDelimiter"`
+
+	// Optional file name pattern of the list elements when splitStringList is set (defaults to {name}_{index}).
+	StringListFileName string `json:"stringListFileName"`
+
+	// Optional format of a split list: files (one file per element, the default) or lines (one element per line).
+	StringListFormat string `json:"stringListFormat"`
+
+	// Optional size in bytes of the pieces to split a large parameter into, each written to its own file.
+	ChunkSize int `json:"chunkSize"`
+
+	// Optional flag to keep the slashes of the name as sub directories of the mount instead of applying pathTranslation.
+	PreservePath bool `json:"preservePath"`
+
+	// Optional tags selecting every Secrets Manager secret that has all of them (used instead of objectName).
+	ObjectTags map[string]string `json:"objectTags"`
+
+	// Optional region to fetch this object from instead of the region (and failover regions) of the mount.
+	Region string `json:"region"`
+
+	// Optional numeric user id to own the mounted files (the provider's user if nil).
+	FileOwner *int `json:"fileOwner"`
+
+	// Optional numeric group id to own the mounted files (the provider's group if nil).
+	FileGroup *int `json:"fileGroup"`
 
 	// Path translation character (not part of YAML spec).
 	translate string `json:"-"`
 
+	// Path translation character for jmesPath object aliases (not part of YAML spec).
+	jmesTranslate string `json:"-"`
+
 	// Mount point directory (not part of YAML spec).
 	mountDir string `json:"-"`
+
+	// Position in the write order computed from DependsOn (not part of YAML spec).
+	writeOrder int `json:"-"`
+
+	// Name of the object a key was exploded from (not part of YAML spec).
+	explodedFrom string `json:"-"`
+
+	// Staging label this copy was expanded from objectVersionStages for (not part of YAML spec).
+	versionStage string `json:"-"`
+
+	// Object holding this jmesPath entry or exploded key (not part of YAML spec).
+	entryOf *SecretDescriptor `json:"-"`
 }
 
 //An individual json key value pair to mount
@@ -53,8 +144,45 @@ type JMESPathEntry struct {
 
 	//File name in which to store the secret in.
 	ObjectAlias string `json:"objectAlias"`
+
+	//Optional action when the path is not found: skip, empty, or error (default).
+	OnMissing string `json:"onMissing"`
+
+	//Optional version of the secret to read the path from instead of the version of the object (secretsmanager only).
+	ObjectVersion string `json:"objectVersion"`
+
+	//Optional staging label of the secret to read the path from instead of that of the object (secretsmanager only).
+	ObjectVersionLabel string `json:"objectVersionLabel"`
 }
 
+// Allowed values for the objectEncoding field.
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+)
+
+// Allowed values for the jmesPath onMissing field.
+const (
+	OnMissingError = "error" // Fail the mount (default)
+	OnMissingSkip  = "skip"  // Do not write the file
+	OnMissingEmpty = "empty" // Write an empty file
+)
+
+// Allowed values for the stringListFormat field.
+const (
+	StringListFiles = "files" // Write each element to its own file (default)
+	StringListLines = "lines" // Write the elements one per line in place of the list
+)
+
+// Defaults for splitting StringList parameters.
+const (
+	defaultStringListDelimiter = ","
+	defaultStringListFileName  = "{name}_{index}"
+)
+
+// Most files a parameter may be split into with chunkSize.
+const maxChunks = 1000
+
 //An individual json key value pair to mount
 type FailoverObjectEntry struct {
 	// Optional name of the failover secret
@@ -67,6 +195,48 @@ type FailoverObjectEntry struct {
 	ObjectVersionLabel string `json:"objectVersionLabel"`
 }
 
+// The failover objects of a secret, one for each failover region.
+//
+// The first entry is used in the first failover region, the second in the
+// second failover region, and so on. Failover regions without an entry use the
+// primary object. A single object (rather than a list) is also accepted, as
+// was required when only one failover region could be used.
+//
+type FailoverObjectList []FailoverObjectEntry
+
+// Unmarshal either a single failover object or a list of them.
+//
+func (l *FailoverObjectList) UnmarshalJSON(data []byte) error {
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var entry FailoverObjectEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		*l = FailoverObjectList{entry}
+		return nil
+	}
+
+	var entries []FailoverObjectEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	*l = entries
+	return nil
+}
+
+// Private helper to get the failover object used in a region.
+//
+// The index is the position of the region in the lookup regions (0 for the
+// primary region). Returns nil when the primary object should be used.
+//
+func (l FailoverObjectList) entry(failoverIndex int) *FailoverObjectEntry {
+	if failoverIndex < 1 || failoverIndex > len(l) {
+		return nil
+	}
+	return &l[failoverIndex-1]
+}
+
 // Enum of supported secret types
 //
 type SecretType int
@@ -80,6 +250,12 @@ func (sType SecretType) String() string {
 	return []string{"ssmparameter", "secretsmanager"}[sType]
 }
 
+// Private map of the largest value each backend can store, in bytes.
+var maxValueSize = map[SecretType]int{
+	SecretsManager: 64 * 1024, // SecretString or SecretBinary
+	SSMParameter:   8 * 1024,  // Advanced parameters
+}
+
 // Private map of allowed objectType and associated ARN type. Used for
 // validating and converting ARNs and objectType.
 var typeMap = map[string]SecretType{
@@ -90,7 +266,9 @@ var typeMap = map[string]SecretType{
 
 // Returns the file name where the secrets are to be written.
 //
-// Uses either the ObjectName or ObjectAlias to construct the file name.
+// Uses either the ObjectName or ObjectAlias to construct the file name. With
+// PreservePath the slashes are kept (so /app/db/password is written to
+// app/db/password under the mount) whatever the pathTranslation.
 //
 func (p *SecretDescriptor) GetFileName() (path string) {
 	fileName := p.ObjectName
@@ -99,7 +277,7 @@ func (p *SecretDescriptor) GetFileName() (path string) {
 	}
 
 	// Translate slashes to underscore if required.
-	if len(p.translate) != 0 {
+	if len(p.translate) != 0 && !p.PreservePath {
 		fileName = strings.ReplaceAll(fileName, string(os.PathSeparator), p.translate)
 	} else {
 		fileName = strings.TrimLeft(fileName, string(os.PathSeparator)) // Strip leading slash
@@ -141,8 +319,7 @@ func (p *SecretDescriptor) getObjectType() (otype string) {
 //
 func (p *SecretDescriptor) GetSecretType() (stype SecretType) {
 
-	// If no objectType, use ARN (but convert ssm to ssmparameter). Note that
-	// SSM does not actually allow ARNs but we convert anyway for other checks.
+	// If no objectType, use ARN (but convert ssm to ssmparameter).
 	sType := p.getObjectType()
 
 	return typeMap[sType]
@@ -153,41 +330,141 @@ func (p *SecretDescriptor) getJmesEntrySecretDescriptor(j *JMESPathEntry) (d Sec
 	return SecretDescriptor{
 		ObjectAlias: j.ObjectAlias,
 		ObjectType:  p.getObjectType(),
-		translate:   p.translate,
+		translate:   p.jmesTranslate,
 		mountDir:    p.mountDir,
+		writeOrder:  p.writeOrder,
+		FileOwner:   p.FileOwner,
+		FileGroup:   p.FileGroup,
+		entryOf:     p.GetSourceDescriptor(),
 	}
 }
 
+// Returns the descriptor of the object a value was read from: the object
+// holding a jmesPath entry or exploded key, or the descriptor itself.
+//
+func (p *SecretDescriptor) GetSourceDescriptor() *SecretDescriptor {
+	if p.entryOf != nil {
+		return p.entryOf
+	}
+	return p
+}
+
+// Returns the position of this object in the write order.
+//
+// Objects with a lower write order must be written before objects with a
+// higher write order. Objects without dependencies have a write order of 0.
+//
+func (p *SecretDescriptor) GetWriteOrder() int {
+	return p.writeOrder
+}
+
+// Returns the user id that should own the mounted files (-1 to leave the
+// owner unchanged).
+//
+func (p *SecretDescriptor) GetFileOwner() int {
+	if p.FileOwner == nil {
+		return -1
+	}
+	return *p.FileOwner
+}
+
+// Returns the group id that should own the mounted files (-1 to leave the
+// group unchanged).
+//
+func (p *SecretDescriptor) GetFileGroup() int {
+	if p.FileGroup == nil {
+		return -1
+	}
+	return *p.FileGroup
+}
+
+// Returns true if the file ownership is set for this object.
+//
+func (p *SecretDescriptor) HasFileOwnership() bool {
+	return p.FileOwner != nil || p.FileGroup != nil
+}
+
+// Returns true if the file for the whole secret should be written.
+//
+// This is false when writeParent is turned off so that only the jmesPath
+// entries are written.
+//
+func (p *SecretDescriptor) GetWriteParent() bool {
+	return p.WriteParent == nil || *p.WriteParent
+}
+
+// Returns true if SecureString parameters should be decrypted when fetched.
+//
+// This is false when withDecryption is turned off so that the encrypted value
+// is mounted for consumers that decrypt it themselves.
+//
+func (p *SecretDescriptor) GetWithDecryption() bool {
+	return p.WithDecryption == nil || *p.WithDecryption
+}
+
 // Returns the secret name for the current descriptor.
 //
-// The current secret name will resolve to the ObjectName if not in failover,
-//  and will resolve the the backup ARN if in failover.
+// The current secret name will resolve to the ObjectName in the primary region
+//  (failover index 0), and to the failover object of a failover region when
+//  one is given for that region.
+//
+// When MatchNamePrefix is set, the random suffix is stripped from Secrets
+// Manager ARNs so the partial ARN matches the secret even after it has been
+// deleted and re-created with the same name.
 //
-func (p *SecretDescriptor) GetSecretName(useFailoverRegion bool) (secretName string) {
-	if len(p.FailoverObject.ObjectName) > 0 && useFailoverRegion {
-		return p.FailoverObject.ObjectName
+func (p *SecretDescriptor) GetSecretName(failoverIndex int) (secretName string) {
+	secretName = p.ObjectName
+	if entry := p.FailoverObject.entry(failoverIndex); entry != nil && len(entry.ObjectName) > 0 {
+		secretName = entry.ObjectName
 	}
-	return p.ObjectName
+	if p.MatchNamePrefix {
+		secretName = secretSuffixRE.ReplaceAllString(secretName, "$1")
+	}
+	return secretName
 }
 
 // Return the ObjectVersionLabel
 //
-func (p *SecretDescriptor) GetObjectVersionLabel(useFailoverRegion bool) (secretName string) {
-	if len(p.FailoverObject.ObjectVersionLabel) > 0 && useFailoverRegion {
-		return p.FailoverObject.ObjectVersionLabel
+func (p *SecretDescriptor) GetObjectVersionLabel(failoverIndex int) (secretName string) {
+	if entry := p.FailoverObject.entry(failoverIndex); entry != nil && len(entry.ObjectVersionLabel) > 0 {
+		return entry.ObjectVersionLabel
 	}
 	return p.ObjectVersionLabel
 }
 
 // Return the ObjectVersion
 //
-func (p *SecretDescriptor) GetObjectVersion(useFailoverRegion bool) (secretName string) {
-	if len(p.FailoverObject.ObjectVersion) > 0 && useFailoverRegion {
-		return p.FailoverObject.ObjectVersion
+func (p *SecretDescriptor) GetObjectVersion(failoverIndex int) (secretName string) {
+	if entry := p.FailoverObject.entry(failoverIndex); entry != nil && len(entry.ObjectVersion) > 0 {
+		return entry.ObjectVersion
 	}
 	return p.ObjectVersion
 }
 
+// Return the object name and the names of all failover objects.
+//
+func (p *SecretDescriptor) GetObjectNames() []string {
+	names := []string{p.ObjectName}
+	for _, entry := range p.FailoverObject {
+		if len(entry.ObjectName) > 0 {
+			names = append(names, entry.ObjectName)
+		}
+	}
+	return names
+}
+
+// Return the region the object is fetched from first.
+//
+// This is the region of the object when it has one, and otherwise the primary
+// region of the mount (the first of the given lookup regions).
+//
+func (p *SecretDescriptor) GetRegion(regions []string) string {
+	if len(p.Region) > 0 || len(regions) == 0 {
+		return p.Region
+	}
+	return regions[0]
+}
+
 // Private helper to validate the contents of SecretDescriptor.
 //
 // This method is used to validate input before it is used by the rest of the
@@ -195,13 +472,40 @@ func (p *SecretDescriptor) GetObjectVersion(useFailoverRegion bool) (secretName
 //
 func (p *SecretDescriptor) validateSecretDescriptor(regions []string) error {
 
-	if len(p.ObjectName) == 0 {
+	if len(p.ObjectTags) > 0 {
+		if err := p.validateTagSelector(); err != nil {
+			return err
+		}
+	} else if len(p.ObjectName) == 0 {
 		return fmt.Errorf("Object name must be specified")
+	} else if err := p.validateObjectName(p.ObjectName, p.ObjectType, p.GetRegion(regions)); err != nil {
+		return err
 	}
 
-	err := p.validateObjectName(p.ObjectName, p.ObjectType, regions[0])
-	if err != nil {
-		return err
+	// Objects with their own region are only fetched from that region.
+	if len(p.Region) > 0 {
+		if !regionRE.MatchString(p.Region) {
+			return fmt.Errorf("region is not a valid AWS region: %s", p.Region)
+		}
+		if !utils.SamePartition(p.Region, regions[0]) {
+			return fmt.Errorf("region %s is not in the same partition as region %s: %s", p.Region, regions[0], p.ObjectName)
+		}
+		if len(p.FailoverObject) > 0 {
+			return fmt.Errorf("failoverObject can not be used with region: %s", p.ObjectName)
+		}
+	}
+
+	// Replicas are looked up in the failover regions in place of failover objects
+	if p.UseReplica {
+		if p.GetSecretType() != SecretsManager {
+			return fmt.Errorf("useReplica is only supported for secretsmanager objects: %s", p.ObjectName)
+		}
+		if len(p.FailoverObject) > 0 || len(p.Region) > 0 {
+			return fmt.Errorf("useReplica can not be used with failoverObject or region: %s", p.ObjectName)
+		}
+		if len(regions) < 2 {
+			return fmt.Errorf("useReplica allowed only when failover region is defined: %s", p.ObjectName)
+		}
 	}
 
 	// Can only use objectVersion or objectVersionLabel for SSM not both
@@ -209,9 +513,66 @@ func (p *SecretDescriptor) validateSecretDescriptor(regions []string) error {
 		return fmt.Errorf("ssm parameters can not specify both objectVersion and objectVersionLabel: %s", p.ObjectName)
 	}
 
+	// The size limit can not be negative or more than the backend allows
+	if p.MaxSize < 0 || p.MaxSize > maxValueSize[p.GetSecretType()] {
+		return fmt.Errorf("maxSize must be between 0 and the %s limit of %d bytes: %s",
+			p.GetSecretType(), maxValueSize[p.GetSecretType()], p.ObjectName)
+	}
+
+	// Only Secrets Manager ARNs have a random suffix to ignore
+	if p.MatchNamePrefix && p.GetSecretType() != SecretsManager {
+		return fmt.Errorf("matchNamePrefix is only supported for secretsmanager objects: %s", p.ObjectName)
+	}
+
 	// Do not allow ../ in a path when translation is turned off
 	if badPathRE.MatchString(p.GetFileName()) {
-		return fmt.Errorf("path can not contain ../: %s", p.ObjectName)
+		return validationErrorf(ErrPathTraversal, "path can not contain ../: %s", p.ObjectName)
+	}
+
+	// Kept paths must name a file below the mount point
+	if p.PreservePath {
+		fileName := p.GetFileName()
+		if filepath.Clean(fileName) != fileName || fileName == "." || fileName == ".." || strings.HasPrefix(fileName, "../") {
+			return validationErrorf(ErrPathTraversal, "preservePath requires a file name without empty, . or .. path elements: %s", p.ObjectName)
+		}
+	}
+
+	// Owners must be valid numeric ids (-1 and 4294967295 mean no change to chown)
+	if p.FileOwner != nil && (*p.FileOwner < 0 || int64(*p.FileOwner) > maxFileID) {
+		return fmt.Errorf("fileOwner must be a numeric user id between 0 and %d: %s", maxFileID, p.ObjectName)
+	}
+	if p.FileGroup != nil && (*p.FileGroup < 0 || int64(*p.FileGroup) > maxFileID) {
+		return fmt.Errorf("fileGroup must be a numeric group id between 0 and %d: %s", maxFileID, p.ObjectName)
+	}
+
+	// Only decode encodings we understand
+	switch p.ObjectEncoding {
+	case "", EncodingBase64, EncodingHex:
+	default:
+		return fmt.Errorf("objectEncoding must be one of base64 or hex: %s", p.ObjectName)
+	}
+
+	// Only Parameter Store decrypts on request, and encrypted values are not JSON
+	if p.WithDecryption != nil && p.GetSecretType() != SSMParameter {
+		return fmt.Errorf("withDecryption is only supported for ssmparameter objects: %s", p.ObjectName)
+	}
+	if !p.GetWithDecryption() && len(p.JMESPath) != 0 {
+		return fmt.Errorf("jmesPath can not be used when withDecryption is false: %s", p.ObjectName)
+	}
+	if !p.GetWithDecryption() && p.ObjectExplode {
+		return fmt.Errorf("objectExplode can not be used when withDecryption is false: %s", p.ObjectName)
+	}
+
+	if err := p.validateStringList(); err != nil {
+		return err
+	}
+	if err := p.validateChunkSize(); err != nil {
+		return err
+	}
+
+	// Something must be written for every object
+	if !p.GetWriteParent() && len(p.JMESPath) == 0 && !p.ObjectExplode && !p.splitsIntoFiles() && p.ChunkSize == 0 {
+		return fmt.Errorf("writeParent can only be false when jmesPath, objectExplode, splitStringList, or chunkSize is used: %s", p.ObjectName)
 	}
 
 	//ensure each jmesPath entry has a path and an objectalias
@@ -223,9 +584,33 @@ func (p *SecretDescriptor) validateSecretDescriptor(regions []string) error {
 		if len(jmesPathEntry.ObjectAlias) == 0 {
 			return fmt.Errorf("Object alias must be specified for JMES object")
 		}
+
+		// Do not allow ../ in an alias when translation is turned off
+		jmesDescriptor := p.getJmesEntrySecretDescriptor(&jmesPathEntry)
+		if badPathRE.MatchString(jmesDescriptor.GetFileName()) {
+			return validationErrorf(ErrPathTraversal, "path can not contain ../: %s", jmesPathEntry.ObjectAlias)
+		}
+
+		switch jmesPathEntry.OnMissing {
+		case "", OnMissingError, OnMissingSkip, OnMissingEmpty:
+		default:
+			return fmt.Errorf("onMissing must be one of skip, empty, or error: %s", jmesPathEntry.OnMissing)
+		}
+
+		// Only Secrets Manager secrets keep several versions of the JSON around
+		if jmesPathEntry.isPinned() && p.GetSecretType() != SecretsManager {
+			return fmt.Errorf("jmesPath objectVersion and objectVersionLabel are only supported for secretsmanager objects: %s", jmesPathEntry.ObjectAlias)
+		}
+		if len(jmesPathEntry.ObjectVersion) != 0 && len(jmesPathEntry.ObjectVersionLabel) != 0 {
+			return fmt.Errorf("jmesPath entries can not specify both objectVersion and objectVersionLabel: %s", jmesPathEntry.ObjectAlias)
+		}
 	}
 
-	if len(p.FailoverObject.ObjectName) > 0 {
+	for i, entry := range p.FailoverObject {
+		if len(entry.ObjectName) == 0 {
+			continue
+		}
+
 		// Backup arns require object alias to be set.
 		if len(p.ObjectAlias) == 0 {
 			return fmt.Errorf("object alias must be specified for objects with failover entries: %s", p.ObjectName)
@@ -235,18 +620,21 @@ func (p *SecretDescriptor) validateSecretDescriptor(regions []string) error {
 		if len(regions) < 2 {
 			return fmt.Errorf("failover object allowed only when failover region is defined: %s", p.ObjectName)
 		}
+		if i+1 >= len(regions) {
+			return fmt.Errorf("%d failover objects given for %d failover regions: %s", len(p.FailoverObject), len(regions)-1, p.ObjectName)
+		}
 
-		err := p.validateObjectName(p.FailoverObject.ObjectName, p.ObjectType, regions[1])
+		err := p.validateObjectName(entry.ObjectName, p.ObjectType, regions[i+1])
 		if err != nil {
 			return err
 		}
 
 		// Can only use objectVersion or objectVersionLabel for SSM not both
-		if p.GetSecretType() == SSMParameter && len(p.FailoverObject.ObjectVersion) != 0 && len(p.FailoverObject.ObjectVersionLabel) != 0 {
+		if p.GetSecretType() == SSMParameter && len(entry.ObjectVersion) != 0 && len(entry.ObjectVersionLabel) != 0 {
 			return fmt.Errorf("ssm parameters can not specify both objectVersion and objectVersionLabel: %s", p.ObjectName)
 		}
 
-		if p.FailoverObject.ObjectVersion != p.ObjectVersion {
+		if entry.ObjectVersion != p.ObjectVersion {
 			return fmt.Errorf("object versions must match between primary and failover regions: %s", p.ObjectName)
 		}
 	}
@@ -254,6 +642,101 @@ func (p *SecretDescriptor) validateSecretDescriptor(regions []string) error {
 	return nil
 }
 
+// Private helper to validate an object selecting secrets by tag.
+//
+// Several secrets may match, so fields naming a single file or version are
+// not allowed.
+//
+func (p *SecretDescriptor) validateTagSelector() error {
+
+	selector := TagSelector(p.ObjectTags)
+	if len(p.ObjectName) != 0 {
+		return fmt.Errorf("objectName and objectTags can not both be used: %s", p.ObjectName)
+	}
+	if p.ObjectType != SecretsManager.String() {
+		return fmt.Errorf("objectTags is only supported for secretsmanager objects: %s", selector)
+	}
+	if len(p.ObjectTags) > maxObjectTags {
+		return fmt.Errorf("objectTags can have at most %d tags: %s", maxObjectTags, selector)
+	}
+	for key := range p.ObjectTags {
+		if len(key) == 0 {
+			return fmt.Errorf("objectTags keys can not be empty: %s", selector)
+		}
+	}
+	if len(p.ObjectAlias) != 0 || len(p.JMESPath) != 0 || p.ObjectExplode {
+		return fmt.Errorf("objectAlias, jmesPath, and objectExplode can not be used with objectTags: %s", selector)
+	}
+	if len(p.ObjectVersion) != 0 || len(p.FailoverObject) != 0 || p.MatchNamePrefix || len(p.DependsOn) != 0 || len(p.Region) != 0 {
+		return fmt.Errorf("objectVersion, failoverObject, matchNamePrefix, dependsOn, and region can not be used with objectTags: %s", selector)
+	}
+	return nil
+}
+
+// Private helper to validate the splitStringList options.
+//
+// The element file names depend on the value, so only the pattern can be
+// checked here; the names themselves are checked when the list is split.
+//
+func (p *SecretDescriptor) validateStringList() error {
+
+	if !p.SplitStringList {
+		if len(p.StringListDelimiter) != 0 || len(p.StringListFileName) != 0 || len(p.StringListFormat) != 0 {
+			return fmt.Errorf("stringListDelimiter, stringListFileName, and stringListFormat require splitStringList: %s", p.ObjectName)
+		}
+		return nil
+	}
+	if p.GetSecretType() != SSMParameter {
+		return fmt.Errorf("splitStringList is only supported for ssmparameter objects: %s", p.ObjectName)
+	}
+	if !p.GetWithDecryption() || len(p.JMESPath) != 0 || p.ObjectExplode {
+		return fmt.Errorf("splitStringList can not be used with jmesPath, objectExplode, or withDecryption false: %s", p.ObjectName)
+	}
+
+	switch p.StringListFormat {
+	case "", StringListFiles:
+	case StringListLines:
+		if len(p.StringListFileName) != 0 {
+			return fmt.Errorf("stringListFileName can not be used when stringListFormat is lines: %s", p.ObjectName)
+		}
+	default:
+		return fmt.Errorf("stringListFormat must be one of files or lines: %s", p.ObjectName)
+	}
+	if len(p.StringListFileName) != 0 && !strings.Contains(p.StringListFileName, "{index}") {
+		return fmt.Errorf("stringListFileName must contain {index}: %s", p.ObjectName)
+	}
+	return nil
+}
+
+// Private helper to validate the chunkSize option.
+//
+// Chunks are named like split list elements ({name}_{index}), so a parameter
+// can not be both chunked and split into elements.
+//
+func (p *SecretDescriptor) validateChunkSize() error {
+
+	if p.ChunkSize == 0 {
+		return nil
+	}
+	if p.ChunkSize < 0 {
+		return fmt.Errorf("chunkSize can not be negative: %s", p.ObjectName)
+	}
+	if p.GetSecretType() != SSMParameter {
+		return fmt.Errorf("chunkSize is only supported for ssmparameter objects: %s", p.ObjectName)
+	}
+	if p.SplitStringList || len(p.JMESPath) != 0 || p.ObjectExplode {
+		return fmt.Errorf("chunkSize can not be used with splitStringList, jmesPath, or objectExplode: %s", p.ObjectName)
+	}
+	return nil
+}
+
+// Private helper to tell if the elements of a split list are written to their
+// own files.
+//
+func (p *SecretDescriptor) splitsIntoFiles() bool {
+	return p.SplitStringList && p.StringListFormat != StringListLines
+}
+
 // Private helper to validate an objectname.
 //
 // This function validates the objectname string, and makes sure it matches the
@@ -276,67 +759,123 @@ func (p *SecretDescriptor) validateObjectName(objectName string, objectType stri
 		return fmt.Errorf("ARN region must match region %s: %s", region, objectName)
 	}
 
+	// The ARN must also be in the partition of the region (for example
+	// arn:aws-cn: in China), since a region is only in one partition.
+	if partition := utils.PartitionOf(region); hasARN && len(partition) > 0 && objARN.Partition != partition {
+		return fmt.Errorf("ARN partition must be %s in region %s: %s", partition, region, objectName)
+	}
+
 	// Make sure either objectType is used or a full ARN is specified
 	if len(objectType) == 0 && !hasARN {
-		return fmt.Errorf("Must use objectType when a full ARN is not specified: %s", objectName)
+		return validationErrorf(ErrInvalidObjectType, "Must use objectType when a full ARN is not specified: %s", objectName)
 	}
 
 	// Make sure the ARN is for a supported service
 	_, ok := typeMap[objARN.Service]
 	if len(objectType) == 0 && !ok {
-		return fmt.Errorf("Invalid service in ARN: %s", objARN.Service)
+		return validationErrorf(ErrInvalidObjectType, "Invalid service in ARN: %s", objARN.Service)
 	}
 
 	// Make sure objectType is one we understand
 	_, ok = typeMap[objectType]
 	if len(objectType) != 0 && (!ok || objectType == "ssm") {
-		return fmt.Errorf("Invalid objectType: %s", objectType)
+		return validationErrorf(ErrInvalidObjectType, "Invalid objectType: %s", objectType)
 	}
 
 	// If both ARN and objectType are used make sure they agree
 	if len(objectType) != 0 && hasARN && typeMap[objectType] != typeMap[objARN.Service] {
-		return fmt.Errorf("objectType does not match ARN: %s", objectName)
+		return validationErrorf(ErrInvalidObjectType, "objectType does not match ARN: %s", objectName)
 	}
 
-	return nil
+	// SSM ARNs (used for shared parameters) must name a parameter
+	if hasARN && typeMap[objARN.Service] == SSMParameter && !strings.HasPrefix(objARN.Resource, "parameter/") {
+		return fmt.Errorf("ssm parameter ARNs must be of the form arn:<partition>:ssm:<region>:<account>:parameter/<name>: %s", objectName)
+	}
+
+	// Catch names AWS would reject before anything is fetched.
+	if hasARN {
+		return validateNameRules(objectName, typeMap[objARN.Service], &objARN)
+	}
+	return validateNameRules(objectName, typeMap[objectType], nil)
 }
 
 // Group requested objects by secret type and return a map (keyed by secret type) of slices of requests.
 //
 // This function will parse the objects array specified in the
 // SecretProviderClass passed on the mount request. All entries will be
-// validated. The object will be grouped into slices based on GetSecretType()
+// linted for common mistakes and validated. The object will be grouped into slices based on GetSecretType()
 // and returned in a map keyed by secret type. This is to allow batching of
 // requests.
 //
-func NewSecretDescriptorList(mountDir, translate, objectSpec string, regions []string) (
+func NewSecretDescriptorList(mountDir, translate, jmesTranslate, objectSpec string, regions []string) (
+	desc map[SecretType][]*SecretDescriptor,
+	e error,
+) {
+	return NewSecretDescriptorListWithOptions(mountDir, translate, jmesTranslate, objectSpec, regions, DescriptorOptions{})
+}
+
+// Group requested objects by secret type using the given descriptor options.
+//
+func NewSecretDescriptorListWithOptions(mountDir, translate, jmesTranslate, objectSpec string, regions []string, opts DescriptorOptions) (
 	desc map[SecretType][]*SecretDescriptor,
 	e error,
 ) {
 
 	// See if we should substitite underscore for slash
-	if len(translate) == 0 {
-		translate = "_" // Use default
-	} else if strings.ToLower(translate) == "false" {
-		translate = "" // Turn it off.
-	} else if len(translate) != 1 {
-		return nil, fmt.Errorf("pathTranslation must be either 'False' or a single character string")
+	translate, err := parseTranslation("pathTranslation", translate)
+	if err != nil {
+		return nil, err
+	}
+
+	// JMES aliases use pathTranslation unless told otherwise
+	if len(jmesTranslate) == 0 {
+		jmesTranslate = translate
+	} else if jmesTranslate, err = parseTranslation("jmesPathTranslation", jmesTranslate); err != nil {
+		return nil, err
 	}
 
 	// Unpack the SecretProviderClass mount specification
+	if len(objectSpec) > maxObjectSpecSize {
+		return nil, fmt.Errorf("SecretProviderClass objects exceed %d bytes", maxObjectSpecSize)
+	}
 	descriptors := make([]*SecretDescriptor, 0)
-	err := yaml.Unmarshal([]byte(objectSpec), &descriptors)
+	err = yaml.Unmarshal([]byte(objectSpec), &descriptors)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to load SecretProviderClass: %+v", err)
 	}
 
+	// Mount each staged version of a secret as its own object.
+	descriptors, err = expandVersionStages(descriptors)
+	if err != nil {
+		return nil, err
+	}
+
 	// Validate each record and check for duplicates
 	groups := make(map[SecretType][]*SecretDescriptor, 0)
-	names := make(map[string]bool)
+	names := make(map[string]*SecretDescriptor)
 	for _, descriptor := range descriptors {
 
+		if descriptor == nil { // An empty list entry
+			return nil, fmt.Errorf("Object entries can not be empty")
+		}
+
 		descriptor.translate = translate
+		descriptor.jmesTranslate = jmesTranslate
 		descriptor.mountDir = mountDir
+
+		// Look for common mistakes first to give a more helpful error.
+		err = descriptor.lintSecretDescriptor()
+		if err != nil {
+			return nil, err
+		}
+
+		// ARNs in another region are read from that region when allowed.
+		if opts.AllowCrossRegionARNs {
+			if region := descriptor.arnRegion(regions); len(region) > 0 {
+				descriptor.Region = region
+			}
+		}
+
 		err = descriptor.validateSecretDescriptor(regions)
 		if err != nil {
 			return nil, err
@@ -346,17 +885,25 @@ func NewSecretDescriptorList(mountDir, translate, objectSpec string, regions []s
 		sType := descriptor.GetSecretType()
 		groups[sType] = append(groups[sType], descriptor)
 
-		// Check for duplicate names
-		if names[descriptor.ObjectName] {
-			return nil, fmt.Errorf("Name already in use for objectName: %s", descriptor.ObjectName)
+		// Objects selected by tag are only named once they are resolved.
+		if len(descriptor.ObjectTags) > 0 {
+			continue
+		}
+
+		// Check for duplicate names. The staged copies of a secret share its
+		// objectName but write to their own files.
+		prev := names[descriptor.ObjectName]
+		if prev != nil && (prev.ObjectName != descriptor.ObjectName || len(prev.versionStage)+len(descriptor.versionStage) == 0) {
+			return nil, validationErrorf(ErrDuplicateAlias, "Name already in use for objectName: %s", descriptor.ObjectName)
+		} else if prev == nil {
+			names[descriptor.ObjectName] = descriptor
 		}
-		names[descriptor.ObjectName] = true
 
 		if len(descriptor.ObjectAlias) > 0 {
-			if names[descriptor.ObjectAlias] {
-				return nil, fmt.Errorf("Name already in use for objectAlias: %s", descriptor.ObjectAlias)
+			if names[descriptor.ObjectAlias] != nil {
+				return nil, validationErrorf(ErrDuplicateAlias, "Name already in use for objectAlias: %s", descriptor.ObjectAlias)
 			}
-			names[descriptor.ObjectAlias] = true
+			names[descriptor.ObjectAlias] = descriptor
 		}
 
 		if len(descriptor.JMESPath) == 0 { //jmesPath not used. No more checks
@@ -364,14 +911,79 @@ func NewSecretDescriptorList(mountDir, translate, objectSpec string, regions []s
 		}
 
 		for _, jmesPathEntry := range descriptor.JMESPath {
-			if names[jmesPathEntry.ObjectAlias] {
-				return nil, fmt.Errorf("Name already in use for objectAlias: %s", jmesPathEntry.ObjectAlias)
+			if names[jmesPathEntry.ObjectAlias] != nil {
+				return nil, validationErrorf(ErrDuplicateAlias, "Name already in use for objectAlias: %s", jmesPathEntry.ObjectAlias)
 			}
 
-			names[jmesPathEntry.ObjectAlias] = true
+			names[jmesPathEntry.ObjectAlias] = descriptor
 		}
 
 	}
 
+	// Work out the order in which to write the objects.
+	visiting := make(map[*SecretDescriptor]bool)
+	done := make(map[*SecretDescriptor]bool)
+	for _, descriptor := range descriptors {
+		err = descriptor.resolveWriteOrder(names, visiting, done)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return groups, nil
 }
+
+// Private helper to convert a path translation attribute to the character
+// to use.
+//
+// Returns the default (underscore) when not specified and an empty string when
+// translation is turned off.
+//
+func parseTranslation(name, translate string) (string, error) {
+	if len(translate) == 0 {
+		return "_", nil // Use default
+	} else if strings.ToLower(translate) == "false" {
+		return "", nil // Turn it off.
+	} else if len(translate) != 1 {
+		return "", fmt.Errorf("%s must be either 'False' or a single character string", name)
+	}
+	return translate, nil
+}
+
+// Private helper to compute the write order of a descriptor from DependsOn.
+//
+// Each object is written after every object it depends on, so its write order
+// is one more than the highest write order of its dependencies. Dependencies
+// may name an objectName, objectAlias, or jmesPath objectAlias (which refers
+// to the object containing it). Unknown names and cycles are rejected.
+//
+func (p *SecretDescriptor) resolveWriteOrder(
+	names map[string]*SecretDescriptor,
+	visiting, done map[*SecretDescriptor]bool,
+) error {
+
+	if done[p] {
+		return nil
+	}
+	if visiting[p] {
+		return fmt.Errorf("dependsOn cycle detected for objectName: %s", p.ObjectName)
+	}
+	visiting[p] = true
+
+	for _, name := range p.DependsOn {
+		dep := names[name]
+		if dep == nil {
+			return fmt.Errorf("dependsOn references unknown object %s: %s", name, p.ObjectName)
+		}
+
+		err := dep.resolveWriteOrder(names, visiting, done)
+		if err != nil {
+			return err
+		}
+		p.writeOrder = max(p.writeOrder, dep.writeOrder+1)
+	}
+
+	visiting[p] = false
+	done[p] = true
+	return nil
+}
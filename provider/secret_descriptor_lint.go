@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Secrets Manager staging labels used to catch typos in objectVersionLabel.
+var knownVersionStages = []string{"AWSCURRENT", "AWSPREVIOUS", "AWSPENDING"}
+
+// Common alternate spellings of the supported objectType values.
+var objectTypeAliases = map[string]string{
+	"secretsmanager":    "secretsmanager",
+	"secretmanager":     "secretsmanager",
+	"secrets":           "secretsmanager",
+	"ssmparameter":      "ssmparameter",
+	"ssmparameters":     "ssmparameter",
+	"ssm":               "ssmparameter",
+	"parameterstore":    "ssmparameter",
+	"ssmparameterstore": "ssmparameter",
+}
+
+// Private helper to look for common mistakes in a descriptor.
+//
+// Unlike validateSecretDescriptor, which reports what is wrong, this lint pass
+// looks for likely typos (objectType casing, ARN vs name confusion) and returns
+// an error suggesting the probable fix. Staging labels close to a known label
+// only log a warning, since custom labels may legitimately look like them.
+//
+func (p *SecretDescriptor) lintSecretDescriptor() error {
+
+	// Suggest the correct objectType for near misses like SecretsManager or ssm.
+	if _, ok := typeMap[p.ObjectType]; len(p.ObjectType) != 0 && (!ok || p.ObjectType == "ssm") {
+		if suggestion := suggestObjectType(p.ObjectType); len(suggestion) != 0 {
+			return validationErrorf(ErrInvalidObjectType, "Invalid objectType: %s (did you mean %q?)", p.ObjectType, suggestion)
+		}
+	}
+
+	err := lintObjectName(p.ObjectName, p.ObjectType)
+	if err != nil {
+		return err
+	}
+	for _, entry := range p.FailoverObject {
+		err = lintObjectName(entry.ObjectName, p.ObjectType)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Staging labels only apply to Secrets Manager.
+	if p.ObjectType == "ssmparameter" || strings.HasPrefix(p.ObjectName, "arn:aws:ssm:") {
+		return nil
+	}
+	labels := []string{p.ObjectVersionLabel}
+	for _, entry := range p.FailoverObject {
+		labels = append(labels, entry.ObjectVersionLabel)
+	}
+	for _, label := range labels {
+		if suggestion := suggestVersionStage(label); len(suggestion) != 0 {
+			utils.Warningf("objectVersionLabel %s is not a known staging label (did you mean %q?)", label, suggestion)
+		}
+	}
+
+	return nil
+}
+
+// Private helper to look for confusion between names and ARNs.
+//
+func lintObjectName(objectName, objectType string) error {
+
+	if len(objectName) == 0 {
+		return nil
+	}
+
+	if strings.TrimSpace(objectName) != objectName {
+		return fmt.Errorf("objectName has leading or trailing whitespace: %q", objectName)
+	}
+
+	// Catch placeholders that were not replaced with a node label.
+	if placeholder := namePlaceholderRE.FindString(objectName); len(placeholder) > 0 {
+		return validationErrorf(ErrInvalidObjectName, "objectName has an unknown placeholder %s: %s (node labels must be enabled with --object-name-node-labels)", placeholder, objectName)
+	}
+
+	// Catch ARNs with the wrong case or missing the arn: prefix.
+	lower := strings.ToLower(objectName)
+	if strings.HasPrefix(lower, "arn:") && !strings.HasPrefix(objectName, "arn:") {
+		return fmt.Errorf("ARN prefix must be lower case: %s (did you mean %q?)", objectName, "arn:"+objectName[4:])
+	}
+	for _, svc := range []string{"secretsmanager", "ssm"} {
+		for _, partition := range utils.Partitions() {
+			if strings.HasPrefix(objectName, partition+":"+svc+":") {
+				return fmt.Errorf("ARN is missing the arn: prefix: %s (did you mean %q?)", objectName, "arn:"+objectName)
+			}
+		}
+	}
+
+	// Catch an ARN for one service used with the objectType of the other.
+	if objectType == "ssmparameter" && strings.Contains(objectName, ":secretsmanager:") {
+		return fmt.Errorf("objectName is a Secrets Manager ARN: %s (did you mean objectType %q?)", objectName, "secretsmanager")
+	}
+	if objectType == "secretsmanager" && strings.Contains(objectName, ":ssm:") {
+		return fmt.Errorf("objectName is an SSM parameter ARN: %s (did you mean objectType %q?)", objectName, "ssmparameter")
+	}
+
+	return nil
+}
+
+// Private helper to find the objectType a user most likely meant.
+//
+// Returns an empty string when there is no plausible suggestion.
+//
+func suggestObjectType(objectType string) string {
+
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(objectType))
+
+	if suggestion, ok := objectTypeAliases[normalized]; ok {
+		return suggestion
+	}
+	for _, candidate := range []string{"secretsmanager", "ssmparameter"} {
+		if editDistance(normalized, candidate) <= 2 {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Private helper to find the staging label a user most likely meant.
+//
+// Returns an empty string when the label is a known label or is not close to
+// one (custom labels are allowed).
+//
+func suggestVersionStage(label string) string {
+
+	if len(label) == 0 {
+		return ""
+	}
+	for _, stage := range knownVersionStages {
+		if label == stage {
+			return ""
+		}
+	}
+	for _, stage := range knownVersionStages {
+		if editDistance(strings.ToUpper(label), stage) <= 2 {
+			return stage
+		}
+	}
+	return ""
+}
+
+// Private implementation of the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+type lintTest struct {
+	testName string
+	objects  string
+	expErr   string
+}
+
+var lintTests []lintTest = []lintTest{
+	{
+		testName: "objectType casing",
+		objects: `
+          - objectName: secret1
+            objectType: SecretsManager`,
+		expErr: `Invalid objectType: SecretsManager (did you mean "secretsmanager"?)`,
+	},
+	{
+		testName: "objectType short form",
+		objects: `
+          - objectName: parm1
+            objectType: ssm`,
+		expErr: `Invalid objectType: ssm (did you mean "ssmparameter"?)`,
+	},
+	{
+		testName: "objectType typo",
+		objects: `
+          - objectName: parm1
+            objectType: ssmparamter`,
+		expErr: `Invalid objectType: ssmparamter (did you mean "ssmparameter"?)`,
+	},
+	{
+		testName: "Secrets Manager ARN with ssmparameter",
+		objects: `
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw
+            objectType: ssmparameter`,
+		expErr: `objectName is a Secrets Manager ARN: arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw (did you mean objectType "secretsmanager"?)`,
+	},
+	{
+		testName: "ARN missing prefix",
+		objects: `
+          - objectName: aws:secretsmanager:us-west-2:123456789012:secret:feaw`,
+		expErr: `ARN is missing the arn: prefix: aws:secretsmanager:us-west-2:123456789012:secret:feaw (did you mean "arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw"?)`,
+	},
+	{
+		testName: "ARN upper case prefix",
+		objects: `
+          - objectName: ARN:aws:secretsmanager:us-west-2:123456789012:secret:feaw`,
+		expErr: `ARN prefix must be lower case: ARN:aws:secretsmanager:us-west-2:123456789012:secret:feaw (did you mean "arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw"?)`,
+	},
+	{
+		testName: "Whitespace in name",
+		objects: `
+          - objectName: " secret1"
+            objectType: secretsmanager`,
+		expErr: `objectName has leading or trailing whitespace: " secret1"`,
+	},
+	{
+		testName: "Version label typo warns",
+		objects: `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectVersionLabel: AWSCURENT`,
+		expErr: "", // Only a warning
+	},
+	{
+		testName: "Version label casing warns",
+		objects: `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectVersionLabel: awsprevious`,
+		expErr: "", // Only a warning
+	},
+	{
+		testName: "Custom version label",
+		objects: `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectVersionLabel: custom`,
+		expErr: "",
+	},
+	{
+		testName: "SSM label not checked",
+		objects: `
+          - objectName: parm1
+            objectType: ssmparameter
+            objectVersionLabel: AWSCURENT`,
+		expErr: "",
+	},
+	{
+		testName: "Unknown placeholder",
+		objects: `
+          - objectName: db-{topology.kubernetes.io/zone}
+            objectType: secretsmanager`,
+		expErr: "objectName has an unknown placeholder {topology.kubernetes.io/zone}: db-{topology.kubernetes.io/zone} (node labels must be enabled with --object-name-node-labels)",
+	},
+}
+
+func TestExpandObjectNames(t *testing.T) {
+
+	objects := `
+        - objectName: db-{zone}
+          objectType: secretsmanager
+          objectAlias: "{zone}"
+          failoverObject:
+            - objectName: db-{zone}-dr
+        - objectName: parm-{zone}-{rack}
+          objectType: ssmparameter
+          failoverObject: {objectName: "parm-{zone}"}`
+	expanded, err := ExpandObjectNames(objects, map[string]string{"zone": "us-west-2a"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var descriptors []*SecretDescriptor
+	if err := yaml.Unmarshal([]byte(expanded), &descriptors); err != nil {
+		t.Fatalf("Can not read expanded objects: %v", err)
+	}
+	for _, tc := range []struct{ got, exp string }{
+		{descriptors[0].ObjectName, "db-us-west-2a"},
+		{descriptors[0].ObjectAlias, "{zone}"}, // Only names are expanded
+		{descriptors[0].FailoverObject[0].ObjectName, "db-us-west-2a-dr"},
+		{descriptors[1].ObjectName, "parm-us-west-2a-{rack}"}, // No value
+		{descriptors[1].FailoverObject[0].ObjectName, "parm-us-west-2a"},
+	} {
+		if tc.got != tc.exp {
+			t.Errorf("Expected %s, got %s", tc.exp, tc.got)
+		}
+	}
+
+	if _, err := ExpandObjectNames("objectName: x", nil); err == nil {
+		t.Errorf("Expected an error for an invalid specification")
+	}
+}
+
+func TestSuggestVersionStage(t *testing.T) {
+	for label, exp := range map[string]string{
+		"AWSCURENT":   "AWSCURRENT",
+		"awsprevious": "AWSPREVIOUS",
+		"AWSPENDING":  "",
+		"custom":      "",
+		"":            "",
+	} {
+		if got := suggestVersionStage(label); got != exp {
+			t.Errorf("Expected %q for %s, got %q", exp, label, got)
+		}
+	}
+}
+
+func TestLintDescriptors(t *testing.T) {
+	for _, tst := range lintTests {
+		t.Run(tst.testName, func(t *testing.T) {
+			_, err := NewSecretDescriptorList("/", "", "", tst.objects, singleRegion)
+			if len(tst.expErr) == 0 && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(tst.expErr) != 0 && (err == nil || err.Error() != tst.expErr) {
+				t.Fatalf("Expected error: %s, got error: %v", tst.expErr, err)
+			}
+		})
+	}
+}
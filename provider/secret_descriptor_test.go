@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -116,6 +117,16 @@ func TestSSMObjectType(t *testing.T) {
 	RunDescriptorValidationTest(t, &descriptor, expectedErrorMessage)
 }
 
+func TestBadParameterArn(t *testing.T) {
+	objectName := "arn:aws:ssm:us-west-2:123456789012:document/feaw"
+	descriptor := SecretDescriptor{
+		ObjectName: objectName,
+	}
+
+	expectedErrorMessage := fmt.Sprintf("ssm parameter ARNs must be of the form arn:<partition>:ssm:<region>:<account>:parameter/<name>: %s", objectName)
+	RunDescriptorValidationTest(t, &descriptor, expectedErrorMessage)
+}
+
 func TestObjectTypeMisMatchArn(t *testing.T) {
 	objectName := "arn:aws:secretsmanager:us-west-2:123456789012:secret:/feaw"
 	descriptor := SecretDescriptor{
@@ -149,7 +160,7 @@ func TestConflictingName(t *testing.T) {
         - objectName: secret1
           objectType: ssmparameter`
 
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 	expectedErrorMessage := fmt.Sprintf("Name already in use for objectName: %s", "secret1")
 
 	if err == nil || err.Error() != expectedErrorMessage {
@@ -167,7 +178,7 @@ func TestConflictingAlias(t *testing.T) {
             objectType: ssmparameter
             objectAlias: aliasOne`
 
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 	expectedErrorMessage := fmt.Sprintf("Name already in use for objectAlias: %s", "aliasOne")
 
 	if err == nil || err.Error() != expectedErrorMessage {
@@ -187,7 +198,7 @@ func TestConflictingAliasJMES(t *testing.T) {
               - path: .username
                 objectAlias: aliasOne`
 
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 	expectedErrorMessage := fmt.Sprintf("Name already in use for objectAlias: %s", "aliasOne")
 
 	if err == nil || err.Error() != expectedErrorMessage {
@@ -195,6 +206,33 @@ func TestConflictingAliasJMES(t *testing.T) {
 	}
 }
 
+// Make sure common failures can be told apart without matching the message.
+func TestValidationErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		objects string
+		kind    error
+	}{
+		{"[{objectName: secret1, objectType: ssmparameter}, {objectName: secret1, objectType: ssmparameter}]", ErrDuplicateAlias},
+		{"[{objectName: secret1, objectType: ssmparameter, objectAlias: a}, {objectName: secret2, objectType: ssmparameter, objectAlias: a}]", ErrDuplicateAlias},
+		{"[{objectName: secret1, objectType: SecretsManger}]", ErrInvalidObjectType},
+		{"[{objectName: secret1, objectType: secretsmanager}, {objectName: secret2, objectType: sqs}]", ErrInvalidObjectType},
+		{"[{objectName: secret1}]", ErrInvalidObjectType},
+		{"[{objectName: secret1, objectType: ssmparameter, objectAlias: ../etc/passwd}]", ErrPathTraversal},
+		{"[{objectName: secret1, objectType: secretsmanager, jmesPath: [{path: user, objectAlias: a/../../b}]}]", ErrPathTraversal},
+	} {
+		_, err := NewSecretDescriptorList("/", "False", "", tc.objects, singleRegion)
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("Expected %v for %s, got %v", tc.kind, tc.objects, err)
+		}
+	}
+
+	// Other failures are none of these.
+	_, err := NewSecretDescriptorList("/", "", "", "[{objectType: ssmparameter}]", singleRegion)
+	if err == nil || errors.Is(err, ErrDuplicateAlias) || errors.Is(err, ErrInvalidObjectType) || errors.Is(err, ErrPathTraversal) {
+		t.Errorf("Unexpected error kind: %v", err)
+	}
+}
+
 func TestMissingAliasJMES(t *testing.T) {
 	objects :=
 		`
@@ -203,7 +241,7 @@ func TestMissingAliasJMES(t *testing.T) {
             jmesPath:
               - path: .username`
 
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 	expectedErrorMessage := fmt.Sprintf("Object alias must be specified for JMES object")
 
 	if err == nil || err.Error() != expectedErrorMessage {
@@ -219,7 +257,7 @@ func TestMissingPathJMES(t *testing.T) {
             jmesPath:
               - objectAlias: aliasOne`
 
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 	expectedErrorMessage := fmt.Sprintf("Path must be specified for JMES object")
 
 	if err == nil || err.Error() != expectedErrorMessage {
@@ -227,6 +265,24 @@ func TestMissingPathJMES(t *testing.T) {
 	}
 }
 
+func TestInvalidOnMissingJMES(t *testing.T) {
+	objects :=
+		`
+          - objectName: secret2
+            objectType: ssmparameter
+            jmesPath:
+              - path: username
+                objectAlias: aliasOne
+                onMissing: ignore`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "onMissing must be one of skip, empty, or error: ignore"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
 //test separation/grouping into ssm/secretsmanager with valid parameters
 func TestNewDescriptorList(t *testing.T) {
 	objects := `
@@ -237,7 +293,7 @@ func TestNewDescriptorList(t *testing.T) {
           - objectName: secret3
             objectType: ssmparameter
             objectAlias: myParm`
-	descriptorList, err := NewSecretDescriptorList("/", "_", objects, singleRegion)
+	descriptorList, err := NewSecretDescriptorList("/", "_", "", objects, singleRegion)
 
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
@@ -265,7 +321,7 @@ func TestBadYaml(t *testing.T) {
           - objectName: secret1
             objectType: secretsmanager
           - {`
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 
 	if err == nil {
 		t.Fatalf("Expected error but got none.")
@@ -276,7 +332,7 @@ func TestBadYaml(t *testing.T) {
 func TestErrorYaml(t *testing.T) {
 	objects := `
           - objectName: secret1`
-	_, err := NewSecretDescriptorList("/", "", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
 
 	if err == nil {
 		t.Fatalf("Expected error but got none.")
@@ -299,7 +355,7 @@ func TestBadTrans(t *testing.T) {
           - objectName: secret1
             objectType: secretsmanager
     `
-	_, err := NewSecretDescriptorList("/", "--", objects, singleRegion)
+	_, err := NewSecretDescriptorList("/", "--", "", objects, singleRegion)
 
 	if err == nil || !strings.Contains(err.Error(), "must be either 'False' or a single character") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -314,7 +370,7 @@ func TestGetPath(t *testing.T) {
           objectType: ssmparameter
     `
 
-	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", objects, singleRegion)
+	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", "", objects, singleRegion)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -362,7 +418,7 @@ func TestTraversal(t *testing.T) {
 
 	for _, obj := range objects {
 
-		_, err := NewSecretDescriptorList("/", "False", obj, singleRegion)
+		_, err := NewSecretDescriptorList("/", "False", "", obj, singleRegion)
 
 		if err == nil || !strings.Contains(err.Error(), "path can not contain ../") {
 			t.Errorf("Expected error: path can not contain ../, got error: %v\n%v", err, obj)
@@ -398,7 +454,7 @@ func TestNotTraversal(t *testing.T) {
 
 	for _, obj := range objects {
 
-		desc, err := NewSecretDescriptorList("/", "False", obj, singleRegion)
+		desc, err := NewSecretDescriptorList("/", "False", "", obj, singleRegion)
 
 		if len(desc[SSMParameter]) == 0 && len(desc[SecretsManager]) == 0 {
 			t.Errorf("TestNotTraversal: Missing descriptor for %v", obj)
@@ -419,7 +475,7 @@ func TestFallbackObjectRequiresAlias(t *testing.T) {
       failoverObject: 
         objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret1"`
 
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 	if err == nil || !strings.Contains(err.Error(), "object alias must be specified for objects with failover entries") {
 		t.Fatalf("Unexpected error, got %v", err)
 	}
@@ -432,7 +488,7 @@ func TestFallbackNonARNStillNeedsObjectType(t *testing.T) {
       failoverObject: {objectName: "MySecret"}        
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "Must use objectType when a full ARN is not specified") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -447,7 +503,7 @@ func TestBackupArnMustBePairedWithObjectType(t *testing.T) {
       failoverObject: 
          objectName: "arn:aws:secretsmanager:us-west-1:123456789012:secret:secret1"`
 
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-2", "us-west-1"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-2", "us-west-1"})
 
 	if err == nil || !strings.Contains(err.Error(), "Must use objectType when a full ARN is not specified") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -462,7 +518,7 @@ func TestBackupArnDoesNotMatchType(t *testing.T) {
       objectType: "secretsmanager"
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "objectType does not match ARN") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -476,7 +532,7 @@ func TestBackupArnInvalidType(t *testing.T) {
       failoverObject: {objectName: "arn:aws:bad:us-west-2:123456789012:secret:secret1"}	  
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "Invalid service in ARN") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -490,7 +546,7 @@ func TestBackupArnSuccess(t *testing.T) {
       failoverObject: {objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret1"}	 
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -503,7 +559,7 @@ func TestPrimaryArnRequiresRegionMatch(t *testing.T) {
     - objectName: "arn:aws:secretsmanager:us-west-1:123456789012:secret:secret1"
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "ARN region must match region us-west-2") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -517,13 +573,33 @@ func TestBackupArnRequiresRegionMatch(t *testing.T) {
       failoverObject: {objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret1"}
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-east-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-east-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "ARN region must match region us-east-2") {
 		t.Fatalf("Unexpected error, got %v", err)
 	}
 }
 
+// ARNs must be in the partition of their region, such as aws-cn in China.
+func TestArnRequiresPartitionMatch(t *testing.T) {
+	objects := `
+    - objectName: "arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:secret1"
+      objectAlias: test
+    `
+	if _, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"cn-north-1"}); err != nil {
+		t.Fatalf("Unexpected error, got %v", err)
+	}
+
+	objects = `
+    - objectName: "arn:aws:ssm:us-gov-west-1:123456789012:parameter/param1"
+      objectAlias: test
+    `
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-gov-west-1"})
+	if err == nil || !strings.Contains(err.Error(), "ARN partition must be aws-us-gov in region us-gov-west-1") {
+		t.Fatalf("Unexpected error, got %v", err)
+	}
+}
+
 //If a failoverObject is given, then a failover region must be given.
 func TestFallbackDataRequiresMultipleRegions(t *testing.T) {
 	objects := `
@@ -531,13 +607,83 @@ func TestFallbackDataRequiresMultipleRegions(t *testing.T) {
       failoverObject: {objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret1"}	 
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1"})
 
 	if err == nil || !strings.Contains(err.Error(), "failover object allowed only when failover region") {
 		t.Fatalf("Unexpected error, got %v", err)
 	}
 }
 
+//A list of failover objects gives the object to use in each failover region.
+func TestFailoverObjectList(t *testing.T) {
+	objects := `
+    - objectName: "arn:aws:secretsmanager:us-west-1:123456789012:secret:secret1"
+      objectAlias: test
+      failoverObject:
+        - {objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret2", objectVersionLabel: AWSPREVIOUS}
+        - {objectName: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:secret3"}
+    `
+	desc, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2", "eu-west-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	descriptor := desc[SecretsManager][0]
+	for i, expected := range []string{"secret1", "secret2", "secret3"} {
+		if name := descriptor.GetSecretName(i); !strings.HasSuffix(name, expected) {
+			t.Errorf("Expected %s in region %d but got %s", expected, i, name)
+		}
+	}
+	if descriptor.GetObjectVersionLabel(1) != "AWSPREVIOUS" || len(descriptor.GetObjectVersionLabel(2)) != 0 {
+		t.Errorf("Unexpected version labels %s %s", descriptor.GetObjectVersionLabel(1), descriptor.GetObjectVersionLabel(2))
+	}
+	if names := descriptor.GetObjectNames(); len(names) != 3 {
+		t.Errorf("Unexpected object names %v", names)
+	}
+
+	// Each failover object must be in its own region.
+	_, err = NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "eu-west-1", "us-west-2"})
+	if err == nil || !strings.Contains(err.Error(), "ARN region must match region eu-west-1") {
+		t.Fatalf("Unexpected error, got %v", err)
+	}
+
+	// There can not be more failover objects than failover regions.
+	_, err = NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
+	if err == nil || !strings.Contains(err.Error(), "2 failover objects given for 1 failover regions") {
+		t.Fatalf("Unexpected error, got %v", err)
+	}
+}
+
+//Objects with their own region are validated against that region.
+func TestObjectRegion(t *testing.T) {
+	objects := `
+    - objectName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:global"
+      region: us-east-1
+    - objectName: local
+      objectType: secretsmanager
+    `
+	desc, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"eu-west-1", "eu-central-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	regions := []string{"eu-west-1"}
+	if desc[SecretsManager][0].GetRegion(regions) != "us-east-1" || desc[SecretsManager][1].GetRegion(regions) != "eu-west-1" {
+		t.Errorf("Unexpected regions %s %s", desc[SecretsManager][0].GetRegion(regions), desc[SecretsManager][1].GetRegion(regions))
+	}
+
+	for obj, expErr := range map[string]string{
+		`[{objectName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:global", region: us-west-2}]`:                           "ARN region must match region us-west-2",
+		`[{objectName: global, objectType: secretsmanager, region: "US East"}]`:                                                      "region is not a valid AWS region",
+		`[{objectName: global, objectType: secretsmanager, region: us-east-1, objectAlias: g, failoverObject: {objectName: other}}]`: "failoverObject can not be used with region",
+		`[{objectTags: {app: x}, objectType: secretsmanager, region: us-east-1}]`:                                                    "region can not be used with objectTags",
+		`[{objectName: global, objectType: secretsmanager, region: cn-north-1}]`:                                                     "region cn-north-1 is not in the same partition as region eu-west-1",
+	} {
+		_, err := NewSecretDescriptorList("/mountpoint", "", "", obj, []string{"eu-west-1", "eu-central-1"})
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Errorf("%s: expected error %q, got %v", obj, expErr, err)
+		}
+	}
+}
+
 //If using ssmparameter and a failoverObject, then using both objectVersion and objectVersionLabel is invalid
 func TestObjectVersionAndLabelAreIncompatible(t *testing.T) {
 	objects := `
@@ -549,7 +695,7 @@ func TestObjectVersionAndLabelAreIncompatible(t *testing.T) {
         objectVersionLabel: MyLabel
       objectAlias: test
     `
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "ssm parameters can not specify both objectVersion and objectVersionLabel") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -565,7 +711,7 @@ func TestGetPathForMultiregion(t *testing.T) {
         objectName:         MySecretInAnotherRegion
       objectAlias: test
     `
-	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -590,7 +736,7 @@ func TestVersionIdsMustMatch(t *testing.T) {
       objectAlias: test
     `
 
-	_, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	_, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 
 	if err == nil || !strings.Contains(err.Error(), "object versions must match between primary and failover regions") {
 		t.Fatalf("Unexpected error, got %v", err)
@@ -608,7 +754,7 @@ func TestVersionidsMatch(t *testing.T) {
         objectVersion:  VersionId
       objectAlias: test
     `
-	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", objects, []string{"us-west-1", "us-west-2"})
+	descriptorList, err := NewSecretDescriptorList("/mountpoint", "", "", objects, []string{"us-west-1", "us-west-2"})
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -620,3 +766,572 @@ func TestVersionidsMatch(t *testing.T) {
 	}
 
 }
+
+// Make sure malformed SecretProviderClass objects are rejected rather than crashing.
+func FuzzNewSecretDescriptorList(f *testing.F) {
+	f.Add("/", "", `
+          - objectName: secret1
+            objectType: secretsmanager
+            jmesPath:
+              - path: username
+                objectAlias: user`)
+	f.Add("/", "False", `
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:feaw
+            objectAlias: alias
+            failoverObject:
+              objectName: arn:aws:secretsmanager:us-east-1:123456789012:secret:feaw`)
+	f.Add("/", "-", "- objectName: arn:aws:ssm:us-west-2:123456789012:parameter/feaw")
+	f.Add("/", "", "- objectName: arn:::")
+	f.Add("/", "", "[{}]")
+
+	f.Fuzz(func(t *testing.T, mountDir, translate, objects string) {
+		NewSecretDescriptorList(mountDir, translate, "", objects, []string{"us-west-2", "us-east-1"})
+	})
+}
+
+func TestOversizedObjects(t *testing.T) {
+	objects := "- objectName: " + strings.Repeat("x", maxObjectSpecSize)
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := fmt.Sprintf("SecretProviderClass objects exceed %d bytes", maxObjectSpecSize)
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestEmptyObjectEntry(t *testing.T) {
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+          -`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "Object entries can not be empty"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestDependsOnWriteOrder(t *testing.T) {
+	objects := `
+          - objectName: template
+            objectType: secretsmanager
+            dependsOn: [dbCreds, secret3]
+          - objectName: secret2
+            objectType: secretsmanager
+            jmesPath:
+              - path: username
+                objectAlias: dbCreds
+          - objectName: secret3
+            objectType: ssmparameter
+            dependsOn: [secret2]`
+
+	descriptorList, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]int{"template": 2, "secret2": 0, "secret3": 1}
+	for _, descriptors := range descriptorList {
+		for _, descriptor := range descriptors {
+			if descriptor.GetWriteOrder() != expected[descriptor.ObjectName] {
+				t.Fatalf("Bad write order for %s: %d", descriptor.ObjectName, descriptor.GetWriteOrder())
+			}
+		}
+	}
+}
+
+func TestDependsOnUnknown(t *testing.T) {
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            dependsOn: [secret2]`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "dependsOn references unknown object secret2: secret1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestDependsOnCycle(t *testing.T) {
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            dependsOn: [secret2]
+          - objectName: secret2
+            objectType: secretsmanager
+            objectAlias: alias2
+            dependsOn: [secret1]`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "dependsOn cycle detected for objectName: secret1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestMatchNamePrefix(t *testing.T) {
+	objects := `
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:my/secret-AbC123
+            objectAlias: secret1
+            matchNamePrefix: true
+          - objectName: arn:aws:secretsmanager:us-west-2:123456789012:secret:my/secret2-AbC123
+            objectAlias: secret2
+          - objectName: partial/name
+            objectType: secretsmanager
+            matchNamePrefix: true`
+
+	descriptorList, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:my/secret",
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:my/secret2-AbC123",
+		"partial/name",
+	}
+	for i, descriptor := range descriptorList[SecretsManager] {
+		if descriptor.GetSecretName(0) != expected[i] {
+			t.Fatalf("Expected secret name %s got %s", expected[i], descriptor.GetSecretName(0))
+		}
+	}
+}
+
+func TestMatchNamePrefixSSM(t *testing.T) {
+	objects := `
+          - objectName: parm1
+            objectType: ssmparameter
+            matchNamePrefix: true`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "matchNamePrefix is only supported for secretsmanager objects: parm1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestMaxSizeLimit(t *testing.T) {
+	objects := `
+          - objectName: parm1
+            objectType: ssmparameter
+            maxSize: 10000`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "maxSize must be between 0 and the ssmparameter limit of 8192 bytes: parm1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestWriteParentNeedsJMESPath(t *testing.T) {
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            writeParent: false`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "writeParent can only be false when jmesPath, objectExplode, splitStringList, or chunkSize is used: secret1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestWithDecryptionValidation(t *testing.T) {
+	badObjects := map[string]string{
+		`
+          - objectName: secret1
+            objectType: secretsmanager
+            withDecryption: false`: "withDecryption is only supported for ssmparameter objects: secret1",
+		`
+          - objectName: parm1
+            objectType: ssmparameter
+            withDecryption: false
+            jmesPath:
+              - path: username
+                objectAlias: username`: "jmesPath can not be used when withDecryption is false: parm1",
+	}
+	for objects, expectedErrorMessage := range badObjects {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+
+	objects := `
+          - objectName: parm1
+            objectType: ssmparameter
+            withDecryption: false`
+	descriptorList, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil || descriptorList[SSMParameter][0].GetWithDecryption() {
+		t.Fatalf("withDecryption not turned off: %v", err)
+	}
+}
+
+func TestJMESPathTranslation(t *testing.T) {
+	objects := `
+          - objectName: my/secret
+            objectType: secretsmanager
+            jmesPath:
+              - path: username
+                objectAlias: db/username`
+
+	// Aliases follow pathTranslation by default.
+	descriptorList, err := NewSecretDescriptorList("/", "False", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	desc := descriptorList[SecretsManager][0]
+	jmesDesc := desc.getJmesEntrySecretDescriptor(&desc.JMESPath[0])
+	if desc.GetFileName() != "my/secret" || jmesDesc.GetFileName() != "db/username" {
+		t.Fatalf("Bad file names: %s %s", desc.GetFileName(), jmesDesc.GetFileName())
+	}
+
+	descriptorList, err = NewSecretDescriptorList("/", "", "-", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	desc = descriptorList[SecretsManager][0]
+	jmesDesc = desc.getJmesEntrySecretDescriptor(&desc.JMESPath[0])
+	if desc.GetFileName() != "my_secret" || jmesDesc.GetFileName() != "db-username" {
+		t.Fatalf("Bad file names: %s %s", desc.GetFileName(), jmesDesc.GetFileName())
+	}
+
+	// Aliases can not escape the mount point.
+	objects = `
+          - objectName: secret
+            objectType: secretsmanager
+            jmesPath:
+              - path: username
+                objectAlias: ../username`
+	_, err = NewSecretDescriptorList("/", "", "False", objects, singleRegion)
+	if err == nil || err.Error() != "path can not contain ../: ../username" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestBadObjectEncoding(t *testing.T) {
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectEncoding: base32`
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "objectEncoding must be one of base64 or hex: secret1"
+
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestObjectExplodeValidation(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectExplode: true
+            writeParent: false`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !descriptors[SecretsManager][0].ObjectExplode {
+		t.Fatalf("objectExplode not set")
+	}
+
+	objects = `
+          - objectName: parameter1
+            objectType: ssmparameter
+            objectExplode: true
+            withDecryption: false`
+	_, err = NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	expectedErrorMessage := "objectExplode can not be used when withDecryption is false: parameter1"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestSplitStringListValidation(t *testing.T) {
+
+	objects := `
+          - objectName: parameter1
+            objectType: ssmparameter
+            splitStringList: true
+            stringListFileName: "hosts/{index}"
+            writeParent: false`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !descriptors[SSMParameter][0].SplitStringList {
+		t.Fatalf("splitStringList not set")
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: secret1, objectType: secretsmanager, splitStringList: true}]`:                                                          "splitStringList is only supported for ssmparameter objects: secret1",
+		`[{objectName: parameter1, objectType: ssmparameter, stringListDelimiter: ";"}]`:                                                      "stringListDelimiter, stringListFileName, and stringListFormat require splitStringList: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, objectExplode: true}]`:                                    "splitStringList can not be used with jmesPath, objectExplode, or withDecryption false: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, withDecryption: false}]`:                                  "splitStringList can not be used with jmesPath, objectExplode, or withDecryption false: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, stringListFormat: csv}]`:                                  "stringListFormat must be one of files or lines: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, stringListFileName: host}]`:                               "stringListFileName must contain {index}: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, stringListFormat: lines, stringListFileName: "{index}"}]`: "stringListFileName can not be used when stringListFormat is lines: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, splitStringList: true, stringListFormat: lines, writeParent: false}]`:            "writeParent can only be false when jmesPath, objectExplode, splitStringList, or chunkSize is used: parameter1",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestChunkSizeValidation(t *testing.T) {
+
+	objects := `
+          - objectName: parameter1
+            objectType: ssmparameter
+            chunkSize: 4096
+            writeParent: false`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if descriptors[SSMParameter][0].ChunkSize != 4096 {
+		t.Fatalf("chunkSize not set")
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: parameter1, objectType: ssmparameter, chunkSize: -1}]`:                        "chunkSize can not be negative: parameter1",
+		`[{objectName: secret1, objectType: secretsmanager, chunkSize: 10}]`:                         "chunkSize is only supported for ssmparameter objects: secret1",
+		`[{objectName: parameter1, objectType: ssmparameter, chunkSize: 10, objectExplode: true}]`:   "chunkSize can not be used with splitStringList, jmesPath, or objectExplode: parameter1",
+		`[{objectName: parameter1, objectType: ssmparameter, chunkSize: 10, splitStringList: true}]`: "chunkSize can not be used with splitStringList, jmesPath, or objectExplode: parameter1",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestPreservePath(t *testing.T) {
+
+	objects := `
+          - objectName: /app/db/password
+            objectType: ssmparameter
+            preservePath: true
+          - objectName: team/db
+            objectType: secretsmanager
+            preservePath: true`
+	descriptors, err := NewSecretDescriptorList("/mountpoint", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path := descriptors[SSMParameter][0].GetMountPath(); path != "/mountpoint/app/db/password" {
+		t.Errorf("Bad mount path: %s", path)
+	}
+	if name := descriptors[SecretsManager][0].GetFileName(); name != "team/db" {
+		t.Errorf("Bad file name: %s", name)
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: /app//password, objectType: ssmparameter, preservePath: true}]`:       "preservePath requires a file name without empty, . or .. path elements: /app//password",
+		`[{objectName: /app/./password, objectType: ssmparameter, preservePath: true}]`:      "preservePath requires a file name without empty, . or .. path elements: /app/./password",
+		`[{objectName: /app/db/, objectType: ssmparameter, preservePath: true}]`:             "preservePath requires a file name without empty, . or .. path elements: /app/db/",
+		`[{objectName: app, objectType: ssmparameter, objectAlias: a/, preservePath: true}]`: "preservePath requires a file name without empty, . or .. path elements: app",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+		if !errors.Is(err, ErrPathTraversal) {
+			t.Errorf("Expected a path traversal error, got %v", err)
+		}
+	}
+}
+
+func TestPinnedJMESPathValidation(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            jmesPath:
+              - path: password
+                objectAlias: current
+              - path: password
+                objectAlias: previous
+                objectVersionLabel: AWSPREVIOUS`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if descriptors[SecretsManager][0].JMESPath[0].isPinned() || !descriptors[SecretsManager][0].JMESPath[1].isPinned() {
+		t.Fatalf("Unexpected pins: %+v", descriptors[SecretsManager][0].JMESPath)
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: parameter1, objectType: ssmparameter, jmesPath: [{path: a, objectAlias: a, objectVersion: "1"}]}]`:                              "jmesPath objectVersion and objectVersionLabel are only supported for secretsmanager objects: a",
+		`[{objectName: secret1, objectType: secretsmanager, jmesPath: [{path: a, objectAlias: a, objectVersion: v1, objectVersionLabel: AWSPREVIOUS}]}]`: "jmesPath entries can not specify both objectVersion and objectVersionLabel: a",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestVersionStagesValidation(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectVersionStages: [AWSCURRENT, AWSPENDING]
+            jmesPath:
+              - path: password
+                objectAlias: password
+          - objectName: secret1
+            objectType: secretsmanager
+            objectAlias: current`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(descriptors[SecretsManager]) != 3 {
+		t.Fatalf("Expected 3 descriptors, got %d", len(descriptors[SecretsManager]))
+	}
+	for i, stage := range []string{"AWSCURRENT", "AWSPENDING"} {
+		descriptor := descriptors[SecretsManager][i]
+		if descriptor.GetFileName() != "secret1_"+stage || descriptor.ObjectVersionLabel != stage || descriptor.JMESPath[0].ObjectAlias != "password_"+stage {
+			t.Errorf("Unexpected descriptor for %s: %+v", stage, descriptor)
+		}
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: parameter1, objectType: ssmparameter, objectVersionStages: [AWSCURRENT]}]`:                                "objectVersionStages is only supported for secretsmanager objects named by objectName: parameter1",
+		`[{objectName: secret1, objectVersionStages: [AWSCURRENT]}]`:                                                             "objectVersionStages is only supported for secretsmanager objects named by objectName: secret1",
+		`[{objectName: secret1, objectType: secretsmanager, objectVersionLabel: AWSCURRENT, objectVersionStages: [AWSPENDING]}]`: "objectVersionStages can not be used with objectVersion or objectVersionLabel: secret1",
+		`[{objectName: secret1, objectType: secretsmanager, objectExplode: true, objectVersionStages: [AWSPENDING]}]`:            "objectVersionStages can not be used with objectExplode: secret1",
+		`[{objectName: secret1, objectType: secretsmanager, objectVersionStages: [AWSCURRENT, AWSCURRENT]}]`:                     `objectVersionStages must be distinct staging labels: "AWSCURRENT": secret1`,
+		`[{objectName: secret1, objectType: secretsmanager, objectVersionStages: [a/b]}]`:                                        `objectVersionStages must be distinct staging labels: "a/b": secret1`,
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+
+	// The files of the stages can not collide with other objects.
+	objects = `[{objectName: secret1, objectType: secretsmanager, objectVersionStages: [AWSCURRENT]}, {objectName: secret1_AWSCURRENT, objectType: secretsmanager}]`
+	_, err = NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if !errors.Is(err, ErrDuplicateAlias) {
+		t.Errorf("Expected a duplicate name, got error: %v", err)
+	}
+}
+
+func TestCrossRegionARNs(t *testing.T) {
+
+	objects := `
+          - objectName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:central-AbCdEf"
+          - objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:local-AbCdEf"`
+	regions := []string{"us-west-2", "us-west-1"}
+
+	_, err := NewSecretDescriptorList("/", "", "", objects, regions)
+	if err == nil || !strings.HasPrefix(err.Error(), "ARN region must match region us-west-2") {
+		t.Fatalf("Expected a region mismatch, got error: %v", err)
+	}
+
+	opts := DescriptorOptions{AllowCrossRegionARNs: true}
+	descriptors, err := NewSecretDescriptorListWithOptions("/", "", "", objects, regions, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	central, local := descriptors[SecretsManager][0], descriptors[SecretsManager][1]
+	if central.GetRegion(regions) != "us-east-1" || local.Region != "" {
+		t.Errorf("Unexpected regions: %s %s", central.Region, local.Region)
+	}
+
+	// Other partitions and failover objects are still rejected.
+	for _, objects := range []string{
+		`[{objectName: "arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:central-AbCdEf"}]`,
+		`[{objectName: "arn:aws:secretsmanager:us-east-1:123456789012:secret:central-AbCdEf", objectAlias: central, failoverObject: {objectName: central}}]`,
+	} {
+		if _, err := NewSecretDescriptorListWithOptions("/", "", "", objects, regions, opts); err == nil {
+			t.Errorf("Expected error for %s", objects)
+		}
+	}
+}
+
+func TestNameRules(t *testing.T) {
+
+	for _, name := range []string{
+		`[{objectName: "prod/db+user=1@team.io-x", objectType: secretsmanager}]`,
+		`[{objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db-AbCdEf"}]`,
+		`[{objectName: "/aws/service/global-infrastructure/regions", objectType: ssmparameter}]`,
+		`[{objectName: "/app/db.password:3", objectType: ssmparameter}]`,
+		`[{objectName: "/app/db_password:prod-label", objectType: ssmparameter}]`,
+		`[{objectName: "arn:aws:ssm:us-west-2:123456789012:parameter/app/password"}]`,
+	} {
+		if _, err := NewSecretDescriptorList("/", "", "", name, singleRegion); err != nil {
+			t.Errorf("Unexpected error for %s: %v", name, err)
+		}
+	}
+
+	longSecret, longParameter := strings.Repeat("a", 513), strings.Repeat("a", 1012)
+	deepParameter := strings.Repeat("/a", 16)
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: "prod db", objectType: secretsmanager}]`:                                 `secret names can only contain letters, numbers, and the characters /_+=.@- (found " "): prod db`,
+		`[{objectName: "arn:aws:secretsmanager:us-west-2:123456789012:secret:prod#db-AbCdEf"}]`: `secret names can only contain letters, numbers, and the characters /_+=.@- (found "#"): arn:aws:secretsmanager:us-west-2:123456789012:secret:prod#db-AbCdEf`,
+		`[{objectName: "` + longSecret + `", objectType: secretsmanager}]`:                      "secret names can be at most 512 characters: " + longSecret,
+		`[{objectName: "/app/db+password", objectType: ssmparameter}]`:                          `ssm parameter names can only contain letters, numbers, and the characters /_.- (found "+"): /app/db+password`,
+		`[{objectName: "/app/password:1:2", objectType: ssmparameter}]`:                         "ssm parameter names can only end with one :version or :label selector of at most 100 characters: /app/password:1:2",
+		`[{objectName: "` + longParameter + `", objectType: ssmparameter}]`:                     "ssm parameter names can be at most 1011 characters: " + longParameter,
+		`[{objectName: "` + deepParameter + `", objectType: ssmparameter}]`:                     "ssm parameter names can have at most 15 hierarchy levels: " + deepParameter,
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage || !errors.Is(err, ErrInvalidObjectName) {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestFileOwnershipValidation(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            fileOwner: 1000
+            jmesPath:
+              - path: password
+                objectAlias: password`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	descriptor := descriptors[SecretsManager][0]
+	if descriptor.GetFileOwner() != 1000 || descriptor.GetFileGroup() != -1 || !descriptor.HasFileOwnership() {
+		t.Fatalf("Unexpected ownership: %d:%d", descriptor.GetFileOwner(), descriptor.GetFileGroup())
+	}
+	entry := descriptor.getJmesEntrySecretDescriptor(&descriptor.JMESPath[0])
+	if entry.GetFileOwner() != 1000 || entry.GetFileGroup() != -1 {
+		t.Fatalf("Expected the jmesPath entry to inherit the ownership, got %d:%d", entry.GetFileOwner(), entry.GetFileGroup())
+	}
+
+	for objects, expectedErrorMessage := range map[string]string{
+		`[{objectName: secret1, objectType: secretsmanager, fileOwner: -1}]`:         "fileOwner must be a numeric user id between 0 and 4294967294: secret1",
+		`[{objectName: secret1, objectType: secretsmanager, fileGroup: 4294967295}]`: "fileGroup must be a numeric group id between 0 and 4294967294: secret1",
+	} {
+		_, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+	if _, err := NewSecretDescriptorList("/", "", "", `[{objectName: secret1, objectType: secretsmanager, fileOwner: app}]`, singleRegion); err == nil {
+		t.Errorf("Expected an error for a user name")
+	}
+}
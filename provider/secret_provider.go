@@ -10,22 +10,76 @@ package provider
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
 // Generic interface for the different secret providers.
 //
+// GetSecretValues fetches the objects of the descriptors and records their
+// versions in the current version map (curMap). Per call settings of the mount,
+// such as whether access denied errors may fail over, are passed in the
+// options (FetchOptions{} for the defaults).
+//
 type SecretProvider interface {
-	GetSecretValues(ctx context.Context, descriptor []*SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) (secret []*SecretValue, e error)
+	GetSecretValues(ctx context.Context, descriptor []*SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion, opts FetchOptions) (secret []*SecretValue, e error)
 }
 
 // Factory class to return singltons based on secret type (secretsmanager or ssmparameter).
 //
 type SecretProviderFactory struct {
 	Providers map[SecretType]SecretProvider // Maps secret type to the provider.
+
+	regional *regionalFactories // Providers for objects with their own region (nil when built from clients).
+}
+
+// Private set of factories for objects with their own region, built on first use.
+type regionalFactories struct {
+	mu        sync.Mutex
+	session   *session.Session
+	opts      ProviderOptions
+	factories map[string]*SecretProviderFactory
+}
+
+// Optional provider settings configured at startup.
+//
+type ProviderOptions struct {
+	// Warn when a mounted SSM parameter expires within this window (0 disables the check).
+	ParameterExpiryWarning time.Duration
+
+	// Cache of AWS responses shared by all mounts (nil disables caching).
+	SecretCache *SecretCache
+
+	// Maximum Secrets Manager secrets fetched at once for a mount (0 or 1 fetches serially).
+	MaxConcurrentFetches int
+
+	// What to do about advanced tier SSM parameters (see TierPolicyAllow, empty for allow).
+	AdvancedTierPolicy string
+
+	// Rate limits of Secrets Manager and SSM calls shared by all mounts (nil for no limits).
+	RateLimits *AWSRateLimits
+}
+
+// Private helper to decide if an error from a region should fail the mount
+// without trying the remaining regions.
+func isFatalError(opts FetchOptions, isFailover bool, err error) bool {
+
+	if !utils.IsFatalError(err) {
+		return false
+	}
+	if opts.AccessDeniedFailover && !isFailover && utils.ErrorCategory(err) == utils.ErrorAccessDenied {
+		return false
+	}
+	return true
 }
 
 // The prototype for the provider factory fatory
@@ -38,16 +92,117 @@ type ProviderFactoryFactory func(session []*session.Session, reigons []string) (
 // provider implementation using the secret type.
 //
 func NewSecretProviderFactory(sessions []*session.Session, regions []string) (factory *SecretProviderFactory) {
+	return NewSecretProviderFactoryWithOptions(sessions, regions, ProviderOptions{})
+}
+
+// Creates the provider factory using the given provider options.
+//
+func NewSecretProviderFactoryWithOptions(sessions []*session.Session, regions []string, opts ProviderOptions) (factory *SecretProviderFactory) {
+
+	parameterStoreProvider := NewParameterStoreProvider(sessions, regions)
+	parameterStoreProvider.expiryWarning = opts.ParameterExpiryWarning
+	parameterStoreProvider.tierPolicy = opts.AdvancedTierPolicy
+	secretsManagerProvider := NewSecretsManagerProvider(sessions, regions)
+	secretsManagerProvider.maxConcurrentFetches = opts.MaxConcurrentFetches
+
+	// Space out calls across all mounts if rate limits are set.
+	if opts.RateLimits != nil {
+		for _, client := range parameterStoreProvider.clients {
+			if c, ok := client.Client.(*ssm.SSM); ok {
+				opts.RateLimits.attach(&c.Handlers, SSMParameter, client.Region)
+			}
+		}
+		for _, client := range secretsManagerProvider.clients {
+			if c, ok := client.Client.(*secretsmanager.SecretsManager); ok {
+				opts.RateLimits.attach(&c.Handlers, SecretsManager, client.Region)
+			}
+		}
+	}
 
-	return &SecretProviderFactory{
+	// Share responses between mounts if caching is enabled.
+	if opts.SecretCache != nil {
+		for i, client := range parameterStoreProvider.clients {
+			parameterStoreProvider.clients[i].Client = &cachingSSM{client.Client, opts.SecretCache, client.Region}
+		}
+		for i, client := range secretsManagerProvider.clients {
+			secretsManagerProvider.clients[i].Client = &cachingSecretsManager{client.Client, opts.SecretCache, client.Region}
+		}
+	}
+
+	factory = &SecretProviderFactory{
 		Providers: map[SecretType]SecretProvider{
-			SSMParameter:   NewParameterStoreProvider(sessions, regions),
-			SecretsManager: NewSecretsManagerProvider(sessions, regions),
+			SSMParameter:   parameterStoreProvider,
+			SecretsManager: secretsManagerProvider,
 		},
 	}
+	if len(sessions) > 0 {
+		factory.regional = &regionalFactories{session: sessions[0], opts: opts}
+	}
+	return factory
 
 }
 
+// Endpoints of the Secrets Manager and SSM clients of a mount.
+//
+// Either endpoint may be empty to use the default one. Any {region}
+// placeholder is replaced by the region of each client.
+//
+type MountEndpoints struct {
+	SecretsManager string // From the secretsManagerEndpointUrl mount attribute
+	SSM            string // From the ssmEndpointUrl mount attribute
+}
+
+// Returns a copy of the session whose Secrets Manager and SSM clients use the
+// endpoints of a mount.
+//
+// The endpoints are carried by the endpoint resolver of the session, so other
+// clients built from the session (such as STS) resolve their endpoints as
+// usual.
+//
+func WithMountEndpoints(sess *session.Session, eps MountEndpoints) *session.Session {
+	return sess.Copy(aws.NewConfig().WithEndpointResolver(eps))
+}
+
+// Resolve the endpoint of a service in a region, using the endpoint of the
+// mount for Secrets Manager and SSM when it is set.
+//
+func (eps MountEndpoints) EndpointFor(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+
+	ep := eps.endpoint(service)
+	if len(ep) == 0 {
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	}
+	return endpoints.ResolvedEndpoint{URL: utils.ExpandEndpoint(ep, region), SigningRegion: region}, nil
+}
+
+// Private helper to get the endpoint of the mount for a service (by endpoint
+// ID), if any.
+func (eps MountEndpoints) endpoint(service string) string {
+
+	switch service {
+	case secretsmanager.EndpointsID:
+		return eps.SecretsManager
+	case ssm.EndpointsID:
+		return eps.SSM
+	}
+	return ""
+}
+
+// Private helper to build the client configuration of a service in a region.
+//
+// When the mount sets an endpoint for the service (see WithMountEndpoints) the
+// endpoint overrides of the provider are left out, so the endpoint resolver
+// of the session gives the endpoint of the mount instead.
+//
+func clientConfig(sess *session.Session, service, endpointsID, region string) *aws.Config {
+
+	config := utils.ServiceConfig(service, region)
+	if eps, ok := sess.Config.EndpointResolver.(MountEndpoints); ok && len(eps.endpoint(endpointsID)) > 0 {
+		config.Endpoint = nil
+	}
+	return config
+}
+
 // Factory method to get the correct secret provider for the request type.
 //
 // This factory method uses the secret type to return the previously created
@@ -56,3 +211,31 @@ func NewSecretProviderFactory(sessions []*session.Session, regions []string) (fa
 func (p SecretProviderFactory) GetSecretProvider(secretType SecretType) (prov SecretProvider) {
 	return p.Providers[secretType]
 }
+
+// Get the secret provider for objects that set their own region.
+//
+// Objects with a region are only fetched from that region (there is no
+// failover), using the credentials of the primary region. The clients for each
+// distinct region are only created when first needed and then reused for the
+// rest of the mount. Factories built from clients (rather than sessions) use
+// the same providers for every region.
+//
+func (p SecretProviderFactory) GetRegionalSecretProvider(secretType SecretType, region string) (prov SecretProvider) {
+
+	if len(region) == 0 || p.regional == nil {
+		return p.GetSecretProvider(secretType)
+	}
+
+	p.regional.mu.Lock()
+	defer p.regional.mu.Unlock()
+	if p.regional.factories == nil {
+		p.regional.factories = make(map[string]*SecretProviderFactory)
+	}
+	factory := p.regional.factories[region]
+	if factory == nil {
+		factory = NewSecretProviderFactoryWithOptions([]*session.Session{p.regional.session}, []string{region}, p.regional.opts)
+		factory.regional = nil // Regional objects do not nest.
+		p.regional.factories[region] = factory
+	}
+	return factory.GetSecretProvider(secretType)
+}
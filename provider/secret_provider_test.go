@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Make sure providers for objects with their own region are built once for each region.
+func TestGetRegionalSecretProvider(t *testing.T) {
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", ""))))
+	factory := NewSecretProviderFactory([]*session.Session{sess}, []string{"us-west-2"})
+
+	if factory.GetRegionalSecretProvider(SecretsManager, "") != factory.GetSecretProvider(SecretsManager) {
+		t.Fatalf("Expected the mount provider for objects without a region")
+	}
+
+	regional := factory.GetRegionalSecretProvider(SecretsManager, "eu-west-1").(*SecretsManagerProvider)
+	if len(regional.clients) != 1 || regional.clients[0].Region != "eu-west-1" || regional.clients[0].FailoverIndex != 0 {
+		t.Fatalf("Unexpected regional clients %+v", regional.clients)
+	}
+	if factory.GetRegionalSecretProvider(SecretsManager, "eu-west-1") != regional {
+		t.Fatalf("Expected the regional provider to be reused")
+	}
+	ssm := factory.GetRegionalSecretProvider(SSMParameter, "eu-west-1").(*ParameterStoreProvider)
+	if len(ssm.clients) != 1 || ssm.clients[0].Region != "eu-west-1" {
+		t.Fatalf("Unexpected regional clients %+v", ssm.clients)
+	}
+
+	// Factories built from clients use the same providers everywhere.
+	clientFactory := &SecretProviderFactory{Providers: factory.Providers}
+	if clientFactory.GetRegionalSecretProvider(SecretsManager, "eu-west-1") != factory.GetSecretProvider(SecretsManager) {
+		t.Fatalf("Expected the mount provider from a factory built from clients")
+	}
+}
+
+// Make sure an endpoint set on the mount session is used in every region.
+func TestClientConfigEndpoint(t *testing.T) {
+
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", "https://override.example.com")
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
+
+	if ep := aws.StringValue(clientConfig(sess, utils.SecretsManagerService, secretsmanager.EndpointsID, "us-west-2").Endpoint); ep != "https://override.example.com" {
+		t.Fatalf("Expected the endpoint override, got %s", ep)
+	}
+
+	sess = WithMountEndpoints(sess, MountEndpoints{SecretsManager: "https://vpce-1.secretsmanager.{region}.vpce.amazonaws.com"})
+	factory := NewSecretProviderFactory([]*session.Session{sess}, []string{"us-west-2"})
+	regional := factory.GetRegionalSecretProvider(SecretsManager, "eu-west-1").(*SecretsManagerProvider)
+	client := regional.clients[0].Client.(*secretsmanager.SecretsManager)
+	if ep := client.Endpoint; ep != "https://vpce-1.secretsmanager.eu-west-1.vpce.amazonaws.com" {
+		t.Fatalf("Expected the mount endpoint, got %s", ep)
+	}
+
+	// Each service uses its own endpoint.
+	ssmClient := factory.GetRegionalSecretProvider(SSMParameter, "eu-west-1").(*ParameterStoreProvider).clients[0].Client.(*ssm.SSM)
+	if ep := ssmClient.Endpoint; ep != "https://ssm.eu-west-1.amazonaws.com" {
+		t.Fatalf("Expected the default SSM endpoint, got %s", ep)
+	}
+	sess = WithMountEndpoints(sess, MountEndpoints{SSM: "https://vpce-2.ssm.{region}.vpce.amazonaws.com"})
+	factory = NewSecretProviderFactory([]*session.Session{sess}, []string{"us-east-1"})
+	ssmClient = factory.GetSecretProvider(SSMParameter).(*ParameterStoreProvider).clients[0].Client.(*ssm.SSM)
+	if ep := ssmClient.Endpoint; ep != "https://vpce-2.ssm.us-east-1.vpce.amazonaws.com" {
+		t.Fatalf("Expected the SSM mount endpoint, got %s", ep)
+	}
+	client = factory.GetSecretProvider(SecretsManager).(*SecretsManagerProvider).clients[0].Client.(*secretsmanager.SecretsManager)
+	if ep := client.Endpoint; ep != "https://override.example.com" {
+		t.Fatalf("Expected the endpoint override, got %s", ep)
+	}
+}
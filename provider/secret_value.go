@@ -1,23 +1,131 @@
 package provider
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/jmespath/go-jmespath"
 )
 
 // Contains the actual contents of the secret fetched from either Secrete Manager
 // or SSM Parameter Store along with the original descriptor.
 type SecretValue struct {
-	Value      []byte
-	Descriptor SecretDescriptor
+	Value         []byte
+	Descriptor    SecretDescriptor
+	IsFailover    bool          // True when the value was served by a failover region
+	FailoverIndex int           // Position of the region that served the value in the lookup regions (0 for the primary)
+	Expiration    time.Time     // Set when the value is about to expire (zero otherwise)
+	Version       string        // Version of the object the value came from (empty when unknown)
+	ARN           string        // ARN of the object the value came from (empty when unknown, for example when reloaded)
+	AdvancedTier  bool          // Set on advanced tier parameters when the tier policy is warn or deny
+	Latency       time.Duration // How long the fetch of the object (or the SSM call it was fetched in) took
 }
 
 func (p *SecretValue) String() string { return "<REDACTED>" } // Do not log secrets
+
+// Private helper to record how long the fetch of values took.
+func setLatency(values []*SecretValue, latency time.Duration) {
+	for _, value := range values {
+		value.Latency = latency
+	}
+}
+
+// Check the value against the maxSize of its descriptor (if any).
+//
+// Catches unexpectedly large values being mounted by mistake.
+//
+func (p *SecretValue) CheckSize() error {
+	if p.Descriptor.MaxSize > 0 && len(p.Value) > p.Descriptor.MaxSize {
+		return fmt.Errorf("value of %s is %d bytes which exceeds maxSize of %d bytes",
+			p.Descriptor.ObjectName, len(p.Value), p.Descriptor.MaxSize)
+	}
+	return nil
+}
+
+// Private helper to decode the value using the objectEncoding of its
+// descriptor (if any).
+//
+// Only used on freshly fetched values since the decoded value is what gets
+// written to the mount. Surrounding white space is ignored. The error does not
+// include the value to avoid leaking secrets.
+//
+func (p *SecretValue) decode() error {
+
+	var decoded []byte
+	var err error
+	switch p.Descriptor.ObjectEncoding {
+	case EncodingBase64:
+		decoded, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(p.Value)))
+	case EncodingHex:
+		decoded, err = hex.DecodeString(strings.TrimSpace(string(p.Value)))
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to decode %s value of %s", p.Descriptor.ObjectEncoding, p.Descriptor.ObjectName)
+	}
+
+	p.Value = decoded
+	return nil
+}
+
+// Private helper to strip trailing white space from the value when the trim
+// flag of its descriptor is set.
+//
+// Like decode, only used on freshly fetched (and decoded) values.
+//
+func (p *SecretValue) trim() {
+	if p.Descriptor.Trim {
+		p.Value = bytes.TrimRightFunc(p.Value, unicode.IsSpace)
+	}
+}
+
+// Private helper to evaluate a JMES path.
+//
+// Guards against malformed paths crashing the provider by converting any panic
+// in the JMES library into an error.
+func searchJMESPath(path string, data interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return jmespath.Search(path, data)
+}
+
 //parse out and return specified key value pairs from the secret
 func (p *SecretValue) getJsonSecrets() (s []*SecretValue, e error) {
 
 	jsonValues := make([]*SecretValue, 0)
+	if p.Descriptor.ObjectExplode {
+		exploded, err := p.explodeJson()
+		if err != nil {
+			return nil, err
+		}
+		jsonValues = append(jsonValues, exploded...)
+	}
+	if p.Descriptor.splitsIntoFiles() {
+		elements, err := p.splitList()
+		if err != nil {
+			return nil, err
+		}
+		jsonValues = append(jsonValues, elements...)
+	}
+	if p.Descriptor.ChunkSize > 0 {
+		chunks, err := p.chunk()
+		if err != nil {
+			return nil, err
+		}
+		jsonValues = append(jsonValues, chunks...)
+	}
 	if len(p.Descriptor.JMESPath) == 0 {
 		return jsonValues, nil
 	}
@@ -32,12 +140,24 @@ func (p *SecretValue) getJsonSecrets() (s []*SecretValue, e error) {
 	//fetch all specified key value pairs`
 	for _, jmesPathEntry := range p.Descriptor.JMESPath {
 
-		jsonSecret, err := jmespath.Search(jmesPathEntry.Path, data)
+		if jmesPathEntry.isPinned() {
+			continue // Read from another version of the secret (see fetchPinnedEntries).
+		}
+
+		jsonSecret, err := searchJMESPath(jmesPathEntry.Path, data)
 
 		if err != nil {
 			return nil, fmt.Errorf("Invalid JMES Path: %s.", jmesPathEntry.Path)
 		}
 
+		if jsonSecret == nil && jmesPathEntry.OnMissing == OnMissingSkip {
+			continue // Optional key not present, do not mount it.
+		}
+
+		if jsonSecret == nil && jmesPathEntry.OnMissing == OnMissingEmpty {
+			jsonSecret = "" // Optional key not present, mount an empty file.
+		}
+
 		if jsonSecret == nil {
 			return nil, fmt.Errorf("JMES Path - %s for object alias - %s does not point to a valid object.",
 				jmesPathEntry.Path, jmesPathEntry.ObjectAlias)
@@ -51,12 +171,199 @@ func (p *SecretValue) getJsonSecrets() (s []*SecretValue, e error) {
 
 		descriptor := p.Descriptor.getJmesEntrySecretDescriptor(&jmesPathEntry)
 
+		// The jmesPath entries inherit the trim flag of the secret.
+		if p.Descriptor.Trim {
+			jsonSecretAsString = strings.TrimRightFunc(jsonSecretAsString, unicode.IsSpace)
+		}
+
 		secretValue := SecretValue{
-			Value:      []byte(jsonSecretAsString),
-			Descriptor: descriptor,
+			Value:         []byte(jsonSecretAsString),
+			Descriptor:    descriptor,
+			IsFailover:    p.IsFailover,
+			FailoverIndex: p.FailoverIndex,
+			Version:       p.Version,
+			ARN:           p.ARN,
 		}
 		jsonValues = append(jsonValues, &secretValue)
 
 	}
 	return jsonValues, nil
 }
+
+// Private helper to return every top-level key of a JSON object as its own
+// secret (used by objectExplode).
+//
+// Keys are returned in sorted order and named like jmesPath aliases. String
+// values are mounted as is and other values as their JSON text.
+//
+func (p *SecretValue) explodeJson() (s []*SecretValue, e error) {
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(p.Value, &data); err != nil {
+		return nil, fmt.Errorf("objectExplode requires a JSON object in secret: %s.", p.Descriptor.ObjectName)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]*SecretValue, 0, len(keys))
+	for _, key := range keys {
+
+		descriptor := p.Descriptor.getJmesEntrySecretDescriptor(&JMESPathEntry{ObjectAlias: key})
+		descriptor.explodedFrom = p.Descriptor.ObjectName
+		fileName := descriptor.GetFileName()
+		if len(fileName) == 0 || fileName == "." || fileName == ".." || badPathRE.MatchString(fileName) {
+			return nil, validationErrorf(ErrPathTraversal, "objectExplode key %q of secret %s is not a valid file name.", key, p.Descriptor.ObjectName)
+		}
+
+		var value string
+		if err := json.Unmarshal(data[key], &value); err != nil {
+			value = string(data[key]) // Not a string, mount the JSON text.
+		}
+		if p.Descriptor.Trim {
+			value = strings.TrimRightFunc(value, unicode.IsSpace)
+		}
+
+		values = append(values, &SecretValue{
+			Value:         []byte(value),
+			Descriptor:    descriptor,
+			IsFailover:    p.IsFailover,
+			FailoverIndex: p.FailoverIndex,
+			Version:       p.Version,
+			ARN:           p.ARN,
+		})
+	}
+	return values, nil
+}
+
+// Private helper to return the delimiter of a split list.
+func (p *SecretValue) listDelimiter() string {
+	if len(p.Descriptor.StringListDelimiter) == 0 {
+		return defaultStringListDelimiter
+	}
+	return p.Descriptor.StringListDelimiter
+}
+
+// Private helper to return every element of a list parameter as its own
+// secret (used by splitStringList).
+//
+// The elements are named with the stringListFileName pattern, where {name} is
+// the file name of the list and {index} the position of the element (from 0).
+// Like exploded keys, the names are only known once the value is fetched.
+//
+func (p *SecretValue) splitList() (s []*SecretValue, e error) {
+
+	pattern := p.Descriptor.StringListFileName
+	if len(pattern) == 0 {
+		pattern = defaultStringListFileName
+	}
+
+	elements := strings.Split(string(p.Value), p.listDelimiter())
+	values := make([]*SecretValue, 0, len(elements))
+	for i, element := range elements {
+
+		alias := strings.NewReplacer("{name}", p.Descriptor.GetFileName(), "{index}", strconv.Itoa(i)).Replace(pattern)
+		descriptor := p.Descriptor.getJmesEntrySecretDescriptor(&JMESPathEntry{ObjectAlias: alias})
+		descriptor.explodedFrom = p.Descriptor.ObjectName
+		fileName := descriptor.GetFileName()
+		if len(fileName) == 0 || fileName == "." || fileName == ".." || badPathRE.MatchString(fileName) {
+			return nil, validationErrorf(ErrPathTraversal, "splitStringList element %d of parameter %s is not a valid file name.", i, p.Descriptor.ObjectName)
+		}
+
+		if p.Descriptor.Trim {
+			element = strings.TrimRightFunc(element, unicode.IsSpace)
+		}
+		values = append(values, &SecretValue{
+			Value:         []byte(element),
+			Descriptor:    descriptor,
+			IsFailover:    p.IsFailover,
+			FailoverIndex: p.FailoverIndex,
+			Version:       p.Version,
+			ARN:           p.ARN,
+		})
+	}
+	return values, nil
+}
+
+// Private helper to return the pieces of a large parameter, each as its own
+// secret (used by chunkSize).
+//
+// The pieces are named {name}_{index} (from 0) like split list elements, and
+// are slices of the fetched value so no copies of a large value are made.
+// Values are split on byte boundaries; concatenating the files in index order
+// gives back the value.
+//
+func (p *SecretValue) chunk() (s []*SecretValue, e error) {
+
+	size := p.Descriptor.ChunkSize
+	count := (len(p.Value) + size - 1) / size
+	if count > maxChunks {
+		return nil, fmt.Errorf("chunkSize %d splits parameter %s into more than %d files.", size, p.Descriptor.ObjectName, maxChunks)
+	}
+
+	values := make([]*SecretValue, 0, count)
+	for i := 0; i < count; i++ {
+
+		alias := strings.NewReplacer("{name}", p.Descriptor.GetFileName(), "{index}", strconv.Itoa(i)).Replace(defaultStringListFileName)
+		descriptor := p.Descriptor.getJmesEntrySecretDescriptor(&JMESPathEntry{ObjectAlias: alias})
+		descriptor.explodedFrom = p.Descriptor.ObjectName
+
+		end := (i + 1) * size
+		if end > len(p.Value) {
+			end = len(p.Value)
+		}
+		values = append(values, &SecretValue{
+			Value:         p.Value[i*size : end],
+			Descriptor:    descriptor,
+			IsFailover:    p.IsFailover,
+			FailoverIndex: p.FailoverIndex,
+			Version:       p.Version,
+			ARN:           p.ARN,
+		})
+	}
+	return values, nil
+}
+
+// Private helper to rewrite a list parameter with one element per line when
+// its stringListFormat is lines.
+//
+// Like decode, only used on freshly fetched values since the rewritten value
+// is what gets written to the mount.
+//
+func (p *SecretValue) listToLines() {
+	if p.Descriptor.SplitStringList && p.Descriptor.StringListFormat == StringListLines {
+		p.Value = []byte(strings.Join(strings.Split(string(p.Value), p.listDelimiter()), "\n"))
+	}
+}
+
+// Check that no file exploded from a JSON object (see objectExplode) or split
+// from a list (see splitStringList) has the same name as another file of the
+// mount.
+//
+// The exploded keys are only known once the secrets are fetched, so unlike
+// other names they can not be checked when the SecretProviderClass is read.
+//
+func CheckExplodedNames(secrets []*SecretValue) error {
+
+	names := make(map[string]*SecretDescriptor)
+	for _, secret := range secrets {
+		if !secret.Descriptor.GetWriteParent() {
+			continue // Not written
+		}
+		fileName := secret.Descriptor.GetFileName()
+		other := names[fileName]
+		if other != nil && (len(other.explodedFrom) > 0 || len(secret.Descriptor.explodedFrom) > 0) {
+			from := secret.Descriptor.explodedFrom
+			if len(from) == 0 {
+				from = other.explodedFrom
+			}
+			return fmt.Errorf("objectExplode key of %s collides with another file of the mount: %s", from, fileName)
+		}
+		descriptor := secret.Descriptor
+		names[fileName] = &descriptor
+	}
+	return nil
+}
@@ -70,3 +70,298 @@ func TestInvalidJMESResultType(t *testing.T) {
 
 	RunGetJsonSecretTest(t, jsonContent, path, objectAlias, expectedErrorMessage)
 }
+
+func RunGetJsonSecretOnMissingTest(t *testing.T, onMissing string, expectedValues int, expectedValue string) {
+	descriptor := SecretDescriptor{
+		ObjectName: TEST_OBJECT_NAME,
+		ObjectType: "ssmparameter",
+		JMESPath: []JMESPathEntry{
+			{Path: "username", ObjectAlias: "username"},
+			{Path: "missing", ObjectAlias: "missing", OnMissing: onMissing},
+		},
+	}
+
+	secretValue := SecretValue{
+		Value:      []byte(`{"username": "ParameterStoreUser"}`),
+		Descriptor: descriptor,
+	}
+
+	values, err := secretValue.getJsonSecrets()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != expectedValues {
+		t.Fatalf("Expected %d values, got %d", expectedValues, len(values))
+	}
+	if string(values[len(values)-1].Value) != expectedValue {
+		t.Fatalf("Expected value %q, got %q", expectedValue, string(values[len(values)-1].Value))
+	}
+}
+
+func TestJMESPathOnMissingSkip(t *testing.T) {
+	RunGetJsonSecretOnMissingTest(t, OnMissingSkip, 1, "ParameterStoreUser")
+}
+
+func TestJMESPathOnMissingEmpty(t *testing.T) {
+	RunGetJsonSecretOnMissingTest(t, OnMissingEmpty, 2, "")
+}
+
+func TestJMESPathOnMissingError(t *testing.T) {
+
+	jsonContent := `{"username": "ParameterStoreUser", "password": "PasswordForParameterStore"}`
+	path := "testpath"
+	objectAlias := "testAlias"
+	expectedErrorMessage := fmt.Sprintf("JMES Path - %s for object alias - %s does not point to a valid object.", path, objectAlias)
+
+	descriptor := SecretDescriptor{
+		ObjectName: TEST_OBJECT_NAME,
+		JMESPath:   []JMESPathEntry{{Path: path, ObjectAlias: objectAlias, OnMissing: OnMissingError}},
+	}
+	secretValue := SecretValue{Value: []byte(jsonContent), Descriptor: descriptor}
+
+	_, err := secretValue.getJsonSecrets()
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+// Make sure malformed secrets and JMES paths are rejected rather than crashing.
+func FuzzGetJsonSecrets(f *testing.F) {
+	f.Add(`{"username": "ParameterStoreUser", "password": "PasswordForParameterStore"}`, "username")
+	f.Add(`{"a": {"b": ["c", "d"]}}`, "a.b[0]")
+	f.Add(`[1, 2, 3]`, "[::-1]")
+	f.Add(`{"username": 3}`, "to_string(username)")
+
+	f.Fuzz(func(t *testing.T, jsonContent, path string) {
+		secretValue := SecretValue{
+			Value: []byte(jsonContent),
+			Descriptor: SecretDescriptor{
+				ObjectName: TEST_OBJECT_NAME,
+				ObjectType: "secretsmanager",
+				JMESPath:   []JMESPathEntry{{Path: path, ObjectAlias: "alias"}},
+			},
+		}
+		secretValue.getJsonSecrets()
+	})
+}
+
+func TestDecode(t *testing.T) {
+
+	for encoding, value := range map[string]string{
+		"":             "secret",
+		EncodingBase64: "c2VjcmV0\n",
+		EncodingHex:    "736563726574",
+	} {
+		secretValue := SecretValue{
+			Value:      []byte(value),
+			Descriptor: SecretDescriptor{ObjectName: TEST_OBJECT_NAME, ObjectEncoding: encoding},
+		}
+		if err := secretValue.decode(); err != nil || string(secretValue.Value) != "secret" {
+			t.Fatalf("Bad %s decode: %s %v", encoding, string(secretValue.Value), err)
+		}
+	}
+
+	secretValue := SecretValue{
+		Value:      []byte("not hex"),
+		Descriptor: SecretDescriptor{ObjectName: TEST_OBJECT_NAME, ObjectEncoding: EncodingHex},
+	}
+	expectedErrorMessage := fmt.Sprintf("Failed to decode hex value of %s", TEST_OBJECT_NAME)
+	if err := secretValue.decode(); err == nil || err.Error() != expectedErrorMessage {
+		t.Fatalf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestTrim(t *testing.T) {
+
+	secretValue := SecretValue{
+		Value:      []byte("  secret \r\n\t\n"),
+		Descriptor: SecretDescriptor{ObjectName: TEST_OBJECT_NAME},
+	}
+	secretValue.trim()
+	if string(secretValue.Value) != "  secret \r\n\t\n" {
+		t.Fatalf("Value trimmed without trim: %q", string(secretValue.Value))
+	}
+
+	secretValue.Descriptor.Trim = true
+	secretValue.trim()
+	if string(secretValue.Value) != "  secret" {
+		t.Fatalf("Bad trimmed value: %q", string(secretValue.Value))
+	}
+
+	// The jmesPath entries are trimmed as well.
+	secretValue = SecretValue{
+		Value: []byte(`{"password": "pass\n"}`),
+		Descriptor: SecretDescriptor{
+			ObjectName: TEST_OBJECT_NAME,
+			ObjectType: "secretsmanager",
+			Trim:       true,
+			JMESPath:   []JMESPathEntry{{Path: "password", ObjectAlias: "password"}},
+		},
+	}
+	jsonValues, err := secretValue.getJsonSecrets()
+	if err != nil || len(jsonValues) != 1 || string(jsonValues[0].Value) != "pass" {
+		t.Fatalf("Bad trimmed jmesPath value: %v %v", jsonValues, err)
+	}
+}
+
+func TestObjectExplode(t *testing.T) {
+
+	secretValue := SecretValue{
+		Value: []byte(`{"password": "pass\n", "username": "user", "port": 5432, "tags": ["a", "b"], "a/b": "nested"}`),
+		Descriptor: SecretDescriptor{
+			ObjectName:    TEST_OBJECT_NAME,
+			ObjectType:    "secretsmanager",
+			ObjectExplode: true,
+			Trim:          true,
+			jmesTranslate: "_",
+		},
+	}
+
+	values, err := secretValue.getJsonSecrets()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []struct{ name, value string }{
+		{"a_b", "nested"},
+		{"password", "pass"},
+		{"port", "5432"},
+		{"tags", `["a", "b"]`},
+		{"username", "user"},
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(values))
+	}
+	for i, exp := range expected {
+		if values[i].Descriptor.GetFileName() != exp.name || string(values[i].Value) != exp.value {
+			t.Errorf("Expected %s=%s, got %s=%s", exp.name, exp.value, values[i].Descriptor.GetFileName(), string(values[i].Value))
+		}
+	}
+}
+
+func TestObjectExplodeErrors(t *testing.T) {
+
+	for jsonContent, expectedErrorMessage := range map[string]string{
+		`["not", "an", "object"]`: fmt.Sprintf("objectExplode requires a JSON object in secret: %s.", TEST_OBJECT_NAME),
+		`NotValidJson`:            fmt.Sprintf("objectExplode requires a JSON object in secret: %s.", TEST_OBJECT_NAME),
+		`{"..": "up"}`:            fmt.Sprintf(`objectExplode key ".." of secret %s is not a valid file name.`, TEST_OBJECT_NAME),
+		`{"../etc": "up"}`:        fmt.Sprintf(`objectExplode key "../etc" of secret %s is not a valid file name.`, TEST_OBJECT_NAME),
+	} {
+		secretValue := SecretValue{
+			Value:      []byte(jsonContent),
+			Descriptor: SecretDescriptor{ObjectName: TEST_OBJECT_NAME, ObjectType: "secretsmanager", ObjectExplode: true},
+		}
+		_, err := secretValue.getJsonSecrets()
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestCheckExplodedNames(t *testing.T) {
+
+	exploded := func(name, from string) *SecretValue {
+		return &SecretValue{Descriptor: SecretDescriptor{ObjectAlias: name, explodedFrom: from}}
+	}
+	object := func(name string) *SecretValue {
+		return &SecretValue{Descriptor: SecretDescriptor{ObjectName: name}}
+	}
+	hidden := false
+
+	if err := CheckExplodedNames([]*SecretValue{object("secret1"), exploded("username", "secret1"), object("secret2")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Names of objects that are not written may be reused.
+	parent := &SecretValue{Descriptor: SecretDescriptor{ObjectName: "username", WriteParent: &hidden}}
+	if err := CheckExplodedNames([]*SecretValue{parent, exploded("username", "secret1")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, secrets := range [][]*SecretValue{
+		{object("username"), exploded("username", "secret1")},
+		{exploded("username", "secret1"), object("username")},
+		{exploded("username", "secret1"), exploded("username", "secret1")},
+	} {
+		err := CheckExplodedNames(secrets)
+		expectedErrorMessage := "objectExplode key of secret1 collides with another file of the mount: username"
+		if err == nil || err.Error() != expectedErrorMessage {
+			t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+		}
+	}
+}
+
+func TestSplitStringList(t *testing.T) {
+
+	split := func(value string, descriptor SecretDescriptor) ([]string, string) {
+		descriptor.ObjectName = "hosts"
+		descriptor.ObjectType = "ssmparameter"
+		descriptor.SplitStringList = true
+		descriptor.jmesTranslate = "_"
+		secretValue := SecretValue{Value: []byte(value), Descriptor: descriptor}
+		secretValue.listToLines()
+		values, err := secretValue.getJsonSecrets()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var files []string
+		for _, v := range values {
+			files = append(files, v.Descriptor.GetFileName()+"="+string(v.Value))
+		}
+		return files, string(secretValue.Value)
+	}
+
+	files, parent := split("a.example.com,b.example.com", SecretDescriptor{})
+	if fmt.Sprint(files) != "[hosts_0=a.example.com hosts_1=b.example.com]" || parent != "a.example.com,b.example.com" {
+		t.Errorf("Bad default split: %v %q", files, parent)
+	}
+
+	files, _ = split("a ;b \n", SecretDescriptor{StringListDelimiter: ";", StringListFileName: "{name}/host-{index}", Trim: true})
+	if fmt.Sprint(files) != "[hosts_host-0=a hosts_host-1=b]" {
+		t.Errorf("Bad patterned split: %v", files)
+	}
+
+	files, parent = split("a,b,c", SecretDescriptor{StringListFormat: StringListLines})
+	if len(files) != 0 || parent != "a\nb\nc" {
+		t.Errorf("Bad lines split: %v %q", files, parent)
+	}
+
+	secretValue := SecretValue{
+		Value:      []byte("a,b"),
+		Descriptor: SecretDescriptor{ObjectName: "hosts", ObjectType: "ssmparameter", SplitStringList: true, StringListFileName: "../{index}"},
+	}
+	_, err := secretValue.getJsonSecrets()
+	expectedErrorMessage := "splitStringList element 0 of parameter hosts is not a valid file name."
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
+
+func TestChunk(t *testing.T) {
+
+	secretValue := SecretValue{
+		Value:      []byte("abcdefghij"),
+		Descriptor: SecretDescriptor{ObjectName: "cert", ObjectType: "ssmparameter", ChunkSize: 4},
+	}
+	values, err := secretValue.getJsonSecrets()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var files []string
+	for _, v := range values {
+		files = append(files, v.Descriptor.GetFileName()+"="+string(v.Value))
+		if v.Descriptor.explodedFrom != "cert" {
+			t.Errorf("Chunk %s not marked as derived from cert", v.Descriptor.GetFileName())
+		}
+	}
+	if fmt.Sprint(files) != "[cert_0=abcd cert_1=efgh cert_2=ij]" {
+		t.Errorf("Bad chunks: %v", files)
+	}
+
+	secretValue.Value = make([]byte, maxChunks*4+1)
+	_, err = secretValue.getJsonSecrets()
+	expectedErrorMessage := "chunkSize 4 splits parameter cert into more than 1000 files."
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("Expected error: %s, got error: %v", expectedErrorMessage, err)
+	}
+}
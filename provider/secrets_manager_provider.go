@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -28,15 +31,19 @@ import (
 // latency DescribeSecret call to first determine if the secret has been
 // updated.
 //
+// Secrets are fetched serially unless maxConcurrentFetches allows fetching
+// several secrets of a mount at once.
+//
 type SecretsManagerProvider struct {
-	clients []SecretsManagerClient
+	clients              []SecretsManagerClient
+	maxConcurrentFetches int // Maximum secrets fetched at once (0 or 1 to fetch serially)
 }
 
 //SecretsManager client with region
 type SecretsManagerClient struct {
-	Region     string
-	Client     secretsmanageriface.SecretsManagerAPI
-	IsFailover bool
+	Region        string
+	Client        secretsmanageriface.SecretsManagerAPI
+	FailoverIndex int // Position of the region in the lookup regions (0 for the primary)
 }
 
 // Get the secret from SecretsManager.
@@ -49,11 +56,19 @@ func (p *SecretsManagerProvider) GetSecretValues(
 	ctx context.Context,
 	descriptors []*SecretDescriptor,
 	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
 ) (v []*SecretValue, errs error) {
 
+	if p.maxConcurrentFetches > 1 && len(descriptors) > 1 {
+		return p.getSecretValuesConcurrently(ctx, descriptors, curMap, opts)
+	}
+
 	// Fetch each secret in order. If any secret fails we will return that secret's errors
 	for _, descriptor := range descriptors {
-		values, errs := p.fetchSecretManagerValue(ctx, descriptor, curMap)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		values, errs := p.fetchSecretManagerValue(ctx, descriptor, curMap, opts)
 		if values == nil {
 			return nil, errs
 		}
@@ -62,6 +77,106 @@ func (p *SecretsManagerProvider) GetSecretValues(
 	return v, nil
 }
 
+// Private helper to fetch secrets using a bounded pool of workers.
+//
+// Each fetch records its versions in its own map (seeded with the current
+// versions of the secret and its pinned jmesPath entries) so the workers never
+// share the current version map. Once all fetches finish, the values and
+// versions are merged in descriptor order and the error of the first failed
+// descriptor (if any) is returned, so the results do not depend on the order
+// in which fetches complete.
+//
+func (p *SecretsManagerProvider) getSecretValuesConcurrently(
+	ctx context.Context,
+	descriptors []*SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
+) (v []*SecretValue, e error) {
+
+	type fetchResult struct {
+		values   []*SecretValue
+		versions map[string]*v1alpha1.ObjectVersion
+		err      error
+	}
+	results := make([]fetchResult, len(descriptors))
+	for i, descriptor := range descriptors {
+		versions := make(map[string]*v1alpha1.ObjectVersion)
+		if curVer := curMap[descriptor.GetFileName()]; curVer != nil {
+			versions[descriptor.GetFileName()] = curVer
+		}
+		for j := range descriptor.JMESPath { // Pinned entries are reloaded by version
+			if !descriptor.JMESPath[j].isPinned() {
+				continue
+			}
+			entryDescriptor := descriptor.getJmesEntrySecretDescriptor(&descriptor.JMESPath[j])
+			if curVer := curMap[entryDescriptor.GetFileName()]; curVer != nil {
+				versions[entryDescriptor.GetFileName()] = curVer
+			}
+		}
+		results[i].versions = versions
+	}
+
+	jobs := make(chan int, len(descriptors))
+	for i := range descriptors {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.maxConcurrentFetches, len(descriptors)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i].err = err
+					continue
+				}
+				results[i].values, results[i].err = p.fetchRecovered(ctx, descriptors[i], results[i].versions, opts)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.values != nil {
+			continue
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		if err := ctx.Err(); err != nil { // Never return nil values without an error
+			return nil, err
+		}
+		return nil, fmt.Errorf("secret was not fetched")
+	}
+	for _, result := range results {
+		v = append(v, result.values...)
+		for id, ver := range result.versions {
+			curMap[id] = ver
+		}
+	}
+	return v, nil
+}
+
+// Private helper to fetch a secret on a worker goroutine, turning a panic into
+// an error since the gRPC interceptors only recover the request goroutine.
+func (p *SecretsManagerProvider) fetchRecovered(
+	ctx context.Context,
+	descriptor *SecretDescriptor,
+	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
+) (value []*SecretValue, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			klog.FromContext(ctx).Error(nil, "Panic fetching secret", "object", descriptor.ObjectName, "panic", r, "stack", string(debug.Stack()))
+			value, err = nil, fmt.Errorf("internal error fetching secret %s", descriptor.ObjectName)
+		}
+	}()
+	return p.fetchSecretManagerValue(ctx, descriptor, curMap, opts)
+}
+
 // Private helper function to fetch a single secret.
 //
 // This method iterates over all available clients in the SecretsManagerProvider.
@@ -72,16 +187,26 @@ func (p *SecretsManagerProvider) fetchSecretManagerValue(
 	ctx context.Context,
 	descriptor *SecretDescriptor,
 	curMap map[string]*v1alpha1.ObjectVersion,
+	opts FetchOptions,
 ) (value []*SecretValue, err error) {
 
+	start := time.Now()
+	var errs []error
 	for _, client := range p.clients {
+		if ctx.Err() != nil { // Don't try other regions once cancelled.
+			return nil, ctx.Err()
+		}
 		secretVal, err := p.fetchSecretManagerValueWithClient(ctx, client, descriptor, curMap)
+		if err != nil && descriptor.UseReplica && client.FailoverIndex > 0 {
+			err = p.explainReplicaError(ctx, descriptor, client.Region, err)
+		}
 
 		//check if fatal(4XX status error) exist to error out the mount
-		if utils.IsFatalError(err) {
-			return nil, err
+		if isFatalError(opts, client.FailoverIndex > 0, err) {
+			return nil, utils.WithObject(SecretsManager.String(), descriptor.ObjectName, client.Region, err)
 		} else if err != nil {
 			klog.Warning(err)
+			errs = append(errs, err)
 		}
 
 		if len(secretVal) > 0 && len(value) == 0 {
@@ -89,9 +214,11 @@ func (p *SecretsManagerProvider) fetchSecretManagerValue(
 		}
 	}
 	if len(value) == 0 {
-		return nil, fmt.Errorf("Failed to fetch secret from all regions: %s", descriptor.ObjectName)
+		err = fmt.Errorf("Failed to fetch secret from all regions: %s: %w", descriptor.ObjectName, utils.JoinRegionErrors(errs))
+		return nil, utils.WithObject(SecretsManager.String(), descriptor.ObjectName, "", err)
 	}
 
+	setLatency(value, time.Since(start))
 	return value, nil
 }
 
@@ -110,25 +237,48 @@ func (p *SecretsManagerProvider) fetchSecretManagerValueWithClient(
 
 	var values []*SecretValue
 
+	// Nothing is read from the version of the secret itself when only entries
+	// pinned to other versions are written, so it is not fetched at all.
+	if descriptor.onlyPinnedEntries() {
+		return p.fetchPinnedEntries(ctx, client, descriptor, curMap, nil)
+	}
+
 	// Don't re-fetch if we already have the current version.
-	isCurrent, version, err := p.isCurrent(ctx, client, descriptor, curMap)
+	_, mounted := curMap[descriptor.GetFileName()]
+	isCurrent, version, stages, err := p.isCurrent(ctx, client, descriptor, curMap)
 	if err != nil {
 		return nil, err
 	}
 
-	// If version is current, read it back in, otherwise pull it down
+	// If version is current, read it back in, otherwise pull it down. When
+	// the whole secret is not written there is nothing to read back.
 	var secret *SecretValue
-	if isCurrent {
+	if isCurrent && descriptor.GetWriteParent() {
+		utils.RecordFetchDecision(client.Region, utils.FetchReloaded)
 		secret, err = p.reloadSecret(descriptor)
 		if err != nil {
 			return nil, err
 		}
 	} else { // Fetch the latest version.
+		switch {
+		case isCurrent:
+			utils.RecordFetchDecision(client.Region, utils.FetchRefetched)
+		case mounted:
+			utils.RecordFetchDecision(client.Region, utils.FetchChanged)
+		default:
+			utils.RecordFetchDecision(client.Region, utils.FetchInitial)
+		}
 		version, secret, err = p.fetchSecret(ctx, client, descriptor)
+		if err != nil && p.isAbsentStage(ctx, client, descriptor, err) {
+			return absentStageValues(client, descriptor, curMap), nil
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
+	secret.IsFailover = client.FailoverIndex > 0
+	secret.FailoverIndex = client.FailoverIndex
+	secret.Version = version
 	values = append(values, secret) // Build up the slice of values
 
 	//Fetch individual json key value pairs based on jmesPath
@@ -139,6 +289,13 @@ func (p *SecretsManagerProvider) fetchSecretManagerValueWithClient(
 
 	values = append(values, jsonSecrets...)
 
+	// Entries pinned to another version record their own versions.
+	pinnedSecrets, err := p.fetchPinnedEntries(ctx, client, descriptor, curMap, stages)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, pinnedSecrets...)
+
 	// Update the version in the current version map.
 	for _, jsonSecret := range jsonSecrets {
 		jsonDescriptor := jsonSecret.Descriptor
@@ -165,46 +322,71 @@ func (p *SecretsManagerProvider) fetchSecretManagerValueWithClient(
 // version to determine if it is current. Otherwise, the current vesion
 // information is fetched using DescribeSecret and this method checks if the
 // current version is labeled as current (AWSCURRENT) or has the label
-// sepecified via objectVersionLable (if any).
+// sepecified via objectVersionLable (if any). The staging labels of each
+// version are returned when DescribeSecret was called (nil otherwise).
 //
 func (p *SecretsManagerProvider) isCurrent(
 	ctx context.Context,
 	client SecretsManagerClient,
 	descriptor *SecretDescriptor,
 	curMap map[string]*v1alpha1.ObjectVersion,
-) (cur bool, ver string, err error) {
+) (cur bool, ver string, stages map[string][]*string, err error) {
 
 	// If we don't have this version, it is not current.
 	curVer := curMap[descriptor.GetFileName()]
 	if curVer == nil {
-		return false, "", nil
+		return false, "", nil, nil
 	}
 
-	// If the secret is pinned to a version see if that is what we have.
-	if len(descriptor.GetObjectVersion(client.IsFailover)) > 0 {
-		return curVer.Version == descriptor.GetObjectVersion(client.IsFailover), curVer.Version, nil
+	// If the secret is pinned to a version see if that is what we have. Pinned
+	// versions are immutable so there is never a need to call DescribeSecret,
+	// in either region.
+	pinnedVer := descriptor.GetObjectVersion(client.FailoverIndex)
+	if len(pinnedVer) > 0 {
+		return curVer.Version == pinnedVer, curVer.Version, nil, nil
 	}
 
 	// Lookup the current version information.
-	rsp, err := client.Client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(descriptor.GetSecretName(client.IsFailover))})
+	stages, err = p.describeStages(ctx, client, descriptor)
 	if err != nil {
-		return false, curVer.Version, fmt.Errorf("%s: Failed to describe secret %s: %w", client.Region, descriptor.ObjectName, err)
+		return false, curVer.Version, nil, err
 	}
 
 	// If no label is specified use current, otherwise use the specified label.
 	label := "AWSCURRENT"
-	if len(descriptor.GetObjectVersionLabel(client.IsFailover)) > 0 {
-		label = descriptor.GetObjectVersionLabel(client.IsFailover)
+	if len(descriptor.GetObjectVersionLabel(client.FailoverIndex)) > 0 {
+		label = descriptor.GetObjectVersionLabel(client.FailoverIndex)
 	}
 
 	// Linear search for desired label in the list of labels on current version.
-	stages := rsp.VersionIdsToStages[curVer.Version]
+	curStages := stages[curVer.Version]
 	hasLabel := false
-	for i := 0; i < len(stages) && !hasLabel; i++ {
-		hasLabel = *(stages[i]) == label
+	for i := 0; i < len(curStages) && !hasLabel; i++ {
+		hasLabel = *(curStages[i]) == label
 	}
 
-	return hasLabel, curVer.Version, nil // If the current version has the desired label, it is current.
+	return hasLabel, curVer.Version, stages, nil // If the current version has the desired label, it is current.
+}
+
+// Private helper to describe a secret and return the staging labels of each
+// of its versions (never nil).
+func (p *SecretsManagerProvider) describeStages(
+	ctx context.Context,
+	client SecretsManagerClient,
+	descriptor *SecretDescriptor,
+) (map[string][]*string, error) {
+
+	start := time.Now()
+	rsp, err := client.Client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(descriptor.GetSecretName(client.FailoverIndex))})
+	utils.ObserveAPICall(SecretsManager.String(), "DescribeSecret", client.Region, time.Since(start))
+	if err != nil {
+		utils.RecordFetchError(SecretsManager.String(), client.Region, "", err)
+		return nil, utils.WithRequestContext(client.Region, "", fmt.Errorf("Failed to describe secret %s: %w", descriptor.ObjectName, err))
+	}
+	if rsp.VersionIdsToStages == nil {
+		return map[string][]*string{}, nil
+	}
+	return rsp.VersionIdsToStages, nil
 }
 
 // Private helper to fetch a given secret.
@@ -218,21 +400,24 @@ func (p *SecretsManagerProvider) fetchSecret(
 	descriptor *SecretDescriptor,
 ) (ver string, val *SecretValue, err error) {
 
-	req := secretsmanager.GetSecretValueInput{SecretId: aws.String(descriptor.GetSecretName(client.IsFailover))}
+	req := secretsmanager.GetSecretValueInput{SecretId: aws.String(descriptor.GetSecretName(client.FailoverIndex))}
 
 	// Use explicit version if specified
-	if len(descriptor.GetObjectVersion(client.IsFailover)) != 0 {
-		req.SetVersionId(descriptor.GetObjectVersion(client.IsFailover))
+	if len(descriptor.GetObjectVersion(client.FailoverIndex)) != 0 {
+		req.SetVersionId(descriptor.GetObjectVersion(client.FailoverIndex))
 	}
 
 	// Use stage label if specified
-	if len(descriptor.GetObjectVersionLabel(client.IsFailover)) != 0 {
-		req.SetVersionStage(descriptor.GetObjectVersionLabel(client.IsFailover))
+	if len(descriptor.GetObjectVersionLabel(client.FailoverIndex)) != 0 {
+		req.SetVersionStage(descriptor.GetObjectVersionLabel(client.FailoverIndex))
 	}
 
+	start := time.Now()
 	rsp, err := client.Client.GetSecretValueWithContext(ctx, &req)
+	utils.ObserveAPICall(SecretsManager.String(), "GetSecretValue", client.Region, time.Since(start))
 	if err != nil {
-		return "", nil, fmt.Errorf("%s: Failed fetching secret %s: %w", client.Region, descriptor.ObjectName, err)
+		utils.RecordFetchError(SecretsManager.String(), client.Region, "", err)
+		return "", nil, utils.WithRequestContext(client.Region, "", fmt.Errorf("Failed fetching secret %s: %w", descriptor.ObjectName, err))
 	}
 
 	// Use either secret string or secret binary.
@@ -243,7 +428,13 @@ func (p *SecretsManagerProvider) fetchSecret(
 		sValue = rsp.SecretBinary
 	}
 
-	return *rsp.VersionId, &SecretValue{Value: sValue, Descriptor: *descriptor}, nil
+	secret := &SecretValue{Value: sValue, Descriptor: *descriptor, ARN: aws.StringValue(rsp.ARN)}
+	if err := secret.decode(); err != nil {
+		return "", nil, fmt.Errorf("%s: %w", client.Region, err)
+	}
+	secret.trim()
+
+	return *rsp.VersionId, secret, nil
 }
 
 // Private helper to refesh a secret from its previously stored value.
@@ -271,10 +462,11 @@ func NewSecretsManagerProviderWithClients(clients ...SecretsManagerClient) *Secr
 func NewSecretsManagerProvider(awsSessions []*session.Session, regions []string) *SecretsManagerProvider {
 	var clients []SecretsManagerClient
 	for i, awsSession := range awsSessions {
+		config := clientConfig(awsSession, utils.SecretsManagerService, secretsmanager.EndpointsID, regions[i])
 		client := SecretsManagerClient{
-			Region:     *awsSession.Config.Region,
-			Client:     secretsmanager.New(awsSession, aws.NewConfig().WithRegion(regions[i])),
-			IsFailover: i > 0,
+			Region:        regions[i],
+			Client:        secretsmanager.New(awsSession, config),
+			FailoverIndex: i,
 		}
 		clients = append(clients, client)
 	}
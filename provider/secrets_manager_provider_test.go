@@ -0,0 +1,552 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	getCnt  int
+	descCnt int
+}
+
+func (m *mockSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	m.getCnt++
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String("secret"),
+		VersionId:    input.VersionId,
+	}, nil
+}
+
+func (m *mockSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+	m.descCnt++
+	return &secretsmanager.DescribeSecretOutput{}, nil
+}
+
+// Make sure pinned versions never call DescribeSecret in either region.
+func TestPinnedVersionSkipsDescribe(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestPinnedVersionSkipsDescribe")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectAlias: alias1
+            objectVersion: v1
+            failoverObject:
+              objectName: secret1
+              objectVersion: v1`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, []string{"us-west-2", "us-east-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = ioutil.WriteFile(descriptors[SecretsManager][0].GetMountPath(), []byte("secret"), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	primary, failover := &mockSecretsManager{}, &mockSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(
+		SecretsManagerClient{Region: "us-west-2", Client: primary},
+		SecretsManagerClient{Region: "us-east-1", Client: failover, FailoverIndex: 1},
+	)
+
+	// Remount with the pinned version current, then with a stale version.
+	for _, curVer := range []string{"v1", "v0"} {
+		curMap := map[string]*v1alpha1.ObjectVersion{"alias1": {Id: "alias1", Version: curVer}}
+		_, err = provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if curMap["alias1"].Version != "v1" {
+			t.Fatalf("Wrong version: %s", curMap["alias1"].Version)
+		}
+	}
+
+	if primary.descCnt != 0 || failover.descCnt != 0 {
+		t.Fatalf("DescribeSecret called for pinned version: %d, %d", primary.descCnt, failover.descCnt)
+	}
+	if primary.getCnt != 1 {
+		t.Fatalf("Expected one GetSecretValue call for the stale version, got %d", primary.getCnt)
+	}
+}
+
+// Mock Secrets Manager client that tracks how many calls run at once.
+type concurrentSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (m *concurrentSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mu.Lock()
+	m.active++
+	m.maxSeen = max(m.maxSeen, m.active)
+	m.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+
+	if strings.HasPrefix(*input.SecretId, "Fail") {
+		return nil, fmt.Errorf("Error fetching %s", *input.SecretId)
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String("value-" + *input.SecretId),
+		VersionId:    aws.String("v-" + *input.SecretId),
+	}, nil
+}
+
+func TestConcurrentFetches(t *testing.T) {
+
+	var descriptors []*SecretDescriptor
+	for i := 0; i < 10; i++ {
+		descriptors = append(descriptors, &SecretDescriptor{ObjectName: fmt.Sprintf("secret%d", i), ObjectType: "secretsmanager"})
+	}
+
+	client := &concurrentSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client})
+	provider.maxConcurrentFetches = 3
+
+	curMap := map[string]*v1alpha1.ObjectVersion{}
+	values, err := provider.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.maxSeen < 2 || client.maxSeen > 3 {
+		t.Fatalf("Expected 2 to 3 fetches at once, got %d", client.maxSeen)
+	}
+
+	// Results are in descriptor order regardless of completion order.
+	for i, value := range values {
+		name := fmt.Sprintf("secret%d", i)
+		if string(value.Value) != "value-"+name || curMap[name].Version != "v-"+name {
+			t.Fatalf("Unexpected value for %s: %s %v", name, string(value.Value), curMap[name])
+		}
+	}
+	if len(values) != 10 || len(curMap) != 10 {
+		t.Fatalf("Expected 10 values and versions, got %d and %d", len(values), len(curMap))
+	}
+}
+
+func TestConcurrentFetchErrors(t *testing.T) {
+
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "secret0", ObjectType: "secretsmanager"},
+		{ObjectName: "Fail1", ObjectType: "secretsmanager"},
+		{ObjectName: "Fail2", ObjectType: "secretsmanager"},
+	}
+
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: &concurrentSecretsManager{}})
+	provider.maxConcurrentFetches = 3
+
+	// The first failed descriptor is always reported and nothing is recorded.
+	for i := 0; i < 5; i++ {
+		curMap := map[string]*v1alpha1.ObjectVersion{}
+		_, err := provider.GetSecretValues(context.Background(), descriptors, curMap, FetchOptions{})
+		if err == nil || !strings.Contains(err.Error(), "Error fetching Fail1") || strings.Contains(err.Error(), "Fail2") {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(curMap) != 0 {
+			t.Fatalf("Unexpected versions recorded: %v", curMap)
+		}
+	}
+}
+
+func TestConcurrentFetchCancelled(t *testing.T) {
+
+	descriptors := []*SecretDescriptor{
+		{ObjectName: "secret0", ObjectType: "secretsmanager"},
+		{ObjectName: "secret1", ObjectType: "secretsmanager"},
+	}
+
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: &concurrentSecretsManager{}})
+	provider.maxConcurrentFetches = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	values, err := provider.GetSecretValues(ctx, descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if values != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancellation error, got %v %v", values, err)
+	}
+}
+
+// Mock Secrets Manager client that denies access to every secret.
+type deniedSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	getCnt int
+}
+
+func (m *deniedSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	m.getCnt++
+	return nil, awserr.NewRequestFailure(awserr.New("AccessDeniedException", "not authorized", nil), 400, "someId")
+}
+
+// Make sure access denied in the primary region only fails over when allowed.
+func TestAccessDeniedFailover(t *testing.T) {
+
+	descriptors := []*SecretDescriptor{{ObjectName: "secret1", ObjectType: "secretsmanager", ObjectVersion: "v1"}}
+
+	failover := &mockSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(
+		SecretsManagerClient{Region: "us-west-2", Client: &deniedSecretsManager{}},
+		SecretsManagerClient{Region: "us-east-1", Client: failover, FailoverIndex: 1},
+	)
+
+	_, err := provider.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "AccessDeniedException") || failover.getCnt != 0 {
+		t.Fatalf("Expected a fatal access denied error, got %v with %d failover calls", err, failover.getCnt)
+	}
+
+	opts := FetchOptions{AccessDeniedFailover: true}
+	values, err := provider.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 1 || !values[0].IsFailover || failover.getCnt != 1 {
+		t.Fatalf("Expected the value from the failover region, got %+v", values)
+	}
+
+	// Access denied in the failover region is still fatal.
+	denied := &deniedSecretsManager{}
+	provider = NewSecretsManagerProviderWithClients(
+		SecretsManagerClient{Region: "us-west-2", Client: &deniedSecretsManager{}},
+		SecretsManagerClient{Region: "us-east-1", Client: denied, FailoverIndex: 1},
+	)
+	_, err = provider.GetSecretValues(context.Background(), descriptors, map[string]*v1alpha1.ObjectVersion{}, opts)
+	if err == nil || denied.getCnt != 1 || utils.ErrorCategory(err) != utils.ErrorAccessDenied {
+		t.Fatalf("Expected access denied from both regions, got %v", err)
+	}
+}
+
+// Mock Secrets Manager client that is unavailable and records the secrets asked for.
+type unavailableSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secretIds []string
+}
+
+func (m *unavailableSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	m.secretIds = append(m.secretIds, aws.StringValue(input.SecretId))
+	return nil, awserr.NewRequestFailure(awserr.New("InternalServiceError", "unavailable", nil), 500, "someId")
+}
+
+// Make sure the failover regions are tried in order, each with its own failover object.
+func TestMultipleFailoverRegions(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectAlias: alias1
+            objectVersion: v1
+            failoverObject:
+              - objectName: secret2
+                objectVersion: v1
+              - objectName: secret3
+                objectVersion: v1`
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, regions)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	primary, second := &unavailableSecretsManager{}, &unavailableSecretsManager{}
+	third := &mockSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(
+		SecretsManagerClient{Region: regions[0], Client: primary},
+		SecretsManagerClient{Region: regions[1], Client: second, FailoverIndex: 1},
+		SecretsManagerClient{Region: regions[2], Client: third, FailoverIndex: 2},
+	)
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(primary.secretIds) != 1 || primary.secretIds[0] != "secret1" || len(second.secretIds) != 1 || second.secretIds[0] != "secret2" {
+		t.Fatalf("Unexpected secrets fetched: %v %v", primary.secretIds, second.secretIds)
+	}
+	if len(values) != 1 || !values[0].IsFailover || values[0].FailoverIndex != 2 || third.getCnt != 1 {
+		t.Fatalf("Expected the value from the last failover region, got %+v", values)
+	}
+	if name := values[0].Descriptor.GetSecretName(values[0].FailoverIndex); name != "secret3" {
+		t.Fatalf("Expected secret3 but got %s", name)
+	}
+}
+
+// Mock Secrets Manager client holding a JSON secret mid rotation.
+type rotatingSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	gets []string
+}
+
+func (m *rotatingSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	version := aws.StringValue(input.VersionId)
+	switch aws.StringValue(input.VersionStage) {
+	case "AWSPENDING": // Not mid rotation after all
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "can not find the staging label", nil)
+	case "AWSPREVIOUS":
+		version = "v1"
+	case "", "AWSCURRENT":
+		if len(version) == 0 {
+			version = "v2"
+		}
+	}
+	m.gets = append(m.gets, version)
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"password": "password-` + version + `"}`),
+		VersionId:    aws.String(version),
+	}, nil
+}
+
+func (m *rotatingSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+	if aws.StringValue(input.SecretId) == "missing" {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "can not find the secret", nil)
+	}
+	return &secretsmanager.DescribeSecretOutput{
+		VersionIdsToStages: map[string][]*string{"v2": {aws.String("AWSCURRENT")}, "v1": {aws.String("AWSPREVIOUS")}},
+	}, nil
+}
+
+// Make sure each staged version of a secret is mounted to its own file.
+func TestVersionStages(t *testing.T) {
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            objectVersionStages: [AWSCURRENT, AWSPREVIOUS]`
+	descriptors, err := NewSecretDescriptorList("/", "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: &rotatingSecretsManager{}})
+	curMap := make(map[string]*v1alpha1.ObjectVersion)
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"secret1_AWSCURRENT": `{"password": "password-v2"}`, "secret1_AWSPREVIOUS": `{"password": "password-v1"}`}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(values))
+	}
+	for _, value := range values {
+		if string(value.Value) != expected[value.Descriptor.GetFileName()] {
+			t.Errorf("Wrong value for %s: %s", value.Descriptor.GetFileName(), value.Value)
+		}
+	}
+	if curMap["secret1_AWSCURRENT"].Version != "v2" || curMap["secret1_AWSPREVIOUS"].Version != "v1" {
+		t.Errorf("Wrong versions: %v %v", curMap["secret1_AWSCURRENT"], curMap["secret1_AWSPREVIOUS"])
+	}
+}
+
+// Make sure a stage that is not on any version is mounted as empty files, but
+// a missing secret still fails.
+func TestAbsentVersionStage(t *testing.T) {
+
+	objects := `
+          - objectName: %s
+            objectType: secretsmanager
+            objectVersionStages: [AWSCURRENT, AWSPENDING]
+            jmesPath: [{path: password, objectAlias: password}]`
+	descriptors, err := NewSecretDescriptorList("/", "", "", fmt.Sprintf(objects, "secret1"), singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: &rotatingSecretsManager{}})
+	curMap := make(map[string]*v1alpha1.ObjectVersion)
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"secret1_AWSCURRENT":  `{"password": "password-v2"}`,
+		"password_AWSCURRENT": "password-v2",
+		"secret1_AWSPENDING":  "",
+		"password_AWSPENDING": "",
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(values))
+	}
+	for _, value := range values {
+		if exp, ok := expected[value.Descriptor.GetFileName()]; !ok || string(value.Value) != exp {
+			t.Errorf("Wrong value for %s: %s", value.Descriptor.GetFileName(), value.Value)
+		}
+	}
+	if curMap["secret1_AWSPENDING"] == nil || curMap["secret1_AWSPENDING"].Version != "" {
+		t.Errorf("Wrong version for the absent stage: %v", curMap["secret1_AWSPENDING"])
+	}
+
+	descriptors, err = NewSecretDescriptorList("/", "", "", fmt.Sprintf(objects, "missing"), singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = provider.GetSecretValues(context.Background(), descriptors[SecretsManager], map[string]*v1alpha1.ObjectVersion{}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "staging label") {
+		t.Fatalf("Expected the fetch error for a missing secret, got %v", err)
+	}
+}
+
+// Make sure jmesPath entries read their path from the version they are pinned
+// to and that entries pinned to a version id are reloaded from the mount.
+func TestPinnedJMESPathEntries(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestPinnedJMESPathEntries")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            jmesPath:
+              - path: password
+                objectAlias: current
+              - path: password
+                objectAlias: previous
+                objectVersionLabel: AWSPREVIOUS
+              - path: password
+                objectAlias: first
+                objectVersion: v1`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	client := &rotatingSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client})
+	for _, concurrent := range []int{1, 2} {
+		provider.maxConcurrentFetches = concurrent
+		client.gets = nil
+		curMap := make(map[string]*v1alpha1.ObjectVersion)
+		values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{"secret1": `{"password": "password-v2"}`, "current": "password-v2", "previous": "password-v1", "first": "password-v1"}
+		if len(values) != len(expected) {
+			t.Fatalf("Expected %d values, got %d", len(expected), len(values))
+		}
+		for _, value := range values {
+			fileName := value.Descriptor.GetFileName()
+			if string(value.Value) != expected[fileName] {
+				t.Errorf("Wrong value for %s: %s", fileName, value.Value)
+			}
+			if err := ioutil.WriteFile(value.Descriptor.GetMountPath(), value.Value, 0644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if curMap["previous"].Version != "v1" || curMap["first"].Version != "v1" || curMap["secret1"].Version != "v2" {
+			t.Fatalf("Wrong versions: %v %v %v", curMap["secret1"], curMap["previous"], curMap["first"])
+		}
+
+		// Remounting reloads the version pin, and the label pin while the
+		// label is still on the mounted version.
+		client.gets = nil
+		values, err = provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(values) != len(expected) || len(client.gets) != 0 {
+			t.Fatalf("Expected nothing to be fetched, got %d values and fetches %v", len(values), client.gets)
+		}
+
+		// Once the label moves the label pin is fetched again.
+		curMap["previous"].Version = "v0"
+		client.gets = nil
+		if _, err = provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Join(client.gets, ",") != "v1" || curMap["previous"].Version != "v1" {
+			t.Fatalf("Expected only the label pin to be fetched, got fetches %v", client.gets)
+		}
+	}
+}
+
+// Make sure the secret itself is not fetched when only pinned entries are
+// written.
+func TestOnlyPinnedJMESPathEntries(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestOnlyPinnedJMESPathEntries")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	objects := `
+          - objectName: secret1
+            objectType: secretsmanager
+            writeParent: false
+            jmesPath:
+              - path: password
+                objectAlias: previous
+                objectVersionLabel: AWSPREVIOUS
+              - path: password
+                objectAlias: current
+                objectVersionLabel: AWSCURRENT`
+	descriptors, err := NewSecretDescriptorList(dir, "", "", objects, singleRegion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	client := &rotatingSecretsManager{}
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client})
+	curMap := make(map[string]*v1alpha1.ObjectVersion)
+	values, err := provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 2 || strings.Join(client.gets, ",") != "v1,v2" || curMap["secret1"] != nil {
+		t.Fatalf("Expected only the pinned entries to be fetched, got %d values and fetches %v", len(values), client.gets)
+	}
+	for _, value := range values {
+		if err := ioutil.WriteFile(value.Descriptor.GetMountPath(), value.Value, 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	client.gets = nil
+	values, err = provider.GetSecretValues(context.Background(), descriptors[SecretsManager], curMap, FetchOptions{})
+	if err != nil || len(values) != 2 || len(client.gets) != 0 {
+		t.Fatalf("Expected the pinned entries to be reloaded, got %d values and fetches %v: %v", len(values), client.gets, err)
+	}
+}
@@ -0,0 +1,209 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+	"k8s.io/klog/v2"
+)
+
+// ListSecrets accepts at most 10 filters, one per tag key.
+const maxObjectTags = 10
+
+// Upper bound on the secrets a single objectTags entry may select, so a broad
+// tag can not fill the mount with every secret in the account.
+const maxTaggedObjects = 100
+
+// Implemented by providers that can select objects by tag.
+type tagLister interface {
+	listTaggedSecrets(ctx context.Context, tags map[string]string, opts FetchOptions) ([]string, error)
+}
+
+// Format tags for log and error messages (sorted key=value pairs).
+//
+func TagSelector(tags map[string]string) string {
+
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Replace every object selecting secrets by tag (objectTags) with one object
+// for each matching secret.
+//
+// The matching secrets are looked up on every mount, so secrets tagged later
+// are picked up when the mount is rotated. Secrets that are already listed by
+// name are skipped, and a match that would be written to the same file as
+// another object fails the mount.
+//
+func ResolveTaggedObjects(
+	ctx context.Context,
+	factory *SecretProviderFactory,
+	descriptors map[SecretType][]*SecretDescriptor,
+	opts FetchOptions,
+) error {
+
+	var tagged, named []*SecretDescriptor
+	for _, descriptor := range descriptors[SecretsManager] {
+		if len(descriptor.ObjectTags) > 0 {
+			tagged = append(tagged, descriptor)
+		} else {
+			named = append(named, descriptor)
+		}
+	}
+	if len(tagged) == 0 {
+		return nil
+	}
+
+	lister, ok := factory.GetSecretProvider(SecretsManager).(tagLister)
+	if !ok {
+		return utils.InvalidConfiguration(fmt.Errorf("objectTags is not supported by the secretsmanager provider"))
+	}
+
+	// Track the names and files already in use.
+	seen := make(map[string]bool)
+	files := make(map[string]string)
+	for _, sType := range []SecretType{SSMParameter, SecretsManager} {
+		for _, descriptor := range descriptors[sType] {
+			if len(descriptor.ObjectTags) > 0 {
+				continue
+			}
+			seen[descriptor.ObjectName] = true
+			files[descriptor.GetFileName()] = descriptor.ObjectName
+			for _, jmesEntry := range descriptor.JMESPath {
+				jmesDescriptor := descriptor.getJmesEntrySecretDescriptor(&jmesEntry)
+				files[jmesDescriptor.GetFileName()] = descriptor.ObjectName
+			}
+		}
+	}
+
+	for _, descriptor := range tagged {
+		selector := TagSelector(descriptor.ObjectTags)
+		names, err := lister.listTaggedSecrets(ctx, descriptor.ObjectTags, opts)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			klog.Warningf("No secrets match objectTags %s", selector)
+		}
+
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			match := *descriptor
+			match.ObjectName = name
+			match.ObjectTags = nil
+			if other, ok := files[match.GetFileName()]; ok {
+				return utils.InvalidConfiguration(validationErrorf(ErrDuplicateAlias, "secret %s selected by objectTags %s has the same file name as %s", name, selector, other))
+			}
+			files[match.GetFileName()] = name
+			named = append(named, &match)
+		}
+	}
+
+	descriptors[SecretsManager] = named
+	return nil
+}
+
+// Private helper to list the names of the secrets with all the given tags.
+//
+// Each region is tried in turn until one succeeds, the same way secrets are
+// fetched.
+//
+func (p *SecretsManagerProvider) listTaggedSecrets(ctx context.Context, tags map[string]string, opts FetchOptions) ([]string, error) {
+
+	var errs []error
+	for _, client := range p.clients {
+		if ctx.Err() != nil { // Don't try other regions once cancelled.
+			return nil, ctx.Err()
+		}
+		names, err := p.listTaggedSecretsWithClient(ctx, client, tags)
+		if err == nil {
+			return names, nil
+		}
+		if isFatalError(opts, client.FailoverIndex > 0, err) {
+			return nil, err
+		}
+		klog.Warning(err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("Failed to list secrets from all regions: %s: %w", TagSelector(tags), utils.JoinRegionErrors(errs))
+}
+
+// Private helper to list the names of the secrets with all the given tags in
+// a single region.
+//
+// The tag-key filters narrow the listing server side, but they match
+// prefixes, so the exact tags are checked on each result.
+//
+func (p *SecretsManagerProvider) listTaggedSecretsWithClient(
+	ctx context.Context,
+	client SecretsManagerClient,
+	tags map[string]string,
+) ([]string, error) {
+
+	input := &secretsmanager.ListSecretsInput{}
+	for _, key := range sortedKeys(tags) {
+		input.Filters = append(input.Filters, &secretsmanager.Filter{
+			Key:    aws.String(secretsmanager.FilterNameStringTypeTagKey),
+			Values: []*string{aws.String(key)},
+		})
+	}
+
+	var names []string
+	start := time.Now()
+	err := client.Client.ListSecretsPagesWithContext(ctx, input, func(page *secretsmanager.ListSecretsOutput, lastPage bool) bool {
+		for _, entry := range page.SecretList {
+			if hasTags(entry.Tags, tags) {
+				names = append(names, aws.StringValue(entry.Name))
+			}
+		}
+		return len(names) <= maxTaggedObjects
+	})
+	utils.ObserveAPICall(SecretsManager.String(), "ListSecrets", client.Region, time.Since(start))
+	if err != nil {
+		utils.RecordFetchError(SecretsManager.String(), client.Region, "", err)
+		return nil, utils.WithRequestContext(client.Region, "", fmt.Errorf("Failed listing secrets tagged %s: %w", TagSelector(tags), err))
+	}
+	if len(names) > maxTaggedObjects {
+		return nil, utils.InvalidConfiguration(fmt.Errorf("objectTags %s match more than %d secrets", TagSelector(tags), maxTaggedObjects))
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Private helper to check that a secret has every one of the given tags.
+func hasTags(secretTags []*secretsmanager.Tag, tags map[string]string) bool {
+
+	found := 0
+	for _, tag := range secretTags {
+		if value, ok := tags[aws.StringValue(tag.Key)]; ok && value == aws.StringValue(tag.Value) {
+			found++
+		}
+	}
+	return found == len(tags)
+}
+
+// Private helper to return the keys of a map in sorted order.
+func sortedKeys(tags map[string]string) []string {
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+type listingSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	pages [][]*secretsmanager.SecretListEntry
+	input *secretsmanager.ListSecretsInput
+}
+
+func (m *listingSecretsManager) ListSecretsPagesWithContext(
+	ctx context.Context, input *secretsmanager.ListSecretsInput,
+	fn func(*secretsmanager.ListSecretsOutput, bool) bool, options ...request.Option,
+) error {
+	m.input = input
+	for i, page := range m.pages {
+		if !fn(&secretsmanager.ListSecretsOutput{SecretList: page}, i == len(m.pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+// Private helper to build a list entry with the given tags.
+func taggedEntry(name string, tags ...string) *secretsmanager.SecretListEntry {
+
+	entry := &secretsmanager.SecretListEntry{Name: aws.String(name)}
+	for i := 0; i < len(tags); i += 2 {
+		entry.Tags = append(entry.Tags, &secretsmanager.Tag{Key: aws.String(tags[i]), Value: aws.String(tags[i+1])})
+	}
+	return entry
+}
+
+func TestResolveTaggedObjects(t *testing.T) {
+
+	client := &listingSecretsManager{pages: [][]*secretsmanager.SecretListEntry{
+		{
+			taggedEntry("payments/db", "app", "payments", "env", "prod"),
+			taggedEntry("payments/test", "app", "payments", "env", "prodtest"),
+		},
+		{
+			taggedEntry("payments/api", "app", "payments", "env", "prod", "team", "core"),
+			taggedEntry("explicit", "app", "payments", "env", "prod"),
+			taggedEntry("other", "app", "billing", "env", "prod"),
+		},
+	}}
+	factory := &SecretProviderFactory{Providers: map[SecretType]SecretProvider{
+		SecretsManager: NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client}),
+	}}
+
+	objects := `
+          - objectName: explicit
+            objectType: secretsmanager
+          - objectType: secretsmanager
+            objectTags:
+              app: payments
+              env: prod`
+	descriptors, err := NewSecretDescriptorList("/", "_", "", objects, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ResolveTaggedObjects(context.Background(), factory, descriptors, FetchOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, descriptor := range descriptors[SecretsManager] {
+		if len(descriptor.ObjectTags) != 0 {
+			t.Errorf("Tags not cleared on %s", descriptor.ObjectName)
+		}
+		names = append(names, descriptor.ObjectName)
+	}
+	if strings.Join(names, " ") != "explicit payments/api payments/db" {
+		t.Errorf("Unexpected objects: %v", names)
+	}
+	if descriptors[SecretsManager][1].GetFileName() != "payments_api" {
+		t.Errorf("Unexpected file name: %s", descriptors[SecretsManager][1].GetFileName())
+	}
+	if len(client.input.Filters) != 2 || aws.StringValue(client.input.Filters[0].Values[0]) != "app" {
+		t.Errorf("Unexpected filters: %v", client.input.Filters)
+	}
+}
+
+func TestResolveTaggedObjectsCollision(t *testing.T) {
+
+	client := &listingSecretsManager{pages: [][]*secretsmanager.SecretListEntry{
+		{taggedEntry("payments/db", "app", "payments")},
+	}}
+	factory := &SecretProviderFactory{Providers: map[SecretType]SecretProvider{
+		SecretsManager: NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client}),
+	}}
+
+	objects := `
+          - objectName: other
+            objectType: secretsmanager
+            objectAlias: payments_db
+          - objectType: secretsmanager
+            objectTags:
+              app: payments`
+	descriptors, err := NewSecretDescriptorList("/", "_", "", objects, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = ResolveTaggedObjects(context.Background(), factory, descriptors, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "has the same file name as other") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestResolveTaggedObjectsLimit(t *testing.T) {
+
+	var page []*secretsmanager.SecretListEntry
+	for i := 0; i <= maxTaggedObjects; i++ {
+		page = append(page, taggedEntry("secret"+strings.Repeat("x", i), "app", "payments"))
+	}
+	client := &listingSecretsManager{pages: [][]*secretsmanager.SecretListEntry{page}}
+	provider := NewSecretsManagerProviderWithClients(SecretsManagerClient{Region: "us-west-2", Client: client})
+
+	_, err := provider.listTaggedSecrets(context.Background(), map[string]string{"app": "payments"}, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "match more than 100 secrets") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestObjectTagsValidation(t *testing.T) {
+
+	for _, objects := range []string{
+		`
+          - objectName: secret1
+            objectType: secretsmanager
+            objectTags: {app: payments}`,
+		`
+          - objectType: ssmparameter
+            objectTags: {app: payments}`,
+		`
+          - objectType: secretsmanager
+            objectAlias: alias1
+            objectTags: {app: payments}`,
+		`
+          - objectType: secretsmanager
+            objectVersion: v1
+            objectTags: {app: payments}`,
+		`
+          - objectType: secretsmanager
+            objectTags: {"": payments}`,
+	} {
+		if _, err := NewSecretDescriptorList("/", "", "", objects, []string{"us-west-2"}); err == nil {
+			t.Errorf("Expected error for %s", objects)
+		}
+	}
+}
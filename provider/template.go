@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The largest objectsTemplate attribute accepted.
+const maxTemplateSpecSize = 64 * 1024
+
+// A file rendered from the fetched secrets using a Go text/template.
+//
+// Templates combine several secrets into one file, for example a database
+// configuration file containing both a user name and a password. The template
+// data is a map of every fetched value (including jmesPath entries and parents
+// not written because of writeParent) keyed by the file name the value would be
+// written to. The secret function returns a value by name and fails the mount
+// when the name is unknown, which is also the behaviour of a missing map key.
+// The base64 and json functions encode a value for use in other formats.
+// Ranging over the data visits the values in file name order, so bundles built
+// from every fetched value render the same way on each rotation and do not
+// cause needless reloads of the application.
+//
+type ObjectTemplate struct {
+	FileName string `json:"fileName"` // Name of the rendered file in the mount
+	Template string `json:"template"` // Go text/template source
+
+	tmpl     *template.Template
+	mountDir string
+}
+
+// Private helper to build the functions available in templates.
+func templateFuncs(data map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(name string) (string, error) {
+			value, ok := data[name]
+			if !ok {
+				return "", fmt.Errorf("no object named %s", name)
+			}
+			return value, nil
+		},
+		"base64": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"json": func(value string) (string, error) {
+			quoted, err := json.Marshal(value)
+			return string(quoted), err
+		},
+	}
+}
+
+// Parse and validate the objectsTemplate attribute of a SecretProviderClass.
+//
+// The attribute is a YAML list of fileName and template entries. Each template
+// must parse, and file names must be plain names (no path separators) that are
+// not repeated.
+//
+func NewObjectTemplateList(mountDir, templateSpec string) (t []*ObjectTemplate, e error) {
+
+	if len(templateSpec) == 0 {
+		return nil, nil
+	}
+	if len(templateSpec) > maxTemplateSpecSize {
+		return nil, fmt.Errorf("objectsTemplate exceeds %d bytes", maxTemplateSpecSize)
+	}
+
+	var templates []*ObjectTemplate
+	if err := yaml.Unmarshal([]byte(templateSpec), &templates); err != nil {
+		return nil, fmt.Errorf("Failed to load objectsTemplate: %+v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, tmpl := range templates {
+		if tmpl == nil {
+			return nil, fmt.Errorf("objectsTemplate entries can not be empty")
+		}
+		if len(tmpl.FileName) == 0 {
+			return nil, fmt.Errorf("fileName must be specified for objectsTemplate entries")
+		}
+		if strings.ContainsAny(tmpl.FileName, `/\`) || tmpl.FileName == "." || tmpl.FileName == ".." {
+			return nil, validationErrorf(ErrPathTraversal, "template fileName must be a file name without a path: %s", tmpl.FileName)
+		}
+		if names[tmpl.FileName] {
+			return nil, validationErrorf(ErrDuplicateAlias, "Name already in use for template fileName: %s", tmpl.FileName)
+		}
+		names[tmpl.FileName] = true
+
+		// The functions are rebound to the fetched values when rendering.
+		parsed, err := template.New(tmpl.FileName).Option("missingkey=error").Funcs(templateFuncs(nil)).Parse(tmpl.Template)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template for %s: %v", tmpl.FileName, err)
+		}
+		tmpl.tmpl = parsed
+		tmpl.mountDir = mountDir
+	}
+
+	return templates, nil
+}
+
+// Render the template using the fetched values.
+//
+// Returns a value to be written after all of the fetched values along with its
+// version, which is a hash of the template and of the name and version of
+// every fetched value, so the driver sees a new version whenever any of the
+// secrets used by the template changes. Only versions are hashed, since a hash
+// of the rendered contents reported as the object version could be used to
+// guess low entropy secrets. Errors do not include the rendered contents to
+// avoid leaking secrets.
+//
+func (t *ObjectTemplate) Render(values []*SecretValue) (val *SecretValue, version string, e error) {
+
+	data := make(map[string]string, len(values))
+	versions := make(map[string]string, len(values))
+	writeOrder := 0
+	for _, value := range values {
+		fileName := value.Descriptor.GetFileName()
+		if fileName == t.FileName {
+			return nil, "", fmt.Errorf("template fileName is also used by an object: %s", t.FileName)
+		}
+		data[fileName] = string(value.Value)
+		versions[fileName] = value.Version
+		writeOrder = max(writeOrder, value.Descriptor.GetWriteOrder()+1)
+	}
+
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return nil, "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Funcs(templateFuncs(data)).Execute(&out, data); err != nil {
+		return nil, "", fmt.Errorf("Failed to render template %s: %v", t.FileName, err)
+	}
+
+	return &SecretValue{
+		Value: out.Bytes(),
+		Descriptor: SecretDescriptor{
+			ObjectAlias: t.FileName,
+			mountDir:    t.mountDir,
+			writeOrder:  writeOrder,
+		},
+	}, t.version(versions), nil
+}
+
+// Private helper to hash the template along with the versions of the values it
+// was rendered from, in file name order.
+func (t *ObjectTemplate) version(versions map[string]string) string {
+
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%q\n", t.Template)
+	for _, name := range names {
+		fmt.Fprintf(hash, "%q %q\n", name, versions[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
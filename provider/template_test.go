@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectTemplateValidation(t *testing.T) {
+
+	tests := []struct {
+		spec     string
+		expError string
+	}{
+		{`[{"template": "x"}]`, "fileName must be specified"},
+		{`[{"fileName": "../x", "template": "x"}]`, "template fileName must be a file name without a path"},
+		{`[{"fileName": "a/b", "template": "x"}]`, "template fileName must be a file name without a path"},
+		{`[{"fileName": "x", "template": "x"}, {"fileName": "x", "template": "y"}]`, "Name already in use for template fileName: x"},
+		{`[{"fileName": "x", "template": "{{ .user "}]`, "Invalid template for x"},
+		{`[{"fileName": "x", "template": "{{ unknown .user }}"}]`, "Invalid template for x"},
+		{`[null]`, "objectsTemplate entries can not be empty"},
+		{`not a list`, "Failed to load objectsTemplate"},
+	}
+	for _, tst := range tests {
+		_, err := NewObjectTemplateList("/mnt", tst.spec)
+		if err == nil || !strings.Contains(err.Error(), tst.expError) {
+			t.Errorf("%s: expected error %q, got %v", tst.spec, tst.expError, err)
+		}
+	}
+
+	if templates, err := NewObjectTemplateList("/mnt", ""); err != nil || templates != nil {
+		t.Fatalf("Expected no templates, got %v %v", templates, err)
+	}
+}
+
+func TestObjectTemplateRender(t *testing.T) {
+
+	templates, err := NewObjectTemplateList("/mnt", `
+- fileName: database.yaml
+  template: |
+    user: {{ .user }}
+    password: {{ secret "db/password" | json }}
+    token: {{ index . "token" | base64 }}
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	values := []*SecretValue{
+		{Value: []byte("admin"), Descriptor: SecretDescriptor{ObjectAlias: "user", writeOrder: 1}, Version: "1"},
+		{Value: []byte(`p"w`), Descriptor: SecretDescriptor{ObjectName: "db/password"}, Version: "v1"},
+		{Value: []byte("abc"), Descriptor: SecretDescriptor{ObjectAlias: "token"}, Version: "v1"},
+	}
+	value, version, err := templates[0].Render(values)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(value.Value) != "user: admin\npassword: \"p\\\"w\"\ntoken: YWJj\n" {
+		t.Fatalf("Unexpected rendered value: %s", string(value.Value))
+	}
+	if value.Descriptor.GetMountPath() != "/mnt/database.yaml" || value.Descriptor.GetWriteOrder() != 2 {
+		t.Fatalf("Unexpected descriptor: %+v", value.Descriptor)
+	}
+
+	// The version changes with the versions of the values, not their contents.
+	values[0].Value = []byte("root")
+	_, sameVersion, err := templates[0].Render(values)
+	if err != nil || len(version) == 0 || version != sameVersion {
+		t.Fatalf("Expected the same version: %s %s %v", version, sameVersion, err)
+	}
+	values[0].Version = "2"
+	_, newVersion, err := templates[0].Render(values)
+	if err != nil || version == newVersion {
+		t.Fatalf("Expected a new version: %s %s %v", version, newVersion, err)
+	}
+}
+
+func TestObjectTemplateRenderErrors(t *testing.T) {
+
+	values := []*SecretValue{
+		{Value: []byte("admin"), Descriptor: SecretDescriptor{ObjectAlias: "user"}},
+	}
+
+	for spec, expError := range map[string]string{
+		`[{"fileName": "x", "template": "{{ .missing }}"}]`:           "Failed to render template x",
+		`[{"fileName": "x", "template": "{{ secret \"missing\" }}"}]`: "no object named missing",
+		`[{"fileName": "user", "template": "{{ .user }}"}]`:           "template fileName is also used by an object: user",
+	} {
+		templates, err := NewObjectTemplateList("/mnt", spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, _, err = templates[0].Render(values)
+		if err == nil || !strings.Contains(err.Error(), expError) || strings.Contains(err.Error(), "admin") {
+			t.Errorf("%s: expected error %q, got %v", spec, expError, err)
+		}
+	}
+}
+
+// Make sure bundles of every value render the same whatever order the values were fetched in.
+func TestObjectTemplateRenderSorted(t *testing.T) {
+
+	templates, err := NewObjectTemplateList("/mnt", `
+- fileName: app.env
+  template: |
+    {{- range $name, $value := . }}
+    {{ $name }}={{ $value }}
+    {{- end }}
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	values := []*SecretValue{
+		{Value: []byte("3"), Descriptor: SecretDescriptor{ObjectAlias: "c"}},
+		{Value: []byte("1"), Descriptor: SecretDescriptor{ObjectAlias: "a"}},
+		{Value: []byte("2"), Descriptor: SecretDescriptor{ObjectAlias: "b"}},
+	}
+	reversed := []*SecretValue{values[2], values[1], values[0]}
+
+	value, version, err := templates[0].Render(values)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(value.Value) != "\na=1\nb=2\nc=3\n" {
+		t.Fatalf("Unexpected rendered value: %q", string(value.Value))
+	}
+	value2, version2, err := templates[0].Render(reversed)
+	if err != nil || string(value2.Value) != string(value.Value) || version2 != version {
+		t.Fatalf("Rendering changed with the value order: %q %s %s %v", string(value2.Value), version, version2, err)
+	}
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors for common SecretProviderClass validation failures.
+//
+// Callers such as admission webhooks and the validate command can test for
+// these with errors.Is to map a failure to user guidance rather than matching
+// the message, which is kept as it was and may change between releases.
+//
+var (
+	ErrDuplicateAlias    = errors.New("name already in use") // Two objects (or aliases) would write the same file
+	ErrInvalidObjectType = errors.New("invalid object type") // Missing, unknown, or mismatched objectType or ARN service
+	ErrInvalidObjectName = errors.New("invalid object name") // The name breaks the AWS naming rules
+	ErrPathTraversal     = errors.New("invalid file path")   // A file name contains ../ or is not a usable file name
+)
+
+// Private error type marking a validation failure with one of the exported
+// errors. The message is that of the wrapped error.
+type validationError struct {
+	kind error
+	err  error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *validationError) Unwrap() error {
+	return e.err
+}
+
+func (e *validationError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Private helper to create a validation error of the given kind.
+func validationErrorf(kind error, format string, args ...interface{}) error {
+	return &validationError{kind: kind, err: fmt.Errorf(format, args...)}
+}
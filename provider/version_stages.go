@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to replace each descriptor using objectVersionStages with one
+// descriptor for each staging label.
+//
+// During a rotation window applications may need both the current and the
+// pending credentials. Each staged copy fetches the secret by its staging
+// label and writes it (and its jmesPath entries) to a file named with the
+// stage appended after an underscore, for example dbcreds_AWSPENDING. Since
+// every copy is then an ordinary descriptor pinned to a label, rotation and
+// failover treat the stages independently. The stages are checked here, as
+// the copies no longer carry them. A stage that is not on any version (for
+// example AWSPENDING outside a rotation) is mounted as empty files rather
+// than failing the mount (see absentStageValues).
+//
+func expandVersionStages(descriptors []*SecretDescriptor) ([]*SecretDescriptor, error) {
+
+	var expanded []*SecretDescriptor
+	for _, descriptor := range descriptors {
+		if descriptor == nil || len(descriptor.ObjectVersionStages) == 0 {
+			expanded = append(expanded, descriptor)
+			continue
+		}
+		if err := descriptor.validateVersionStages(); err != nil {
+			return nil, err
+		}
+
+		baseName := descriptor.ObjectAlias
+		if len(baseName) == 0 {
+			baseName = descriptor.ObjectName
+		}
+		for _, stage := range descriptor.ObjectVersionStages {
+			staged := *descriptor
+			staged.ObjectVersionStages = nil
+			staged.ObjectVersionLabel = stage
+			staged.ObjectAlias = baseName + "_" + stage
+			staged.versionStage = stage
+			staged.JMESPath = nil
+			for _, entry := range descriptor.JMESPath {
+				entry.ObjectAlias += "_" + stage
+				staged.JMESPath = append(staged.JMESPath, entry)
+			}
+			staged.FailoverObject = nil
+			for _, entry := range descriptor.FailoverObject {
+				staged.FailoverObject = append(staged.FailoverObject, FailoverObjectEntry{ObjectName: entry.ObjectName, ObjectVersionLabel: stage})
+			}
+			expanded = append(expanded, &staged)
+		}
+	}
+	return expanded, nil
+}
+
+// Private helper to check the objectVersionStages of a descriptor.
+func (p *SecretDescriptor) validateVersionStages() error {
+
+	// The object is not validated yet, so find its type without assuming an ARN.
+	sType, ok := typeMap[p.ObjectType]
+	if objARN, err := arn.Parse(p.ObjectName); len(p.ObjectType) == 0 && err == nil {
+		sType, ok = typeMap[objARN.Service]
+	}
+
+	switch {
+	case !ok || sType != SecretsManager || len(p.ObjectTags) > 0:
+		return fmt.Errorf("objectVersionStages is only supported for secretsmanager objects named by objectName: %s", p.ObjectName)
+	case len(p.ObjectVersion) != 0 || len(p.ObjectVersionLabel) != 0:
+		return fmt.Errorf("objectVersionStages can not be used with objectVersion or objectVersionLabel: %s", p.ObjectName)
+	case p.ObjectExplode:
+		return fmt.Errorf("objectVersionStages can not be used with objectExplode: %s", p.ObjectName)
+	}
+	for _, entry := range p.JMESPath {
+		if entry.isPinned() {
+			return fmt.Errorf("jmesPath entries can not specify objectVersion or objectVersionLabel with objectVersionStages: %s", entry.ObjectAlias)
+		}
+	}
+	for _, entry := range p.FailoverObject {
+		if len(entry.ObjectVersion) != 0 || len(entry.ObjectVersionLabel) != 0 {
+			return fmt.Errorf("failover objects can not specify versions with objectVersionStages: %s", p.ObjectName)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, stage := range p.ObjectVersionStages {
+		if len(stage) == 0 || strings.ContainsAny(stage, `/\`) || seen[stage] {
+			return fmt.Errorf("objectVersionStages must be distinct staging labels: %q: %s", stage, p.ObjectName)
+		}
+		seen[stage] = true
+	}
+	return nil
+}
+
+// Private helper to check if fetching a staged copy failed only because no
+// version of the secret has its staging label.
+//
+// GetSecretValue reports a missing label and a missing secret the same way,
+// so the secret is described to tell them apart. This only happens on a not
+// found error, so mounts of existing stages make no extra calls.
+//
+func (p *SecretsManagerProvider) isAbsentStage(
+	ctx context.Context,
+	client SecretsManagerClient,
+	descriptor *SecretDescriptor,
+	fetchErr error,
+) bool {
+
+	var aerr awserr.Error
+	if len(descriptor.versionStage) == 0 || !errors.As(fetchErr, &aerr) || aerr.Code() != secretsmanager.ErrCodeResourceNotFoundException {
+		return false
+	}
+
+	start := time.Now()
+	rsp, err := client.Client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(descriptor.GetSecretName(client.FailoverIndex))})
+	utils.ObserveAPICall(SecretsManager.String(), "DescribeSecret", client.Region, time.Since(start))
+	if err != nil {
+		return false // Report the original error.
+	}
+	for _, stages := range rsp.VersionIdsToStages {
+		for _, stage := range stages {
+			if aws.StringValue(stage) == descriptor.versionStage {
+				return false // The label exists, so something else is wrong.
+			}
+		}
+	}
+	return true
+}
+
+// Private helper to build the values of a staged copy whose staging label is
+// not on any version of the secret.
+//
+// The file of the stage and of each of its jmesPath entries is written empty,
+// so applications never read a stale value (for example the pending
+// credentials of a finished rotation) and can tell the stage is absent. The
+// empty version is never current, so the stage is fetched again on the next
+// rotation.
+//
+func absentStageValues(client SecretsManagerClient, descriptor *SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) []*SecretValue {
+
+	klog.V(2).Infof("%s: Staging label %s is not on any version of secret %s, mounting empty files", client.Region, descriptor.versionStage, descriptor.ObjectName)
+
+	descriptors := []SecretDescriptor{*descriptor}
+	for i := range descriptor.JMESPath {
+		descriptors = append(descriptors, descriptor.getJmesEntrySecretDescriptor(&descriptor.JMESPath[i]))
+	}
+
+	values := make([]*SecretValue, 0, len(descriptors))
+	for _, desc := range descriptors {
+		values = append(values, &SecretValue{
+			Value:         []byte{},
+			Descriptor:    desc,
+			IsFailover:    client.FailoverIndex > 0,
+			FailoverIndex: client.FailoverIndex,
+		})
+		curMap[desc.GetFileName()] = &v1alpha1.ObjectVersion{Id: desc.GetFileName(), Version: ""}
+	}
+	return values
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to remember the most recent mount request for a target path.
+//
+// The saved requests allow an operator to force a refresh of a mount without
+// waiting for the next rotation interval. Requests for target paths that no
+// longer exist (the pod is gone) are dropped first (see pruneMounts).
+//
+func (s *CSIDriverProviderServer) recordMount(req *v1alpha1.MountRequest) {
+
+	s.pruneMounts(mountPruneInterval)
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+
+	if s.mounts == nil {
+		s.mounts = make(map[string]*v1alpha1.MountRequest)
+	}
+	s.mounts[req.GetTargetPath()] = req
+}
+
+// Private helper to drop what is remembered about target paths that no longer
+// exist (the pod is gone).
+//
+// The paths are checked without holding the lock, so a slow file system does
+// not hold up other mounts, and at most once per interval (0 to always check).
+//
+func (s *CSIDriverProviderServer) pruneMounts(interval time.Duration) {
+
+	s.mountsMu.Lock()
+	if interval > 0 && time.Since(s.mountsPruned) < interval {
+		s.mountsMu.Unlock()
+		return
+	}
+	s.mountsPruned = time.Now()
+	paths := make(map[string]bool, len(s.mounts))
+	for path := range s.mounts {
+		paths[path] = true
+	}
+	for path := range s.inventory {
+		paths[path] = true
+	}
+	for path := range s.writeHashes {
+		paths[path] = true
+	}
+	s.mountsMu.Unlock()
+
+	var gone []string
+	for path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			gone = append(gone, path)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+	for _, path := range gone {
+		delete(s.mounts, path)
+		delete(s.inventory, path)
+		delete(s.writeHashes, path)
+		delete(s.annotated, path)
+	}
+}
+
+// Force an immediate re-fetch of the secrets mounted for a pod volume.
+//
+// The previous mount request for the volume is replayed without any current
+// versions so that every secret is fetched again and rewritten. This is only
+// supported when the provider writes the secrets, since otherwise there is no
+// way to hand the results back to the driver.
+//
+func (s *CSIDriverProviderServer) Refresh(ctx context.Context, nameSpace, podName, volume string) error {
+
+	if s.driverWriteSecrets {
+		return fmt.Errorf("refresh is not supported when the driver writes the secrets")
+	}
+
+	var reqs []*v1alpha1.MountRequest
+	s.mountsMu.Lock()
+	for path, req := range s.mounts {
+		var attrib map[string]string
+		if err := json.Unmarshal([]byte(req.GetAttributes()), &attrib); err != nil {
+			continue
+		}
+		if attrib[namespaceAttrib] != nameSpace || attrib[podnameAttrib] != podName {
+			continue
+		}
+
+		// Target paths end in .../volumes/kubernetes.io~csi/<volume>/mount
+		if len(volume) != 0 && filepath.Base(filepath.Dir(path)) != volume {
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	s.mountsMu.Unlock()
+
+	if len(reqs) == 0 {
+		return fmt.Errorf("no mounts found for pod %s in namespace %s", podName, nameSpace)
+	}
+
+	for _, req := range reqs {
+		klog.Infof("Refreshing mount %s for pod %s in namespace %s", req.GetTargetPath(), podName, nameSpace)
+		if err := s.replayMount(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Force an immediate re-fetch of every mount on the node using an object,
+// optionally only in one namespace.
+//
+// After an emergency credential rotation the operator may not know which
+// pods mount the secret. The object is matched against the objectName (or
+// ARN) of the objects of each mount's last successful mount, including
+// failover objects served by a failover region. Every matching mount is
+// refreshed even when some fail. Returns the target paths refreshed.
+//
+func (s *CSIDriverProviderServer) RefreshObject(ctx context.Context, nameSpace, objectName string) (refreshed []string, e error) {
+
+	if s.driverWriteSecrets {
+		return nil, fmt.Errorf("refresh is not supported when the driver writes the secrets")
+	}
+
+	var reqs []*v1alpha1.MountRequest
+	s.mountsMu.Lock()
+	for path, req := range s.mounts {
+		mount := s.inventory[path]
+		if mount == nil || (len(nameSpace) != 0 && mount.Namespace != nameSpace) {
+			continue
+		}
+		for _, obj := range mount.Objects {
+			if obj.ObjectName == objectName || (len(obj.ARN) != 0 && obj.ARN == objectName) {
+				reqs = append(reqs, req)
+				break
+			}
+		}
+	}
+	s.mountsMu.Unlock()
+
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no mounts found using object %s", objectName)
+	}
+
+	var errs []error
+	for _, req := range reqs {
+		klog.Infof("Refreshing mount %s using object %s", req.GetTargetPath(), objectName)
+		if err := s.replayMount(ctx, req); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		refreshed = append(refreshed, req.GetTargetPath())
+	}
+	sort.Strings(refreshed)
+	return refreshed, errors.Join(errs...)
+}
+
+// Private helper to replay a previous mount request without any current
+// versions, so every secret is fetched again and rewritten.
+func (s *CSIDriverProviderServer) replayMount(ctx context.Context, req *v1alpha1.MountRequest) error {
+
+	_, err := s.Mount(ctx, &v1alpha1.MountRequest{
+		Attributes: req.GetAttributes(),
+		Secrets:    req.GetSecrets(),
+		TargetPath: req.GetTargetPath(),
+		Permission: req.GetPermission(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh %s: %w", req.GetTargetPath(), err)
+	}
+	return nil
+}
+
+// Returns the handler for the admin endpoint.
+//
+// The admin endpoint is only served on a local unix socket. It accepts POST
+// requests to /refresh with the namespace, pod, and (optional) volume query
+// parameters and calls Refresh for the matching mounts. Requests with the
+// object parameter (and an optional namespace) instead call RefreshObject and
+// return the refreshed target paths as JSON. POST requests to /freeze and
+// /unfreeze freeze and unfreeze the provider (see SetFrozen), and GET requests
+// to /freeze return whether it is frozen as JSON.
+//
+func (s *CSIDriverProviderServer) AdminHandler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		nameSpace, podName := query.Get("namespace"), query.Get("pod")
+		if objectName := query.Get("object"); len(objectName) != 0 && len(podName) == 0 {
+			refreshed, err := s.RefreshObject(r.Context(), nameSpace, objectName)
+			if err != nil {
+				utils.Errorf("Refresh failed: %v", err)
+			}
+			if len(refreshed) == 0 {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status := http.StatusOK
+			if err != nil {
+				status = http.StatusMultiStatus // Some mounts failed.
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string][]string{"refreshed": refreshed})
+			return
+		}
+		if len(nameSpace) == 0 || len(podName) == 0 {
+			http.Error(w, "namespace and pod (or object) are required", http.StatusBadRequest)
+			return
+		}
+
+		err := s.Refresh(r.Context(), nameSpace, podName, query.Get("volume"))
+		if err != nil {
+			utils.Errorf("Refresh failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/freeze", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]bool{"frozen": s.Frozen()})
+		case http.MethodPost:
+			s.SetFrozen(true)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/unfreeze", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.SetFrozen(false)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
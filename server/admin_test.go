@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Make sure a refresh rewrites the secrets of a previous mount.
+func TestRefresh(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestRefresh")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+
+	err = svr.Refresh(ctx, "fakeNS", "fakePod", "")
+	if err == nil || !strings.Contains(err.Error(), "no mounts found") {
+		t.Fatalf("TestRefresh: Unexpected error %v", err)
+	}
+
+	_, err = svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestRefresh: got unexpected error %s", err.Error())
+	}
+
+	// Clobber a secret then make sure the refresh fetches it again.
+	err = ioutil.WriteFile(filepath.Join(dir, "TestSecret1"), []byte("stale"), 0644)
+	if err != nil {
+		t.Fatalf("TestRefresh: could not write secret: %v", err)
+	}
+
+	err = svr.Refresh(ctx, "fakeNS", "fakePod", "")
+	if err != nil {
+		t.Fatalf("TestRefresh: got unexpected error %s", err.Error())
+	}
+	validateMounts(t, dir, tst, nil)
+
+	// Volume names must match the target path.
+	err = svr.Refresh(ctx, "fakeNS", "fakePod", "otherVolume")
+	if err == nil || !strings.Contains(err.Error(), "no mounts found") {
+		t.Fatalf("TestRefresh: Unexpected error %v", err)
+	}
+}
+
+// Make sure every mount using an object can be refreshed.
+func TestRefreshObject(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestRefreshObject")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+
+	_, err = svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestRefreshObject: got unexpected error %s", err.Error())
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "TestSecret1"), []byte("stale"), 0644)
+	if err != nil {
+		t.Fatalf("TestRefreshObject: could not write secret: %v", err)
+	}
+
+	refreshed, err := svr.RefreshObject(ctx, "", "TestSecret1")
+	if err != nil || len(refreshed) != 1 || refreshed[0] != dir {
+		t.Fatalf("TestRefreshObject: unexpected result %v %v", refreshed, err)
+	}
+	validateMounts(t, dir, tst, nil)
+
+	for _, tc := range []struct{ nameSpace, objectName string }{
+		{"otherNS", "TestSecret1"},
+		{"", "OtherSecret"},
+	} {
+		if _, err := svr.RefreshObject(ctx, tc.nameSpace, tc.objectName); err == nil || !strings.Contains(err.Error(), "no mounts found") {
+			t.Errorf("TestRefreshObject: Unexpected error for %+v: %v", tc, err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	svr.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refresh?namespace=fakeNS&object=TestParm1", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"refreshed":["`+dir+`"]`) {
+		t.Fatalf("TestRefreshObject: unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// Make sure refresh is rejected when the driver writes the secrets.
+func TestRefreshDriverWrites(t *testing.T) {
+
+	svr := newServerWithMocks(nil, true)
+	err := svr.Refresh(context.Background(), "fakeNS", "fakePod", "")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("TestRefreshDriverWrites: Unexpected error %v", err)
+	}
+}
+
+// Make sure the admin endpoint validates requests.
+func TestAdminHandler(t *testing.T) {
+
+	handler := newServerWithMocks(nil, false).AdminHandler()
+
+	adminTests := []struct {
+		method, url string
+		expStatus   int
+	}{
+		{http.MethodGet, "/refresh?namespace=fakeNS&pod=fakePod", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/refresh?namespace=fakeNS", http.StatusBadRequest},
+		{http.MethodPost, "/refresh?namespace=fakeNS&pod=fakePod", http.StatusInternalServerError},
+		{http.MethodPost, "/refresh?object=TestSecret1", http.StatusInternalServerError},
+	}
+
+	for _, tst := range adminTests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tst.method, tst.url, nil))
+		if rec.Code != tst.expStatus {
+			t.Fatalf("TestAdminHandler: %s %s expected status %d got %d", tst.method, tst.url, tst.expStatus, rec.Code)
+		}
+	}
+}
+
+// Make sure mounts whose target path is gone are dropped, at most once per interval.
+func TestPruneMounts(t *testing.T) {
+
+	dir := t.TempDir()
+	svr := newServerWithMocks(nil, false)
+	svr.recordMount(&v1alpha1.MountRequest{TargetPath: dir})
+	svr.recordInventory("fakeNS", "fakePod", dir, nil)
+
+	os.RemoveAll(dir)
+	svr.recordMount(&v1alpha1.MountRequest{TargetPath: t.TempDir()})
+	if len(svr.mounts) != 2 {
+		t.Fatalf("TestPruneMounts: expected no pruning within the interval, got %d mounts", len(svr.mounts))
+	}
+
+	svr.pruneMounts(0)
+	if len(svr.mounts) != 1 || len(svr.inventory) != 0 {
+		t.Fatalf("TestPruneMounts: expected the removed mount to be dropped, got %d mounts and %d inventory", len(svr.mounts), len(svr.inventory))
+	}
+}
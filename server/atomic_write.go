@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Name of the symbolic link to the directory holding the current files of a
+// mount written atomically.
+const atomicDataLink = "..data"
+
+// Private helper to write all the files of a mount so that they change at
+// once.
+//
+// Writing each file in turn lets applications read a mix of old and new files
+// during a rotation (for example a new certificate with the old key). Like
+// the kubelet does for ConfigMap volumes, the files are written to a new
+// timestamped directory in the mount, the ..data symbolic link is switched to
+// it with a single rename, and each file (or top level directory) of the mount
+// is a symbolic link through ..data. Applications therefore see either all the
+// old files or all the new ones. The previous directory is removed after the
+// switch, as are the links of files no longer mounted. File names can not
+// start with .. since those names are used by the layout.
+//
+func (s *CSIDriverProviderServer) writeAtomically(ctx context.Context, mountDir string, secrets []*provider.SecretValue, mode os.FileMode) error {
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("mount request cancelled: %w", err)
+	}
+
+	// Find the names visible at the top of the mount.
+	topLevel := make(map[string]bool)
+	for _, secret := range secrets {
+		name := strings.SplitN(filepath.ToSlash(secret.Descriptor.GetFileName()), "/", 2)[0]
+		if strings.HasPrefix(name, "..") {
+			return utils.InvalidConfiguration(fmt.Errorf("file names can not start with .. when atomicWrites is used: %s", secret.Descriptor.GetFileName()))
+		}
+		topLevel[name] = true
+	}
+
+	// Write the new files to their own directory.
+	sync := s.shouldSync(mountDir)
+	dataDir, err := ioutil.TempDir(mountDir, time.Now().UTC().Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		return err
+	}
+	switched := false
+	defer func() {
+		if !switched {
+			os.RemoveAll(dataDir) // Cleanup on fail
+		}
+	}()
+	if err := os.Chmod(dataDir, 0755); err != nil { // Readable like the mount itself
+		return err
+	}
+	for _, secret := range secrets {
+		if err := writeDataFile(dataDir, secret, mode, sync); err != nil {
+			return err
+		}
+	}
+	if sync {
+		if err := syncDir(dataDir); err != nil {
+			return err
+		}
+	}
+
+	// Last chance to back out before the new files become visible.
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("mount request cancelled: %w", err)
+	}
+
+	// Switch to the new files.
+	dataLink := filepath.Join(mountDir, atomicDataLink)
+	oldDataDir, _ := os.Readlink(dataLink)
+	if err := replaceWithLink(filepath.Base(dataDir), dataLink); err != nil {
+		return err
+	}
+	switched = true
+
+	// Link the visible names through ..data, replacing any files written
+	// before atomic writes were used.
+	for name := range topLevel {
+		link, target := filepath.Join(mountDir, name), filepath.Join(atomicDataLink, name)
+		if cur, err := os.Readlink(link); err == nil && cur == target {
+			continue
+		}
+		if err := replaceWithLink(target, link); err != nil {
+			return err
+		}
+	}
+
+	// Drop the links of files no longer mounted and the previous files.
+	entries, err := ioutil.ReadDir(mountDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Mode()&os.ModeSymlink == 0 || topLevel[entry.Name()] {
+			continue
+		}
+		if target, err := os.Readlink(filepath.Join(mountDir, entry.Name())); err == nil && strings.HasPrefix(target, atomicDataLink+string(os.PathSeparator)) {
+			os.Remove(filepath.Join(mountDir, entry.Name()))
+		}
+	}
+	if strings.HasPrefix(oldDataDir, "..") && filepath.Base(oldDataDir) == oldDataDir && oldDataDir != filepath.Base(dataDir) {
+		if err := os.RemoveAll(filepath.Join(mountDir, oldDataDir)); err != nil {
+			klog.Warningf("Failed to remove previous files %s: %v", oldDataDir, err)
+		}
+	}
+
+	// Make the switch durable. The new files are already visible so failures
+	// are only logged.
+	if sync {
+		if err := syncDir(mountDir); err != nil {
+			klog.Warningf("Failed to sync directory %s: %v", mountDir, err)
+		}
+	}
+	return nil
+}
+
+// Private helper to write one file of a mount to the directory of its new
+// files.
+func writeDataFile(dataDir string, secret *provider.SecretValue, mode os.FileMode, sync bool) error {
+
+	path := filepath.Join(dataDir, secret.Descriptor.GetFileName())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // Don't leak file descriptors
+
+	if err := file.Chmod(mode); err != nil { // Not subject to the umask
+		return err
+	}
+	if secret.Descriptor.HasFileOwnership() {
+		if err := file.Chown(secret.Descriptor.GetFileOwner(), secret.Descriptor.GetFileGroup()); err != nil {
+			return fmt.Errorf("failed to set the owner of %s: %w", secret.Descriptor.GetFileName(), err)
+		}
+	}
+	if _, err := file.Write(secret.Value); err != nil {
+		return err
+	}
+
+	// Record where the secret came from, if enabled.
+	if utils.DefaultFeatureGate.Enabled(utils.FileProvenanceXattrs) {
+		setProvenance(path, secret.Descriptor.GetMountPath(), secret)
+	}
+
+	if sync {
+		return file.Sync()
+	}
+	return nil
+}
+
+// Private helper to atomically replace a path with a symbolic link.
+//
+// The link is created under a temporary name and renamed over the path. A
+// directory left by non-atomic writes can not be renamed over, so it is
+// removed first.
+//
+func replaceWithLink(target, path string) error {
+
+	tmpLink := filepath.Join(filepath.Dir(path), "..tmp"+filepath.Base(path))
+	os.Remove(tmpLink) // Left over from a failed mount
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		if err := os.RemoveAll(path); err != nil {
+			os.Remove(tmpLink)
+			return err
+		}
+	}
+	if err := os.Rename(tmpLink, path); err != nil {
+		os.Remove(tmpLink)
+		return err
+	}
+	return nil
+}
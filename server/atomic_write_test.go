@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Private helper to build a mount request that writes the files atomically.
+func buildAtomicMountReq(dir string, tst testCase) *v1alpha1.MountRequest {
+
+	req := buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})
+	var attrib map[string]string
+	json.Unmarshal([]byte(req.Attributes), &attrib)
+	attrib[atomicWritesAttrib] = "true"
+	attr, _ := json.Marshal(attrib)
+	req.Attributes = string(attr)
+	return req
+}
+
+// Private helper to list the timestamped data directories of a mount.
+func dataDirs(t *testing.T, dir string) (dirs []string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "..") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs
+}
+
+// Make sure all the files of a mount are switched at once through ..data.
+func TestAtomicWrites(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestAtomicWrites")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	// A file written before atomic writes were used is replaced.
+	if err := ioutil.WriteFile(filepath.Join(dir, "TestSecret1"), []byte("old"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	for i := 0; i < 2; i++ {
+		if _, err := svr.Mount(context.Background(), buildAtomicMountReq(dir, tst)); err != nil {
+			t.Fatalf("TestAtomicWrites: got unexpected error %s", err.Error())
+		}
+
+		for file, value := range tst.expSecrets {
+			if target, err := os.Readlink(filepath.Join(dir, file)); err != nil || target != filepath.Join(atomicDataLink, file) {
+				t.Fatalf("TestAtomicWrites: expected %s to link through ..data, got %s %v", file, target, err)
+			}
+			contents, err := ioutil.ReadFile(filepath.Join(dir, file))
+			if err != nil || string(contents) != value {
+				t.Fatalf("TestAtomicWrites: expected %s in %s, got %s %v", value, file, contents, err)
+			}
+			info, _ := os.Stat(filepath.Join(dir, file))
+			if info.Mode().Perm() != 0644 {
+				t.Errorf("TestAtomicWrites: unexpected mode %s for %s", info.Mode(), file)
+			}
+		}
+		dirs := dataDirs(t, dir)
+		if target, _ := os.Readlink(filepath.Join(dir, atomicDataLink)); len(dirs) != 1 || target != dirs[0] {
+			t.Fatalf("TestAtomicWrites: expected only the current data directory, got %v and ..data -> %s", dirs, target)
+		}
+	}
+
+	// Files no longer mounted are removed.
+	tst.mountObjs = tst.mountObjs[:1]
+	svr = newServerWithMocks(&tst, false)
+	if _, err := svr.Mount(context.Background(), buildAtomicMountReq(dir, tst)); err != nil {
+		t.Fatalf("TestAtomicWrites: got unexpected error %s", err.Error())
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "TestParm1")); !os.IsNotExist(err) {
+		t.Fatalf("TestAtomicWrites: expected TestParm1 to be removed, got %v", err)
+	}
+	if len(dataDirs(t, dir)) != 1 {
+		t.Fatalf("TestAtomicWrites: expected only the current data directory, got %v", dataDirs(t, dir))
+	}
+}
+
+// Make sure nothing changes when a write fails.
+func TestAtomicWritesFailure(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestAtomicWritesFailure")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	tst.mountObjs = []map[string]interface{}{
+		{"objectName": "TestSecret1", "objectType": "secretsmanager", "objectAlias": "..secret"},
+	}
+	svr := newServerWithMocks(&tst, false)
+	_, err = svr.Mount(context.Background(), buildAtomicMountReq(dir, tst))
+	if err == nil || !strings.Contains(err.Error(), "file names can not start with ..") {
+		t.Fatalf("TestAtomicWritesFailure: expected an error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := svr.writeAtomically(ctx, dir, nil, 0644); err == nil {
+		t.Fatalf("TestAtomicWritesFailure: expected a cancelled write to fail")
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("TestAtomicWritesFailure: expected nothing to be written, got %d entries", len(entries))
+	}
+}
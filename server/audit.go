@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+// A record of secret access written to the audit log, one JSON object per
+// line. Secret values are never recorded.
+//
+type AuditRecord struct {
+	Time           time.Time `json:"time"`
+	RequestID      string    `json:"requestID,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Pod            string    `json:"pod"`
+	ServiceAccount string    `json:"serviceAccount"`
+	ObjectType     string    `json:"objectType"`
+	ObjectName     string    `json:"objectName"`
+	ARN            string    `json:"arn,omitempty"`
+	Version        string    `json:"version,omitempty"`
+	Region         string    `json:"region"`
+	LatencyMillis  int64     `json:"latencyMillis"`
+}
+
+// Audit log of the secrets fetched by the provider.
+//
+// Security teams need a trail of which workload read which secret that is kept
+// apart from the debug logs (which change between releases and may be sampled
+// or dropped). Each object fetched for a mount is recorded once, with the pod,
+// namespace, service account, version, region it was served from, and how long
+// the fetch took. Values served from the mount or the secret cache are
+// recorded too, since the pod still gets them.
+//
+type AuditLog struct {
+	mu  sync.Mutex
+	out io.Writer
+	enc *json.Encoder
+}
+
+// Open the audit log at path, appending to an existing file. A path of -
+// writes the records to standard output.
+//
+func NewAuditLog(path string) (*AuditLog, error) {
+
+	if path == "-" {
+		return newAuditLog(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can not open the audit log: %w", err)
+	}
+	return newAuditLog(file), nil
+}
+
+// Private factory to create an audit log writing to out.
+func newAuditLog(out io.Writer) *AuditLog {
+	return &AuditLog{out: out, enc: json.NewEncoder(out)}
+}
+
+// Private helper to write a record. Records are written whole, one at a time,
+// so concurrent mounts do not interleave them. Failures are logged rather than
+// failing the mount.
+func (a *AuditLog) write(record *AuditRecord) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(record); err != nil {
+		klog.Errorf("Failed to write the audit log: %v", err)
+	}
+}
+
+// Private helper to record the objects fetched for a mount (nothing when the
+// audit log is disabled).
+//
+// The jmesPath entries and exploded keys of an object are recorded once, as
+// the object they were read from.
+//
+func (s *CSIDriverProviderServer) auditFetches(ctx context.Context, nameSpace, podName, svcAcct string, regions []string, secrets []*provider.SecretValue) {
+
+	if s.auditLog == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	type object struct{ name, version, region string }
+	seen := make(map[object]bool)
+	for _, secret := range secrets {
+		source := secret.Descriptor.GetSourceDescriptor()
+		region := source.Region
+		if len(region) == 0 && secret.FailoverIndex < len(regions) {
+			region = regions[secret.FailoverIndex]
+		}
+		record := AuditRecord{
+			Time:           now,
+			RequestID:      RequestID(ctx),
+			Namespace:      nameSpace,
+			Pod:            podName,
+			ServiceAccount: svcAcct,
+			ObjectType:     source.GetSecretType().String(),
+			ObjectName:     source.GetSecretName(secret.FailoverIndex),
+			ARN:            secret.ARN,
+			Version:        secret.Version,
+			Region:         region,
+			LatencyMillis:  secret.Latency.Milliseconds(),
+		}
+		key := object{record.ObjectName, record.Version, record.Region}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		s.auditLog.write(&record)
+	}
+}
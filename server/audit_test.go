@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Make sure every object fetched is recorded without its value.
+func TestAuditLog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestAuditLog")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	var out bytes.Buffer
+	svr.auditLog = newAuditLog(&out)
+
+	if _, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err != nil {
+		t.Fatalf("TestAuditLog: got unexpected error %s", err.Error())
+	}
+	if strings.Contains(out.String(), "secret1") || strings.Contains(out.String(), "parm1") {
+		t.Fatalf("TestAuditLog: secret values were recorded: %s", out.String())
+	}
+
+	records := make(map[string]AuditRecord)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("TestAuditLog: invalid record %q: %v", line, err)
+		}
+		records[record.ObjectName] = record
+	}
+	if len(records) != 2 {
+		t.Fatalf("TestAuditLog: expected 2 records, got %s", out.String())
+	}
+	secret, parm := records["TestSecret1"], records["TestParm1"]
+	if secret.ObjectType != "secretsmanager" || secret.Version != "1" || secret.Region != "fakeRegion" ||
+		secret.Namespace != "fakeNS" || secret.Pod != "fakePod" || secret.ServiceAccount != "fakeSvcAcc" {
+		t.Errorf("TestAuditLog: unexpected record %+v", secret)
+	}
+	if parm.ObjectType != "ssmparameter" || parm.Version != "1" {
+		t.Errorf("TestAuditLog: unexpected record %+v", parm)
+	}
+}
+
+// Make sure the audit log appends to its file.
+func TestNewAuditLog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestNewAuditLog")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	path := filepath.Join(dir, "audit.log")
+	for i := 0; i < 2; i++ {
+		auditLog, err := NewAuditLog(path)
+		if err != nil {
+			t.Fatalf("TestNewAuditLog: got unexpected error %v", err)
+		}
+		auditLog.write(&AuditRecord{ObjectName: "secret1"})
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Count(string(data), `"objectName":"secret1"`) != 2 {
+		t.Fatalf("TestNewAuditLog: expected 2 records, got %s", data)
+	}
+	if _, err := NewAuditLog(filepath.Join(dir, "missing", "audit.log")); err == nil {
+		t.Fatalf("TestNewAuditLog: expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Git commit filled in by Makefile during build.
+var GitCommit string
+
+// Build stamp set by older build scripts.
+//
+// Deprecated: set version.Build instead. Builds that still set this variable
+// (with -X .../server.Version=...) keep reporting their version, since -X
+// silently ignores variables that do not exist.
+//
+var Version string
+
+func init() {
+	if len(version.Build) == 0 {
+		version.Build = Version
+	}
+	utils.RegisterMetrics(buildInfoGauge)
+}
+
+// Name of the build information metric.
+const buildInfoMetric = "secrets_store_csi_driver_provider_aws_build_info"
+
+// The build information metric, set on every scrape since the enabled
+// features can change while the provider runs.
+var buildInfoGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{Name: buildInfoMetric, Help: "Build and runtime information about the provider."},
+	[]string{"version", "git_commit", "go_version", "aws_sdk_version", "features"})
+
+// Build and runtime information about the running provider.
+//
+// Used to track version skew across a fleet of nodes.
+//
+type BuildInfo struct {
+	Version    string   // Provider version
+	GitCommit  string   // Git commit the provider was built from
+	GoVersion  string   // Go version used to build the provider
+	SDKVersion string   // AWS SDK version
+	Features   []string // Enabled feature gates
+}
+
+// Returns the build and runtime information of the running provider.
+//
+// The git commit comes from the Makefile and falls back to the version control
+// information embedded by the Go tool chain.
+//
+func GetBuildInfo() BuildInfo {
+
+	commit := GitCommit
+	if info, ok := debug.ReadBuildInfo(); ok && len(commit) == 0 {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				commit = setting.Value
+			}
+		}
+	}
+	if len(commit) == 0 {
+		commit = "unknown"
+	}
+
+	return BuildInfo{
+		Version:    version.Current().String(),
+		GitCommit:  commit,
+		GoVersion:  runtime.Version(),
+		SDKVersion: aws.SDKVersion,
+		Features:   utils.DefaultFeatureGate.EnabledFeatures(),
+	}
+}
+
+// Returns the build information in a single line.
+func (b BuildInfo) String() string {
+
+	features := strings.Join(b.Features, ",")
+	if len(features) == 0 {
+		features = "none"
+	}
+	return fmt.Sprintf("%s (commit %s; %s; aws-sdk-go %s; features %s)",
+		b.Version, b.GitCommit, b.GoVersion, b.SDKVersion, features)
+}
+
+// Returns a handler serving the provider metrics.
+//
+// The metrics are written in the Prometheus text format. The build information
+// metric has a constant value of 1 and the build information in the labels.
+// It is served with the mount, AWS API call, and failover metrics.
+//
+func MetricsHandler() http.Handler {
+
+	metrics := utils.MetricsHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := GetBuildInfo()
+		buildInfoGauge.Reset()
+		buildInfoGauge.WithLabelValues(info.Version, info.GitCommit, info.GoVersion, info.SDKVersion, strings.Join(info.Features, ",")).Set(1)
+		metrics.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
+)
+
+// Make sure the build information is complete.
+func TestBuildInfo(t *testing.T) {
+
+	defer func(build, commit string) { version.Build, GitCommit = build, commit }(version.Build, GitCommit)
+	version.Build, GitCommit = "1.0.v1.0.4-2026.10.17", "abc123"
+
+	info := GetBuildInfo()
+	if info.GitCommit != "abc123" || info.SDKVersion != aws.SDKVersion || len(info.GoVersion) == 0 {
+		t.Fatalf("TestBuildInfo: unexpected build info %+v", info)
+	}
+
+	expected := "1.0.4+v1.0.4-2026.10.17 (commit abc123; " + info.GoVersion + "; aws-sdk-go " + aws.SDKVersion + "; features none)"
+	if info.String() != expected {
+		t.Fatalf("TestBuildInfo: expected %s got %s", expected, info.String())
+	}
+}
+
+// Make sure the metrics are served in the Prometheus text format.
+func TestMetricsHandler(t *testing.T) {
+
+	defer func(commit string) { GitCommit = commit }(GitCommit)
+	GitCommit = `abc"quoted"`
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("TestMetricsHandler: unexpected status %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE "+buildInfoMetric+" gauge\n") ||
+		!strings.Contains(body, buildInfoMetric+`{aws_sdk_version="`+aws.SDKVersion+`",features="",git_commit="abc\"quoted\"",`) ||
+		!strings.Contains(body, `version="`+version.Current().String()+`"} 1`+"\n") ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("TestMetricsHandler: unexpected metrics %s", body)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Default failover regions for SecretProviderClasses that do not set
+// failoverRegion.
+//
+// This lets a platform team roll out (or move) failover regions for a whole
+// cluster from the runtime configuration instead of editing every
+// SecretProviderClass. A namespace listed in namespaces uses its regions.
+// Otherwise the first node label rule matching the node of the pod is used.
+// Pods matching neither mount without failover, as before.
+//
+type FailoverRegionDefaults struct {
+	Namespaces map[string]string   `json:"namespaces,omitempty"` // Namespace to failover regions (comma separated)
+	NodeLabels []NodeLabelFailover `json:"nodeLabels,omitempty"` // Rules checked in order
+}
+
+// Failover regions for pods on nodes with the given label value.
+//
+type NodeLabelFailover struct {
+	Label          string `json:"label"`          // Node label, such as topology.kubernetes.io/region
+	Value          string `json:"value"`          // Value the label must have
+	FailoverRegion string `json:"failoverRegion"` // Failover regions (comma separated)
+}
+
+// Private helper to check the default failover regions are usable.
+func (d *FailoverRegionDefaults) validate() error {
+
+	if d == nil {
+		return nil
+	}
+	for ns, regions := range d.Namespaces {
+		if len(ns) == 0 {
+			return fmt.Errorf("defaultFailoverRegions: namespaces can not be empty")
+		}
+		if err := checkRegionList(regions); err != nil {
+			return fmt.Errorf("defaultFailoverRegions: namespace %s: %w", ns, err)
+		}
+	}
+	for i, rule := range d.NodeLabels {
+		if len(rule.Label) == 0 {
+			return fmt.Errorf("defaultFailoverRegions: nodeLabels[%d]: label can not be empty", i)
+		}
+		if err := checkRegionList(rule.FailoverRegion); err != nil {
+			return fmt.Errorf("defaultFailoverRegions: nodeLabels[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Private helper to check a comma separated list of regions has no empty
+// entries. The regions themselves are checked against the primary region on
+// each mount.
+func checkRegionList(regions string) error {
+	for _, region := range strings.Split(regions, ",") {
+		if len(strings.TrimSpace(region)) == 0 {
+			return fmt.Errorf("%q: failover regions can not be empty", regions)
+		}
+	}
+	return nil
+}
+
+// Private helper to find the default failover regions of a pod (empty for
+// none).
+//
+// The primary region is dropped from the defaults, so one rule can list every
+// region of a rollout (or a node label rule can match the primary region
+// itself) without failing the mounts in that region.
+//
+func (s *CSIDriverProviderServer) defaultFailoverRegion(ctx context.Context, settings *serverSettings, namespace, podName, region string) (string, error) {
+
+	defaults := settings.failoverDefaults
+	if defaults == nil {
+		return "", nil
+	}
+
+	regions, ok := defaults.Namespaces[namespace]
+	for i := 0; !ok && i < len(defaults.NodeLabels); i++ {
+		rule := defaults.NodeLabels[i]
+		value, err := s.getNodeLabel(ctx, settings, namespace, podName, rule.Label)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve node label %s. error %+v", rule.Label, err)
+		}
+		if value == rule.Value {
+			regions, ok = rule.FailoverRegion, true
+		}
+	}
+
+	var failover []string
+	for _, r := range strings.Split(regions, ",") {
+		if r = strings.TrimSpace(r); len(r) != 0 && r != region {
+			failover = append(failover, r)
+		}
+	}
+	return strings.Join(failover, ","), nil
+}
+
+// Private helper to look up a label of the node of a pod. Like the region of
+// the node, the lookups are briefly cached when enabled.
+func (s *CSIDriverProviderServer) getNodeLabel(ctx context.Context, settings *serverSettings, namespace, podName, label string) (string, error) {
+
+	nodeName, err := s.lookups.get(ctx, settings.lookupTTL, "pod/"+namespace+"/"+podName, func() (string, error) {
+		pod, err := s.k8sClient.Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return pod.Spec.NodeName, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.lookups.get(ctx, settings.lookupTTL, "node/"+nodeName+"/label/"+label, func() (string, error) {
+		node, err := s.k8sClient.Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return node.ObjectMeta.Labels[label], nil
+	})
+}
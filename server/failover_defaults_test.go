@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDefaultFailoverRegions(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "team-a"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "team-b"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "team-c"},
+			Spec:       corev1.PodSpec{NodeName: "node2"},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{regionLabel: "us-east-1", "tier": "dr"}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{regionLabel: "us-west-2"}},
+		},
+	)
+	svr := &CSIDriverProviderServer{k8sClient: clientset.CoreV1(), lookups: newLookupCache()}
+	settings := &serverSettings{lookupTTL: time.Minute, failoverDefaults: &FailoverRegionDefaults{
+		Namespaces: map[string]string{"team-a": "us-west-2, eu-west-1"},
+		NodeLabels: []NodeLabelFailover{
+			{Label: "tier", Value: "dr", FailoverRegion: "us-east-2"},
+			{Label: regionLabel, Value: "us-west-2", FailoverRegion: "us-west-2,us-east-1"},
+		},
+	}}
+
+	for _, tc := range []struct {
+		namespace, region, failover string
+		exp                         []string
+	}{
+		{"team-a", "", "", []string{"us-east-1", "us-west-2", "eu-west-1"}}, // By namespace
+		{"team-a", "", "us-east-2", []string{"us-east-1", "us-east-2"}},     // The SecretProviderClass wins
+		{"team-b", "", "", []string{"us-east-1", "us-east-2"}},              // By node label
+		{"team-c", "", "", []string{"us-west-2", "us-east-1"}},              // Primary region dropped
+		{"team-a", "us-west-2", "", []string{"us-west-2", "eu-west-1"}},     // Primary region set by the SecretProviderClass
+	} {
+		regions, err := svr.getAwsRegions(tc.region, tc.failover, tc.namespace, "pod1", context.Background(), settings)
+		if err != nil || !reflect.DeepEqual(regions, tc.exp) {
+			t.Errorf("Unexpected regions for %s: %v %v", tc.namespace, regions, err)
+		}
+	}
+
+	// No defaults once they are removed.
+	settings = &serverSettings{lookupTTL: time.Minute}
+	regions, err := svr.getAwsRegions("", "", "team-a", "pod1", context.Background(), settings)
+	if err != nil || !reflect.DeepEqual(regions, []string{"us-east-1"}) {
+		t.Errorf("Unexpected regions without defaults: %v %v", regions, err)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Full name of the experimental gRPC method fetching a single object.
+const FetchObjectMethod = "/aws.secretsstore.v1alpha1.ObjectFetcher/FetchObject"
+
+// Private context key marking a mount request as an on demand fetch.
+type fetchOnlyKey struct{}
+
+// Private helper to check if the mount request is an on demand fetch.
+func isFetchOnly(ctx context.Context) bool {
+	fetchOnly, _ := ctx.Value(fetchOnlyKey{}).(bool)
+	return fetchOnly
+}
+
+// Fetch a single object on demand (experimental).
+//
+// The request is a mount request whose objects attribute holds exactly one
+// object, which lets future driver and agent features (such as lazy loading
+// of secrets) fetch objects without a full mount. The object is fetched with
+// the pod's credentials like any mount, but nothing is written to the target
+// path, and the files and versions are returned in the response instead
+// (whether or not the driver writes the secrets of mounts). The request is
+// also not remembered for refreshes, the inventory, or pod annotations, and
+// no current versions are reused since nothing is read from the mount.
+//
+func (s *CSIDriverProviderServer) FetchObject(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+
+	if !utils.DefaultFeatureGate.Enabled(utils.OnDemandFetch) {
+		return nil, mountStatus(utils.InvalidConfiguration(fmt.Errorf("on demand fetches require the %s feature gate", utils.OnDemandFetch)))
+	}
+
+	var attrib map[string]string
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &attrib); err != nil {
+		return nil, mountStatus(utils.InvalidConfiguration(fmt.Errorf("failed to unmarshal attributes, error: %+v", err)))
+	}
+	if err := validateFetchAttributes(attrib); err != nil {
+		return nil, mountStatus(utils.InvalidConfiguration(err))
+	}
+
+	klog.Infof("Fetching %s on demand for pod %s in namespace %s", req.GetTargetPath(), attrib[podnameAttrib], attrib[namespaceAttrib])
+	return s.Mount(context.WithValue(ctx, fetchOnlyKey{}, true), &v1alpha1.MountRequest{
+		Attributes: req.GetAttributes(),
+		Secrets:    req.GetSecrets(),
+		TargetPath: req.GetTargetPath(),
+		Permission: req.GetPermission(),
+	})
+}
+
+// Private helper to check an on demand fetch names a single object and
+// nothing that only applies to full mounts.
+func validateFetchAttributes(attrib map[string]string) error {
+
+	var objects []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(attrib[secProvAttrib]), &objects); err != nil {
+		return fmt.Errorf("Failed to load SecretProviderClass: %+v", err)
+	}
+	if len(objects) != 1 {
+		return fmt.Errorf("on demand fetches must name exactly one object, not %d", len(objects))
+	}
+	if _, ok := objects[0]["objectTags"]; ok {
+		return fmt.Errorf("on demand fetches can not select objects with objectTags")
+	}
+	for _, name := range []string{templatesAttrib, syncSecretAttrib, sharedObjectsAttrib} {
+		if len(attrib[name]) > 0 {
+			return fmt.Errorf("%s can not be used with on demand fetches", name)
+		}
+	}
+	return nil
+}
+
+// The experimental service fetching single objects on demand.
+//
+// The service is registered on the provider socket next to the driver's
+// provider service when the OnDemandFetch feature gate is on. It reuses the
+// driver's mount messages so no new protocol definitions are needed.
+//
+type ObjectFetcher interface {
+	FetchObject(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error)
+}
+
+// Register the on demand fetch service on a gRPC server.
+//
+func RegisterObjectFetcher(s grpc.ServiceRegistrar, srv ObjectFetcher) {
+	s.RegisterService(&objectFetcherDesc, srv)
+}
+
+// Private description of the on demand fetch service (normally generated by
+// protoc).
+var objectFetcherDesc = grpc.ServiceDesc{
+	ServiceName: "aws.secretsstore.v1alpha1.ObjectFetcher",
+	HandlerType: (*ObjectFetcher)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "FetchObject", Handler: fetchObjectHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "server/fetch.go",
+}
+
+// Private gRPC handler for FetchObject.
+func fetchObjectHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+
+	req := new(v1alpha1.MountRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ObjectFetcher).FetchObject(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: FetchObjectMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ObjectFetcher).FetchObject(ctx, req.(*v1alpha1.MountRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
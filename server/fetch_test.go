@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Make sure single objects are fetched over gRPC without writing to the mount.
+func TestFetchObject(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestFetchObject")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+
+	socket := filepath.Join(dir, "aws.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("TestFetchObject: can not listen: %v", err)
+	}
+	grpcSrv := grpc.NewServer()
+	RegisterObjectFetcher(grpcSrv, svr)
+	go grpcSrv.Serve(listener)
+	defer grpcSrv.Stop()
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("TestFetchObject: can not connect: %v", err)
+	}
+	defer conn.Close()
+
+	mountDir := filepath.Join(dir, "mount")
+	os.Mkdir(mountDir, 0755)
+	fetch := func(tst testCase) (*v1alpha1.MountResponse, error) {
+		rsp := &v1alpha1.MountResponse{}
+		err := conn.Invoke(context.Background(), FetchObjectMethod, buildMountReq(mountDir, tst, []*v1alpha1.ObjectVersion{}), rsp)
+		return rsp, err
+	}
+
+	// Off unless the feature gate is set.
+	if _, err = fetch(tst); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("TestFetchObject: expected InvalidArgument but got %v", err)
+	}
+	utils.DefaultFeatureGate.Set("OnDemandFetch=true")
+	defer utils.DefaultFeatureGate.Set("OnDemandFetch=false")
+
+	// Only one object at a time.
+	if _, err = fetch(tst); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("TestFetchObject: expected InvalidArgument for two objects but got %v", err)
+	}
+
+	tst.mountObjs = tst.mountObjs[:1]
+	rsp, err := fetch(tst)
+	if err != nil {
+		t.Fatalf("TestFetchObject: got unexpected error %v", err)
+	}
+	name := tst.mountObjs[0]["objectName"].(string)
+	if len(rsp.Files) != 1 || rsp.Files[0].Path != name || string(rsp.Files[0].Contents) != tst.expSecrets[name] {
+		t.Fatalf("TestFetchObject: unexpected files %+v", rsp.Files)
+	}
+	if len(rsp.ObjectVersion) != 1 || rsp.ObjectVersion[0].Id != name {
+		t.Fatalf("TestFetchObject: unexpected versions %+v", rsp.ObjectVersion)
+	}
+	if files, _ := ioutil.ReadDir(mountDir); len(files) != 0 {
+		t.Fatalf("TestFetchObject: files written to the mount: %v", files)
+	}
+	if len(svr.mounts) != 0 || len(svr.inventory) != 0 {
+		t.Fatalf("TestFetchObject: fetch was recorded as a mount")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// File permission of mounts whose request gives none, unless changed with
+// ServerOptions.DefaultFilePermission.
+const defaultFilePermission os.FileMode = 0644
+
+// Allowed actions when a mount asks for a broader file permission than the
+// file permission policy allows.
+const (
+	PermissionActionWarn  = "warn"  // Mount with the requested permission but log and report it on the pod
+	PermissionActionClamp = "clamp" // Mount with the permission bits the policy allows (and warn)
+	PermissionActionDeny  = "deny"  // Fail the mount (default)
+)
+
+// Upper bound on the file permission of mounted secrets.
+//
+// The file permission of a mount comes from the volume (the filePermission
+// attribute, 0644 by default), so every workload picks its own. The policy
+// lets cluster operators hold every mount on the node to least privilege, for
+// example no access for other users with 0640. A permission is broader than
+// the maximum when it has any bit the maximum does not have, so 0604 is
+// broader than 0640 even though it is smaller.
+//
+type FilePermissionPolicy struct {
+	max    os.FileMode
+	action string
+}
+
+// Factory function to create a file permission policy.
+//
+// The maximum is an octal file mode such as 0640, and the action one of warn,
+// clamp, or deny (deny when empty).
+//
+func NewFilePermissionPolicy(max string, action string) (*FilePermissionPolicy, error) {
+
+	mode, err := parseFileMode(max)
+	if err != nil {
+		return nil, fmt.Errorf("max file permission %w", err)
+	}
+
+	switch action {
+	case "":
+		action = PermissionActionDeny
+	case PermissionActionWarn, PermissionActionClamp, PermissionActionDeny:
+	default:
+		return nil, fmt.Errorf("file permission action must be one of warn, clamp, or deny: %s", action)
+	}
+
+	return &FilePermissionPolicy{max: mode, action: action}, nil
+}
+
+// Check the file permission of a mount against the policy.
+//
+// Returns the permission to mount with, which only differs from the requested
+// one when the action is clamp, and whether the requested permission is
+// broader than allowed. An error is returned when the action is deny.
+//
+func (p *FilePermissionPolicy) Check(perm os.FileMode) (os.FileMode, bool, error) {
+
+	if p == nil || perm&^p.max == 0 {
+		return perm, false, nil
+	}
+
+	switch p.action {
+	case PermissionActionClamp:
+		return perm & p.max, true, nil
+	case PermissionActionWarn:
+		return perm, true, nil
+	}
+	return perm, true, fmt.Errorf("file permission %#o is broader than the maximum of %#o allowed by the provider", perm, p.max)
+}
+
+// Private helper to parse the file permission of mounts whose request does
+// not give one (defaultFilePermission when empty).
+//
+// The driver normally sends the filePermission of the volume with every
+// mount, but a request without one used to fail the mount. The permission is
+// an octal file mode such as 0640, and must be allowed by the file permission
+// policy (if any) so a default can never be denied or clamped.
+//
+func parseDefaultFilePermission(perm string, policy *FilePermissionPolicy) (os.FileMode, error) {
+
+	if len(perm) == 0 { // The built in default is only checked at mount time
+		return defaultFilePermission, nil
+	}
+	mode, err := parseFileMode(perm)
+	if err != nil {
+		return 0, fmt.Errorf("default file permission %w", err)
+	}
+	if mode == 0 { // No one could read the files
+		return 0, fmt.Errorf("default file permission can not be 0")
+	}
+	if _, broader, _ := policy.Check(mode); broader {
+		return 0, fmt.Errorf("default file permission %#o is broader than the maximum of %#o", mode, policy.max)
+	}
+	return mode, nil
+}
+
+// Private helper to get the file permission of a mount request, which the
+// driver sends as a decimal number (the default when empty).
+func (s *CSIDriverProviderServer) getFilePermission(permission string) (os.FileMode, error) {
+
+	if len(permission) == 0 && s.defaultPermission == 0 {
+		return defaultFilePermission, nil
+	}
+	if len(permission) == 0 {
+		return s.defaultPermission, nil
+	}
+	var perm os.FileMode
+	if err := json.Unmarshal([]byte(permission), &perm); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal file permission, error: %+v", err)
+	}
+	return perm, nil
+}
+
+// Private helper to parse an octal file mode of at most 0777.
+func parseFileMode(perm string) (os.FileMode, error) {
+
+	mode, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("must be an octal file mode between 0 and 0777: %s", perm)
+	}
+	return os.FileMode(mode), nil
+}
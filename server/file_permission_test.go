@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestFilePermissionPolicyCheck(t *testing.T) {
+
+	for _, tst := range []struct {
+		action  string
+		perm    os.FileMode
+		expPerm os.FileMode
+		broader bool
+		expErr  bool
+	}{
+		{PermissionActionDeny, 0640, 0640, false, false},
+		{PermissionActionDeny, 0400, 0400, false, false},
+		{PermissionActionDeny, 0644, 0644, true, true},
+		{PermissionActionClamp, 0777, 0640, true, false},
+		{PermissionActionClamp, 0604, 0600, true, false},
+		{PermissionActionWarn, 0777, 0777, true, false},
+	} {
+		policy, err := NewFilePermissionPolicy("0640", tst.action)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		perm, broader, err := policy.Check(tst.perm)
+		if perm != tst.expPerm || broader != tst.broader || (err != nil) != tst.expErr {
+			t.Errorf("%s %#o: got %#o %v %v", tst.action, tst.perm, perm, broader, err)
+		}
+	}
+
+	// No policy allows any permission.
+	var policy *FilePermissionPolicy
+	if perm, broader, err := policy.Check(0777); perm != 0777 || broader || err != nil {
+		t.Errorf("Unexpected result without a policy: %#o %v %v", perm, broader, err)
+	}
+
+	for max, action := range map[string]string{"0640": "block", "0999": "", "1777": "", "rw-r-----": ""} {
+		if _, err := NewFilePermissionPolicy(max, action); err == nil {
+			t.Errorf("Expected an error for %s %s", max, action)
+		}
+	}
+}
+
+// Make sure mounts asking for broad permissions are denied or clamped.
+func TestFilePermissionPolicyMount(t *testing.T) {
+
+	tst := testCase{
+		testName:   "File Permission Policy",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expSecrets: map[string]string{"TestSecret1": "secret1"},
+		perms:      "511", // 0777
+	}
+	ctx := context.Background()
+
+	svr := newServerWithMocks(&tst, true)
+	svr.permPolicy, _ = NewFilePermissionPolicy("0640", PermissionActionDeny)
+	_, err := svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "file permission 0777 is broader than the maximum of 0640") {
+		t.Fatalf("Expected the mount to be denied, got %v", err)
+	}
+
+	svr = newServerWithMocks(&tst, true)
+	svr.permPolicy, _ = NewFilePermissionPolicy("0640", PermissionActionClamp)
+	rsp, err := svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rsp.Files) != 1 || rsp.Files[0].Mode != 0640 {
+		t.Fatalf("Expected the permission to be clamped, got %v", rsp.Files)
+	}
+
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != permissionReason || !strings.Contains(events.Items[0].Message, "mounting with 0640") {
+		t.Fatalf("Expected a %s event, got %+v", permissionReason, events.Items)
+	}
+}
+
+// Make sure mounts without a permission use the default.
+func TestDefaultFilePermission(t *testing.T) {
+
+	tst := testCase{
+		testName:   "Default File Permission",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+	}
+	ctx := context.Background()
+	svr := newServerWithMocks(&tst, true)
+
+	rsp, err := svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil || len(rsp.Files) != 1 || rsp.Files[0].Mode != 0644 {
+		t.Fatalf("Expected the built in default: %v %v", rsp, err)
+	}
+
+	perm, err := parseDefaultFilePermission("0600", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	svr.defaultPermission = perm
+	svr.driverWriteSecrets = false
+	if _, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "TestSecret1")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the file written with 0600: %v %v", info, err)
+	}
+
+	// The default is checked against the policy when the server is created.
+	policy, _ := NewFilePermissionPolicy("0640", PermissionActionDeny)
+	for perm, expErr := range map[string]string{
+		"0644": "default file permission 0644 is broader than the maximum of 0640",
+		"644x": "default file permission must be an octal file mode between 0 and 0777: 644x",
+		"1777": "default file permission must be an octal file mode between 0 and 0777: 1777",
+		"0":    "default file permission can not be 0",
+	} {
+		_, err := NewServer(nil, nil, ServerOptions{PermissionPolicy: policy, DefaultFilePermission: perm})
+		if err == nil || err.Error() != expErr {
+			t.Errorf("Expected error: %s, got error: %v", expErr, err)
+		}
+	}
+	svr, err = NewServer(nil, nil, ServerOptions{PermissionPolicy: policy, DefaultFilePermission: "0440"})
+	if err != nil || svr.defaultPermission != 0440 {
+		t.Errorf("Unexpected server: %v %v", svr, err)
+	}
+}
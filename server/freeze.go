@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Freeze (or unfreeze) the provider.
+//
+// A frozen provider fetches nothing from AWS, as a kill switch for security
+// teams during an incident such as a compromised role. Files already mounted
+// are left as they are: rotation reconciles of mounts the provider writes
+// report the versions already mounted, while new mounts, on demand fetches,
+// refreshes, and reconciles of mounts the driver writes (which would need the
+// values) fail with a message saying the provider is frozen.
+//
+func (s *CSIDriverProviderServer) SetFrozen(frozen bool) {
+
+	if s.frozen.Swap(frozen) == frozen {
+		return
+	}
+	utils.SetFrozen(frozen)
+	if frozen {
+		klog.Warningf("Provider frozen: no secrets are fetched until it is unfrozen")
+	} else {
+		klog.Infof("Provider unfrozen: secrets are fetched again")
+	}
+}
+
+// Tell if the provider is frozen.
+func (s *CSIDriverProviderServer) Frozen() bool {
+	return s.frozen.Load()
+}
+
+// Private helper to answer a mount request while the provider is frozen.
+func (s *CSIDriverProviderServer) frozenMount(ctx context.Context, req *v1alpha1.MountRequest, nameSpace, podName string) (*v1alpha1.MountResponse, error) {
+
+	if !s.driverWriteSecrets && !isFetchOnly(ctx) && len(req.GetCurrentObjectVersion()) > 0 {
+		klog.Infof("Provider frozen: leaving the mount for pod %s in namespace %s as is", podName, nameSpace)
+		return &v1alpha1.MountResponse{ObjectVersion: req.GetCurrentObjectVersion()}, nil
+	}
+
+	err := fmt.Errorf("the provider is frozen for incident response, no secrets are fetched for pod %s in namespace %s until it is unfrozen", podName, nameSpace)
+	utils.Errorf("%s", err)
+	return nil, utils.WithCategory(utils.ErrorUnavailable, err)
+}
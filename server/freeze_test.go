@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Make sure a frozen provider fetches nothing and leaves mounts as they are.
+func TestFrozenMount(t *testing.T) {
+
+	tst := testCase{
+		testName:   "Frozen Mount",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expSecrets: map[string]string{"TestSecret1": "secret1"},
+		perms:      "420",
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	svr := newServerWithMocks(&tst, false)
+
+	rsp, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The mocks panic on any further AWS call.
+	svr.SetFrozen(true)
+	frozenRsp, err := svr.Mount(ctx, buildMountReq(dir, tst, rsp.ObjectVersion))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(frozenRsp.ObjectVersion) != 1 || frozenRsp.ObjectVersion[0].Version != "1" {
+		t.Fatalf("Expected the mounted versions, got %v", frozenRsp.ObjectVersion)
+	}
+	validateMounts(t, dir, tst, frozenRsp)
+
+	_, err = svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "the provider is frozen") {
+		t.Fatalf("Expected new mounts to fail, got %v", err)
+	}
+
+	// Rotations of mounts the driver writes need the values.
+	svr.driverWriteSecrets = true
+	_, err = svr.Mount(ctx, buildMountReq(dir, tst, rsp.ObjectVersion))
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected the rotation to fail, got %v", err)
+	}
+}
+
+// Make sure the admin endpoint freezes and unfreezes the provider.
+func TestFreezeAdmin(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	handler := svr.AdminHandler()
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := send(http.MethodPost, "/freeze"); w.Code != http.StatusNoContent || !svr.Frozen() {
+		t.Fatalf("Expected the provider to be frozen: %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/freeze"); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"frozen":true}` {
+		t.Fatalf("Unexpected state: %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/unfreeze"); w.Code != http.StatusMethodNotAllowed || !svr.Frozen() {
+		t.Fatalf("Expected GET to be rejected: %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/unfreeze"); w.Code != http.StatusNoContent || svr.Frozen() {
+		t.Fatalf("Expected the provider to be unfrozen: %d", w.Code)
+	}
+}
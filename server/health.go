@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/discovery"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Time allowed for each health check, well within the default probe timeout.
+const healthTimeout = 2 * time.Second
+
+// Mounts in progress for longer than this (far longer than the driver waits
+// for a mount) are stuck.
+var stuckMountAge = 10 * time.Minute
+
+// Serves the liveness and readiness endpoints used by the DaemonSet probes.
+//
+// /healthz (liveness) checks that the provider socket answers gRPC health
+// checks and that no mount is stuck, so a wedged provider is restarted. It
+// also reports the time of the last successful mount, which is only
+// informational since a node without pods never mounts and an AWS outage must
+// not restart the provider. /readyz (readiness) also checks that the
+// Kubernetes API (used to find regions and roles) is reachable and reports the
+// time of the last successful STS call, which is informational for the same
+// reasons.
+//
+type HealthServer struct {
+	socketPath string
+	k8sClient  discovery.ServerVersionInterface
+}
+
+// Report of the health checks returned by both endpoints.
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Factory function to create the health server.
+//
+func NewHealthServer(socketPath string, k8sClient discovery.ServerVersionInterface) *HealthServer {
+	return &HealthServer{socketPath: socketPath, k8sClient: k8sClient}
+}
+
+// Returns the handler serving /healthz and /readyz.
+//
+// Both return 200 when every check passes (or only warns) and 503 otherwise,
+// with a JSON report of the checks in the body.
+//
+func (h *HealthServer) Handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.checkSocket(r.Context()), checkMountActivity())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.checkSocket(r.Context()), checkMountActivity(), h.checkK8sAPI(r.Context()), checkSTSActivity())
+	})
+	return mux
+}
+
+// Private helper to write the health report.
+func writeHealth(w http.ResponseWriter, checks ...CheckResult) {
+
+	report := healthReport{Status: CheckPass, Checks: checks}
+	for _, check := range checks {
+		if check.Status == CheckFail {
+			report.Status = CheckFail
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == CheckFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Private helper to check the provider socket answers gRPC health checks.
+func (h *HealthServer) checkSocket(ctx context.Context) CheckResult {
+
+	name := "Provider socket"
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	conn, err := grpc.NewClient("unix://"+h.socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("can not connect to %s: %v", h.socketPath, err)}
+	}
+	defer conn.Close()
+
+	rsp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("%s is not serving: %v", h.socketPath, err)}
+	}
+	if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return CheckResult{name, CheckFail, fmt.Sprintf("%s is %s", h.socketPath, rsp.GetStatus())}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("%s is serving", h.socketPath)}
+}
+
+// Private helper to check the Kubernetes API is reachable.
+//
+// The discovery client does not take a context, so the check is abandoned
+// (and reported as failed) once it takes too long.
+//
+func (h *HealthServer) checkK8sAPI(ctx context.Context) CheckResult {
+
+	result := make(chan CheckResult, 1)
+	go func() { result <- checkK8sAPI(h.k8sClient, nil) }()
+
+	select {
+	case res := <-result:
+		return res
+	case <-time.After(healthTimeout):
+		return CheckResult{"Kubernetes API", CheckFail, fmt.Sprintf("no response within %s", healthTimeout)}
+	case <-ctx.Done():
+		return CheckResult{"Kubernetes API", CheckFail, ctx.Err().Error()}
+	}
+}
+
+// Private helper to check no mount is stuck and report the last successful
+// mount.
+func checkMountActivity() CheckResult {
+
+	name := "Mounts"
+	if oldest := utils.OldestMountInProgress(); !oldest.IsZero() && time.Since(oldest) > stuckMountAge {
+		return CheckResult{name, CheckFail, fmt.Sprintf("a mount has been in progress since %s", oldest.UTC().Format(time.RFC3339))}
+	}
+	last := utils.LastMountSuccess()
+	if last.IsZero() {
+		return CheckResult{name, CheckWarn, "no successful mount since the provider started"}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("last successful mount at %s", last.UTC().Format(time.RFC3339))}
+}
+
+// Private helper to report the last successful STS call.
+func checkSTSActivity() CheckResult {
+
+	name := "STS"
+	last := utils.LastSTSSuccess()
+	if last.IsZero() {
+		return CheckResult{name, CheckWarn, "no successful call since the provider started"}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("last successful call at %s", last.UTC().Format(time.RFC3339))}
+}
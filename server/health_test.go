@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to get the status and report of a health endpoint.
+func getHealth(t *testing.T, handler http.Handler, path string) (int, healthReport) {
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("bad health report %s: %v", rec.Body.String(), err)
+	}
+	return rec.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestHealthEndpoints")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	socket := filepath.Join(dir, "aws.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("TestHealthEndpoints: can not listen: %v", err)
+	}
+	grpcSrv := grpc.NewServer()
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	go grpcSrv.Serve(listener)
+	defer grpcSrv.Stop()
+
+	handler := NewHealthServer(socket, fake.NewSimpleClientset().Discovery()).Handler()
+
+	code, report := getHealth(t, handler, "/healthz")
+	if code != http.StatusOK || report.Status != CheckPass || len(report.Checks) != 2 {
+		t.Errorf("TestHealthEndpoints: unexpected liveness %d %+v", code, report)
+	}
+	code, report = getHealth(t, handler, "/readyz")
+	if code != http.StatusOK || report.Status != CheckPass || len(report.Checks) != 4 {
+		t.Errorf("TestHealthEndpoints: unexpected readiness %d %+v", code, report)
+	}
+
+	// Fails while a mount is stuck.
+	defer func(age time.Duration) { stuckMountAge = age }(stuckMountAge)
+	stuckMountAge = 0
+	mountDone := utils.StartMount()
+	code, report = getHealth(t, handler, "/healthz")
+	if code != http.StatusServiceUnavailable || report.Checks[1].Status != CheckFail {
+		t.Errorf("TestHealthEndpoints: unexpected liveness with a stuck mount %d %+v", code, report)
+	}
+	mountDone(nil)
+	code, report = getHealth(t, handler, "/healthz")
+	if code != http.StatusOK || report.Checks[1].Status != CheckPass {
+		t.Errorf("TestHealthEndpoints: unexpected liveness after the mount %d %+v", code, report)
+	}
+
+	// Not serving once shut down.
+	healthSrv.Shutdown()
+	code, report = getHealth(t, handler, "/healthz")
+	if code != http.StatusServiceUnavailable || report.Status != CheckFail {
+		t.Errorf("TestHealthEndpoints: unexpected liveness after shutdown %d %+v", code, report)
+	}
+}
+
+func TestHealthNoSocket(t *testing.T) {
+
+	handler := NewHealthServer("/nonexistent/aws.sock", fake.NewSimpleClientset().Discovery()).Handler()
+	code, report := getHealth(t, handler, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Checks[0].Status != CheckFail || report.Checks[2].Status != CheckPass {
+		t.Errorf("TestHealthNoSocket: unexpected readiness %d %+v", code, report)
+	}
+}
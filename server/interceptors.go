@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Prefix of the standard gRPC health check methods, which are not logged since
+// the health endpoints call them every few seconds.
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+// Private context key holding the ID of a gRPC request.
+type requestIDKey struct{}
+
+// Returns the ID given to the gRPC request of the context (empty outside of a
+// request).
+//
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Private helper to generate a short random request ID.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// Returns the interceptors of the provider's gRPC server, to install with
+// grpc.ChainUnaryInterceptor.
+//
+// On a busy node the logs of concurrent mounts interleave. Each request is
+// given an ID, and its start and finish are logged with the ID, the pod and
+// namespace of mount requests, the gRPC status code, and the duration, so the
+// lines of one mount can be picked out. Code serving a request logs with the
+// logger of its context, which carries the ID. A panic while serving a request is
+// logged with its stack and returned as an Internal error instead of
+// crashing the provider (and failing every other mount on the node).
+//
+func UnaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{requestIDInterceptor, loggingInterceptor, recoveryInterceptor}
+}
+
+// Private interceptor giving each request an ID, which is also added to the
+// logger of the request (see klog.FromContext).
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := newRequestID()
+	ctx = klog.NewContext(ctx, klog.LoggerWithValues(klog.FromContext(ctx), "requestID", id))
+	return handler(context.WithValue(ctx, requestIDKey{}, id), req)
+}
+
+// Private interceptor logging the start and finish of each request.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+		return handler(ctx, req)
+	}
+
+	id, pod := RequestID(ctx), requestPod(req)
+	klog.Infof("Started %s request %s%s", info.FullMethod, id, pod)
+	start := time.Now()
+	rsp, err := handler(ctx, req)
+	if err != nil {
+		klog.Infof("Finished %s request %s%s in %s with code %s", info.FullMethod, id, pod, time.Since(start), status.Code(err))
+	} else {
+		klog.Infof("Finished %s request %s%s in %s", info.FullMethod, id, pod, time.Since(start))
+	}
+	return rsp, err
+}
+
+// Private helper to describe the pod of a mount request for the logs (empty
+// for other requests).
+func requestPod(req interface{}) string {
+
+	mountReq, ok := req.(*v1alpha1.MountRequest)
+	if !ok {
+		return ""
+	}
+	var attrib map[string]string
+	if err := json.Unmarshal([]byte(mountReq.GetAttributes()), &attrib); err != nil {
+		return ""
+	}
+	return " for pod " + attrib[podnameAttrib] + " in namespace " + attrib[namespaceAttrib]
+}
+
+// Private interceptor turning a panic into an Internal error.
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (rsp interface{}, e error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			klog.Errorf("Panic serving %s request %s: %v\n%s", info.FullMethod, RequestID(ctx), r, debug.Stack())
+			rsp, e = nil, status.Errorf(codes.Internal, "internal error serving request %s", RequestID(ctx))
+		}
+	}()
+	return handler(ctx, req)
+}
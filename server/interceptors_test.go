@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Private helper to run a handler through all the interceptors.
+func intercept(req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/v1alpha1.CSIDriverProvider/Mount"}
+	interceptors := UnaryInterceptors()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(context.Background(), req)
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+
+	// Each request gets its own ID.
+	var ids []string
+	for i := 0; i < 2; i++ {
+		rsp, err := intercept(&v1alpha1.MountRequest{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			ids = append(ids, RequestID(ctx))
+			return "ok", nil
+		})
+		if rsp != "ok" || err != nil {
+			t.Fatalf("Unexpected response: %v %v", rsp, err)
+		}
+	}
+	if len(ids[0]) != 16 || ids[0] == ids[1] {
+		t.Fatalf("Expected distinct request IDs, got %v", ids)
+	}
+
+	// Errors are passed through unchanged.
+	expected := errors.New("failed")
+	if _, err := intercept(nil, func(ctx context.Context, req interface{}) (interface{}, error) { return nil, expected }); err != expected {
+		t.Fatalf("Expected %v, got %v", expected, err)
+	}
+
+	// Panics become Internal errors.
+	rsp, err := intercept(nil, func(ctx context.Context, req interface{}) (interface{}, error) { panic("boom") })
+	if rsp != nil || status.Code(err) != codes.Internal {
+		t.Fatalf("Expected an Internal error, got %v %v", rsp, err)
+	}
+
+	if RequestID(context.Background()) != "" {
+		t.Fatalf("Expected no request ID outside of a request")
+	}
+}
+
+// Make sure the logger of a request carries its ID.
+func TestRequestLogger(t *testing.T) {
+
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.BufferLogs(true)))
+	ctx := klog.NewContext(context.Background(), logger)
+	var id string
+	requestIDInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		id = RequestID(ctx)
+		klog.FromContext(ctx).Info("mounting")
+		return nil, nil
+	})
+	logged := logger.GetSink().(ktesting.Underlier).GetBuffer().String()
+	if len(id) == 0 || !strings.Contains(logged, `requestID="`+id+`"`) {
+		t.Fatalf("Expected the request ID %s in the log, got %s", id, logged)
+	}
+}
+
+func TestRequestPod(t *testing.T) {
+
+	req := &v1alpha1.MountRequest{Attributes: `{"csi.storage.k8s.io/pod.name": "web", "csi.storage.k8s.io/pod.namespace": "shop"}`}
+	if pod := requestPod(req); pod != " for pod web in namespace shop" {
+		t.Fatalf("Unexpected pod: %q", pod)
+	}
+	for _, req := range []interface{}{&v1alpha1.MountRequest{Attributes: "{"}, &v1alpha1.VersionRequest{}, nil} {
+		if pod := requestPod(req); pod != "" {
+			t.Fatalf("Expected no pod for %v, got %q", req, pod)
+		}
+	}
+}
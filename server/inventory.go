@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// An object mounted on the node, as reported in the inventory.
+//
+// Only the names and versions of objects are exported, never their values.
+//
+type InventoryObject struct {
+	ObjectType string `json:"objectType"`
+	ObjectName string `json:"objectName"`
+	ARN        string `json:"arn,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Failover   bool   `json:"failover,omitempty"`
+}
+
+// The objects of the last successful mount of a pod volume.
+//
+type InventoryMount struct {
+	Namespace  string            `json:"namespace"`
+	Pod        string            `json:"pod"`
+	TargetPath string            `json:"targetPath"`
+	MountedAt  time.Time         `json:"mountedAt"`
+	Objects    []InventoryObject `json:"objects"`
+}
+
+// The secrets and versions currently mounted on a node.
+//
+type Inventory struct {
+	Node        string           `json:"node"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+	Mounts      []InventoryMount `json:"mounts"`
+}
+
+// Private helper to remember the objects of a successful mount for the
+// inventory.
+//
+// The objects come from the fetched values, so jmesPath entries, exploded keys
+// and rendered templates are reported once as the object they came from.
+//
+func (s *CSIDriverProviderServer) recordInventory(nameSpace, podName, mountDir string, secrets []*provider.SecretValue) {
+
+	mount := &InventoryMount{
+		Namespace:  nameSpace,
+		Pod:        podName,
+		TargetPath: mountDir,
+		MountedAt:  time.Now().UTC(),
+		Objects:    []InventoryObject{},
+	}
+	seen := make(map[string]bool)
+	for _, secret := range secrets {
+		name := secret.Descriptor.GetSecretName(secret.FailoverIndex)
+		if len(name) == 0 { // jmesPath entries, exploded keys, and templates
+			continue
+		}
+		objType := secret.Descriptor.GetSecretType().String()
+		if seen[objType+"/"+name] {
+			continue
+		}
+		seen[objType+"/"+name] = true
+		mount.Objects = append(mount.Objects, InventoryObject{
+			ObjectType: objType,
+			ObjectName: name,
+			ARN:        secret.ARN,
+			Version:    secret.Version,
+			Failover:   secret.IsFailover,
+		})
+	}
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+	if s.inventory == nil {
+		s.inventory = make(map[string]*InventoryMount)
+	}
+	s.inventory[mountDir] = mount
+}
+
+// Return the inventory of the objects currently mounted by this provider.
+//
+// Mounts whose target path no longer exists (the pod is gone) are dropped.
+// Since the inventory is kept in memory, mounts made before the provider
+// restarted only show up again once they are rotated.
+//
+func (s *CSIDriverProviderServer) Inventory(node string) *Inventory {
+
+	s.pruneMounts(0)
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+
+	inv := &Inventory{Node: node, GeneratedAt: time.Now().UTC(), Mounts: []InventoryMount{}}
+	for _, mount := range s.inventory {
+		inv.Mounts = append(inv.Mounts, *mount)
+	}
+	sort.Slice(inv.Mounts, func(i, j int) bool { return inv.Mounts[i].TargetPath < inv.Mounts[j].TargetPath })
+	return inv
+}
+
+// Destination of the exported inventory.
+//
+type InventorySink interface {
+	Export(ctx context.Context, inv *Inventory) error
+}
+
+// Create an inventory sink from its URL.
+//
+// The supported sinks are file:///path/to/file.json (rewritten on every
+// export), s3://bucket/prefix (written to <prefix>/<node>.json), and
+// cloudwatch://log-group (one event for each mount in the <node> log stream).
+// The S3 and CloudWatch sinks use the given session, which should carry the
+// provider's own credentials.
+//
+func NewInventorySink(sinkURL string, sess *session.Session) (InventorySink, error) {
+
+	u, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory sink %s: %w", sinkURL, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		if len(u.Path) == 0 || strings.HasSuffix(u.Path, "/") {
+			return nil, fmt.Errorf("inventory file sink must name a file: %s", sinkURL)
+		}
+		return &fileInventorySink{path: u.Path}, nil
+	case "s3":
+		if len(u.Host) == 0 {
+			return nil, fmt.Errorf("inventory s3 sink must name a bucket: %s", sinkURL)
+		}
+		return &s3InventorySink{client: s3.New(sess), bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	case "cloudwatch":
+		logGroup := u.Host + u.Path // Log group names may start with a slash (cloudwatch:///aws/...)
+		if len(strings.Trim(logGroup, "/")) == 0 {
+			return nil, fmt.Errorf("inventory cloudwatch sink must name a log group: %s", sinkURL)
+		}
+		return &cloudWatchInventorySink{client: cloudwatchlogs.New(sess), logGroup: logGroup}, nil
+	default:
+		return nil, fmt.Errorf("inventory sink must start with file://, s3://, or cloudwatch://: %s", sinkURL)
+	}
+}
+
+// Periodically export the inventory of mounted objects until the context is
+// cancelled.
+//
+// Export failures are logged and retried on the next interval.
+//
+func RunInventoryExport(ctx context.Context, srv *CSIDriverProviderServer, sink InventorySink, node string, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		inv := srv.Inventory(node)
+		if err := sink.Export(ctx, inv); err != nil {
+			utils.Errorf("Failed to export the mount inventory: %v", err)
+			continue
+		}
+		klog.V(2).Infof("Exported the inventory of %d mounts", len(inv.Mounts))
+	}
+}
+
+// Private sink writing the inventory to a local file.
+type fileInventorySink struct {
+	path string
+}
+
+// Write the inventory to a temporary file and rename it into place, so
+// readers never see a partial inventory.
+//
+func (f *fileInventorySink) Export(ctx context.Context, inv *Inventory) error {
+
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), ".inventory")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Cleanup on failure.
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Private sink writing the inventory of each node to an S3 object.
+type s3InventorySink struct {
+	client s3iface.S3API
+	bucket string
+	prefix string
+}
+
+func (s *s3InventorySink) Export(ctx context.Context, inv *Inventory) error {
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	key := path.Join(s.prefix, inv.Node+".json")
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return nil
+}
+
+// Private sink sending the inventory to CloudWatch Logs.
+//
+// Each mount is a separate event (with the node and export time) so large
+// inventories stay within the CloudWatch event size limit.
+//
+type cloudWatchInventorySink struct {
+	client   cloudwatchlogsiface.CloudWatchLogsAPI
+	logGroup string
+}
+
+// Events of a single PutLogEvents call (the CloudWatch limit is 10000).
+const maxInventoryEvents = 1000
+
+func (c *cloudWatchInventorySink) Export(ctx context.Context, inv *Inventory) error {
+
+	_, err := c.client.CreateLogStreamWithContext(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(c.logGroup),
+		LogStreamName: aws.String(inv.Node),
+	})
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+		return fmt.Errorf("failed to create log stream %s in %s: %w", inv.Node, c.logGroup, err)
+	}
+
+	var events []*cloudwatchlogs.InputLogEvent
+	timestamp := aws.Int64(inv.GeneratedAt.UnixNano() / int64(time.Millisecond))
+	for _, mount := range inv.Mounts {
+		data, err := json.Marshal(struct {
+			Node        string    `json:"node"`
+			GeneratedAt time.Time `json:"generatedAt"`
+			InventoryMount
+		}{inv.Node, inv.GeneratedAt, mount})
+		if err != nil {
+			return err
+		}
+		events = append(events, &cloudwatchlogs.InputLogEvent{Message: aws.String(string(data)), Timestamp: timestamp})
+	}
+
+	for len(events) > 0 {
+		batch := events
+		if len(batch) > maxInventoryEvents {
+			batch = batch[:maxInventoryEvents]
+		}
+		events = events[len(batch):]
+		_, err := c.client.PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(c.logGroup),
+			LogStreamName: aws.String(inv.Node),
+			LogEvents:     batch,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send the inventory to %s: %w", c.logGroup, err)
+		}
+	}
+	return nil
+}
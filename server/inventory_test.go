@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Make sure successful mounts are reported in the inventory until the pod is gone.
+func TestInventory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestInventory")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	_, err = svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestInventory: got unexpected error %s", err.Error())
+	}
+
+	inv := svr.Inventory("fakeNode")
+	if inv.Node != "fakeNode" || len(inv.Mounts) != 1 {
+		t.Fatalf("TestInventory: unexpected inventory %+v", inv)
+	}
+	mount := inv.Mounts[0]
+	if mount.Namespace != "fakeNS" || mount.Pod != "fakePod" || mount.TargetPath != dir {
+		t.Errorf("TestInventory: unexpected mount %+v", mount)
+	}
+	expected := map[string]string{"secretsmanager/TestSecret1": "1", "ssmparameter/TestParm1": "1"}
+	if len(mount.Objects) != len(expected) {
+		t.Fatalf("TestInventory: unexpected objects %+v", mount.Objects)
+	}
+	for _, obj := range mount.Objects {
+		if version, ok := expected[obj.ObjectType+"/"+obj.ObjectName]; !ok || version != obj.Version {
+			t.Errorf("TestInventory: unexpected object %+v", obj)
+		}
+	}
+
+	// Mounts are dropped once the target path is removed.
+	os.RemoveAll(dir)
+	if inv := svr.Inventory("fakeNode"); len(inv.Mounts) != 0 {
+		t.Errorf("TestInventory: expected no mounts but got %+v", inv.Mounts)
+	}
+}
+
+func TestFileInventorySink(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestFileInventorySink")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	path := filepath.Join(dir, "inventory.json")
+	sink, err := NewInventorySink("file://"+path, nil)
+	if err != nil {
+		t.Fatalf("TestFileInventorySink: got unexpected error %s", err.Error())
+	}
+	inv := &Inventory{Node: "node1", Mounts: []InventoryMount{{Namespace: "ns", Pod: "pod1"}}}
+	if err := sink.Export(context.Background(), inv); err != nil {
+		t.Fatalf("TestFileInventorySink: got unexpected error %s", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("TestFileInventorySink: got unexpected error %s", err.Error())
+	}
+	var got Inventory
+	if err := json.Unmarshal(data, &got); err != nil || got.Node != "node1" || got.Mounts[0].Pod != "pod1" {
+		t.Errorf("TestFileInventorySink: unexpected inventory %s (%v)", data, err)
+	}
+
+	// Only the inventory is left behind.
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("TestFileInventorySink: expected one file but got %d", len(files))
+	}
+}
+
+func TestNewInventorySinkErrors(t *testing.T) {
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-west-2")))
+	for _, sinkURL := range []string{"", "/tmp/inventory.json", "file:///tmp/", "s3:///prefix", "cloudwatch://", "http://example.com"} {
+		if _, err := NewInventorySink(sinkURL, sess); err == nil {
+			t.Errorf("TestNewInventorySinkErrors: expected error for %q", sinkURL)
+		}
+	}
+	for _, sinkURL := range []string{"s3://bucket/prefix", "cloudwatch:///aws/secrets-inventory"} {
+		if _, err := NewInventorySink(sinkURL, sess); err != nil {
+			t.Errorf("TestNewInventorySinkErrors: unexpected error for %q: %v", sinkURL, err)
+		}
+	}
+}
+
+type mockInventoryS3 struct {
+	s3iface.S3API
+	input *s3.PutObjectInput
+}
+
+func (m *mockInventoryS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	m.input = input
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3InventorySink(t *testing.T) {
+
+	client := &mockInventoryS3{}
+	sink := &s3InventorySink{client: client, bucket: "bucket", prefix: "inventory"}
+	if err := sink.Export(context.Background(), &Inventory{Node: "node1"}); err != nil {
+		t.Fatalf("TestS3InventorySink: got unexpected error %s", err.Error())
+	}
+	if aws.StringValue(client.input.Bucket) != "bucket" || aws.StringValue(client.input.Key) != "inventory/node1.json" {
+		t.Errorf("TestS3InventorySink: unexpected object s3://%s/%s", aws.StringValue(client.input.Bucket), aws.StringValue(client.input.Key))
+	}
+}
+
+type mockInventoryLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	events []*cloudwatchlogs.InputLogEvent
+}
+
+func (m *mockInventoryLogs) CreateLogStreamWithContext(
+	ctx aws.Context, input *cloudwatchlogs.CreateLogStreamInput, opts ...request.Option,
+) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "exists", nil)
+}
+
+func (m *mockInventoryLogs) PutLogEventsWithContext(
+	ctx aws.Context, input *cloudwatchlogs.PutLogEventsInput, opts ...request.Option,
+) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	m.events = append(m.events, input.LogEvents...)
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func TestCloudWatchInventorySink(t *testing.T) {
+
+	client := &mockInventoryLogs{}
+	sink := &cloudWatchInventorySink{client: client, logGroup: "group"}
+	inv := &Inventory{Node: "node1", Mounts: []InventoryMount{{Pod: "pod1"}, {Pod: "pod2"}}}
+	if err := sink.Export(context.Background(), inv); err != nil {
+		t.Fatalf("TestCloudWatchInventorySink: got unexpected error %s", err.Error())
+	}
+	if len(client.events) != 2 || !strings.Contains(aws.StringValue(client.events[1].Message), `"node":"node1"`) ||
+		!strings.Contains(aws.StringValue(client.events[1].Message), `"pod":"pod2"`) {
+		t.Errorf("TestCloudWatchInventorySink: unexpected events %v", client.events)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Remove expired lookups once the cache grows by this many entries.
+const lookupSweepInterval = 100
+
+// Private short-lived cache of Kubernetes lookups.
+//
+// When the rotation reconciler runs, every pod on the node is remounted in a
+// short window and each mount without a region looks up its pod and then the
+// same node object. This cache keeps the results of those lookups for a short
+// time (a reconcile wave) and makes concurrent lookups of the same object wait
+// for a single API call, which keeps the provider under its configured QPS and
+// burst limits. Failed lookups are never cached.
+//
+type lookupCache struct {
+	mu        sync.Mutex
+	entries   map[string]*lookupEntry
+	nextSweep int
+}
+
+// Private lookup result, which is pending until done is closed.
+type lookupEntry struct {
+	done    chan struct{}
+	value   string
+	err     error
+	expires time.Time
+}
+
+// Private factory to create a lookup cache.
+func newLookupCache() *lookupCache {
+	return &lookupCache{
+		entries:   make(map[string]*lookupEntry),
+		nextSweep: lookupSweepInterval,
+	}
+}
+
+// Private helper to return a cached lookup or perform it.
+//
+// New lookups are cached for ttl, which callers take from the server settings
+// so it can be reloaded. A nil cache (or a ttl that is not positive) always
+// calls lookup. Callers waiting on another caller's lookup stop waiting when
+// their context is done.
+//
+func (c *lookupCache) get(ctx context.Context, ttl time.Duration, key string, lookup func() (string, error)) (string, error) {
+
+	if c == nil || ttl <= 0 {
+		return lookup()
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		c.mu.Unlock()
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if entry.err == nil && time.Now().Before(entry.expires) {
+			return entry.value, nil
+		}
+		c.mu.Lock()
+		if c.entries[key] == entry { // Expired or failed, so look it up again.
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return c.get(ctx, ttl, key, lookup)
+	}
+
+	entry = &lookupEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.sweep()
+	c.mu.Unlock()
+
+	entry.value, entry.err = lookup()
+	entry.expires = time.Now().Add(ttl) // Read by others only once done is closed
+	close(entry.done)
+
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	return entry.value, entry.err
+}
+
+// Private helper to remove expired lookups. Must be called with the lock held.
+func (c *lookupCache) sweep() {
+
+	if len(c.entries) < c.nextSweep {
+		return
+	}
+	now := time.Now()
+	for key, entry := range c.entries {
+		select {
+		case <-entry.done:
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		default: // Still pending
+		}
+	}
+	c.nextSweep = len(c.entries) + lookupSweepInterval
+}
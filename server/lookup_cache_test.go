@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLookupCacheSharesLookups(t *testing.T) {
+
+	cache := newLookupCache()
+	var calls int32
+	lookup := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "us-west-2", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := cache.get(context.Background(), time.Minute, "node/node1", lookup); err != nil || val != "us-west-2" {
+				t.Errorf("Unexpected lookup result: %s %v", val, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("Expected one lookup, got %d", calls)
+	}
+}
+
+func TestLookupCacheErrorsAndExpiry(t *testing.T) {
+
+	cache := newLookupCache()
+	calls := 0
+	failing := func() (string, error) { calls++; return "", fmt.Errorf("not found") }
+	working := func() (string, error) { calls++; return "node1", nil }
+
+	// Failures are not cached.
+	cache.get(context.Background(), time.Minute, "pod/ns/pod1", failing)
+	if val, err := cache.get(context.Background(), time.Minute, "pod/ns/pod1", working); err != nil || val != "node1" || calls != 2 {
+		t.Fatalf("Unexpected lookup result: %s %v %d", val, err, calls)
+	}
+
+	// Expired lookups are done again.
+	cache.entries["pod/ns/pod1"].expires = time.Now().Add(-time.Second)
+	cache.get(context.Background(), time.Minute, "pod/ns/pod1", working)
+	if calls != 3 {
+		t.Fatalf("Expected the expired lookup to be done again, got %d lookups", calls)
+	}
+
+	// No caching when disabled.
+	var disabled *lookupCache
+	disabled.get(context.Background(), time.Minute, "pod/ns/pod1", working)
+	disabled.get(context.Background(), time.Minute, "pod/ns/pod1", working)
+	cache.get(context.Background(), 0, "pod/ns/pod2", working)
+	cache.get(context.Background(), 0, "pod/ns/pod2", working)
+	if calls != 7 {
+		t.Fatalf("Expected every lookup to be done without a cache, got %d lookups", calls)
+	}
+}
+
+func TestRegionLookupCached(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "ns"},
+			Spec:       corev1.PodSpec{NodeName: "node1"},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{regionLabel: "us-west-2"}},
+		},
+	)
+	svr := &CSIDriverProviderServer{k8sClient: clientset.CoreV1(), lookups: newLookupCache()}
+
+	for _, pod := range []string{"pod1", "pod2", "pod1", "pod2"} {
+		region, err := svr.getRegionFromNode(context.Background(), &serverSettings{lookupTTL: time.Minute}, "ns", pod)
+		if err != nil || region != "us-west-2" {
+			t.Fatalf("Unexpected region: %s %v", region, err)
+		}
+	}
+
+	// Two pod lookups and a single node lookup.
+	if len(clientset.Actions()) != 3 {
+		t.Fatalf("Expected 3 API calls, got %d: %v", len(clientset.Actions()), clientset.Actions())
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// gRPC status codes returned for each category of mount failure.
+var categoryCodes = map[string]codes.Code{
+	utils.ErrorInvalidConfiguration: codes.InvalidArgument,
+	utils.ErrorAccessDenied:         codes.PermissionDenied,
+	utils.ErrorNotFound:             codes.NotFound,
+	utils.ErrorThrottled:            codes.ResourceExhausted,
+	utils.ErrorRejected:             codes.FailedPrecondition,
+	utils.ErrorUnavailable:          codes.Unavailable,
+	utils.ErrorCancelled:            codes.Canceled,
+	utils.ErrorUnknown:              codes.Unknown,
+}
+
+// Private helper to convert a mount failure to a gRPC status error.
+//
+// The status code gives the category of the failure (for example
+// PermissionDenied or NotFound) and an ErrorInfo detail carries the category
+// as the reason along with the object, region, AWS error code, and AWS request
+// ID when known. The message is unchanged so events read as before.
+//
+func mountStatus(err error) error {
+
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	category := utils.ErrorCategory(err)
+	code := categoryCodes[category]
+	if category == utils.ErrorCancelled && errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+
+	metadata := make(map[string]string)
+	if objErr := utils.GetObjectError(err); objErr != nil {
+		metadata["objectType"] = objErr.ObjectType
+		metadata["objectName"] = objErr.ObjectName
+		if len(objErr.Region) > 0 {
+			metadata["region"] = objErr.Region
+		}
+	}
+	if awsCode := utils.GetErrorCode(err); len(awsCode) > 0 {
+		metadata["awsErrorCode"] = awsCode
+	}
+	if requestID := utils.GetRequestID(err); len(requestID) > 0 {
+		metadata["requestId"] = requestID
+	}
+
+	st := status.New(code, err.Error())
+	detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   category,
+		Domain:   auth.ProviderName,
+		Metadata: metadata,
+	})
+	if detailErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
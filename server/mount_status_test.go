@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to get the ErrorInfo detail of a mount failure.
+func getErrorInfo(t *testing.T, err error, expCode codes.Code) *errdetails.ErrorInfo {
+
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected a status error but got %v", err)
+	}
+	if st.Code() != expCode {
+		t.Fatalf("expected code %s but got %s: %v", expCode, st.Code(), err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return nil
+}
+
+func TestMountStatusNotFound(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestMountStatusNotFound")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	var tst testCase
+	for _, tc := range mountTestsForMultiRegion {
+		if tc.testName == "SecretsManager Primary Region 4XX Fail" {
+			tst = tc
+		}
+	}
+	svr := newServerWithMocks(&tst, false)
+	_, err = svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+
+	info := getErrorInfo(t, err, codes.NotFound)
+	if info.Reason != utils.ErrorNotFound || info.Domain != "secrets-store-csi-driver-provider-aws" {
+		t.Errorf("TestMountStatusNotFound: unexpected reason %s or domain %s", info.Reason, info.Domain)
+	}
+	for key, expected := range map[string]string{
+		"objectType":   "secretsmanager",
+		"objectName":   "TestSecret1",
+		"awsErrorCode": "ResourceNotFoundException",
+	} {
+		if info.Metadata[key] != expected {
+			t.Errorf("TestMountStatusNotFound: expected %s of %s but got %s", key, expected, info.Metadata[key])
+		}
+	}
+}
+
+func TestMountStatusInvalidConfiguration(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	req := &v1alpha1.MountRequest{
+		Attributes:           `{"awsRetryMode": "legacy"}`,
+		TargetPath:           "/tmp",
+		Permission:           "420",
+		CurrentObjectVersion: []*v1alpha1.ObjectVersion{},
+	}
+	_, err := svr.Mount(context.Background(), req)
+
+	info := getErrorInfo(t, err, codes.InvalidArgument)
+	if info.Reason != utils.ErrorInvalidConfiguration {
+		t.Errorf("TestMountStatusInvalidConfiguration: unexpected reason %s", info.Reason)
+	}
+}
+
+func TestMountStatusPassThrough(t *testing.T) {
+
+	err := status.Error(codes.Aborted, "already a status")
+	if mountStatus(err) != err {
+		t.Errorf("TestMountStatusPassThrough: status errors should be unchanged")
+	}
+	if mountStatus(nil) != nil {
+		t.Errorf("TestMountStatusPassThrough: nil should be unchanged")
+	}
+
+	st, _ := status.FromError(mountStatus(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)))
+	if st.Code() != codes.DeadlineExceeded {
+		t.Errorf("TestMountStatusPassThrough: expected DeadlineExceeded but got %s", st.Code())
+	}
+}
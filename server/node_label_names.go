@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to replace the node label placeholders (such as
+// {topology.kubernetes.io/zone}) in the object names of a mount with the
+// labels of the pod's node.
+//
+// Only the labels enabled with --object-name-node-labels are replaced, and
+// the pod and node are only looked up when the objects use one of them. A
+// node without the label fails the mount rather than mounting a different
+// object.
+//
+func (s *CSIDriverProviderServer) expandNodeLabels(ctx context.Context, settings *serverSettings, namespace, podName, objectSpec string) (string, error) {
+
+	values := make(map[string]string)
+	for _, label := range s.nameLabels {
+		if !strings.Contains(objectSpec, "{"+label+"}") {
+			continue
+		}
+		value, err := s.getNodeLabel(ctx, settings, namespace, podName, label)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve node label %s. error %+v", label, err)
+		}
+		if len(value) == 0 {
+			return "", fmt.Errorf("the node of pod %s has no %s label to use in object names", podName, label)
+		}
+		values[label] = value
+	}
+	if len(values) == 0 {
+		return objectSpec, nil
+	}
+	expanded, err := provider.ExpandObjectNames(objectSpec, values)
+	if err != nil {
+		return "", utils.InvalidConfiguration(err)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const zoneLabel = "topology.kubernetes.io/zone"
+
+// Make sure node labels are replaced in object names when enabled.
+func TestNodeLabelObjectNames(t *testing.T) {
+
+	tst := testCase{
+		testName:   "Node Label Object Names",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1-{" + zoneLabel + "}", "objectType": "secretsmanager"},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expSecrets: map[string]string{"TestSecret1-us-west-2a": "secret1"},
+		perms:      "420",
+	}
+
+	// Without the label enabled the placeholder is reported.
+	dir := t.TempDir()
+	svr := newServerWithMocks(&tst, false)
+	_, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "unknown placeholder {"+zoneLabel+"}") {
+		t.Fatalf("Unexpected error without the label enabled: %v", err)
+	}
+
+	// A node without the label fails the mount.
+	svr.nameLabels = []string{zoneLabel}
+	_, err = svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "has no "+zoneLabel+" label") {
+		t.Fatalf("Unexpected error without the node label: %v", err)
+	}
+
+	// The zone of the node is used.
+	node, err := svr.k8sClient.Nodes().Get(context.Background(), "fakeNode", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Can not get node: %v", err)
+	}
+	node.Labels[zoneLabel] = "us-west-2a"
+	if _, err := svr.k8sClient.Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Can not update node: %v", err)
+	}
+	rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	validateMounts(t, dir, tst, rsp)
+	if len(rsp.ObjectVersion) != 1 || rsp.ObjectVersion[0].Id != "TestSecret1-us-west-2a" {
+		t.Fatalf("Expected the zone in the object name, got %v", rsp.ObjectVersion)
+	}
+}
+
+// Make sure only the object names of a specification are expanded.
+func TestExpandNodeLabels(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	spec := "- objectName: db-{" + zoneLabel + "}\n  objectAlias: '{" + zoneLabel + "}'\n"
+	expanded, err := svr.expandNodeLabels(context.Background(), svr.loadSettings(), "fakeNS", "fakePod", spec)
+	if err != nil || expanded != spec {
+		t.Fatalf("Expected the specification unchanged without enabled labels: %q %v", expanded, err)
+	}
+}
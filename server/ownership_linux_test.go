@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Make sure mounted files are given the requested owner.
+func TestFileOwnership(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestFileOwnership")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	// Only root can give files away, others can set their own ids.
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1000, 2000
+	}
+
+	tst := mountTests[0]
+	tst.mountObjs = []map[string]interface{}{
+		{"objectName": "TestSecret1", "objectType": "secretsmanager", "fileOwner": uid, "fileGroup": gid},
+		{"objectName": "TestParm1", "objectType": "ssmparameter"},
+	}
+	svr := newServerWithMocks(&tst, false)
+	if _, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err != nil {
+		t.Fatalf("TestFileOwnership: got unexpected error %s", err.Error())
+	}
+
+	for file, expected := range map[string][2]int{"TestSecret1": {uid, gid}, "TestParm1": {os.Getuid(), os.Getgid()}} {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("TestFileOwnership: got unexpected error %s", err.Error())
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		if int(stat.Uid) != expected[0] || int(stat.Gid) != expected[1] {
+			t.Errorf("TestFileOwnership: expected %s to be owned by %d:%d, got %d:%d", file, expected[0], expected[1], stat.Uid, stat.Gid)
+		}
+	}
+
+	// The driver can not set the owner of the files it writes.
+	svr = newServerWithMocks(&tst, true)
+	_, err = svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "can not be used when the driver writes the secrets") {
+		t.Fatalf("TestFileOwnership: expected an error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+// Extended attributes recording where a written file came from.
+const (
+	xattrVersion = "user.aws.secret.version" // Version id (or parameter version) of the object
+	xattrARN     = "user.aws.secret.arn"     // ARN of the object
+)
+
+// Returned when the file system does not support user extended attributes.
+var errXattrUnsupported = errors.New("extended attributes are not supported")
+
+// Only warn once about file systems without extended attributes.
+var xattrUnsupportedOnce sync.Once
+
+// Private helper to record the origin of a secret in the extended attributes
+// of the file about to replace the mounted file.
+//
+// Lets node level tooling tell which object and version a file holds without
+// asking the provider. Values read back from the mount do not know their ARN,
+// so they keep the ARN of the file they replace. Files without a version (such
+// as rendered templates) are left alone. Failures are only logged since the
+// secret itself was written.
+//
+func setProvenance(tmpPath, mountPath string, secret *provider.SecretValue) {
+
+	if len(secret.Version) == 0 {
+		return
+	}
+	arn := secret.ARN
+	if len(arn) == 0 {
+		arn = getXattr(mountPath, xattrARN)
+	}
+
+	for _, attr := range [][2]string{{xattrVersion, secret.Version}, {xattrARN, arn}} {
+		if len(attr[1]) == 0 {
+			continue
+		}
+		err := setXattr(tmpPath, attr[0], attr[1])
+		if errors.Is(err, errXattrUnsupported) {
+			xattrUnsupportedOnce.Do(func() {
+				klog.Warningf("Can not record file provenance in %s: %v", mountPath, err)
+			})
+			return
+		} else if err != nil {
+			klog.Warningf("Failed to set %s on %s: %v", attr[0], mountPath, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to skip tests where the temp directory does not support user
+// extended attributes.
+func requireXattrs(t *testing.T, dir string) {
+
+	probe := filepath.Join(dir, "probe")
+	if err := os.WriteFile(probe, nil, 0600); err != nil {
+		t.Fatalf("can not write probe file: %v", err)
+	}
+	defer os.Remove(probe)
+	if err := setXattr(probe, xattrVersion, "probe"); err != nil {
+		t.Skipf("extended attributes not available: %v", err)
+	}
+}
+
+func TestFileProvenance(t *testing.T) {
+
+	dir := t.TempDir()
+	requireXattrs(t, dir)
+
+	utils.DefaultFeatureGate.Set("FileProvenanceXattrs=true")
+	defer utils.DefaultFeatureGate.Set("FileProvenanceXattrs=false")
+
+	secretArn := "arn:aws:secretsmanager:fakeRegion:123456789012:secret:TestSecret1-AbC123"
+	parmArn := "arn:aws:ssm:fakeRegion:123456789012:parameter/TestParm1"
+	tst := testCase{
+		testName:   "File Provenance",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager", "jmesPath": []map[string]string{
+				{"path": "username", "objectAlias": "username"},
+			}},
+			{"objectName": "TestParm1", "objectType": "ssmparameter"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(3), ARN: aws.String(parmArn)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"username": "user1"}`), VersionId: aws.String("v1"), ARN: aws.String(secretArn)},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		perms:   "420",
+	}
+
+	svr := newServerWithMocks(&tst, false)
+	_, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestFileProvenance: unexpected error %v", err)
+	}
+
+	for file, expected := range map[string][2]string{
+		"TestSecret1": {"v1", secretArn},
+		"username":    {"v1", secretArn},
+		"TestParm1":   {"3", parmArn},
+	} {
+		path := filepath.Join(dir, file)
+		if version := getXattr(path, xattrVersion); version != expected[0] {
+			t.Errorf("TestFileProvenance: expected version %s on %s but got %s", expected[0], file, version)
+		}
+		if arn := getXattr(path, xattrARN); arn != expected[1] {
+			t.Errorf("TestFileProvenance: expected ARN %s on %s but got %s", expected[1], file, arn)
+		}
+	}
+}
+
+// Make sure values read back from the mount keep the ARN of the file they replace.
+func TestFileProvenanceReload(t *testing.T) {
+
+	dir := t.TempDir()
+	requireXattrs(t, dir)
+
+	mountPath := filepath.Join(dir, "secret")
+	if err := os.WriteFile(mountPath, []byte("old"), 0600); err != nil {
+		t.Fatalf("TestFileProvenanceReload: %v", err)
+	}
+	setXattr(mountPath, xattrARN, "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret-AbC123")
+
+	tmpPath := filepath.Join(dir, "tmp")
+	if err := os.WriteFile(tmpPath, []byte("new"), 0600); err != nil {
+		t.Fatalf("TestFileProvenanceReload: %v", err)
+	}
+	setProvenance(tmpPath, mountPath, &provider.SecretValue{Version: "v2"})
+	if arn := getXattr(tmpPath, xattrARN); arn != "arn:aws:secretsmanager:us-west-2:123456789012:secret:secret-AbC123" {
+		t.Errorf("TestFileProvenanceReload: ARN not carried over, got %s", arn)
+	}
+	if version := getXattr(tmpPath, xattrVersion); version != "v2" {
+		t.Errorf("TestFileProvenanceReload: expected version v2 but got %s", version)
+	}
+
+	// Files without a version are left alone.
+	untagged := filepath.Join(dir, "template")
+	os.WriteFile(untagged, []byte("rendered"), 0600)
+	setProvenance(untagged, mountPath, &provider.SecretValue{})
+	if arn := getXattr(untagged, xattrARN); len(arn) != 0 {
+		t.Errorf("TestFileProvenanceReload: unexpected ARN %s on template", arn)
+	}
+}
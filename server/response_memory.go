@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+// Private limit on the memory held by mount responses in flight.
+//
+// When the driver writes the secrets every response carries the contents of
+// all the files of the mount, and gRPC marshals it into a second copy before
+// sending it. A burst of very large mounts could hold many copies at once and
+// get the provider OOM killed, failing every mount on the node. Each mount
+// reserves an estimate of its response before fetching anything, so a burst
+// of mounts waits (until the request deadline) instead of holding all their
+// secrets at once. The reservation is then changed to the size of the actual
+// response and given back once gRPC has sent it.
+//
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	freed chan struct{} // Closed (and replaced) whenever memory is given back
+}
+
+// Estimated bytes of each file of a response, reserved before the secrets are
+// fetched. Most secrets are well under the 4KB limit of standard parameters.
+const estimatedFileSize = 4096
+
+// Private helper to create a budget of the given bytes (nil for no limit).
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// Private helper to reserve memory for a response, waiting until it is
+// available or the request deadline expires. The returned function gives
+// the memory back and may be called more than once.
+func (b *memoryBudget) acquire(ctx context.Context, size int64) (release func(), err error) {
+
+	if b == nil { // No limit
+		return func() {}, nil
+	}
+	if err := b.take(ctx, size); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(func() { b.release(size) }) }, nil
+}
+
+// Private helper to wait for memory to be available and take it.
+func (b *memoryBudget) take(ctx context.Context, size int64) error {
+
+	if size > b.limit {
+		return fmt.Errorf("mount response of %d bytes exceeds the response memory limit of %d bytes", size, b.limit)
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used+size <= b.limit {
+			b.used += size
+			b.mu.Unlock()
+			return nil
+		}
+		freed, used := b.freed, b.used
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %d bytes of response memory (%d of %d bytes in use): %w", size, used, b.limit, ctx.Err())
+		}
+	}
+}
+
+// Private helper to give memory back and wake up the waiting responses.
+func (b *memoryBudget) release(size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= size
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// Private memory reserved for the response of one mount.
+type responseReservation struct {
+	budget *memoryBudget // Where the memory is reserved (nil for no limit)
+	size   int64         // Bytes reserved
+	held   bool          // Handed over to the stats handler, which gives it back
+	once   sync.Once
+}
+
+// Private helper to reserve an estimate of the response of a mount before
+// fetching its secrets. Nothing is reserved when the response carries no
+// files, and the estimate never exceeds the limit so it never fails a mount
+// by itself.
+func (s *CSIDriverProviderServer) reserveEstimate(
+	ctx context.Context,
+	descriptors map[provider.SecretType][]*provider.SecretDescriptor,
+	templates int,
+) (*responseReservation, error) {
+
+	r := &responseReservation{budget: s.responseMemory}
+	if r.budget == nil || (!s.driverWriteSecrets && !isFetchOnly(ctx)) {
+		return r, nil
+	}
+	files := int64(templates)
+	for _, group := range descriptors {
+		for _, descriptor := range group {
+			files += int64(1 + len(descriptor.JMESPath))
+		}
+	}
+	size := files * estimatedFileSize
+	if size > r.budget.limit {
+		size = r.budget.limit
+	}
+	if err := r.budget.take(ctx, size); err != nil {
+		return nil, err
+	}
+	r.size = size
+	return r, nil
+}
+
+// Private helper to change the reservation to the size of the actual
+// response and hold it until the response is sent.
+func (s *CSIDriverProviderServer) reserveResponse(ctx context.Context, r *responseReservation, rsp *v1alpha1.MountResponse) error {
+
+	var size int64
+	if len(rsp.Files) > 0 { // Only versions, nothing large.
+		size = int64(proto.Size(rsp))
+	}
+	if err := r.resize(ctx, size); err != nil {
+		return err
+	}
+	r.held = holdUntilSent(ctx, r.release)
+	return nil
+}
+
+// Private helper to change the size of a reservation. A reservation that
+// grows gives back its estimate before waiting for the full size, so mounts
+// waiting to grow never hold memory another one needs.
+func (r *responseReservation) resize(ctx context.Context, size int64) error {
+
+	if r.budget == nil || size == r.size {
+		return nil
+	}
+	if size < r.size {
+		r.budget.release(r.size - size)
+		r.size = size
+		return nil
+	}
+	r.budget.release(r.size)
+	r.size = 0
+	if err := r.budget.take(ctx, size); err != nil {
+		return err
+	}
+	r.size = size
+	return nil
+}
+
+// Private helper to give back the reservation, once.
+func (r *responseReservation) release() {
+	r.once.Do(func() {
+		if r.budget != nil && r.size > 0 {
+			r.budget.release(r.size)
+		}
+	})
+}
+
+// Private helper to give back the reservation at the end of a mount unless it
+// was handed over to the stats handler.
+func (r *responseReservation) done() {
+	if !r.held {
+		r.release()
+	}
+}
+
+// Private context key holding the memory reservation of a request.
+type reservationKey struct{}
+
+// Private holder of the function giving back the memory of a response.
+type reservation struct {
+	mu      sync.Mutex
+	release func()
+}
+
+// Private helper to hand the memory of a response over to the stats handler,
+// which gives it back once the response is sent. Returns false (and the
+// caller must give it back) when the handler is not installed.
+func holdUntilSent(ctx context.Context, release func()) bool {
+
+	held, ok := ctx.Value(reservationKey{}).(*reservation)
+	if !ok {
+		return false
+	}
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	held.release = release
+	return true
+}
+
+// Returns a gRPC stats handler that gives back the response memory of each
+// request once its response is sent, to install with grpc.StatsHandler.
+//
+// Without it the memory of a response is given back when the mount returns,
+// so the limit only covers mounts while they fetch and build their response.
+//
+func ResponseMemoryHandler() stats.Handler {
+	return responseMemoryHandler{}
+}
+
+// Private stats handler releasing response memory at the end of each request.
+type responseMemoryHandler struct{}
+
+func (responseMemoryHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, reservationKey{}, &reservation{})
+}
+
+func (responseMemoryHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+
+	if _, ok := s.(*stats.End); !ok {
+		return
+	}
+	if held, ok := ctx.Value(reservationKey{}).(*reservation); ok {
+		held.mu.Lock()
+		defer held.mu.Unlock()
+		if held.release != nil {
+			held.release()
+		}
+	}
+}
+
+func (responseMemoryHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (responseMemoryHandler) HandleConn(ctx context.Context, s stats.ConnStats) {}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/stats"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+func TestMemoryBudget(t *testing.T) {
+
+	if release, err := newMemoryBudget(0).acquire(context.Background(), 1<<30); err != nil || release == nil {
+		t.Fatalf("Expected no limit, got %v", err)
+	}
+
+	budget := newMemoryBudget(100)
+	if _, err := budget.acquire(context.Background(), 101); err == nil || !strings.Contains(err.Error(), "exceeds the response memory limit") {
+		t.Fatalf("Expected an oversized response to fail, got %v", err)
+	}
+
+	release, err := budget.acquire(context.Background(), 60)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A response that does not fit times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := budget.acquire(ctx, 50); err == nil || !strings.Contains(err.Error(), "60 of 100 bytes in use") {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	// A response that does not fit waits for memory to be given back.
+	acquired := make(chan error)
+	go func() {
+		_, err := budget.acquire(context.Background(), 50)
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("Expected to wait, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	release() // No effect
+	if err := <-acquired; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if budget.used != 50 {
+		t.Fatalf("Expected 50 bytes in use, got %d", budget.used)
+	}
+
+	// Reservations shrink right away and grow by waiting for the full size.
+	r := &responseReservation{budget: budget, size: 50}
+	if err := r.resize(context.Background(), 20); err != nil || budget.used != 20 {
+		t.Fatalf("Expected 20 bytes in use, got %d: %v", budget.used, err)
+	}
+	if err := r.resize(context.Background(), 100); err != nil || budget.used != 100 {
+		t.Fatalf("Expected 100 bytes in use, got %d: %v", budget.used, err)
+	}
+	r.done()
+	r.done() // No effect
+	if budget.used != 0 {
+		t.Fatalf("Expected the reservation to be given back, got %d bytes", budget.used)
+	}
+}
+
+// Make sure the estimate of a response is reserved before fetching.
+func TestReserveEstimate(t *testing.T) {
+
+	svr := newServerWithMocks(nil, true)
+	svr.responseMemory = newMemoryBudget(3 * estimatedFileSize)
+	descriptors, err := provider.NewSecretDescriptorList("/tmp", "", "", `
+        - objectName: secret1
+          objectType: secretsmanager
+          jmesPath:
+            - path: username
+              objectAlias: user`, []string{"us-west-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r, err := svr.reserveEstimate(context.Background(), descriptors, 0)
+	if err != nil || svr.responseMemory.used != 2*estimatedFileSize {
+		t.Fatalf("Expected two files to be reserved, got %d bytes: %v", svr.responseMemory.used, err)
+	}
+
+	// Estimates are capped at the limit, and wait for the memory.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := svr.reserveEstimate(ctx, descriptors, 5); err == nil || !strings.Contains(err.Error(), "timed out waiting") {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	r.done()
+	if r, err = svr.reserveEstimate(context.Background(), descriptors, 5); err != nil || svr.responseMemory.used != 3*estimatedFileSize {
+		t.Fatalf("Expected the limit to be reserved, got %d bytes: %v", svr.responseMemory.used, err)
+	}
+	r.done()
+
+	// Nothing is reserved when the driver does not write the secrets.
+	svr.driverWriteSecrets = false
+	if r, err = svr.reserveEstimate(context.Background(), descriptors, 0); err != nil || svr.responseMemory.used != 0 {
+		t.Fatalf("Expected nothing to be reserved, got %d bytes: %v", svr.responseMemory.used, err)
+	}
+}
+
+// Make sure the memory of a response is held until the request ends.
+func TestResponseMemoryHandler(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestResponseMemoryHandler")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, true)
+	svr.responseMemory = newMemoryBudget(1 << 20)
+
+	handler := ResponseMemoryHandler()
+	ctx := handler.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/v1alpha1.CSIDriverProvider/Mount"})
+	rsp, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rsp.Files) == 0 || svr.responseMemory.used == 0 {
+		t.Fatalf("Expected the response memory to be held, got %d bytes", svr.responseMemory.used)
+	}
+	handler.HandleRPC(ctx, &stats.OutPayload{})
+	if svr.responseMemory.used == 0 {
+		t.Fatalf("Expected the response memory to be held until the end")
+	}
+	handler.HandleRPC(ctx, &stats.End{})
+	if svr.responseMemory.used != 0 {
+		t.Fatalf("Expected the response memory to be given back, got %d bytes", svr.responseMemory.used)
+	}
+
+	// Responses larger than the limit fail.
+	svr.responseMemory = newMemoryBudget(1)
+	if _, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err == nil {
+		t.Fatalf("Expected the mount to fail")
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Settings that can be changed without restarting the provider.
+//
+// The settings are read from a YAML (or JSON) configuration file, usually a
+// mounted ConfigMap, which is checked for changes periodically. Settings left
+// out of the file keep the value of the matching command line flag, so
+// removing a setting reverts it. The caches can only be tuned when they were
+// enabled on the command line.
+//
+type RuntimeConfig struct {
+	QPS                 float32         `json:"qps"`                 // See --qps
+	Burst               int             `json:"burst"`               // See --burst
+	MaxConcurrentMounts int             `json:"maxConcurrentMounts"` // See --max-concurrent-mounts
+	SecretCacheTTL      metav1.Duration `json:"secretCacheTTL"`      // See --secret-cache-ttl
+	LookupCacheTTL      metav1.Duration `json:"k8sLookupCacheTTL"`   // See --k8s-lookup-cache-ttl
+
+	// Failover regions of SecretProviderClasses without one (nil for none)
+	DefaultFailoverRegions *FailoverRegionDefaults `json:"defaultFailoverRegions,omitempty"`
+}
+
+// Load the runtime configuration from a file.
+//
+// Settings not in the file are taken from the defaults (the command line
+// flags). A missing file (such as an optional ConfigMap that does not exist)
+// gives the defaults. Unknown settings are rejected so typos are not ignored.
+//
+func LoadRuntimeConfig(path string, defaults RuntimeConfig) (RuntimeConfig, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return defaults, nil
+	}
+	if err != nil {
+		return defaults, err
+	}
+	return parseRuntimeConfig(data, defaults)
+}
+
+// Private helper to parse and validate the runtime configuration.
+func parseRuntimeConfig(data []byte, defaults RuntimeConfig) (RuntimeConfig, error) {
+
+	cfg := defaults
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return defaults, fmt.Errorf("invalid runtime configuration: %w", err)
+	}
+
+	switch {
+	case cfg.QPS <= 0:
+		return defaults, fmt.Errorf("qps must be positive: %v", cfg.QPS)
+	case cfg.Burst < 1:
+		return defaults, fmt.Errorf("burst must be at least 1: %d", cfg.Burst)
+	case cfg.MaxConcurrentMounts < 0:
+		return defaults, fmt.Errorf("maxConcurrentMounts can not be negative: %d", cfg.MaxConcurrentMounts)
+	case cfg.SecretCacheTTL.Duration < 0 || cfg.LookupCacheTTL.Duration < 0:
+		return defaults, fmt.Errorf("cache TTLs can not be negative")
+	}
+	if err := cfg.DefaultFailoverRegions.validate(); err != nil {
+		return defaults, err
+	}
+	return cfg, nil
+}
+
+// Watch the runtime configuration file and apply every change until the
+// context is cancelled.
+//
+// The file is read every interval (ConfigMap updates replace the file through
+// a symbolic link, which is easier to catch by reading than by file events).
+// Invalid configurations are logged and ignored, keeping the settings in use.
+//
+func WatchRuntimeConfig(ctx context.Context, path string, interval time.Duration, defaults RuntimeConfig, apply func(RuntimeConfig)) {
+
+	var last []byte
+	applied := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			data, err = []byte{}, nil // Back to the defaults.
+		}
+		if err != nil {
+			utils.Errorf("Failed to read the runtime configuration %s: %v", path, err)
+		} else if !applied || !bytes.Equal(data, last) {
+			last, applied = data, true
+			cfg, err := parseRuntimeConfig(data, defaults)
+			if err != nil {
+				utils.Errorf("Ignoring the runtime configuration %s: %v", path, err)
+			} else {
+				klog.Infof("Applying the runtime configuration %s: %+v", path, cfg)
+				apply(cfg)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Private settings of the server that can be changed without a restart.
+//
+// The settings are never changed in place: a reload builds new settings and
+// swaps them in, and each mount reads them once when it starts.
+//
+type serverSettings struct {
+	mountSlots       chan struct{}           // Limits concurrent mounts (nil for no limit)
+	lookupTTL        time.Duration           // How long pod and node lookups are cached
+	failoverDefaults *FailoverRegionDefaults // Failover regions of SecretProviderClasses without one (nil for none)
+}
+
+// Private factory to build the server settings. The mount slots of the
+// previous settings (if any) are kept when the limit does not change, so
+// mounts in progress still count against it.
+func newServerSettings(prev *serverSettings, maxConcurrentMounts int, lookupTTL time.Duration, defaults *FailoverRegionDefaults) *serverSettings {
+
+	settings := &serverSettings{lookupTTL: lookupTTL, failoverDefaults: defaults}
+	if prev != nil && prev.mountSlots != nil && cap(prev.mountSlots) == maxConcurrentMounts {
+		settings.mountSlots = prev.mountSlots
+	} else if maxConcurrentMounts > 0 {
+		settings.mountSlots = make(chan struct{}, maxConcurrentMounts)
+	}
+	return settings
+}
+
+// Private helper to get the settings in use.
+func (s *CSIDriverProviderServer) loadSettings() *serverSettings {
+
+	if settings := s.settings.Load(); settings != nil {
+		return settings
+	}
+	return &serverSettings{} // Server not made by NewServer (tests)
+}
+
+// Apply the server settings of a runtime configuration: the maximum number of
+// concurrent mounts, how long pod and node lookups are cached, and the default
+// failover regions.
+//
+// Mounts in progress keep the settings they started with (including their
+// mount slots), so for a short time after the limit is lowered more mounts
+// than the new limit may be running. The lookup cache can not be enabled when
+// it was disabled at startup. The QPS, burst, and secret cache TTL belong to
+// the rate limiter and secret cache, which are changed separately.
+//
+func (s *CSIDriverProviderServer) ApplyRuntimeConfig(rc RuntimeConfig) {
+
+	if s.lookups == nil && rc.LookupCacheTTL.Duration > 0 {
+		utils.Warningf("Ignoring k8sLookupCacheTTL since the lookup cache was disabled by --k8s-lookup-cache-ttl")
+	}
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.settings.Store(newServerSettings(s.settings.Load(), rc.MaxConcurrentMounts, rc.LookupCacheTTL.Duration, rc.DefaultFailoverRegions))
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var runtimeDefaults = RuntimeConfig{
+	QPS:                 5,
+	Burst:               10,
+	MaxConcurrentMounts: 0,
+	LookupCacheTTL:      metav1.Duration{Duration: 30 * time.Second},
+}
+
+func TestParseRuntimeConfig(t *testing.T) {
+
+	cfg, err := parseRuntimeConfig([]byte("qps: 20\nmaxConcurrentMounts: 4\nsecretCacheTTL: 1m\n"), runtimeDefaults)
+	if err != nil {
+		t.Fatalf("TestParseRuntimeConfig: unexpected error %v", err)
+	}
+	exp := runtimeDefaults
+	exp.QPS = 20
+	exp.MaxConcurrentMounts = 4
+	exp.SecretCacheTTL.Duration = time.Minute
+	if cfg != exp {
+		t.Fatalf("TestParseRuntimeConfig: expected %+v got %+v", exp, cfg)
+	}
+
+	// Empty files give the defaults.
+	if cfg, err = parseRuntimeConfig([]byte{}, runtimeDefaults); err != nil || cfg != runtimeDefaults {
+		t.Fatalf("TestParseRuntimeConfig: expected defaults but got %+v %v", cfg, err)
+	}
+
+	for _, bad := range []string{
+		"qsp: 20",
+		"qps: 0",
+		"burst: 0",
+		"maxConcurrentMounts: -1",
+		"secretCacheTTL: -1s",
+		"k8sLookupCacheTTL: soon",
+		"qps: [",
+		"defaultFailoverRegions: {namespaces: {team-a: ''}}",
+		"defaultFailoverRegions: {nodeLabels: [{value: dr, failoverRegion: us-east-2}]}",
+		"defaultFailoverRegions: {nodeLabels: [{label: tier, value: dr, failoverRegion: 'us-east-2,'}]}",
+	} {
+		if _, err := parseRuntimeConfig([]byte(bad), runtimeDefaults); err == nil {
+			t.Errorf("TestParseRuntimeConfig: expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseDefaultFailoverRegions(t *testing.T) {
+
+	cfg, err := parseRuntimeConfig([]byte(`
+defaultFailoverRegions:
+  namespaces:
+    team-a: us-west-2
+  nodeLabels:
+  - label: topology.kubernetes.io/region
+    value: us-east-1
+    failoverRegion: us-east-2
+`), runtimeDefaults)
+	if err != nil {
+		t.Fatalf("TestParseDefaultFailoverRegions: unexpected error %v", err)
+	}
+	defaults := cfg.DefaultFailoverRegions
+	if defaults == nil || defaults.Namespaces["team-a"] != "us-west-2" || len(defaults.NodeLabels) != 1 ||
+		defaults.NodeLabels[0] != (NodeLabelFailover{Label: regionLabel, Value: "us-east-1", FailoverRegion: "us-east-2"}) {
+		t.Fatalf("TestParseDefaultFailoverRegions: unexpected defaults %+v", defaults)
+	}
+}
+
+func TestLoadRuntimeConfigMissing(t *testing.T) {
+
+	cfg, err := LoadRuntimeConfig("/nonexistent/config.yaml", runtimeDefaults)
+	if err != nil || cfg != runtimeDefaults {
+		t.Fatalf("TestLoadRuntimeConfigMissing: expected defaults but got %+v %v", cfg, err)
+	}
+}
+
+func TestWatchRuntimeConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestWatchRuntimeConfig")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	path := filepath.Join(dir, "config.yaml")
+	applied := make(chan RuntimeConfig, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchRuntimeConfig(ctx, path, 10*time.Millisecond, runtimeDefaults, func(cfg RuntimeConfig) { applied <- cfg })
+
+	next := func() RuntimeConfig {
+		select {
+		case cfg := <-applied:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestWatchRuntimeConfig: configuration not applied")
+		}
+		return RuntimeConfig{}
+	}
+
+	// The defaults are applied while there is no file.
+	if cfg := next(); cfg != runtimeDefaults {
+		t.Fatalf("TestWatchRuntimeConfig: expected defaults but got %+v", cfg)
+	}
+
+	// Replace the file like a ConfigMap update so partial writes are not read.
+	write := func(data string) {
+		ioutil.WriteFile(path+".tmp", []byte(data), 0644)
+		os.Rename(path+".tmp", path)
+	}
+
+	// Invalid changes are ignored, valid ones are applied once.
+	write("burst: 0")
+	time.Sleep(50 * time.Millisecond)
+	write("burst: 50")
+	if cfg := next(); cfg.Burst != 50 {
+		t.Fatalf("TestWatchRuntimeConfig: expected burst 50 but got %+v", cfg)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(applied) != 0 {
+		t.Fatalf("TestWatchRuntimeConfig: unchanged configuration applied again")
+	}
+
+	// Removing the file reverts to the defaults.
+	os.Remove(path)
+	if cfg := next(); cfg != runtimeDefaults {
+		t.Fatalf("TestWatchRuntimeConfig: expected defaults after removal but got %+v", cfg)
+	}
+}
+
+func TestApplyRuntimeConfig(t *testing.T) {
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+
+	svr.ApplyRuntimeConfig(RuntimeConfig{MaxConcurrentMounts: 1})
+	first := svr.loadSettings()
+	release, err := svr.acquireMountSlot(context.Background(), first)
+	if err != nil {
+		t.Fatalf("TestApplyRuntimeConfig: unexpected error %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := svr.acquireMountSlot(ctx, svr.loadSettings()); err == nil {
+		t.Fatalf("TestApplyRuntimeConfig: expected the second mount to wait")
+	}
+
+	// Unrelated changes keep the slots in use.
+	defaults := &FailoverRegionDefaults{Namespaces: map[string]string{"ns": "us-east-1"}}
+	svr.ApplyRuntimeConfig(RuntimeConfig{MaxConcurrentMounts: 1, LookupCacheTTL: metav1.Duration{Duration: time.Minute}, DefaultFailoverRegions: defaults})
+	second := svr.loadSettings()
+	if second == first || second.mountSlots != first.mountSlots || second.lookupTTL != time.Minute || second.failoverDefaults != defaults {
+		t.Fatalf("TestApplyRuntimeConfig: unexpected settings %+v", second)
+	}
+	if first.lookupTTL != 0 || first.failoverDefaults != nil {
+		t.Fatalf("TestApplyRuntimeConfig: settings in use were changed %+v", first)
+	}
+
+	// Raising the limit lets new mounts in while the old slot is released.
+	svr.ApplyRuntimeConfig(RuntimeConfig{MaxConcurrentMounts: 2})
+	release2, err := svr.acquireMountSlot(context.Background(), svr.loadSettings())
+	if err != nil {
+		t.Fatalf("TestApplyRuntimeConfig: unexpected error after raising the limit %v", err)
+	}
+	release()
+	release2()
+
+	svr.ApplyRuntimeConfig(RuntimeConfig{})
+	if svr.loadSettings().mountSlots != nil {
+		t.Fatalf("TestApplyRuntimeConfig: expected no limit")
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Label marking the Kubernetes Secrets the provider created (and so may update).
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// Private helper to check the name of the Kubernetes Secret to sync into.
+func validateSyncSecretName(name string) error {
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("invalid %s %s: %s", syncSecretAttrib, name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Private helper to copy the mounted values into a Kubernetes Secret in the
+// namespace of the pod.
+//
+// This lets workloads that need the values in environment variables use them
+// without the driver's secretObjects sync. The Secret holds one key for each
+// file of the mount (with the same name and content). The provider only
+// updates Secrets it created, which it labels as managed by the provider, and
+// each pod mounting the volume is added as an owner so the Secret is garbage
+// collected once all of them are gone (owners that no longer exist are
+// dropped on each sync). Failures are logged and recorded as
+// pod events but do not fail the mount, since the files are already written.
+//
+func (s *CSIDriverProviderServer) syncKubernetesSecret(
+	ctx context.Context,
+	nameSpace, podName, podUID, secretName string,
+	secrets []*provider.SecretValue,
+) {
+
+	if !utils.DefaultFeatureGate.Enabled(utils.KubernetesSecretSync) {
+		msg := fmt.Sprintf("%s %s is ignored since the %s feature gate is off", syncSecretAttrib, secretName, utils.KubernetesSecretSync)
+		utils.Warningf("%s for pod %s in namespace %s", msg, podName, nameSpace)
+		s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, secretSyncReason, msg)
+		return
+	}
+
+	err := s.writeKubernetesSecret(ctx, nameSpace, podName, podUID, secretName, secrets)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to sync secret %s: %v", secretName, err)
+		utils.Errorf("%s for pod %s in namespace %s", msg, podName, nameSpace)
+		s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, secretSyncReason, msg)
+		return
+	}
+	klog.Infof("Synced secret %s for pod %s in namespace %s", secretName, podName, nameSpace)
+}
+
+// Private helper to create or update the Kubernetes Secret.
+//
+// Replicas of a workload mount at the same time, so updates are retried when
+// another mount changed the Secret first.
+//
+func (s *CSIDriverProviderServer) writeKubernetesSecret(
+	ctx context.Context,
+	nameSpace, podName, podUID, secretName string,
+	secrets []*provider.SecretValue,
+) error {
+
+	data := make(map[string][]byte)
+	for _, secret := range secrets {
+		if !secret.Descriptor.GetWriteParent() {
+			continue // Not mounted, so not synced either.
+		}
+		key := secret.Descriptor.GetFileName()
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("%s is not a valid secret key (use pathTranslation to replace slashes): %s", key, strings.Join(errs, ", "))
+		}
+		data[key] = secret.Value
+	}
+
+	var owner *metav1.OwnerReference
+	if len(podUID) > 0 {
+		owner = &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: podName, UID: types.UID(podUID)}
+	}
+
+	client := s.k8sClient.Secrets(nameSpace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+
+		existing, err := client.Get(ctx, secretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			created := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      secretName,
+					Namespace: nameSpace,
+					Labels:    map[string]string{managedByLabel: auth.ProviderName},
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: data,
+			}
+			if owner != nil {
+				created.OwnerReferences = []metav1.OwnerReference{*owner}
+			}
+			_, err = client.Create(ctx, created, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) { // Another replica won the race.
+				return apierrors.NewConflict(corev1.Resource("secrets"), secretName, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if existing.Labels[managedByLabel] != auth.ProviderName {
+			return fmt.Errorf("secret exists and is not managed by %s (missing label %s=%s)", auth.ProviderName, managedByLabel, auth.ProviderName)
+		}
+		existing.Data = data
+		existing.OwnerReferences = s.prunePodOwners(ctx, nameSpace, existing.OwnerReferences, owner)
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Private helper to drop the owner references of pods that no longer exist and
+// add the mounting pod (if not yet an owner).
+//
+// Workloads that roll their pods would otherwise grow the owners of the Secret
+// without bound. A pod recreated under the same name has a new UID, so its old
+// reference is dropped too. References that can not be checked are kept.
+//
+func (s *CSIDriverProviderServer) prunePodOwners(
+	ctx context.Context,
+	nameSpace string,
+	owners []metav1.OwnerReference,
+	current *metav1.OwnerReference,
+) []metav1.OwnerReference {
+
+	kept := make([]metav1.OwnerReference, 0, len(owners)+1)
+	for _, ref := range owners {
+		if ref.Kind == "Pod" && (current == nil || ref.UID != current.UID) {
+			pod, err := s.k8sClient.Pods(nameSpace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && pod.UID != ref.UID) {
+				klog.V(2).Infof("Dropping owner pod %s (%s) of synced secret in namespace %s since it no longer exists", ref.Name, ref.UID, nameSpace)
+				continue
+			}
+		}
+		kept = append(kept, ref)
+	}
+	if current != nil && !hasOwner(kept, current.UID) {
+		kept = append(kept, *current)
+	}
+	return kept
+}
+
+// Private helper to check if an object is owned by the given UID.
+func hasOwner(owners []metav1.OwnerReference, uid types.UID) bool {
+
+	for _, owner := range owners {
+		if owner.UID == uid {
+			return true
+		}
+	}
+	return false
+}
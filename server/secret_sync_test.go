@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to build a mount request syncing into a Kubernetes Secret.
+func buildSyncMountReq(dir string, tst testCase, secretName, podUID string) *v1alpha1.MountRequest {
+
+	req := buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})
+	var attrib map[string]string
+	json.Unmarshal([]byte(req.Attributes), &attrib)
+	attrib[syncSecretAttrib] = secretName
+	attrib[podUIDAttrib] = podUID
+	attr, _ := json.Marshal(attrib)
+	req.Attributes = string(attr)
+	return req
+}
+
+// Make sure the mounted values are copied into the Kubernetes Secret.
+func TestSyncKubernetesSecret(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestSyncKubernetesSecret")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	utils.DefaultFeatureGate.Set("KubernetesSecretSync=true")
+	defer utils.DefaultFeatureGate.Set("KubernetesSecretSync=false")
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+	pods := svr.k8sClient.Pods("fakeNS")
+	template, _ := pods.Get(ctx, "fakePod", metav1.GetOptions{})
+	mount := func(podName, uid string) {
+		if _, err := pods.Get(ctx, podName, metav1.GetOptions{}); err != nil {
+			pod := template.DeepCopy()
+			pod.Name, pod.UID = podName, types.UID(uid)
+			pods.Create(ctx, pod, metav1.CreateOptions{})
+		}
+		req := buildSyncMountReq(dir, tst, "app-secrets", uid)
+		var attrib map[string]string
+		json.Unmarshal([]byte(req.Attributes), &attrib)
+		attrib[podnameAttrib] = podName
+		attr, _ := json.Marshal(attrib)
+		req.Attributes = string(attr)
+		if _, err := svr.Mount(ctx, req); err != nil {
+			t.Fatalf("TestSyncKubernetesSecret: got unexpected error %s", err.Error())
+		}
+	}
+	mount("pod1", "uid1")
+	mount("pod2", "uid2")
+	mount("pod1", "uid1")
+
+	secret, err := svr.k8sClient.Secrets("fakeNS").Get(ctx, "app-secrets", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("TestSyncKubernetesSecret: got unexpected error %s", err.Error())
+	}
+	if len(secret.Data) != len(tst.expSecrets) {
+		t.Errorf("TestSyncKubernetesSecret: unexpected data %v", secret.Data)
+	}
+	for key, value := range tst.expSecrets {
+		if string(secret.Data[key]) != value {
+			t.Errorf("TestSyncKubernetesSecret: expected %s for %s but got %s", value, key, secret.Data[key])
+		}
+	}
+	if secret.Labels[managedByLabel] != auth.ProviderName {
+		t.Errorf("TestSyncKubernetesSecret: unexpected labels %v", secret.Labels)
+	}
+	if len(secret.OwnerReferences) != 2 || secret.OwnerReferences[0].UID != "uid1" || secret.OwnerReferences[1].UID != "uid2" {
+		t.Errorf("TestSyncKubernetesSecret: unexpected owners %v", secret.OwnerReferences)
+	}
+
+	// Owners that are gone (or were recreated) are dropped.
+	pods.Delete(ctx, "pod1", metav1.DeleteOptions{})
+	pods.Delete(ctx, "pod2", metav1.DeleteOptions{})
+	mount("pod2", "uid4")
+	mount("pod3", "uid3")
+	secret, _ = svr.k8sClient.Secrets("fakeNS").Get(ctx, "app-secrets", metav1.GetOptions{})
+	if len(secret.OwnerReferences) != 2 || secret.OwnerReferences[0].UID != "uid4" || secret.OwnerReferences[1].UID != "uid3" {
+		t.Errorf("TestSyncKubernetesSecret: unexpected owners after pods were replaced %v", secret.OwnerReferences)
+	}
+}
+
+// Make sure Secrets the provider did not create are left alone.
+func TestSyncKubernetesSecretUnmanaged(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestSyncKubernetesSecretUnmanaged")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	utils.DefaultFeatureGate.Set("KubernetesSecretSync=true")
+	defer utils.DefaultFeatureGate.Set("KubernetesSecretSync=false")
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+	svr.k8sClient.Secrets("fakeNS").Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "fakeNS"},
+		Data:       map[string][]byte{"key": []byte("value")},
+	}, metav1.CreateOptions{})
+
+	// The mount still succeeds.
+	_, err = svr.Mount(ctx, buildSyncMountReq(dir, tst, "other", "uid1"))
+	if err != nil {
+		t.Fatalf("TestSyncKubernetesSecretUnmanaged: got unexpected error %s", err.Error())
+	}
+
+	secret, _ := svr.k8sClient.Secrets("fakeNS").Get(ctx, "other", metav1.GetOptions{})
+	if len(secret.Data) != 1 || string(secret.Data["key"]) != "value" {
+		t.Errorf("TestSyncKubernetesSecretUnmanaged: secret was changed: %v", secret.Data)
+	}
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != secretSyncReason || !strings.Contains(events.Items[0].Message, "not managed by") {
+		t.Errorf("TestSyncKubernetesSecretUnmanaged: unexpected events %+v", events.Items)
+	}
+}
+
+// Make sure nothing is synced unless the feature gate is on.
+func TestSyncKubernetesSecretDisabled(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestSyncKubernetesSecretDisabled")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+	_, err = svr.Mount(ctx, buildSyncMountReq(dir, tst, "app-secrets", "uid1"))
+	if err != nil {
+		t.Fatalf("TestSyncKubernetesSecretDisabled: got unexpected error %s", err.Error())
+	}
+
+	if _, err := svr.k8sClient.Secrets("fakeNS").Get(ctx, "app-secrets", metav1.GetOptions{}); err == nil {
+		t.Errorf("TestSyncKubernetesSecretDisabled: secret should not exist")
+	}
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || !strings.Contains(events.Items[0].Message, "feature gate is off") {
+		t.Errorf("TestSyncKubernetesSecretDisabled: unexpected events %+v", events.Items)
+	}
+
+	// Bad names fail the mount.
+	_, err = svr.Mount(ctx, buildSyncMountReq(dir, tst, "Bad_Name", "uid1"))
+	if st, _ := status.FromError(err); st.Code() != codes.InvalidArgument {
+		t.Errorf("TestSyncKubernetesSecretDisabled: expected InvalidArgument but got %v", err)
+	}
+}
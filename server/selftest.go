@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"k8s.io/client-go/discovery"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
+)
+
+const (
+	CheckPass = "PASS" // The prerequisite is met
+	CheckWarn = "WARN" // The prerequisite is only needed by some configurations
+	CheckFail = "FAIL" // Mounts will fail on this node
+
+	selfTestTimeout = 5 * time.Second // Time allowed for each network check
+	maxClockSkew    = 5 * time.Minute // SigV4 rejects requests signed further off than this
+	warnClockSkew   = time.Minute
+	imdsEndpoint    = "http://169.254.169.254"
+	podIdentityURI  = "http://169.254.170.23/v1/credentials"
+)
+
+// Result of one self test check.
+type CheckResult struct {
+	Name   string `json:"name"`   // What was checked
+	Status string `json:"status"` // One of CheckPass, CheckWarn, or CheckFail
+	Detail string `json:"detail"` // Why the check passed or failed
+}
+
+// Everything the self test needs to know about the node.
+//
+// A nil K8sClient (for example when there is no in-cluster configuration) is
+// reported as a failure using K8sError. The endpoints default to the instance
+// metadata service and Pod Identity agent addresses when empty.
+//
+type SelfTestConfig struct {
+	SocketDir           string
+	K8sClient           discovery.ServerVersionInterface
+	K8sError            error
+	STSClient           stsiface.STSAPI
+	IMDSEndpoint        string
+	PodIdentityEndpoint string
+}
+
+// Run the node prerequisite checks and write a report.
+//
+// Checks that the provider socket directory is writable, the Kubernetes API is
+// reachable, the instance metadata service and Pod Identity agent can be
+// reached, STS can be called, and the node clock is close to the STS clock.
+// Returns false if any check failed, so the self test can gate an init
+// container. Warnings do not fail the self test.
+//
+func RunSelfTest(ctx context.Context, w io.Writer, cfg SelfTestConfig) bool {
+
+	if len(cfg.IMDSEndpoint) == 0 {
+		cfg.IMDSEndpoint = imdsEndpoint
+	}
+	if len(cfg.PodIdentityEndpoint) == 0 {
+		cfg.PodIdentityEndpoint = podIdentityURI
+	}
+
+	results := []CheckResult{
+		checkSocketDir(cfg.SocketDir),
+		checkK8sAPI(cfg.K8sClient, cfg.K8sError),
+		checkEndpoint(ctx, "Instance metadata service", cfg.IMDSEndpoint),
+		checkEndpoint(ctx, "Pod Identity agent", cfg.PodIdentityEndpoint),
+	}
+	results = append(results, checkSTS(ctx, cfg.STSClient)...)
+
+	passed := true
+	fmt.Fprintf(w, "%s self test (version %s)\n", auth.ProviderName, version.Current())
+	for _, result := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", result.Status, result.Name, result.Detail)
+		if result.Status == CheckFail {
+			passed = false
+		}
+	}
+	if passed {
+		fmt.Fprintln(w, "Self test passed")
+	} else {
+		fmt.Fprintln(w, "Self test failed")
+	}
+	return passed
+}
+
+// Private helper to check the driver can find the provider socket.
+func checkSocketDir(dir string) CheckResult {
+
+	name := "Provider socket directory"
+	f, err := os.CreateTemp(dir, ".self-test")
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("%s is not writable: %v", dir, err)}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return CheckResult{name, CheckPass, fmt.Sprintf("%s is writable", dir)}
+}
+
+// Private helper to check the K8s API (used to find regions and roles) is reachable.
+func checkK8sAPI(client discovery.ServerVersionInterface, clientErr error) CheckResult {
+
+	name := "Kubernetes API"
+	if client == nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("no client: %v", clientErr)}
+	}
+	ver, err := client.ServerVersion()
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("not reachable: %v", err)}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("reachable (version %s)", ver.GitVersion)}
+}
+
+// Private helper to check a link local endpoint can be reached.
+//
+// These are only warnings since the instance metadata service is not needed
+// when the region comes from the node labels and the Pod Identity agent is
+// only needed by pods using Pod Identity.
+//
+func checkEndpoint(ctx context.Context, name, endpoint string) CheckResult {
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return CheckResult{name, CheckWarn, fmt.Sprintf("bad endpoint %s: %v", endpoint, err)}
+	}
+	host := u.Host
+	if len(u.Port()) == 0 {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	dialer := net.Dialer{Timeout: selfTestTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return CheckResult{name, CheckWarn, fmt.Sprintf("%s not reachable: %v", host, err)}
+	}
+	conn.Close()
+	return CheckResult{name, CheckPass, fmt.Sprintf("%s reachable", host)}
+}
+
+// Private helper to check STS access and clock skew.
+//
+// Calls GetCallerIdentity with the provider's own credentials. Missing or
+// denied credentials only warn (the provider normally uses the pod's
+// credentials), but STS must answer. The clock skew is measured against the
+// Date header of the STS response.
+//
+func checkSTS(ctx context.Context, client stsiface.STSAPI) []CheckResult {
+
+	name := "STS"
+	var stsDate string
+	start := time.Now()
+	rsp, err := client.GetCallerIdentityWithContext(aws.Context(ctx), &sts.GetCallerIdentityInput{},
+		func(r *request.Request) {
+			r.Handlers.Complete.PushBack(func(r *request.Request) {
+				if r.HTTPResponse != nil {
+					stsDate = r.HTTPResponse.Header.Get("Date")
+				}
+			})
+		})
+
+	var result CheckResult
+	if err == nil {
+		result = CheckResult{name, CheckPass, fmt.Sprintf("reachable as %s", aws.StringValue(rsp.Arn))}
+	} else if len(stsDate) > 0 {
+		result = CheckResult{name, CheckWarn, fmt.Sprintf("reachable but the provider's own credentials failed: %v", err)}
+	} else if aerr, ok := err.(awserr.Error); ok && aerr.Code() == request.ErrCodeRequestError {
+		return []CheckResult{{name, CheckFail, fmt.Sprintf("not reachable: %v", err)}}
+	} else {
+		// The request was never sent, usually for lack of credentials.
+		return []CheckResult{{name, CheckWarn, fmt.Sprintf("not checked since the provider's own credentials are not available: %v", err)}}
+	}
+
+	skew := CheckResult{Name: "Clock skew", Status: CheckWarn, Detail: "STS response had no Date header"}
+	if date, err := http.ParseTime(stsDate); err == nil {
+		// Compare to the middle of the request (the Date header has one second resolution).
+		offset := date.Sub(start.Add(time.Since(start) / 2)).Round(time.Second)
+		if offset < 0 {
+			offset = -offset
+		}
+		switch {
+		case offset >= maxClockSkew:
+			skew = CheckResult{"Clock skew", CheckFail, fmt.Sprintf("node clock is off by %s, AWS requests will be rejected", offset)}
+		case offset >= warnClockSkew:
+			skew = CheckResult{"Clock skew", CheckWarn, fmt.Sprintf("node clock is off by %s", offset)}
+		default:
+			skew = CheckResult{"Clock skew", CheckPass, fmt.Sprintf("node clock is off by %s", offset)}
+		}
+	}
+	return []CheckResult{result, skew}
+}
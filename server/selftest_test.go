@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Private helper to build an STS client calling a mock STS whose clock is off
+// by the given amount.
+//
+func newSelfTestSTS(t *testing.T, skew time.Duration, status int) *sts.STS {
+
+	stsSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			fmt.Fprint(w, `<ErrorResponse><Error><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult>
+<Arn>arn:aws:iam::123456789012:role/node</Arn><UserId>AROAEXAMPLE</UserId><Account>123456789012</Account>
+</GetCallerIdentityResult></GetCallerIdentityResponse>`)
+	}))
+	t.Cleanup(stsSrv.Close)
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(stsSrv.URL).
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", "")).
+		WithMaxRetries(0)))
+	return sts.New(sess)
+}
+
+func TestSelfTest(t *testing.T) {
+
+	agent := httptest.NewServer(http.NotFoundHandler())
+	defer agent.Close()
+
+	var out bytes.Buffer
+	cfg := SelfTestConfig{
+		SocketDir:           t.TempDir(),
+		K8sClient:           fake.NewSimpleClientset().Discovery(),
+		STSClient:           newSelfTestSTS(t, 0, http.StatusOK),
+		IMDSEndpoint:        agent.URL,
+		PodIdentityEndpoint: agent.URL + "/v1/credentials",
+	}
+	if !RunSelfTest(context.Background(), &out, cfg) {
+		t.Fatalf("TestSelfTest: self test failed:\n%s", out.String())
+	}
+	for _, expected := range []string{
+		"[PASS] Provider socket directory",
+		"[PASS] Kubernetes API",
+		"[PASS] Instance metadata service",
+		"[PASS] Pod Identity agent",
+		"[PASS] STS: reachable as arn:aws:iam::123456789012:role/node",
+		"[PASS] Clock skew",
+		"Self test passed",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("TestSelfTest: missing %s in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestSelfTestFailures(t *testing.T) {
+
+	agent := httptest.NewServer(http.NotFoundHandler())
+	agent.Close() // Nothing listening
+
+	var out bytes.Buffer
+	cfg := SelfTestConfig{
+		SocketDir:           filepath.Join(t.TempDir(), "missing"),
+		K8sError:            fmt.Errorf("not in a cluster"),
+		STSClient:           newSelfTestSTS(t, 10*time.Minute, http.StatusForbidden),
+		IMDSEndpoint:        agent.URL,
+		PodIdentityEndpoint: agent.URL,
+	}
+	if RunSelfTest(context.Background(), &out, cfg) {
+		t.Fatalf("TestSelfTestFailures: self test passed:\n%s", out.String())
+	}
+	for _, expected := range []string{
+		"[FAIL] Provider socket directory",
+		"[FAIL] Kubernetes API: no client: not in a cluster",
+		"[WARN] Instance metadata service",
+		"[WARN] Pod Identity agent",
+		"[WARN] STS: reachable but",
+		"[FAIL] Clock skew: node clock is off by",
+		"Self test failed",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("TestSelfTestFailures: missing %s in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestSelfTestNoSTS(t *testing.T) {
+
+	stsSrv := httptest.NewServer(http.NotFoundHandler())
+	stsSrv.Close() // Nothing listening
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(stsSrv.URL).
+		WithCredentials(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRETEXAMPLE", "")).
+		WithMaxRetries(0)))
+	results := checkSTS(context.Background(), sts.New(sess))
+	if len(results) != 1 || results[0].Status != CheckFail {
+		t.Fatalf("TestSelfTestNoSTS: expected failure but got %+v", results)
+	}
+}
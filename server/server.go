@@ -9,36 +9,95 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"k8s.io/klog/v2"
 
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	k8sv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
 	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 )
 
-// Version filled in by Makefile during build.
-var Version string
-
 const (
 	namespaceAttrib      = "csi.storage.k8s.io/pod.namespace"
 	acctAttrib           = "csi.storage.k8s.io/serviceAccount.name"
 	podnameAttrib        = "csi.storage.k8s.io/pod.name"
+	podUIDAttrib         = "csi.storage.k8s.io/pod.uid"
 	regionAttrib         = "region"                        // The attribute name for the region in the SecretProviderClass
 	transAttrib          = "pathTranslation"               // Path translation char
+	jmesTransAttrib      = "jmesPathTranslation"           // Path translation char for jmesPath aliases
 	regionLabel          = "topology.kubernetes.io/region" // The node label giving the region
 	secProvAttrib        = "objects"                       // The attribute used to pass the SecretProviderClass definition (with what to mount)
+	sharedObjectsAttrib  = "sharedObjects"                 // The attribute holding objects shared between SecretProviderClasses, merged ahead of objects
 	failoverRegionAttrib = "failoverRegion"                // The attribute name for the failover region in the SecretProviderClass
+	assumeRoleAttrib     = "assumeRoleArn"                 // The attribute name for the role to chain into in the SecretProviderClass
+	roleArnAttrib        = "roleArn"                       // Alternate name for assumeRoleArn
+	podIdentityAttrib    = "usePodIdentity"                // The attribute name to use EKS Pod Identity in the SecretProviderClass
+	templatesAttrib      = "objectsTemplate"               // The attribute holding files rendered from the fetched secrets
+	sessionNameAttrib    = "roleSessionName"               // The attribute name for the role session name pattern
+	sessionTagsAttrib    = "sessionTags"                   // The attribute name for the session tags to apply when chaining roles
+	maxRetriesAttrib     = "awsMaxRetries"                 // The attribute name for the maximum retries of AWS calls
+	retryModeAttrib      = "awsRetryMode"                  // The attribute name for the retry mode of AWS calls
+	deniedFailoverAttrib = "allowAccessDeniedFailover"     // The attribute name to fail over when the primary region denies access
+	syncSecretAttrib     = "kubernetesSecretName"          // The attribute name of the Kubernetes Secret to copy the mounted values into
+	smEndpointAttrib     = "secretsManagerEndpointUrl"     // The attribute name for the Secrets Manager endpoint (for example a VPC endpoint)
+	ssmEndpointAttrib    = "ssmEndpointUrl"                // The attribute name for the SSM endpoint (for example a VPC endpoint)
+	verifyWritesAttrib   = "verifyAfterWrite"              // The attribute name to check the files the driver wrote on the next mount
+	atomicWritesAttrib   = "atomicWrites"                  // The attribute name to update all the files of a mount at once
+	failbackReason       = "SecretFailback"                // The reason used on events emitted when secrets fail back to the primary region
+	expiringReason       = "SecretExpiring"                // The reason used on events emitted when secrets will soon expire
+	advancedTierReason   = "AdvancedTierParameter"         // The reason used on events emitted when advanced tier parameters are mounted
+	deprecatedReason     = "DeprecatedField"               // The reason used on events emitted when deprecated fields are used
+	secretSyncReason     = "SecretSyncFailed"              // The reason used on events emitted when the Kubernetes Secret can not be synced
+	writeMismatchReason  = "SecretWriteMismatch"           // The reason used on events emitted when files written by the driver do not match
+	permissionReason     = "FilePermissionTooBroad"        // The reason used on events emitted when the file permission is broader than allowed
+	maxAttributesSize    = 1024 * 1024                     // Upper bound on the size of the mount attributes
+	auditAnnotation      = "secrets-store.csi.aws/"        // Prefix of the pod annotation (followed by the volume name) summarizing a mount
+	mountPruneInterval   = time.Minute                     // How often target paths that no longer exist are dropped on mount
+	expiringInterval     = 24 * time.Hour                  // How often a pod is warned about the same expiring secret
+)
+
+// Finds the deprecated fields of a descriptor (replaced in tests, since
+// nothing is deprecated yet).
+var getDeprecations = (*provider.SecretDescriptor).GetDeprecations
+
+// Allowed values for the workload user agent setting.
+const (
+	WorkloadUANone      = "none"      // Do not identify the workload (default)
+	WorkloadUAHashed    = "hashed"    // Add a hash of the namespace and SecretProviderClass objects
+	WorkloadUANamespace = "namespace" // Add the namespace and a hash of the SecretProviderClass objects
+)
+
+// The driver's default limit on the size of gRPC messages it receives.
+const DefaultMaxResponseSize = 4 * 1024 * 1024
+
+// Allowed values for the sync policy used when writing secrets.
+const (
+	SyncAlways = "always" // Sync the file and its directory (default)
+	SyncNever  = "never"  // Leave it to the operating system
+	SyncAuto   = "auto"   // Sync unless the mount is on tmpfs (memory backed)
 )
 
 // A Secrets Store CSI Driver provider implementation for AWS Secrets Manager and SSM Parameter Store.
@@ -49,11 +108,119 @@ const (
 // credentials of the IAM role associated with the pod. If there is a failure
 // during the mount of any one secret no secrets are written to the mount point.
 //
+// The configuration is set by NewServer and never changes afterwards, so
+// concurrent mounts read it without locking. The settings that can be reloaded
+// (see ApplyRuntimeConfig) are kept apart in an immutable serverSettings that
+// is swapped as a whole, and each mount reads it once so it sees a consistent
+// set. The rest of the shared mutable state is:
+//
+//   - the failover tracking (failoverPaths), guarded by failoverMu;
+//   - the mount tracking (mounts, inventory, writeHashes, annotated, and
+//     mountsPruned), guarded by mountsMu;
+//   - the frozen flag and the settings pointer, which are atomic (settingsMu
+//     only serializes reloads);
+//   - the caches and limits (lookups, credCache, responseMemory, auditLog,
+//     and reported), which do their own locking.
+//
 type CSIDriverProviderServer struct {
 	*grpc.Server
 	secretProviderFactory provider.ProviderFactoryFactory
 	k8sClient             k8sv1.CoreV1Interface
 	driverWriteSecrets    bool
+	failoverMu            sync.Mutex
+	settingsMu            sync.Mutex
+	settings              atomic.Pointer[serverSettings]
+	failoverPaths         map[string]map[string]bool // Files last served from the failover region by target path
+	ssoProfile            string                     // Development only: use this SSO profile instead of IRSA
+	podIdentityCluster    string                     // Cluster name for Pod Identity without the agent (empty requires the agent)
+	namePolicy            *provider.ObjectNamePolicy // Naming policy object names must follow (nil for none)
+	denylist              *provider.ObjectDenylist   // Objects that must never be mounted (nil for none)
+	workloadUA            string                     // How to identify the workload in the user agent (see WorkloadUANone)
+	syncPolicy            string                     // When to sync written secrets to disk (see SyncAlways)
+	maxResponseSize       int                        // Largest mount response the driver accepts when it writes the secrets (0 for no limit)
+	selfWriteFallback     bool                       // Write files ourselves when the mount response would be too large
+	lookups               *lookupCache               // Short-lived cache of pod and node lookups (nil for none)
+	retry                 provider.RetryConfig       // Default retry configuration of AWS calls
+	responseMemory        *memoryBudget              // Limit on the memory of responses in flight (nil for no limit)
+	auditLog              *AuditLog                  // Where to record the secrets fetched (nil for none)
+	credCache             *auth.CredentialCache      // IRSA credentials shared between mounts (nil for none)
+	nameLabels            []string                   // Node labels that may be used as placeholders in object names
+	permPolicy            *FilePermissionPolicy      // Upper bound on the file permission of mounts (nil for none)
+	defaultPermission     os.FileMode                // File permission of mounts whose request gives none (0 for 0644)
+	descriptorOpts        provider.DescriptorOptions // How the objects of a SecretProviderClass are read
+	reported              utils.ReportedSet          // Warnings already reported, so they are not repeated on every mount
+	frozen                atomic.Bool                // Fetch nothing from AWS (see SetFrozen)
+	mountsMu              sync.Mutex
+	mounts                map[string]*v1alpha1.MountRequest // Last mount request by target path
+	inventory             map[string]*InventoryMount        // Objects of the last mount by target path
+	writeHashes           map[string]map[string]string      // Hashes of the files the driver was sent by target path
+	annotated             map[string]string                 // Versions hash last annotated on the pod by target path
+	mountsPruned          time.Time                         // When target paths that no longer exist were last dropped
+}
+
+// Optional server settings configured at startup.
+//
+// The zero value serves mounts with the defaults: the provider writes the
+// files itself, nothing is limited, cached, or audited, and no policy is
+// enforced.
+//
+type ServerOptions struct {
+	// Return the secrets to the driver to write instead of writing them ourselves.
+	DriverWriteSecrets bool
+
+	// Maximum mount requests serviced at once (0 for no limit).
+	MaxConcurrentMounts int
+
+	// Development only: use this SSO profile instead of IRSA.
+	SSOProfile string
+
+	// Cluster name for Pod Identity without the agent (empty requires the agent).
+	PodIdentityCluster string
+
+	// Naming policy object names must follow (nil for none).
+	NamePolicy *provider.ObjectNamePolicy
+
+	// Objects that must never be mounted (nil for none).
+	Denylist *provider.ObjectDenylist
+
+	// How to identify the workload in the user agent (see WorkloadUANone, empty for none).
+	WorkloadUA string
+
+	// When to sync written secrets to disk (see SyncAlways, empty for always).
+	SyncPolicy string
+
+	// Largest mount response the driver accepts when it writes the secrets (0 for no limit).
+	MaxResponseSize int
+
+	// Write files ourselves when the mount response would be too large.
+	SelfWriteFallback bool
+
+	// How long pod and node lookups are cached (0 disables the cache).
+	LookupCacheTTL time.Duration
+
+	// Default retry configuration of AWS calls.
+	Retry provider.RetryConfig
+
+	// Limit on the memory of responses in flight (0 for no limit).
+	MaxResponseMemory int64
+
+	// Where to record the secrets fetched (nil for none).
+	AuditLog *AuditLog
+
+	// IRSA credentials shared between mounts (nil for none).
+	CredentialCache *auth.CredentialCache
+
+	// Node labels that may be used as placeholders in object names.
+	NameLabels []string
+
+	// Upper bound on the file permission of mounts (nil for none).
+	PermissionPolicy *FilePermissionPolicy
+
+	// Octal file permission of mounts whose request gives none (empty for 0644).
+	DefaultFilePermission string
+
+	// Read objectName ARNs in another region than the mount from their own region.
+	AllowCrossRegionARNs bool
 }
 
 // Factory function to create the server to handle incoming mount requests.
@@ -61,14 +228,68 @@ type CSIDriverProviderServer struct {
 func NewServer(
 	secretProviderFact provider.ProviderFactoryFactory,
 	k8client k8sv1.CoreV1Interface,
-	driverWriteSecrets bool,
+	opts ServerOptions,
 ) (srv *CSIDriverProviderServer, e error) {
 
-	return &CSIDriverProviderServer{
+	if opts.MaxConcurrentMounts < 0 {
+		return nil, fmt.Errorf("max concurrent mounts can not be negative: %d", opts.MaxConcurrentMounts)
+	}
+	if opts.MaxResponseMemory < 0 {
+		return nil, fmt.Errorf("max response memory can not be negative: %d", opts.MaxResponseMemory)
+	}
+
+	workloadUA := opts.WorkloadUA
+	switch workloadUA {
+	case "":
+		workloadUA = WorkloadUANone
+	case WorkloadUANone, WorkloadUAHashed, WorkloadUANamespace:
+	default:
+		return nil, fmt.Errorf("workload user agent must be one of none, hashed, or namespace: %s", workloadUA)
+	}
+
+	syncPolicy := opts.SyncPolicy
+	switch syncPolicy {
+	case "":
+		syncPolicy = SyncAlways
+	case SyncAlways, SyncNever, SyncAuto:
+	default:
+		return nil, fmt.Errorf("sync policy must be one of always, never, or auto: %s", syncPolicy)
+	}
+
+	defaultPermission, err := parseDefaultFilePermission(opts.DefaultFilePermission, opts.PermissionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var lookups *lookupCache
+	if opts.LookupCacheTTL > 0 {
+		lookups = newLookupCache()
+	}
+
+	srv = &CSIDriverProviderServer{
 		secretProviderFactory: secretProviderFact,
 		k8sClient:             k8client,
-		driverWriteSecrets:    driverWriteSecrets,
-	}, nil
+		driverWriteSecrets:    opts.DriverWriteSecrets,
+		ssoProfile:            opts.SSOProfile,
+		podIdentityCluster:    opts.PodIdentityCluster,
+		namePolicy:            opts.NamePolicy,
+		denylist:              opts.Denylist,
+		workloadUA:            workloadUA,
+		syncPolicy:            syncPolicy,
+		maxResponseSize:       opts.MaxResponseSize,
+		selfWriteFallback:     opts.SelfWriteFallback,
+		lookups:               lookups,
+		retry:                 opts.Retry,
+		responseMemory:        newMemoryBudget(opts.MaxResponseMemory),
+		auditLog:              opts.AuditLog,
+		credCache:             opts.CredentialCache,
+		nameLabels:            opts.NameLabels,
+		permPolicy:            opts.PermissionPolicy,
+		defaultPermission:     defaultPermission,
+		descriptorOpts:        provider.DescriptorOptions{AllowCrossRegionARNs: opts.AllowCrossRegionARNs},
+	}
+	srv.settings.Store(newServerSettings(nil, opts.MaxConcurrentMounts, opts.LookupCacheTTL, nil))
+	return srv, nil
 
 }
 
@@ -80,17 +301,37 @@ func NewServer(
 //
 func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.MountRequest) (response *v1alpha1.MountResponse, e error) {
 
+	if !isFetchOnly(ctx) { // On demand fetches are not mounts.
+		mountDone := utils.StartMount()
+		defer func() {
+			utils.RecordMount(e)
+			mountDone(e)
+		}()
+	}
+	defer func() { e = mountStatus(e) }() // Report the category of any failure
+
 	// Basic sanity check
 	if len(req.GetTargetPath()) == 0 {
-		return nil, fmt.Errorf("Missing mount path")
+		return nil, utils.InvalidConfiguration(fmt.Errorf("Missing mount path"))
 	}
 	mountDir := req.GetTargetPath()
 
+	// Wait our turn if there are already too many mounts in progress.
+	settings := s.loadSettings() // Read once so the whole mount uses the same settings
+	release, err := s.acquireMountSlot(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Unpack the request.
+	if len(req.GetAttributes()) > maxAttributesSize {
+		return nil, utils.InvalidConfiguration(fmt.Errorf("mount attributes exceed %d bytes", maxAttributesSize))
+	}
 	var attrib map[string]string
-	err := json.Unmarshal([]byte(req.GetAttributes()), &attrib)
+	err = json.Unmarshal([]byte(req.GetAttributes()), &attrib)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal attributes, error: %+v", err)
+		return nil, utils.InvalidConfiguration(fmt.Errorf("failed to unmarshal attributes, error: %+v", err))
 	}
 
 	// Get the mount attributes.
@@ -99,7 +340,49 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 	podName := attrib[podnameAttrib]
 	region := attrib[regionAttrib]
 	translate := attrib[transAttrib]
+	jmesTranslate := attrib[jmesTransAttrib]
 	failoverRegion := attrib[failoverRegionAttrib]
+	assumeRoleArn, err := getAssumeRoleArn(attrib)
+	if err != nil {
+		return nil, utils.InvalidConfiguration(err)
+	}
+	usePodIdentity := strings.ToLower(attrib[podIdentityAttrib]) == "true"
+
+	// Log with the request ID (if any), pod, and namespace.
+	logger := klog.FromContext(ctx).WithValues("pod", podName, "namespace", nameSpace)
+	ctx = klog.NewContext(ctx, logger)
+
+	// Fetch nothing while frozen for incident response.
+	if s.frozen.Load() {
+		return s.frozenMount(ctx, req, nameSpace, podName)
+	}
+
+	// Get the role session name and tags used to tell pods apart in IAM
+	// policies and CloudTrail.
+	sessionName, sessionTags, err := s.getSessionAttributes(attrib, assumeRoleArn, usePodIdentity)
+	if err != nil {
+		return nil, utils.InvalidConfiguration(err)
+	}
+
+	// The mount may override how AWS calls are retried.
+	retryOverride, err := provider.NewRetryConfig(attrib[maxRetriesAttrib], attrib[retryModeAttrib])
+	if err != nil {
+		return nil, utils.InvalidConfiguration(err)
+	}
+
+	// The Kubernetes Secret to copy the mounted values into (if any).
+	syncSecret := attrib[syncSecretAttrib]
+	if len(syncSecret) > 0 {
+		if err := validateSyncSecretName(syncSecret); err != nil {
+			return nil, utils.InvalidConfiguration(err)
+		}
+	}
+
+	// Check the files the driver wrote for the last mount (if requested).
+	verifyWrites := strings.ToLower(attrib[verifyWritesAttrib]) == "true" && s.driverWriteSecrets && !isFetchOnly(ctx)
+	if verifyWrites {
+		s.verifyDriverWrites(ctx, nameSpace, podName, mountDir)
+	}
 
 	// Make a map of the currently mounted versions (if any)
 	curVersions := req.GetCurrentObjectVersion()
@@ -109,56 +392,216 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 	}
 
 	// Unpack the file permission to use.
-	var filePermission os.FileMode
-	err = json.Unmarshal([]byte(req.GetPermission()), &filePermission)
+	filePermission, err := s.getFilePermission(req.GetPermission())
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal file permission, error: %+v", err)
+		return nil, utils.InvalidConfiguration(err)
+	}
+	filePermission, err = s.checkFilePermission(ctx, nameSpace, podName, filePermission)
+	if err != nil {
+		return nil, err
 	}
 
-	regions, err := s.getAwsRegions(region, failoverRegion, nameSpace, podName, ctx)
+	regions, err := s.getAwsRegions(region, failoverRegion, nameSpace, podName, ctx, settings)
 	if err != nil {
-		klog.ErrorS(err, "Failed to initialize AWS session")
+		logger.Error(err, "Failed to initialize AWS session")
 		return nil, err
 	}
 
-	klog.Infof("Servicing mount request for pod %s in namespace %s using service account %s with region(s) %s", podName, nameSpace, svcAcct, strings.Join(regions, ", "))
+	// The endpoints of the mount (if any) must be valid in every region (and
+	// in the regions of objects with their own region, once they are read).
+	endpoints := provider.MountEndpoints{SecretsManager: attrib[smEndpointAttrib], SSM: attrib[ssmEndpointAttrib]}
+	if err := validateMountEndpoints(endpoints, regions); err != nil {
+		return nil, utils.InvalidConfiguration(err)
+	}
 
-	awsSessions, err := s.getAwsSessions(nameSpace, svcAcct, ctx, regions)
+	// The role to chain into must be in the partition of the mount.
+	if len(assumeRoleArn) > 0 {
+		if err := auth.ValidateRoleARN(assumeRoleArn, regions[0]); err != nil {
+			return nil, utils.InvalidConfiguration(err)
+		}
+	}
+
+	logger.Info("Servicing mount request", "serviceAccount", svcAcct, "regions", strings.Join(regions, ", "))
+
+	awsSessions, saRole, err := s.getAwsSessions(nameSpace, svcAcct, podName, assumeRoleArn, usePodIdentity, sessionName, sessionTags, ctx, regions)
 	if err != nil {
 		return nil, err
 	}
-	if len(awsSessions) > 2 {
-		klog.Errorf("Max number of region(s) exceeded: %s", strings.Join(regions, ", "))
-		return nil, err
+
+	// Use the endpoints of the mount (if any) for Secrets Manager and SSM.
+	if endpoints != (provider.MountEndpoints{}) {
+		for i := range awsSessions {
+			awsSessions[i] = provider.WithMountEndpoints(awsSessions[i], endpoints)
+		}
+	}
+
+	// Only share cached responses between mounts using the same credentials.
+	// Session tags may grant different access, and another endpoint may serve
+	// different responses, so they are part of the scope. So is the role of
+	// the service account, so moving it to another role stops sharing the
+	// responses fetched with the old one on its next mount.
+	ctx = provider.WithCacheScope(ctx, fmt.Sprintf("%s/%s/%s/%t/%s/%s/%s/%q/%q", nameSpace, svcAcct, saRole,
+		usePodIdentity, assumeRoleArn, sessionName, tagScope(sessionTags), endpoints.SecretsManager, endpoints.SSM))
+
+	// Identify the workload in the user agent (and so CloudTrail) if enabled.
+	if ua := s.workloadUserAgent(nameSpace, attrib[secProvAttrib]); len(ua) > 0 {
+		for _, sess := range awsSessions {
+			sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(ua))
+		}
+	}
+
+	retry := s.retry.Merge(retryOverride)
+	for _, sess := range awsSessions {
+		provider.ApplyRetryConfig(sess, retry)
 	}
 
+	// Some setups only grant access in the failover region.
+	fetchOpts := provider.FetchOptions{AccessDeniedFailover: strings.ToLower(attrib[deniedFailoverAttrib]) == "true"}
+
 	// Get the list of secrets to mount. These will be grouped together by type
 	// in a map of slices (map[string][]*SecretDescriptor) keyed by secret type
 	// so that requests can be batched if the implementation allows it.
-	descriptors, err := provider.NewSecretDescriptorList(mountDir, translate, attrib[secProvAttrib], regions)
+	objectSpec, err := provider.MergeObjectSpecs(attrib[sharedObjectsAttrib], attrib[secProvAttrib])
+	if err != nil {
+		utils.Errorf("Failure merging object lists: %s", err)
+		return nil, utils.InvalidConfiguration(err)
+	}
+	objectSpec, err = s.expandNodeLabels(ctx, settings, nameSpace, podName, objectSpec)
 	if err != nil {
-		klog.Errorf("Failure reading descriptor list: %s", err)
 		return nil, err
 	}
+	descriptors, err := provider.NewSecretDescriptorListWithOptions(mountDir, translate, jmesTranslate, objectSpec, regions, s.descriptorOpts)
+	if err != nil {
+		utils.Errorf("Failure reading descriptor list: %s", err)
+		return nil, utils.InvalidConfiguration(err)
+	}
+	if err := validateMountEndpoints(endpoints, objectRegions(descriptors)); err != nil {
+		return nil, utils.InvalidConfiguration(err)
+	}
+	templates, err := provider.NewObjectTemplateList(mountDir, attrib[templatesAttrib])
+	if err != nil {
+		utils.Errorf("Failure reading templates: %s", err)
+		return nil, utils.InvalidConfiguration(err)
+	}
 
+	// Enforce the naming policy and denylist before anything is looked up,
+	// and again on the secrets selected by tag and the replicas, which are
+	// held to them like any other object.
+	if err := s.checkObjectNames(nameSpace, podName, descriptors); err != nil {
+		return nil, err
+	}
 	providerFactory := s.secretProviderFactory(awsSessions, regions)
-	var fetchedSecrets []*provider.SecretValue
-	for sType := range descriptors { // Iterate over each secret type.
-		// Fetch all the secrets and update the curVerMap
-		provider := providerFactory.GetSecretProvider(sType)
-		secrets, err := provider.GetSecretValues(ctx, descriptors[sType], curVerMap)
+	if err := provider.ResolveTaggedObjects(ctx, providerFactory, descriptors, fetchOpts); err != nil {
+		utils.Errorf("Failure resolving objectTags for pod %s in namespace %s: %s", podName, nameSpace, err)
+		return nil, err
+	}
+	if err := provider.ResolveReplicas(providerFactory, descriptors); err != nil {
+		utils.Errorf("Failure resolving replicas for pod %s in namespace %s: %s", podName, nameSpace, err)
+		return nil, err
+	}
+	if err := s.checkObjectNames(nameSpace, podName, descriptors); err != nil {
+		return nil, err
+	}
+
+	// Let users know about deprecated fields without failing the mount.
+	s.reportDeprecations(ctx, nameSpace, podName, descriptors)
+
+	// Fetch the secret types in a fixed order so every mount builds its
+	// output the same way.
+	sTypes := make([]provider.SecretType, 0, len(descriptors))
+	for sType := range descriptors {
+		sTypes = append(sTypes, sType)
+	}
+	sort.Slice(sTypes, func(i, j int) bool { return sTypes[i] < sTypes[j] })
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("mount request cancelled: %w", err)
+	}
+
+	// Reserve the memory of the response before fetching anything.
+	reservation, err := s.reserveEstimate(ctx, descriptors, len(templates))
+	if err != nil {
+		utils.Errorf("Failure reserving response memory for pod %s in namespace %s: %s", podName, nameSpace, err)
+		return nil, err
+	}
+	defer reservation.done()
+
+	// Fetch all the secrets and update the curVerMap. Objects with their own
+	// region are fetched separately for each region.
+	var groups []fetchGroup
+	for _, sType := range sTypes {
+		for _, group := range groupByRegion(descriptors[sType]) {
+			groups = append(groups, fetchGroup{sType: sType, descriptors: group})
+		}
+	}
+	fetchedSecrets, err := fetchGroups(ctx, providerFactory, groups, curVerMap, fetchOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure nothing larger than expected gets mounted.
+	for _, secret := range fetchedSecrets {
+		if err := secret.CheckSize(); err != nil {
+			utils.Errorf("Failure checking secret size: %s", err)
+			return nil, utils.InvalidConfiguration(err)
+		}
+	}
+
+	// Exploded JSON keys must not overwrite other files.
+	if err := provider.CheckExplodedNames(fetchedSecrets); err != nil {
+		utils.Errorf("Failure checking exploded names for pod %s in namespace %s: %s", podName, nameSpace, err)
+		return nil, utils.InvalidConfiguration(err)
+	}
+
+	// Record who read what in the audit log (if enabled).
+	s.auditFetches(ctx, nameSpace, podName, svcAcct, regions, fetchedSecrets)
+
+	// Note any secrets moving to or back from the failover region.
+	s.trackFailover(ctx, nameSpace, podName, fetchedSecrets)
+	s.checkExpiration(ctx, nameSpace, podName, fetchedSecrets)
+	s.checkAdvancedTier(ctx, nameSpace, podName, fetchedSecrets)
+
+	// Render any templated files from the fetched secrets.
+	var rendered []*provider.SecretValue
+	for _, tmpl := range templates {
+		value, version, err := tmpl.Render(fetchedSecrets)
 		if err != nil {
-			klog.Errorf("Failure getting secret values from provider type %s: %s", sType, err)
-			return nil, err
+			utils.Errorf("Failure rendering templates for pod %s in namespace %s: %s", podName, nameSpace, err)
+			return nil, utils.InvalidConfiguration(err)
 		}
-		fetchedSecrets = append(fetchedSecrets, secrets...) // Build up the list of all secrets
+		rendered = append(rendered, value)
+		curVerMap[tmpl.FileName] = &v1alpha1.ObjectVersion{Id: tmpl.FileName, Version: version}
 	}
+	fetchedSecrets = append(fetchedSecrets, rendered...)
 
 	// Write out the secrets to the mount point after everything is fetched.
+	// Objects are written after the objects they depend on (see dependsOn),
+	// and otherwise in file name order so the files and versions sent to the
+	// driver do not change order between rotations.
+	sort.SliceStable(fetchedSecrets, func(i, j int) bool {
+		iOrder, jOrder := fetchedSecrets[i].Descriptor.GetWriteOrder(), fetchedSecrets[j].Descriptor.GetWriteOrder()
+		if iOrder != jOrder {
+			return iOrder < jOrder
+		}
+		return fetchedSecrets[i].Descriptor.GetFileName() < fetchedSecrets[j].Descriptor.GetFileName()
+	})
 	var files []*v1alpha1.File
+	var atomicSecrets []*provider.SecretValue
+	atomic := strings.ToLower(attrib[atomicWritesAttrib]) == "true" && !s.driverWriteSecrets && !isFetchOnly(ctx)
 	for _, secret := range fetchedSecrets {
 
-		file, err := s.writeFile(secret, filePermission)
+		// Only the jmesPath entries are written when writeParent is false.
+		if !secret.Descriptor.GetWriteParent() {
+			continue
+		}
+
+		// Files written atomically are all written at once below.
+		if atomic {
+			atomicSecrets = append(atomicSecrets, secret)
+			continue
+		}
+
+		file, err := s.writeFile(ctx, secret, filePermission)
 		if err != nil {
 			return nil, err
 		}
@@ -166,13 +609,259 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 			files = append(files, file)
 		}
 	}
+	if atomic {
+		if err := s.writeAtomically(ctx, mountDir, atomicSecrets, filePermission); err != nil {
+			return nil, err
+		}
+	}
 
-	// Build the version response from the current version map and return it.
+	// Build the version response from the current version map.
 	var ov []*v1alpha1.ObjectVersion
 	for id := range curVerMap {
 		ov = append(ov, curVerMap[id])
 	}
-	return &v1alpha1.MountResponse{Files: files, ObjectVersion: ov}, nil
+	sort.Slice(ov, func(i, j int) bool { return ov[i].Id < ov[j].Id })
+	rsp := &v1alpha1.MountResponse{Files: files, ObjectVersion: ov}
+	if isFetchOnly(ctx) {
+		if err := s.reserveResponse(ctx, reservation, rsp); err != nil {
+			return nil, err
+		}
+		return rsp, nil // Nothing was mounted.
+	}
+
+	// Make sure the driver can receive the response.
+	err = s.fitResponse(ctx, rsp, fetchedSecrets, filePermission)
+	if err == nil {
+		err = s.reserveResponse(ctx, reservation, rsp)
+	}
+	if err != nil {
+		utils.Errorf("Failure sending secrets for pod %s in namespace %s: %s", podName, nameSpace, err)
+		return nil, err
+	}
+
+	// Remember the request so the mount can be refreshed on demand.
+	s.recordMount(req)
+	s.recordInventory(nameSpace, podName, mountDir, fetchedSecrets)
+	s.recordDriverWrites(mountDir, verifyWrites, rsp.Files)
+
+	if utils.DefaultFeatureGate.Enabled(utils.PodAuditAnnotation) {
+		s.annotateMount(ctx, nameSpace, podName, mountDir, ov)
+	}
+	if len(syncSecret) > 0 {
+		s.syncKubernetesSecret(ctx, nameSpace, podName, attrib[podUIDAttrib], syncSecret, fetchedSecrets)
+	}
+	return rsp, nil
+}
+
+// The descriptors of one secret type and region, fetched with one call to
+// the secret provider.
+type fetchGroup struct {
+	sType       provider.SecretType
+	descriptors []*provider.SecretDescriptor
+}
+
+// Private helper to fetch the groups of a mount concurrently.
+//
+// Fetching the groups one after another let a slow group (such as a large
+// batch of SSM parameters) use up the request deadline before the next group
+// (such as the Secrets Manager secrets) started. All groups now start at once
+// and share the request deadline, and the first failure cancels the groups
+// still running and is returned. Like concurrent secret fetches, each group
+// records its versions in its own copy of the current version map, and the
+// secrets and changed versions are merged in group order once all groups
+// finish.
+//
+func fetchGroups(
+	ctx context.Context,
+	factory *provider.SecretProviderFactory,
+	groups []fetchGroup,
+	curVerMap map[string]*v1alpha1.ObjectVersion,
+	opts provider.FetchOptions,
+) (secrets []*provider.SecretValue, e error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetchResult struct {
+		values   []*provider.SecretValue
+		versions map[string]*v1alpha1.ObjectVersion
+	}
+	results := make([]fetchResult, len(groups))
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		versions := make(map[string]*v1alpha1.ObjectVersion, len(curVerMap))
+		for id, ver := range curVerMap {
+			versions[id] = ver
+		}
+		results[i].versions = versions
+
+		wg.Add(1)
+		go func(i int, group fetchGroup) {
+			defer wg.Done()
+			fail := func(err error) {
+				errOnce.Do(func() {
+					utils.Errorf("Failure getting secret values from provider type %s: %s", group.sType, err)
+					e = err
+					cancel() // Stop the other groups.
+				})
+			}
+
+			// The interceptors only recover panics of the request goroutine.
+			defer func() {
+				if r := recover(); r != nil {
+					klog.FromContext(ctx).Error(nil, "Panic fetching secrets", "type", group.sType, "panic", r, "stack", string(debug.Stack()))
+					fail(fmt.Errorf("internal error fetching %s objects", group.sType))
+				}
+			}()
+
+			secretProvider := factory.GetRegionalSecretProvider(group.sType, group.descriptors[0].Region)
+			values, err := secretProvider.GetSecretValues(ctx, group.descriptors, results[i].versions, opts)
+			if err != nil {
+				fail(err)
+				return
+			}
+			results[i].values = values
+		}(i, group)
+	}
+	wg.Wait()
+	if e != nil {
+		return nil, e
+	}
+
+	original := make(map[string]*v1alpha1.ObjectVersion, len(curVerMap))
+	for id, ver := range curVerMap {
+		original[id] = ver
+	}
+	for _, result := range results {
+		secrets = append(secrets, result.values...)
+		for id, ver := range result.versions {
+			if original[id] != ver { // Only versions this group changed.
+				curVerMap[id] = ver
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// Private helper to split the descriptors of a secret type by the region they
+// are fetched from.
+//
+// Objects without their own region come first, followed by the objects of
+// each region in the order the regions first appear.
+//
+func groupByRegion(descriptors []*provider.SecretDescriptor) (groups [][]*provider.SecretDescriptor) {
+
+	index := map[string]int{"": 0}
+	groups = [][]*provider.SecretDescriptor{nil}
+	for _, descriptor := range descriptors {
+		i, ok := index[descriptor.Region]
+		if !ok {
+			i = len(groups)
+			index[descriptor.Region] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], descriptor)
+	}
+	if len(groups[0]) == 0 {
+		groups = groups[1:]
+	}
+	return groups
+}
+
+// Private helper to keep the mount response within the size the driver
+// accepts when it writes the secrets.
+//
+// Without this check an oversized response fails with a generic gRPC message
+// size error. When the self write fallback is enabled, the largest files are
+// written directly to the mount (instead of being sent to the driver) until
+// the response fits. Otherwise the mount fails with the response size, the
+// limit, and the largest files.
+//
+// The mount point belongs to the driver when it writes the secrets, and it
+// does not know about the files written by the fallback. It never removes
+// them, so they stay in place when their object is later dropped from the
+// SecretProviderClass or fits in the response again.
+//
+func (s *CSIDriverProviderServer) fitResponse(
+	ctx context.Context,
+	rsp *v1alpha1.MountResponse,
+	secrets []*provider.SecretValue,
+	mode os.FileMode,
+) error {
+
+	if s.maxResponseSize <= 0 || proto.Size(rsp) <= s.maxResponseSize {
+		return nil
+	}
+
+	// Largest files first.
+	files := append([]*v1alpha1.File{}, rsp.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return len(files[i].Contents) > len(files[j].Contents)
+	})
+
+	if !s.selfWriteFallback {
+		var largest []string
+		for i := 0; i < len(files) && i < 3; i++ {
+			largest = append(largest, fmt.Sprintf("%s (%d bytes)", files[i].Path, len(files[i].Contents)))
+		}
+		return fmt.Errorf("mount response of %d bytes exceeds the limit of %d bytes, largest files: %s",
+			proto.Size(rsp), s.maxResponseSize, strings.Join(largest, ", "))
+	}
+
+	bySource := make(map[string]*provider.SecretValue)
+	for _, secret := range secrets {
+		bySource[secret.Descriptor.GetFileName()] = secret
+	}
+
+	for _, file := range files {
+		if proto.Size(rsp) <= s.maxResponseSize {
+			break
+		}
+
+		source, ok := bySource[file.Path]
+		if !ok {
+			return fmt.Errorf("mount response of %d bytes exceeds the limit of %d bytes and %s can not be written directly",
+				proto.Size(rsp), s.maxResponseSize, file.Path)
+		}
+		klog.Warningf("Writing %s (%d bytes) directly since the mount response is too large for the driver", file.Path, len(file.Contents))
+		if err := s.writeToMount(ctx, source, mode); err != nil {
+			return err
+		}
+		for i := range rsp.Files {
+			if rsp.Files[i] == file {
+				rsp.Files = append(rsp.Files[:i], rsp.Files[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if proto.Size(rsp) > s.maxResponseSize {
+		return fmt.Errorf("mount response of %d bytes exceeds the limit of %d bytes", proto.Size(rsp), s.maxResponseSize)
+	}
+	return nil
+}
+
+// Private helper to limit the number of mount requests serviced at once.
+//
+// When a limit is configured, the caller waits until a slot is free or the
+// request deadline expires (so the driver can retry). The returned function
+// must be called to release the slot. Slots are released to the limit they
+// were taken from, even if the limit has since been changed.
+//
+func (s *CSIDriverProviderServer) acquireMountSlot(ctx context.Context, settings *serverSettings) (release func(), err error) {
+
+	slots := settings.mountSlots
+	if slots == nil { // No limit
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out waiting for a mount slot (%d mounts in progress): %w", cap(slots), ctx.Err())
+	}
 }
 
 // Private helper to get the aws lookup regions for a given pod.
@@ -180,26 +869,49 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 // When a region in the mount request is available, the region is added as primary region to the lookup region list
 // If a region is not specified in the mount request, we must lookup the region from node label and add as primary region to the lookup region list
 // If both the region and node label region are not available, error will be thrown
-// If backupRegion is provided and is equal to region/node region, error will be thrown else backupRegion is added to the lookup region list
+// If backupRegion is provided, it is a comma separated list of failover regions that are added to the lookup region list in order
+// If a failover region is empty or repeats the primary region or another failover region, error will be thrown
 //
-func (s *CSIDriverProviderServer) getAwsRegions(region, backupRegion, nameSpace, podName string, ctx context.Context) (response []string, err error) {
+func (s *CSIDriverProviderServer) getAwsRegions(region, backupRegion, nameSpace, podName string, ctx context.Context, settings *serverSettings) (response []string, err error) {
 	var lookupRegionList []string
 
 	// Find primary region.  Fall back to region node if unavailable.
 	if len(region) == 0 {
-		region, err = s.getRegionFromNode(ctx, nameSpace, podName)
+		region, err = s.getRegionFromNode(ctx, settings, nameSpace, podName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to retrieve region from node. error %+v", err)
 		}
 	}
 	lookupRegionList = []string{region}
 
-	// Find backup region
-	if len(backupRegion) > 0 {
-		if region == backupRegion {
+	// Find backup regions, in order of preference. Use the configured
+	// defaults when the SecretProviderClass has none.
+	if len(backupRegion) == 0 {
+		backupRegion, err = s.defaultFailoverRegion(ctx, settings, nameSpace, podName, region)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(backupRegion) == 0 {
+		return lookupRegionList, nil
+	}
+	for _, failover := range strings.Split(backupRegion, ",") {
+		failover = strings.TrimSpace(failover)
+		if len(failover) == 0 {
+			return nil, fmt.Errorf("%s: failover regions can not be empty", backupRegion)
+		}
+		if failover == region {
 			return nil, fmt.Errorf("%v: failover region cannot be the same as the primary region", region)
 		}
-		lookupRegionList = append(lookupRegionList, backupRegion)
+		if !utils.SamePartition(failover, region) {
+			return nil, fmt.Errorf("%v: failover region is not in the same partition as region %v", failover, region)
+		}
+		for _, prev := range lookupRegionList[1:] {
+			if failover == prev {
+				return nil, fmt.Errorf("%v: failover region is listed more than once", failover)
+			}
+		}
+		lookupRegionList = append(lookupRegionList, failover)
 	}
 	return lookupRegionList, nil
 }
@@ -209,34 +921,491 @@ func (s *CSIDriverProviderServer) getAwsRegions(region, backupRegion, nameSpace,
 // Gets the pod's AWS creds for each lookup region
 // Establishes the connection using Aws cred for each lookup region
 // If atleast one session is not created, error will be thrown
+// When an SSO profile is configured (development clusters only) the profile's
+// credentials are used instead of the pod's. Pods may use EKS Pod Identity
+// instead of IRSA. When a role to chain into is given, that role is assumed
+// with the pod recorded as the source identity. The role session name (if
+// any) applies to the role used to fetch secrets: the chained role when there
+// is one and the IRSA role otherwise. Session tags only apply to chained roles.
 //
-func (s *CSIDriverProviderServer) getAwsSessions(nameSpace, svcAcct string, ctx context.Context, lookupRegionList []string) (response []*session.Session, err error) {
+func (s *CSIDriverProviderServer) getAwsSessions(
+	nameSpace, svcAcct, podName, assumeRoleArn string,
+	usePodIdentity bool,
+	sessionName string,
+	sessionTags map[string]string,
+	ctx context.Context,
+	lookupRegionList []string,
+) (response []*session.Session, saRole string, err error) {
 	// Get the pod's AWS creds for each lookup region.
 	var awsSessionsList []*session.Session
 
 	for _, region := range lookupRegionList {
-		oidcAuth, err := auth.NewAuth(ctx, region, nameSpace, svcAcct, s.k8sClient)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %s", region, err)
+		var awsSession *session.Session
+		if len(s.ssoProfile) > 0 {
+			awsSession, err = auth.GetSSOSession(ctx, region, s.ssoProfile)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", region, err)
+			}
+		} else if usePodIdentity {
+			awsSession, err = auth.GetPodIdentitySession(region, nameSpace, svcAcct, s.podIdentityCluster, s.k8sClient)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", region, err)
+			}
+		} else {
+			irsaSessionName := sessionName
+			if len(assumeRoleArn) > 0 {
+				irsaSessionName = "" // Use the default for the first hop
+			}
+			oidcAuth, err := auth.NewAuth(ctx, region, nameSpace, svcAcct, irsaSessionName, s.k8sClient, s.credCache)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", region, err)
+			}
+			awsSession, saRole, err = oidcAuth.GetAWSSessionAndRole()
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", region, err)
+			}
 		}
-		awsSession, err := oidcAuth.GetAWSSession()
-		if err != nil {
-			return nil, fmt.Errorf("%s: %s", region, err)
+
+		if len(assumeRoleArn) > 0 {
+			awsSession, err = auth.GetChainedSession(awsSession, assumeRoleArn, auth.SourceIdentity(nameSpace, podName), sessionName, sessionTags)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", region, err)
+			}
 		}
 		awsSessionsList = append(awsSessionsList, awsSession)
 	}
 
-	return awsSessionsList, nil
+	return awsSessionsList, saRole, nil
+}
+
+// Private helper to get the role to chain into for a mount.
+//
+// The role may be given with either the assumeRoleArn or roleArn attribute,
+// but not both, so there is never a question of which one wins.
+//
+func getAssumeRoleArn(attrib map[string]string) (string, error) {
+
+	assumeRoleArn := attrib[assumeRoleAttrib]
+	roleArn := attrib[roleArnAttrib]
+	if len(assumeRoleArn) > 0 && len(roleArn) > 0 {
+		return "", fmt.Errorf("%s and %s are the same setting, use only one", assumeRoleAttrib, roleArnAttrib)
+	}
+	if len(assumeRoleArn) == 0 {
+		assumeRoleArn = roleArn
+	}
+	return assumeRoleArn, nil
+}
+
+// Private helper to get the role session name and session tags for a mount.
+//
+// STS only accepts session tags on AssumeRole (not on the
+// AssumeRoleWithWebIdentity call made for IRSA), so tags require a role to
+// chain into. A session name can not be set for Pod Identity or SSO
+// credentials, so those need a role to chain into as well.
+//
+func (s *CSIDriverProviderServer) getSessionAttributes(
+	attrib map[string]string, assumeRoleArn string, usePodIdentity bool,
+) (sessionName string, sessionTags map[string]string, e error) {
+
+	nameSpace := attrib[namespaceAttrib]
+	svcAcct := attrib[acctAttrib]
+	podName := attrib[podnameAttrib]
+
+	if len(attrib[sessionNameAttrib]) > 0 {
+		if len(assumeRoleArn) == 0 && (usePodIdentity || len(s.ssoProfile) > 0) {
+			return "", nil, fmt.Errorf("%s requires %s when using Pod Identity or SSO credentials", sessionNameAttrib, assumeRoleAttrib)
+		}
+		sessionName, e = auth.RoleSessionName(attrib[sessionNameAttrib], nameSpace, svcAcct, podName)
+		if e != nil {
+			return "", nil, e
+		}
+	}
+
+	sessionTags, e = auth.ParseSessionTags(attrib[sessionTagsAttrib], nameSpace, svcAcct, podName)
+	if e != nil {
+		return "", nil, e
+	}
+	if len(sessionTags) > 0 && len(assumeRoleArn) == 0 {
+		return "", nil, fmt.Errorf("%s requires %s since STS does not accept session tags for IRSA or Pod Identity credentials",
+			sessionTagsAttrib, assumeRoleAttrib)
+	}
+
+	return sessionName, sessionTags, nil
+}
+
+// Private helper to describe session tags in a cache scope (sorted by key).
+func tagScope(tags map[string]string) string {
+
+	var pairs []string
+	for key, value := range tags {
+		pairs = append(pairs, fmt.Sprintf("%q=%q", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Private helper to make sure the endpoints of a mount are https URLs in
+// every region of the mount.
+func validateMountEndpoints(endpoints provider.MountEndpoints, regions []string) error {
+
+	for _, attr := range [][2]string{{smEndpointAttrib, endpoints.SecretsManager}, {ssmEndpointAttrib, endpoints.SSM}} {
+		for i := 0; len(attr[1]) > 0 && i < len(regions); i++ {
+			if err := utils.ValidateEndpointURL(attr[0], utils.ExpandEndpoint(attr[1], regions[i]), regions[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Private helper to list the regions objects give themselves (sorted, each
+// once), which use the endpoints of the mount too.
+func objectRegions(descriptors map[provider.SecretType][]*provider.SecretDescriptor) []string {
+
+	seen := make(map[string]bool)
+	var regions []string
+	for _, group := range descriptors {
+		for _, descriptor := range group {
+			if len(descriptor.Region) > 0 && !seen[descriptor.Region] {
+				seen[descriptor.Region] = true
+				regions = append(regions, descriptor.Region)
+			}
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Private helper to build the user agent string identifying a workload.
+//
+// Lets CloudTrail analysis map API volume back to workloads even without role
+// chaining. The SecretProviderClass is identified by a hash of its objects.
+// In hashed mode the namespace is hashed too so that namespace names (which
+// may be sensitive) are not sent to AWS. Returns an empty string when the
+// workload is not to be identified.
+//
+func (s *CSIDriverProviderServer) workloadUserAgent(nameSpace, objects string) string {
+
+	switch s.workloadUA {
+	case WorkloadUAHashed:
+		hash := sha256.Sum256([]byte(nameSpace + "/" + objects))
+		return fmt.Sprintf("workload/%x", hash[:8])
+	case WorkloadUANamespace:
+		hash := sha256.Sum256([]byte(objects))
+		return fmt.Sprintf("workload/%s/%x", nameSpace, hash[:8])
+	}
+	return ""
+}
+
+// Private helper to track which secrets are being served from the failover region.
+//
+// Secrets served from the failover region are remembered by mount path. Since
+// the primary region is always tried first, a later mount that serves one of
+// these secrets from the primary region means the secret has failed back. When
+// that happens an event is recorded on the pod so that the recovery is visible
+// and mounts are not assumed to be pinned to the failover region.
+//
+// Target paths that no longer exist (the pod is gone) are dropped first, the
+// same as the saved mount requests.
+//
+func (s *CSIDriverProviderServer) trackFailover(ctx context.Context, nameSpace, podName string, secrets []*provider.SecretValue) {
+
+	s.pruneFailover()
+
+	var failedBack []string
+
+	s.failoverMu.Lock()
+	if s.failoverPaths == nil {
+		s.failoverPaths = make(map[string]map[string]bool)
+	}
+	for _, secret := range secrets {
+		mountDir := secret.Descriptor.GetMountDir()
+		path := secret.Descriptor.GetMountPath()
+		if secret.IsFailover {
+			if !s.failoverPaths[mountDir][path] {
+				utils.RecordFailover(secret.Descriptor.GetSecretType().String())
+				utils.Warningf("Serving %s for pod %s in namespace %s from the failover region", secret.Descriptor.GetFileName(), podName, nameSpace)
+			}
+			if s.failoverPaths[mountDir] == nil {
+				s.failoverPaths[mountDir] = make(map[string]bool)
+			}
+			s.failoverPaths[mountDir][path] = true
+		} else if s.failoverPaths[mountDir][path] {
+			delete(s.failoverPaths[mountDir], path)
+			if len(s.failoverPaths[mountDir]) == 0 {
+				delete(s.failoverPaths, mountDir)
+			}
+			failedBack = append(failedBack, secret.Descriptor.GetFileName())
+		}
+	}
+	s.failoverMu.Unlock()
+
+	if len(failedBack) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("Secrets failed back to the primary region: %s", strings.Join(failedBack, ", "))
+	klog.Infof("%s (pod %s in namespace %s)", msg, podName, nameSpace)
+	s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeNormal, failbackReason, msg)
+}
+
+// Private helper to drop the failover state of target paths that no longer
+// exist. The paths are checked without holding the lock so slow file systems
+// do not hold up other mounts.
+//
+func (s *CSIDriverProviderServer) pruneFailover() {
+
+	s.failoverMu.Lock()
+	dirs := make([]string, 0, len(s.failoverPaths))
+	for dir := range s.failoverPaths {
+		dirs = append(dirs, dir)
+	}
+	s.failoverMu.Unlock()
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			s.failoverMu.Lock()
+			delete(s.failoverPaths, dir)
+			s.failoverMu.Unlock()
+		}
+	}
+}
+
+// Private helper to enforce the naming policy and denylist (if any) on the
+// objects of a mount.
+func (s *CSIDriverProviderServer) checkObjectNames(nameSpace, podName string, descriptors map[provider.SecretType][]*provider.SecretDescriptor) error {
+
+	if s.namePolicy != nil {
+		if err := s.namePolicy.Check(descriptors); err != nil {
+			utils.Errorf("Failure checking object names for pod %s in namespace %s: %s", podName, nameSpace, err)
+			return utils.InvalidConfiguration(err)
+		}
+	}
+	if s.denylist != nil {
+		if err := s.denylist.Check(descriptors); err != nil {
+			utils.Errorf("Denied mount for pod %s in namespace %s: %s", podName, nameSpace, err)
+			return utils.WithCategory(utils.ErrorAccessDenied, err)
+		}
+	}
+	return nil
+}
+
+// Private helper to record an event for secrets that will soon expire.
+//
+// Every mount and rotation fetches the parameters again, so each expiring
+// file is only included in an event on the pod once per expiringInterval.
+//
+func (s *CSIDriverProviderServer) checkExpiration(ctx context.Context, nameSpace, podName string, secrets []*provider.SecretValue) {
+
+	var expiring []string
+	for _, secret := range secrets {
+		key := strings.Join([]string{expiringReason, nameSpace, podName, secret.Descriptor.GetFileName()}, "/")
+		if !secret.Expiration.IsZero() && s.reported.Every(key, expiringInterval) {
+			expiring = append(expiring, fmt.Sprintf("%s (%s)", secret.Descriptor.GetFileName(), secret.Expiration.Format(time.RFC3339)))
+		}
+	}
+	if len(expiring) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("Mounted secrets will soon expire: %s", strings.Join(expiring, ", "))
+	s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, expiringReason, msg)
+}
+
+// Private helper to report advanced tier parameters being mounted.
+//
+// Parameters are only marked when the provider's tier policy is warn, so
+// teams can spot parameters driving per-parameter and API interaction costs.
+// Each parameter is logged and recorded as an event on the pod mounting it
+// the first time it is mounted, rather than on every mount and rotation.
+//
+func (s *CSIDriverProviderServer) checkAdvancedTier(ctx context.Context, nameSpace, podName string, secrets []*provider.SecretValue) {
+
+	var advanced []string
+	for _, secret := range secrets {
+		name := secret.Descriptor.GetSecretName(secret.FailoverIndex)
+		key := secret.ARN
+		if len(key) == 0 {
+			key = name
+		}
+		if secret.AdvancedTier && s.reported.First(advancedTierReason+"/"+key) {
+			advanced = append(advanced, name)
+		}
+	}
+	if len(advanced) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("Mounted parameters use the advanced tier: %s", strings.Join(advanced, ", "))
+	klog.Warningf("%s (pod %s in namespace %s)", msg, podName, nameSpace)
+	s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, advancedTierReason, msg)
+}
+
+// Private helper to enforce the file permission policy (if any) on a mount.
+//
+// Mounts asking for a broader permission than allowed are logged and reported
+// on the pod, and either fail or use the clamped permission depending on the
+// policy.
+//
+func (s *CSIDriverProviderServer) checkFilePermission(ctx context.Context, nameSpace, podName string, perm os.FileMode) (os.FileMode, error) {
+
+	allowed, broader, err := s.permPolicy.Check(perm)
+	if err != nil {
+		utils.Errorf("Denied mount for pod %s in namespace %s: %s", podName, nameSpace, err)
+		s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, permissionReason, err.Error())
+		return perm, utils.InvalidConfiguration(err)
+	}
+	if broader {
+		msg := fmt.Sprintf("File permission %#o is broader than the provider allows, mounting with %#o", perm, allowed)
+		utils.Warningf("%s for pod %s in namespace %s", msg, podName, nameSpace)
+		s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, permissionReason, msg)
+	}
+	return allowed, nil
+}
+
+// Private helper to report deprecated fields used by the SecretProviderClass.
+//
+// Each deprecation is logged as a structured warning, counted, and a single
+// summary event is recorded on the pod. Deprecations are only reported the
+// first time a pod mounts them, not again on every rotation.
+//
+func (s *CSIDriverProviderServer) reportDeprecations(ctx context.Context, nameSpace, podName string, descriptors map[provider.SecretType][]*provider.SecretDescriptor) {
+
+	var msgs []string
+	for _, group := range descriptors {
+		for _, descriptor := range group {
+			for _, dep := range getDeprecations(descriptor) {
+				msg := fmt.Sprintf("%s (%s): %s", dep.ObjectName, dep.Field, dep.Message)
+				if !s.reported.First(strings.Join([]string{deprecatedReason, nameSpace, podName, msg}, "/")) {
+					continue
+				}
+				klog.FromContext(ctx).Info("Deprecated SecretProviderClass field", "namespace", nameSpace, "pod", podName,
+					"object", dep.ObjectName, "field", dep.Field, "message", dep.Message)
+				utils.RecordDeprecation(dep.Field)
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	sort.Strings(msgs) // Map iteration order is random
+	s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, deprecatedReason, strings.Join(msgs, "; "))
+}
+
+// Private helper to annotate a pod with a summary of a mount.
+//
+// The annotation (one per volume) records a hash of the mounted object
+// versions, the number of objects, and the time of the mount so operators can
+// tell at a glance which secret versions a pod is running with. The pod is
+// only patched when the hash changes, so rotations that find nothing new do
+// not write to the API server. Failure to annotate the pod is logged but does
+// not fail the mount.
+//
+func (s *CSIDriverProviderServer) annotateMount(ctx context.Context, nameSpace, podName, targetPath string, versions []*v1alpha1.ObjectVersion) {
+
+	ids := make([]string, 0, len(versions))
+	for _, ver := range versions {
+		ids = append(ids, ver.Id+"="+ver.Version)
+	}
+	sort.Strings(ids) // Hash must not depend on map iteration order
+	versionsHash := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(strings.Join(ids, "\n"))))
+
+	s.mountsMu.Lock()
+	unchanged := s.annotated[targetPath] == versionsHash
+	s.mountsMu.Unlock()
+	if unchanged {
+		return
+	}
+
+	summary, _ := json.Marshal(map[string]interface{}{
+		"versionsHash": versionsHash,
+		"objects":      len(versions),
+		"time":         time.Now().UTC().Format(time.RFC3339),
+	})
+
+	// Target paths end in .../volumes/kubernetes.io~csi/<volume>/mount
+	key := auditAnnotation + filepath.Base(filepath.Dir(targetPath))
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{key: string(summary)},
+		},
+	})
+
+	_, err := s.k8sClient.Pods(nameSpace).Patch(ctx, podName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		utils.Warningf("Failed to annotate pod %s in namespace %s: %v", podName, nameSpace, err)
+		return
+	}
+
+	s.mountsMu.Lock()
+	if s.annotated == nil {
+		s.annotated = make(map[string]string)
+	}
+	s.annotated[targetPath] = versionsHash
+	s.mountsMu.Unlock()
+}
+
+// Private helper to record an event on a pod.
+//
+// Failure to record the event is logged but does not fail the mount.
+//
+func (s *CSIDriverProviderServer) recordEvent(ctx context.Context, nameSpace, podName, eventType, reason, msg string) {
+
+	now := metav1.NewTime(time.Now())
+	_, err := s.k8sClient.Events(nameSpace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: podName + ".",
+			Namespace:    nameSpace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  nameSpace,
+			Name:       podName,
+		},
+		Reason:         reason,
+		Message:        msg,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: auth.ProviderName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		utils.Warningf("Failed to record %s event for pod %s in namespace %s: %v", reason, podName, nameSpace, err)
+	}
 }
 
 // Return the provider plugin version information to the driver.
 //
+// The provider API version is the newest one this release serves of those the
+// driver asks for (see the version package). When it serves none of them, the
+// reply holds the newest API version it does serve, so the driver can decide
+// what to do. The runtime version includes the build information (git commit,
+// Go and SDK versions, and enabled features) so version skew shows up in the
+// driver.
+//
 func (s *CSIDriverProviderServer) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
 
+	var requested []string
+	if len(req.GetVersion()) > 0 {
+		requested = append(requested, req.GetVersion())
+	}
+	api, err := version.Negotiate(version.Current(), requested...)
+	if err != nil && len(requested) > 0 {
+		utils.Warningf("Replying with the best supported provider API: %v", err)
+		api, err = version.Negotiate(version.Current())
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	return &v1alpha1.VersionResponse{
-		Version:        "v1alpha1",
+		Version:        api,
 		RuntimeName:    auth.ProviderName,
-		RuntimeVersion: Version,
+		RuntimeVersion: GetBuildInfo().String(),
 	}, nil
 
 }
@@ -245,28 +1414,38 @@ func (s *CSIDriverProviderServer) Version(ctx context.Context, req *v1alpha1.Ver
 //
 // When a region is not specified in the mount request, we must lookup the
 // region of the requesting pod by first descriing the pod to find the node and
-// then describing the node to get the region label.
+// then describing the node to get the region label. Both lookups are briefly
+// cached (when enabled) since the rotation reconciler remounts every pod on the
+// node at about the same time.
 //
 // See also: https://pkg.go.dev/k8s.io/client-go/kubernetes/typed/core/v1
 //
-func (s *CSIDriverProviderServer) getRegionFromNode(ctx context.Context, namespace string, podName string) (reg string, err error) {
+func (s *CSIDriverProviderServer) getRegionFromNode(ctx context.Context, settings *serverSettings, namespace string, podName string) (reg string, err error) {
 
 	// Describe the pod to find the node: kubectl -o yaml -n <namespace> get pod <podid>
-	pod, err := s.k8sClient.Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	nodeName, err := s.lookups.get(ctx, settings.lookupTTL, "pod/"+namespace+"/"+podName, func() (string, error) {
+		pod, err := s.k8sClient.Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return pod.Spec.NodeName, nil
+	})
 	if err != nil {
 		return "", err
 	}
 
 	// Describe node to get region: kubectl -o yaml -n <namespace> get node <nodeid>
-	nodeName := pod.Spec.NodeName
-	node, err := s.k8sClient.Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	region, err := s.lookups.get(ctx, settings.lookupTTL, "node/"+nodeName, func() (string, error) {
+		node, err := s.k8sClient.Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return node.ObjectMeta.Labels[regionLabel], nil
+	})
 	if err != nil {
 		return "", err
 	}
 
-	labels := node.ObjectMeta.Labels
-	region := labels[regionLabel]
-
 	if len(region) == 0 {
 		return "", fmt.Errorf("Region not found")
 	}
@@ -280,12 +1459,28 @@ func (s *CSIDriverProviderServer) getRegionFromNode(ctx context.Context, namespa
 // we write the secret to a temp file and then rename in order to get as close
 // to an atomic update as the file system supports. This is to avoid having
 // pod applications inadvertantly reading an empty or partial files as it is
-// being updated.
+// being updated. If the request is cancelled before the rename, the old secret
+// is left in place.
 //
-func (s *CSIDriverProviderServer) writeFile(secret *provider.SecretValue, mode os.FileMode) (*v1alpha1.File, error) {
+func (s *CSIDriverProviderServer) writeFile(ctx context.Context, secret *provider.SecretValue, mode os.FileMode) (*v1alpha1.File, error) {
+
+	// Don't start a write for a request the driver has given up on.
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("mount request cancelled: %w", err)
+	}
+
+	// The driver can only be told the mode of the files it writes.
+	if s.driverWriteSecrets && !isFetchOnly(ctx) && secret.Descriptor.HasFileOwnership() {
+		return nil, utils.InvalidConfiguration(fmt.Errorf("fileOwner and fileGroup can not be used when the driver writes the secrets: %s", secret.Descriptor.GetFileName()))
+	}
 
-	// Don't write if the driver is supposed to do it.
-	if s.driverWriteSecrets {
+	// Kept paths are only supported when the driver writes the secrets.
+	if !s.driverWriteSecrets && !isFetchOnly(ctx) && secret.Descriptor.GetSourceDescriptor().PreservePath {
+		return nil, utils.InvalidConfiguration(fmt.Errorf("preservePath can only be used when the driver writes the secrets: %s", secret.Descriptor.GetFileName()))
+	}
+
+	// Don't write if the driver is supposed to do it (or for on demand fetches).
+	if s.driverWriteSecrets || isFetchOnly(ctx) {
 
 		return &v1alpha1.File{
 			Path:     secret.Descriptor.GetFileName(),
@@ -295,34 +1490,179 @@ func (s *CSIDriverProviderServer) writeFile(secret *provider.SecretValue, mode o
 
 	}
 
+	return nil, s.writeToMount(ctx, secret, mode)
+}
+
+// Private helper to write a secret to the mount point through a temp file.
+//
+// Used when the provider writes the secrets and for files that do not fit in
+// the response to the driver.
+//
+func (s *CSIDriverProviderServer) writeToMount(ctx context.Context, secret *provider.SecretValue, mode os.FileMode) error {
+
+	// Kept paths get their sub directories created.
+	dir, pattern := secret.Descriptor.GetMountDir(), secret.Descriptor.GetFileName()
+	if secret.Descriptor.GetSourceDescriptor().PreservePath {
+		dir, pattern = filepath.Dir(secret.Descriptor.GetMountPath()), filepath.Base(pattern)
+		if err := mkdirWithinMount(secret.Descriptor.GetMountDir(), dir); err != nil {
+			return err
+		}
+	}
+
+	// Never follow a symbolic link out of the mount point.
+	if err := checkWithinMount(secret.Descriptor.GetMountDir(), secret.Descriptor.GetMountPath()); err != nil {
+		return err
+	}
+
 	// Write to a tempfile first
-	tmpFile, err := ioutil.TempFile(secret.Descriptor.GetMountDir(), secret.Descriptor.GetFileName())
+	tmpFile, err := ioutil.TempFile(dir, pattern)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer os.Remove(tmpFile.Name()) // Cleanup on fail
 	defer tmpFile.Close()           // Don't leak file descriptors
 
 	err = tmpFile.Chmod(mode) // Set correct permissions
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if secret.Descriptor.HasFileOwnership() { // Set the owner (if requested)
+		err = tmpFile.Chown(secret.Descriptor.GetFileOwner(), secret.Descriptor.GetFileGroup())
+		if err != nil {
+			return fmt.Errorf("failed to set the owner of %s: %w", secret.Descriptor.GetFileName(), err)
+		}
 	}
 
 	_, err = tmpFile.Write(secret.Value) // Write the secret
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = tmpFile.Sync() // Make sure to flush to disk
-	if err != nil {
-		return nil, err
+	// Record where the secret came from, if enabled.
+	if utils.DefaultFeatureGate.Enabled(utils.FileProvenanceXattrs) {
+		setProvenance(tmpFile.Name(), secret.Descriptor.GetMountPath(), secret)
+	}
+
+	sync := s.shouldSync(secret.Descriptor.GetMountDir())
+	if sync {
+		err = tmpFile.Sync() // Make sure to flush to disk
+		if err != nil {
+			return err
+		}
+	}
+
+	// Last chance to back out before the new secret becomes visible.
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("mount request cancelled: %w", err)
 	}
 
 	// Swap out the old secret for the new
 	err = os.Rename(tmpFile.Name(), secret.Descriptor.GetMountPath())
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	// Make the rename durable. The new secret is already visible so failures
+	// are only logged.
+	if sync {
+		if err := syncDir(dir); err != nil {
+			klog.Warningf("Failed to sync directory %s: %v", dir, err)
+		}
 	}
 
-	return nil, nil
+	return nil
+}
+
+// Private helper to create the sub directories of a file written below the
+// mount point.
+//
+// Directories are created one at a time, and one that exists must be a real
+// directory, so a symbolic link (for example one left by a compromised pod)
+// is never followed out of the mount point.
+//
+func mkdirWithinMount(mountDir, dir string) error {
+
+	rel, err := filepath.Rel(mountDir, dir)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("refusing to write %s outside of the mount point %s", dir, mountDir)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := mountDir
+	for _, elem := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, elem)
+		info, err := os.Lstat(current)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(current, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case err != nil:
+			return err
+		case !info.IsDir():
+			return fmt.Errorf("refusing to write below %s, which is not a directory", current)
+		}
+	}
+	return nil
+}
+
+// Private helper to make sure a file written at path stays within the mount
+// point once symbolic links are resolved.
+//
+// File names are already checked for ../ when the SecretProviderClass is read,
+// but a symbolic link inside the mount point (for example one left by a
+// compromised pod) could still send a write elsewhere on the node. The
+// directory the file is written to is resolved, since the rename replaces a
+// symbolic link at the file itself rather than following it. A directory that
+// does not exist is left for the write to fail on.
+//
+func checkWithinMount(mountDir, path string) error {
+
+	root, err := filepath.EvalSymlinks(mountDir)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if os.IsNotExist(err) {
+		return nil // Nothing can be written there.
+	}
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("refusing to write %s outside of the mount point %s", path, mountDir)
+	}
+	return nil
+}
+
+// Private helper to decide if written secrets should be synced to disk.
+//
+// Syncing is not needed on tmpfs (the usual case for mounts created by the
+// driver) since nothing is ever written to disk.
+//
+func (s *CSIDriverProviderServer) shouldSync(dir string) bool {
+	switch s.syncPolicy {
+	case SyncNever:
+		return false
+	case SyncAuto:
+		return !isTmpfs(dir)
+	}
+	return true
+}
+
+// Private helper to flush a directory (and so renames within it) to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
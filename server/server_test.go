@@ -1,16 +1,19 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -20,14 +23,20 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 	"sigs.k8s.io/yaml"
 
 	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/internal/fixtures"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
 	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
 )
 
 type MockParameterStoreClient struct {
@@ -173,9 +182,9 @@ func newServerWithMocks(tstData *testCase, driverWrites bool) *CSIDriverProvider
 		}
 		if backupRegionSsmRsp != nil || ssmBrReqErr != nil {
 			paramClients = append(paramClients, provider.ParameterStoreClient{
-				Region:     failoverRegion,
-				Client:     &MockParameterStoreClient{rsp: backupRegionSsmRsp, reqErr: ssmBrReqErr},
-				IsFailover: true,
+				Region:        failoverRegion,
+				Client:        &MockParameterStoreClient{rsp: backupRegionSsmRsp, reqErr: ssmBrReqErr},
+				FailoverIndex: 1,
 			})
 		}
 
@@ -262,6 +271,27 @@ func buildMountReq(dir string, tst testCase, curState []*v1alpha1.ObjectVersion)
 		attrMap["pathTranslation"] = translate
 	}
 
+	jmesTranslate := tst.attributes["jmesPathTranslation"]
+	if len(jmesTranslate) > 0 {
+		attrMap["jmesPathTranslation"] = jmesTranslate
+	}
+
+	templates := tst.attributes["objectsTemplate"]
+	if len(templates) > 0 {
+		attrMap["objectsTemplate"] = templates
+	}
+
+	for _, attr := range []string{"secretsManagerEndpointUrl", "ssmEndpointUrl"} {
+		if endpointURL := tst.attributes[attr]; len(endpointURL) > 0 {
+			attrMap[attr] = endpointURL
+		}
+	}
+
+	sharedObjects := tst.attributes["sharedObjects"]
+	if len(sharedObjects) > 0 {
+		attrMap["sharedObjects"] = sharedObjects
+	}
+
 	objs, err := yaml.Marshal(tst.mountObjs)
 	if err != nil {
 		panic(err)
@@ -497,6 +527,56 @@ var mountTests []testCase = []testCase{
 		},
 		perms: "420",
 	},
+	{ // Mount every key of a json secret
+		testName:   "Mount Json Explode Success",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager", "objectExplode": true},
+			{"objectName": "TestParm1", "objectType": "ssmparameter", "objectExplode": true, "writeParent": false},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String(`{"host": "db.example.com"}`), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"username": "SecretsManagerUser", "password": "SecretsManagerPassword", "port": 5432}`), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		expErr:  "",
+		expSecrets: map[string]string{
+			"TestSecret1": `{"username": "SecretsManagerUser", "password": "SecretsManagerPassword", "port": 5432}`,
+			"username":    "SecretsManagerUser",
+			"password":    "SecretsManagerPassword",
+			"port":        "5432",
+			"host":        "db.example.com",
+		},
+		perms: "420",
+	},
+	{ // Exploded keys can not overwrite other files
+		testName:   "Mount Json Explode Collision",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager", "objectExplode": true},
+			{"objectName": "TestParm1", "objectType": "ssmparameter"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"TestParm1": "SecretsManagerValue"}`), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expErr:     "objectExplode key of TestSecret1 collides with another file of the mount: TestParm1",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
 	{ // Mount a binary secret
 		testName:   "New Mount Binary Success",
 		attributes: stdAttributes,
@@ -647,7 +727,7 @@ var mountTests []testCase = []testCase{
 		descRsp:    []*secretsmanager.DescribeSecretOutput{},
 		expErr:     "failed to unmarshal file permission",
 		expSecrets: map[string]string{},
-		perms:      "",
+		perms:      "rw-r--r--",
 	},
 	{ // Verify failure when we can not initialize the auth session (no role).
 		testName: "Fail Session",
@@ -853,6 +933,23 @@ var mountTests []testCase = []testCase{
 		},
 		perms: "420",
 	},
+	{ // Verify failure if we use a bad jmesPath translation string
+		testName: "Fail jmesPathTranslation",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "", "roleARN": "fakeRole",
+			"jmesPathTranslation": "--",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		ssmRsp:     []*ssm.GetParametersOutput{},
+		gsvRsp:     []*secretsmanager.GetSecretValueOutput{},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expErr:     "jmesPathTranslation must be",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
 	{ // Verify failure if we use a bad path translation string
 		testName: "Fail pathTranslation",
 		attributes: map[string]string{
@@ -900,6 +997,60 @@ var mountTests []testCase = []testCase{
 		},
 		perms: "420",
 	},
+	{ // Verify encoded values are decoded before they are mounted.
+		testName:   "Object Encoding",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{
+				"objectName":     "TestSecret1",
+				"objectType":     "secretsmanager",
+				"objectEncoding": "base64",
+				"jmesPath": []map[string]string{
+					{"path": "username", "objectAlias": "user"},
+				},
+			},
+			{"objectName": "TestParm1", "objectType": "ssmparameter", "objectEncoding": "hex"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String("7061726d31"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("eyJ1c2VybmFtZSI6ICJ1c2VyMSJ9"), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		expSecrets: map[string]string{
+			"TestSecret1": `{"username": "user1"}`,
+			"user":        "user1",
+			"TestParm1":   "parm1",
+		},
+		perms: "420",
+	},
+	{ // Verify failure when a value is larger than its maxSize.
+		testName:   "Fail maxSize",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager", "maxSize": 4},
+			{"objectName": "TestParm1", "objectType": "ssmparameter", "maxSize": 5},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expErr:     "value of TestSecret1 is 7 bytes which exceeds maxSize of 4 bytes",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
 }
 
 var stdAttributesWithBackupRegion map[string]string = map[string]string{
@@ -1099,6 +1250,74 @@ var mountTestsForMultiRegion []testCase = []testCase{
 		expSecrets: map[string]string{},
 		perms:      "420",
 	},
+	{ // Verify failure when a failover region is listed twice
+		testName: "Repeated FallbackRegion Fail",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "fakeRegion", "roleARN": "fakeRole", "failoverRegion": "fakeBackupRegion, fakeBackupRegion",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		expErr:     "failover region is listed more than once",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
+	{ // Verify failure when a failover region is in another partition
+		testName: "Cross Partition FallbackRegion Fail",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "cn-north-1", "roleARN": "fakeRole", "failoverRegion": "cn-northwest-1,us-east-1",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		expErr:     "us-east-1: failover region is not in the same partition as region cn-north-1",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
+	{ // Verify failure when the mount endpoint is not https
+		testName: "Insecure Endpoint URL Fail",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "us-west-2", "roleARN": "fakeRole",
+			"secretsManagerEndpointUrl": "https://vpce-0123.secretsmanager.{region}.vpce.amazonaws.com",
+			"ssmEndpointUrl":            "http://vpce-0123.ssm.{region}.vpce.amazonaws.com",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		expErr:     "ssmEndpointUrl must be an https URL: http://vpce-0123.ssm.us-west-2.vpce.amazonaws.com",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
+	{ // Verify failure when the mount endpoint is not valid in the region of an object
+		testName: "Object Region Endpoint URL Fail",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "fakeRegion", "roleARN": "fakeRole",
+			"secretsManagerEndpointUrl": "https://vpce-0123.secretsmanager.{region}.vpce.amazonaws.com",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager", "region": "cn-north-1"},
+		},
+		expErr:     "secretsManagerEndpointUrl must be an endpoint in amazonaws.com.cn: https://vpce-0123.secretsmanager.cn-north-1.vpce.amazonaws.com",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
+	{ // Verify failure when the failover region list has an empty entry
+		testName: "Empty FallbackRegion Fail",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "fakeRegion", "roleARN": "fakeRole", "failoverRegion": "fakeBackupRegion,",
+		},
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		expErr:     "failover regions can not be empty",
+		expSecrets: map[string]string{},
+		perms:      "420",
+	},
 	{ // Verify failure when we can not initialize the auth session (no role) in region and failoverRegion.
 		testName: "Multi Region Session Fail",
 		attributes: map[string]string{
@@ -1896,6 +2115,42 @@ var writeOnlyMountTests []testCase = []testCase{
 
 // Test that only run with driverWriteSecrets = true
 var noWriteMountTests []testCase = []testCase{
+	{ // Verify jmesPath aliases can use sub directories while names are flattened (driver writes only)
+		testName: "JMES Path Translation Off",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "", "roleARN": "fakeRole",
+			"jmesPathTranslation": "False",
+		},
+		mountObjs: []map[string]interface{}{
+			{
+				"objectName": "mypath/TestSecret1",
+				"objectType": "secretsmanager",
+				"jmesPath": []map[string]string{
+					{"path": "username", "objectAlias": "db/username"},
+				},
+			},
+			{"objectName": "mypath/TestParm1", "objectType": "ssmparameter"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("mypath/TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"username": "user1"}`), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		expErr:  "",
+		expSecrets: map[string]string{
+			"mypath_TestSecret1": `{"username": "user1"}`,
+			"mypath_TestParm1":   "parm1",
+			"db/username":        "user1",
+		},
+		perms: "420",
+	},
 	{ // Verify success when using leading slashes with driver write
 		testName: "Full path OK",
 		attributes: map[string]string{
@@ -1937,9 +2192,49 @@ func nameMapper(c rune) rune {
 	return c
 }
 
+// Load the mount scenarios of a fixture file as test cases.
+func fixtureTests(t *testing.T, path string) []testCase {
+
+	loaded, err := fixtures.Load(path)
+	if err != nil {
+		t.Fatalf("Can not load fixtures: %v", err)
+	}
+	var tests []testCase
+	for _, fixture := range loaded {
+		tst := testCase{
+			testName:    fixture.Name,
+			attributes:  fixture.Attributes,
+			mountObjs:   fixture.Objects,
+			gsvRsp:      fixture.Primary.GetSecretValueOutputs(),
+			descRsp:     fixture.Primary.DescribeSecretOutputs(),
+			ssmRsp:      fixture.Primary.GetParametersOutputs(),
+			reqErr:      fixture.Primary.SecretsManagerErr(),
+			ssmReqErr:   fixture.Primary.SSMErr(),
+			brGsvRsp:    fixture.Failover.GetSecretValueOutputs(),
+			brDescRsp:   fixture.Failover.DescribeSecretOutputs(),
+			brSsmRsp:    fixture.Failover.GetParametersOutputs(),
+			brReqErr:    fixture.Failover.SecretsManagerErr(),
+			ssmBrReqErr: fixture.Failover.SSMErr(),
+			expErr:      fixture.ExpError,
+			brExpErr:    fixture.ExpFailoverError,
+			expSecrets:  fixture.ExpSecrets,
+			perms:       fixture.Perms,
+		}
+		if tst.attributes == nil {
+			tst.attributes = stdAttributes
+		}
+		if len(tst.perms) == 0 {
+			tst.perms = "420"
+		}
+		tests = append(tests, tst)
+	}
+	return tests
+}
+
 func TestMounts(t *testing.T) {
 	testCases := append(mountTests, mountTestsForMultiRegion...)
 	allTests := append(testCases, writeOnlyMountTests...)
+	allTests = append(allTests, fixtureTests(t, "testdata/mount_fixtures.yaml")...)
 	for _, tst := range allTests {
 
 		t.Run(tst.testName, func(t *testing.T) {
@@ -1954,7 +2249,7 @@ func TestMounts(t *testing.T) {
 
 			// Do the mount
 			req := buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})
-			rsp, err := svr.Mount(nil, req)
+			rsp, err := svr.Mount(context.Background(), req)
 			if len(tst.expErr) == 0 && err != nil {
 				t.Fatalf("%s: Got unexpected error: %s", tst.testName, err)
 			}
@@ -1995,7 +2290,7 @@ func TestMountsNoWrite(t *testing.T) {
 
 			// Do the mount
 			req := buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})
-			rsp, err := svr.Mount(nil, req)
+			rsp, err := svr.Mount(context.Background(), req)
 			if len(tst.expErr) == 0 && err != nil {
 				t.Fatalf("%s: Got unexpected error: %s", tst.testName, err)
 			}
@@ -2418,7 +2713,7 @@ func TestReMounts(t *testing.T) {
 
 			// Do the mount
 			req := buildMountReq(dir, tst, curState)
-			rsp, err := svr.Mount(nil, req)
+			rsp, err := svr.Mount(context.Background(), req)
 			if len(tst.expErr) == 0 && err != nil {
 				t.Fatalf("%s: Got unexpected error: %s", tst.testName, err)
 			}
@@ -2460,7 +2755,7 @@ func TestNoWriteReMounts(t *testing.T) {
 
 			// Do the mount
 			req := buildMountReq(dir, tst, curState)
-			rsp, err := svr.Mount(nil, req)
+			rsp, err := svr.Mount(context.Background(), req)
 			if len(tst.expErr) == 0 && err != nil {
 				t.Fatalf("%s: Got unexpected error: %s", tst.testName, err)
 			}
@@ -2497,7 +2792,7 @@ func TestEmptyAttributes(t *testing.T) {
 		Permission:           "420",
 		CurrentObjectVersion: []*v1alpha1.ObjectVersion{},
 	}
-	rsp, err := svr.Mount(nil, req)
+	rsp, err := svr.Mount(context.Background(), req)
 
 	if rsp != nil {
 		t.Fatalf("TestEmptyAttributes: got unexpected response")
@@ -2509,6 +2804,26 @@ func TestEmptyAttributes(t *testing.T) {
 
 }
 
+func TestBadRetryAttributes(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	for attrib, expErr := range map[string]string{
+		`{"awsRetryMode": "legacy"}`: "retry mode must be one of standard or adaptive",
+		`{"awsMaxRetries": "100"}`:   "max retries must be a number from 0 to 10",
+	} {
+		req := &v1alpha1.MountRequest{
+			Attributes:           attrib,
+			TargetPath:           "/tmp",
+			Permission:           "420",
+			CurrentObjectVersion: []*v1alpha1.ObjectVersion{},
+		}
+		_, err := svr.Mount(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Fatalf("TestBadRetryAttributes: Unexpected error %v", err)
+		}
+	}
+}
+
 func TestNoPath(t *testing.T) {
 
 	svr := newServerWithMocks(nil, false)
@@ -2517,7 +2832,7 @@ func TestNoPath(t *testing.T) {
 		Permission:           "420",
 		CurrentObjectVersion: []*v1alpha1.ObjectVersion{},
 	}
-	rsp, err := svr.Mount(nil, req)
+	rsp, err := svr.Mount(context.Background(), req)
 
 	if rsp != nil {
 		t.Fatalf("TestNoPath: got unexpected response")
@@ -2529,25 +2844,990 @@ func TestNoPath(t *testing.T) {
 
 }
 
-// Make sure the Version call works
-func TestDriverVersion(t *testing.T) {
+// Make sure a cancelled request does not fetch or write anything.
+func TestCancelledMount(t *testing.T) {
 
-	svr, err := NewServer(nil, nil, true)
+	dir, err := ioutil.TempDir("", "TestCancelledMount")
 	if err != nil {
-		t.Fatalf("TestDriverVersion: got unexpected server error %s", err.Error())
+		panic(err)
 	}
-	if svr == nil {
-		t.Fatalf("TestDriverVersion: got empty server")
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rsp, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if rsp != nil {
+		t.Fatalf("TestCancelledMount: got unexpected response")
+	} else if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("TestCancelledMount: Unexpected error %v", err)
 	}
 
-	ver, err := svr.Version(nil, &v1alpha1.VersionRequest{})
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		t.Fatalf("TestDriverVersion: got unexpected error %s", err.Error())
+		t.Fatalf("TestCancelledMount: can not read mount dir: %v", err)
 	}
-	if ver == nil {
-		t.Fatalf("TestDriverVersion: got empty response")
+	if len(files) != 0 {
+		t.Fatalf("TestCancelledMount: expected no files, got %d", len(files))
 	}
-	if ver.RuntimeName != auth.ProviderName {
-		t.Fatalf("TestDriverVersion: wrong RuntimeName: %s", ver.RuntimeName)
+}
+
+// Make sure an event is recorded when a secret fails back to the primary region.
+func TestFailbackEvent(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	descriptors, err := provider.NewSecretDescriptorList("/tmp", "", "", "- objectName: TestSecret1\n  objectType: secretsmanager", []string{"fakeRegion"})
+	if err != nil {
+		t.Fatalf("TestFailbackEvent: unexpected error %v", err)
+	}
+	descriptor := *descriptors[provider.SecretsManager][0]
+	ctx := context.Background()
+
+	svr.trackFailover(ctx, "fakeNS", "fakePod", []*provider.SecretValue{{Descriptor: descriptor, IsFailover: true}})
+	svr.trackFailover(ctx, "fakeNS", "fakePod", []*provider.SecretValue{{Descriptor: descriptor, IsFailover: true}})
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 0 {
+		t.Fatalf("TestFailbackEvent: expected no events while on failover, got %d", len(events.Items))
+	}
+
+	svr.trackFailover(ctx, "fakeNS", "fakePod", []*provider.SecretValue{{Descriptor: descriptor}})
+	events, _ = svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("TestFailbackEvent: expected one event, got %d", len(events.Items))
+	}
+	if events.Items[0].Reason != failbackReason || events.Items[0].InvolvedObject.Name != "fakePod" {
+		t.Fatalf("TestFailbackEvent: unexpected event %+v", events.Items[0])
+	}
+
+	// Already on the primary region, so no new event.
+	svr.trackFailover(ctx, "fakeNS", "fakePod", []*provider.SecretValue{{Descriptor: descriptor}})
+	events, _ = svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("TestFailbackEvent: expected one event, got %d", len(events.Items))
+	}
+}
+
+// Make sure the failover state of a pod is dropped once its target path is gone.
+func TestFailoverPruned(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	dir := t.TempDir()
+	descriptors, err := provider.NewSecretDescriptorList(dir, "", "", "- objectName: TestSecret1\n  objectType: secretsmanager", []string{"fakeRegion"})
+	if err != nil {
+		t.Fatalf("TestFailoverPruned: unexpected error %v", err)
+	}
+	ctx := context.Background()
+
+	svr.trackFailover(ctx, "fakeNS", "fakePod", []*provider.SecretValue{{Descriptor: *descriptors[provider.SecretsManager][0], IsFailover: true}})
+	if len(svr.failoverPaths) != 1 {
+		t.Fatalf("TestFailoverPruned: expected the failover to be tracked, got %v", svr.failoverPaths)
+	}
+
+	os.RemoveAll(dir)
+	svr.trackFailover(ctx, "fakeNS", "otherPod", nil)
+	if len(svr.failoverPaths) != 0 {
+		t.Fatalf("TestFailoverPruned: expected the removed mount to be dropped, got %v", svr.failoverPaths)
+	}
+}
+
+// Make sure each advanced tier parameter is only reported the first time it is mounted.
+func TestAdvancedTierEvent(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	ctx := context.Background()
+	parm1 := &provider.SecretValue{Descriptor: provider.SecretDescriptor{ObjectName: "Parm1"}, AdvancedTier: true}
+	parm2 := &provider.SecretValue{Descriptor: provider.SecretDescriptor{ObjectName: "Parm2"}, AdvancedTier: true}
+
+	svr.checkAdvancedTier(ctx, "fakeNS", "fakePod", []*provider.SecretValue{parm1})
+	svr.checkAdvancedTier(ctx, "fakeNS", "fakePod", []*provider.SecretValue{parm1})
+	svr.checkAdvancedTier(ctx, "otherNS", "otherPod", []*provider.SecretValue{parm1, parm2})
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != advancedTierReason || !strings.HasSuffix(events.Items[0].Message, ": Parm1") {
+		t.Fatalf("TestAdvancedTierEvent: expected one event for Parm1, got %+v", events.Items)
+	}
+	events, _ = svr.k8sClient.Events("otherNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || !strings.HasSuffix(events.Items[0].Message, ": Parm2") {
+		t.Fatalf("TestAdvancedTierEvent: expected one event for Parm2, got %+v", events.Items)
+	}
+}
+
+// Make sure expiring secrets are not reported on every mount.
+func TestExpiringEvent(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	ctx := context.Background()
+	expiring := &provider.SecretValue{Descriptor: provider.SecretDescriptor{ObjectName: "Parm1"}, Expiration: time.Now().Add(time.Hour)}
+	current := &provider.SecretValue{Descriptor: provider.SecretDescriptor{ObjectName: "Parm2"}}
+
+	svr.checkExpiration(ctx, "fakeNS", "fakePod", []*provider.SecretValue{expiring, current})
+	svr.checkExpiration(ctx, "fakeNS", "fakePod", []*provider.SecretValue{expiring, current})
+	svr.checkExpiration(ctx, "otherNS", "otherPod", []*provider.SecretValue{expiring})
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != expiringReason || !strings.Contains(events.Items[0].Message, ": Parm1 (") {
+		t.Fatalf("TestExpiringEvent: expected one event for Parm1, got %+v", events.Items)
+	}
+	events, _ = svr.k8sClient.Events("otherNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("TestExpiringEvent: expected one event for the other pod, got %+v", events.Items)
+	}
+}
+
+// Make sure mounts wait for a free slot and give up at the deadline.
+func TestMaxConcurrentMounts(t *testing.T) {
+
+	_, err := NewServer(nil, nil, ServerOptions{MaxConcurrentMounts: -1})
+	if err == nil || !strings.Contains(err.Error(), "can not be negative") {
+		t.Fatalf("TestMaxConcurrentMounts: Unexpected error %v", err)
+	}
+
+	svr, err := NewServer(nil, nil, ServerOptions{MaxConcurrentMounts: 1})
+	if err != nil {
+		t.Fatalf("TestMaxConcurrentMounts: got unexpected server error %s", err.Error())
+	}
+
+	release, err := svr.acquireMountSlot(context.Background(), svr.loadSettings())
+	if err != nil {
+		t.Fatalf("TestMaxConcurrentMounts: got unexpected error %s", err.Error())
+	}
+
+	// The only slot is taken so this mount must time out.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rsp, err := svr.Mount(ctx, &v1alpha1.MountRequest{TargetPath: "/tmp", Attributes: "{}", Permission: "420"})
+	if rsp != nil {
+		t.Fatalf("TestMaxConcurrentMounts: got unexpected response")
+	} else if err == nil || !strings.Contains(err.Error(), "timed out waiting for a mount slot") {
+		t.Fatalf("TestMaxConcurrentMounts: Unexpected error %v", err)
+	}
+
+	// Once released the slot can be used again.
+	release()
+	release, err = svr.acquireMountSlot(context.Background(), svr.loadSettings())
+	if err != nil {
+		t.Fatalf("TestMaxConcurrentMounts: got unexpected error %s", err.Error())
+	}
+	release()
+}
+
+// Make sure malformed mount attributes are rejected rather than crashing.
+func FuzzMountAttributes(f *testing.F) {
+	tst := mountTests[0]
+	req := buildMountReq("/tmp", tst, nil)
+	f.Add(req.Attributes, req.Permission)
+	f.Add("{}", "420")
+	f.Add(`{"objects": "- objectName: x", "region": "us-west-2", "pathTranslation": "ab"}`, "-1")
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, attributes, permission string) {
+		dir := t.TempDir()
+		svr := newServerWithMocks(nil, false)
+		svr.Mount(context.Background(), &v1alpha1.MountRequest{
+			Attributes: attributes,
+			TargetPath: dir,
+			Permission: permission,
+		})
+	})
+}
+
+// Make sure oversized requests are rejected.
+func TestOversizedAttributes(t *testing.T) {
+
+	svr := newServerWithMocks(nil, false)
+	req := &v1alpha1.MountRequest{
+		Attributes: fmt.Sprintf(`{"objects": "%s"}`, strings.Repeat("x", maxAttributesSize)),
+		TargetPath: "/tmp",
+		Permission: "420",
+	}
+	rsp, err := svr.Mount(context.Background(), req)
+
+	if rsp != nil {
+		t.Fatalf("TestOversizedAttributes: got unexpected response")
+	} else if err == nil || !strings.Contains(err.Error(), "attributes exceed") {
+		t.Fatalf("TestOversizedAttributes: Unexpected error %v", err)
+	}
+}
+
+// Make sure deprecated fields are reported with an event.
+func TestDeprecationEvent(t *testing.T) {
+
+	defer func(get func(*provider.SecretDescriptor) []provider.Deprecation) { getDeprecations = get }(getDeprecations)
+	getDeprecations = func(d *provider.SecretDescriptor) []provider.Deprecation {
+		return []provider.Deprecation{{ObjectName: d.ObjectName, Field: "objectAlias", Message: "use something else"}}
+	}
+
+	svr := newServerWithMocks(nil, false)
+	descriptors, err := provider.NewSecretDescriptorList("/tmp", "", "", "- objectName: feaw\n  objectType: ssmparameter", []string{"fakeRegion"})
+	if err != nil {
+		t.Fatalf("TestDeprecationEvent: unexpected error %v", err)
+	}
+	ctx := context.Background()
+
+	svr.reportDeprecations(ctx, "fakeNS", "fakePod", descriptors)
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("TestDeprecationEvent: expected one event, got %d", len(events.Items))
+	}
+	if events.Items[0].Reason != deprecatedReason || events.Items[0].Message != "feaw (objectAlias): use something else" {
+		t.Fatalf("TestDeprecationEvent: unexpected event %+v", events.Items[0])
+	}
+
+	// Not reported again on rotation, but reported for other pods.
+	svr.reportDeprecations(ctx, "fakeNS", "fakePod", descriptors)
+	svr.reportDeprecations(ctx, "otherNS", "otherPod", descriptors)
+	if events, _ = svr.k8sClient.Events("otherNS").List(ctx, metav1.ListOptions{}); len(events.Items) != 1 {
+		t.Fatalf("TestDeprecationEvent: expected one event for the other pod, got %d", len(events.Items))
+	}
+	var metrics bytes.Buffer
+	utils.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `secrets_store_csi_driver_provider_aws_deprecated_fields_total{field="objectAlias"} 2`) {
+		t.Fatalf("TestDeprecationEvent: expected the deprecations to be counted: %s", metrics.String())
+	}
+}
+
+// Make sure objects are written after the objects they depend on.
+func TestDependsOnOrder(t *testing.T) {
+
+	tst := testCase{
+		testName:   "Depends On",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestParm1", "objectType": "ssmparameter", "dependsOn": []string{"TestSecret1"}},
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					&ssm.Parameter{Name: aws.String("TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		perms:   "420",
+	}
+
+	// Map iteration order is random so try a few times.
+	for i := 0; i < 10; i++ {
+		svr := newServerWithMocks(&tst, true)
+		rsp, err := svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+		if err != nil {
+			t.Fatalf("TestDependsOnOrder: got unexpected error %s", err.Error())
+		}
+		if len(rsp.Files) != 2 || rsp.Files[0].Path != "TestSecret1" || rsp.Files[1].Path != "TestParm1" {
+			t.Fatalf("TestDependsOnOrder: files written out of order: %+v", rsp.Files)
+		}
+	}
+}
+
+// Make sure mounts fail before fetching anything when an object name does not
+// follow the naming policy.
+func TestObjectNamePolicy(t *testing.T) {
+
+	policy, err := provider.NewObjectNamePolicy("Test{cluster}.*", "Secret")
+	if err != nil {
+		t.Fatalf("TestObjectNamePolicy: got unexpected error %s", err.Error())
+	}
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, true)
+	svr.namePolicy = policy
+	_, err = svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "object name does not match the naming policy") {
+		t.Fatalf("TestObjectNamePolicy: unexpected error %v", err)
+	}
+
+	svr.namePolicy, _ = provider.NewObjectNamePolicy("Test.*", "")
+	_, err = svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestObjectNamePolicy: got unexpected error %s", err.Error())
+	}
+}
+
+func TestObjectDenylist(t *testing.T) {
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, true)
+	svr.denylist, _ = provider.NewObjectDenylist("TestSecret*")
+	_, err := svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "object is on the provider denylist") {
+		t.Fatalf("TestObjectDenylist: unexpected error %v", err)
+	}
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.PermissionDenied {
+		t.Fatalf("TestObjectDenylist: expected PermissionDenied but got %v", err)
+	}
+
+	svr.denylist, _ = provider.NewObjectDenylist("OtherSecret")
+	_, err = svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestObjectDenylist: got unexpected error %s", err.Error())
+	}
+
+	// Denied mounts fail before secrets are looked up by tag (the mock client
+	// can not list secrets).
+	tst.mountObjs = append(tst.mountObjs, map[string]interface{}{"objectType": "secretsmanager", "objectTags": map[string]string{"team": "payments"}})
+	svr = newServerWithMocks(&tst, true)
+	svr.denylist, _ = provider.NewObjectDenylist("TestSecret*")
+	_, err = svr.Mount(context.Background(), buildMountReq("/tmp", tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "object is on the provider denylist") {
+		t.Fatalf("TestObjectDenylist: expected a denial before the tag lookup, got %v", err)
+	}
+}
+
+// Make sure only the jmesPath entries are written when writeParent is false,
+// including on rotation.
+func TestWriteParentFalse(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestWriteParentFalse")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := testCase{
+		testName:   "Write Parent False",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{
+				"objectName":  "TestSecret1",
+				"objectType":  "secretsmanager",
+				"writeParent": false,
+				"jmesPath": []map[string]string{
+					{"path": "username", "objectAlias": "user"},
+				},
+			},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"username": "user1"}`), VersionId: aws.String("1")},
+			{SecretString: aws.String(`{"username": "user1"}`), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{
+			{VersionIdsToStages: map[string][]*string{"1": {aws.String("AWSCURRENT")}}},
+		},
+		perms: "420",
+	}
+	svr := newServerWithMocks(&tst, false)
+
+	// Mount twice to make sure the current version is not read back in.
+	var curVersions []*v1alpha1.ObjectVersion
+	for i := 0; i < 2; i++ {
+		rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, curVersions))
+		if err != nil {
+			t.Fatalf("TestWriteParentFalse: got unexpected error %s", err.Error())
+		}
+		curVersions = rsp.ObjectVersion
+
+		user, err := ioutil.ReadFile(filepath.Join(dir, "user"))
+		if err != nil || string(user) != "user1" {
+			t.Fatalf("TestWriteParentFalse: bad jmesPath file %s: %v", string(user), err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "TestSecret1")); !os.IsNotExist(err) {
+			t.Fatalf("TestWriteParentFalse: parent file was written")
+		}
+	}
+}
+
+// Make sure templated files are rendered from the fetched secrets.
+func TestObjectsTemplate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestObjectsTemplate")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := testCase{
+		testName: "Objects Template",
+		attributes: map[string]string{
+			"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod",
+			"nodeName": "fakeNode", "region": "", "roleARN": "fakeRole",
+			"objectsTemplate": `
+- fileName: database.yaml
+  template: |
+    username: {{ .user }}
+    password: {{ secret "pass" | json }}
+`,
+		},
+		mountObjs: []map[string]interface{}{
+			{
+				"objectName":  "TestSecret1",
+				"objectType":  "secretsmanager",
+				"writeParent": false,
+				"jmesPath": []map[string]string{
+					{"path": "username", "objectAlias": "user"},
+					{"path": "password", "objectAlias": "pass"},
+				},
+			},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(`{"username": "user1", "password": "pass\"1"}`), VersionId: aws.String("1")},
+			{SecretString: aws.String(`{"username": "user1", "password": "pass\"1"}`), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{
+			{VersionIdsToStages: map[string][]*string{"1": {aws.String("AWSCURRENT")}}},
+		},
+		perms: "420",
+	}
+	svr := newServerWithMocks(&tst, false)
+
+	// Mount twice to make sure templates are rendered on rotation as well.
+	var curVersions []*v1alpha1.ObjectVersion
+	for i := 0; i < 2; i++ {
+		rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, curVersions))
+		if err != nil {
+			t.Fatalf("TestObjectsTemplate: got unexpected error %s", err.Error())
+		}
+		curVersions = rsp.ObjectVersion
+
+		rendered, err := ioutil.ReadFile(filepath.Join(dir, "database.yaml"))
+		if err != nil || string(rendered) != "username: user1\npassword: \"pass\\\"1\"\n" {
+			t.Fatalf("TestObjectsTemplate: bad rendered file %s: %v", string(rendered), err)
+		}
+		found := false
+		for _, ver := range rsp.ObjectVersion {
+			found = found || (ver.Id == "database.yaml" && len(ver.Version) > 0)
+		}
+		if !found {
+			t.Fatalf("TestObjectsTemplate: no version for the rendered file: %v", rsp.ObjectVersion)
+		}
+	}
+
+	// Missing names fail the mount.
+	tst.attributes["objectsTemplate"] = `[{"fileName": "bad.yaml", "template": "{{ .missing }}"}]`
+	svr = newServerWithMocks(&tst, false)
+	_, err = svr.Mount(context.Background(), buildMountReq(dir, tst, nil))
+	if err == nil || !strings.Contains(err.Error(), "Failed to render template bad.yaml") {
+		t.Fatalf("TestObjectsTemplate: expected render error, got %v", err)
+	}
+}
+
+// Make sure pods are annotated with the mounted versions when enabled.
+func TestAuditAnnotation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestAuditAnnotation")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+	mountDir := filepath.Join(dir, "myVolume", "mount")
+	os.MkdirAll(mountDir, 0755)
+
+	utils.DefaultFeatureGate.Set("PodAuditAnnotation=true")
+	defer utils.DefaultFeatureGate.Set("PodAuditAnnotation=false")
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, false)
+	ctx := context.Background()
+	_, err = svr.Mount(ctx, buildMountReq(mountDir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestAuditAnnotation: got unexpected error %s", err.Error())
+	}
+
+	pod, err := svr.k8sClient.Pods(tst.attributes["namespace"]).Get(ctx, tst.attributes["podName"], metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("TestAuditAnnotation: got unexpected error %s", err.Error())
+	}
+	var summary map[string]interface{}
+	err = json.Unmarshal([]byte(pod.Annotations[auditAnnotation+"myVolume"]), &summary)
+	if err != nil {
+		t.Fatalf("TestAuditAnnotation: bad annotation %v: %v", pod.Annotations, err)
+	}
+	if !strings.HasPrefix(summary["versionsHash"].(string), "sha256:") || summary["objects"].(float64) != float64(len(tst.expSecrets)) {
+		t.Fatalf("TestAuditAnnotation: unexpected summary %v", summary)
+	}
+
+	// The pod is not patched again when the versions do not change.
+	pod.Annotations = nil
+	svr.k8sClient.Pods(pod.Namespace).Update(ctx, pod, metav1.UpdateOptions{})
+	_, err = svr.Mount(ctx, buildMountReq(mountDir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestAuditAnnotation: got unexpected error %s", err.Error())
+	}
+	pod, _ = svr.k8sClient.Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if len(pod.Annotations[auditAnnotation+"myVolume"]) != 0 {
+		t.Fatalf("TestAuditAnnotation: expected no patch for unchanged versions, got %v", pod.Annotations)
+	}
+}
+
+// Make sure the Version call works
+func TestDriverVersion(t *testing.T) {
+
+	svr, err := NewServer(nil, nil, ServerOptions{DriverWriteSecrets: true})
+	if err != nil {
+		t.Fatalf("TestDriverVersion: got unexpected server error %s", err.Error())
+	}
+	if svr == nil {
+		t.Fatalf("TestDriverVersion: got empty server")
+	}
+
+	ver, err := svr.Version(context.Background(), &v1alpha1.VersionRequest{})
+	if err != nil {
+		t.Fatalf("TestDriverVersion: got unexpected error %s", err.Error())
+	}
+	if ver == nil {
+		t.Fatalf("TestDriverVersion: got empty response")
+	}
+	if ver.RuntimeName != auth.ProviderName {
+		t.Fatalf("TestDriverVersion: wrong RuntimeName: %s", ver.RuntimeName)
+	}
+	if !strings.HasPrefix(ver.RuntimeVersion, version.Current().String()+" (commit ") {
+		t.Fatalf("TestDriverVersion: wrong RuntimeVersion: %s", ver.RuntimeVersion)
+	}
+	if ver.Version != "v1alpha1" {
+		t.Fatalf("TestDriverVersion: wrong Version: %s", ver.Version)
+	}
+
+	// An API version that is not served gets the best supported one.
+	ver, err = svr.Version(context.Background(), &v1alpha1.VersionRequest{Version: "v0"})
+	if err != nil || ver.Version != "v1alpha1" {
+		t.Fatalf("TestDriverVersion: expected the best supported API, got %v %v", ver, err)
+	}
+}
+
+// Make sure the workload is only identified in the user agent when enabled.
+func TestWorkloadUserAgent(t *testing.T) {
+
+	if _, err := NewServer(nil, nil, ServerOptions{WorkloadUA: "everything"}); err == nil {
+		t.Fatalf("TestWorkloadUserAgent: expected error for bad mode")
+	}
+
+	svr, err := NewServer(nil, nil, ServerOptions{})
+	if err != nil {
+		t.Fatalf("TestWorkloadUserAgent: got unexpected error %s", err.Error())
+	}
+	if ua := svr.workloadUserAgent("myNS", "- objectName: secret"); ua != "" {
+		t.Fatalf("TestWorkloadUserAgent: workload identified by default: %s", ua)
+	}
+
+	svr.workloadUA = WorkloadUAHashed
+	hashed := svr.workloadUserAgent("myNS", "- objectName: secret")
+	if !regexp.MustCompile("^workload/[0-9a-f]{16}$").MatchString(hashed) {
+		t.Fatalf("TestWorkloadUserAgent: bad hashed user agent: %s", hashed)
+	}
+	if hashed == svr.workloadUserAgent("otherNS", "- objectName: secret") {
+		t.Fatalf("TestWorkloadUserAgent: namespace not part of the hash")
+	}
+
+	svr.workloadUA = WorkloadUANamespace
+	if ua := svr.workloadUserAgent("myNS", "- objectName: secret"); !regexp.MustCompile("^workload/myNS/[0-9a-f]{16}$").MatchString(ua) {
+		t.Fatalf("TestWorkloadUserAgent: bad namespace user agent: %s", ua)
+	}
+}
+
+// Make sure roleArn is accepted in place of assumeRoleArn.
+func TestRoleArnAlias(t *testing.T) {
+
+	roleArn := "arn:aws:iam::210987654321:role/secrets"
+	for _, attrib := range []map[string]string{
+		{roleArnAttrib: roleArn},
+		{assumeRoleAttrib: roleArn},
+	} {
+		if arn, err := getAssumeRoleArn(attrib); err != nil || arn != roleArn {
+			t.Fatalf("TestRoleArnAlias: wrong role for %v: %s %v", attrib, arn, err)
+		}
+	}
+
+	// Setting both is rejected, even with the same role.
+	for _, other := range []string{roleArn, "arn:aws:iam::210987654321:role/other"} {
+		_, err := getAssumeRoleArn(map[string]string{assumeRoleAttrib: roleArn, roleArnAttrib: other})
+		if err == nil || !strings.Contains(err.Error(), "use only one") {
+			t.Fatalf("TestRoleArnAlias: unexpected error: %v", err)
+		}
+	}
+}
+
+// Make sure the role session name and session tags are validated.
+func TestSessionAttributes(t *testing.T) {
+
+	svr, err := NewServer(nil, nil, ServerOptions{})
+	if err != nil {
+		t.Fatalf("TestSessionAttributes: got unexpected error %s", err.Error())
+	}
+	attrib := map[string]string{
+		namespaceAttrib:   "myNS",
+		acctAttrib:        "mySA",
+		podnameAttrib:     "myPod",
+		sessionNameAttrib: "{pod}.{namespace}",
+		sessionTagsAttrib: "team=payments,namespace={namespace}",
+	}
+	roleArn := "arn:aws:iam::123456789012:role/secrets"
+
+	name, tags, err := svr.getSessionAttributes(attrib, roleArn, false)
+	if err != nil || name != "myPod.myNS" || tags["namespace"] != "myNS" {
+		t.Fatalf("TestSessionAttributes: bad session attributes: %s %v %v", name, tags, err)
+	}
+
+	// Tags can only be set through AssumeRole.
+	_, _, err = svr.getSessionAttributes(attrib, "", false)
+	if err == nil || !strings.Contains(err.Error(), "sessionTags requires assumeRoleArn") {
+		t.Fatalf("TestSessionAttributes: unexpected error: %v", err)
+	}
+
+	delete(attrib, sessionTagsAttrib)
+	if name, _, err = svr.getSessionAttributes(attrib, "", false); err != nil || name != "myPod.myNS" {
+		t.Fatalf("TestSessionAttributes: bad IRSA session name: %s %v", name, err)
+	}
+	_, _, err = svr.getSessionAttributes(attrib, "", true)
+	if err == nil || !strings.Contains(err.Error(), "roleSessionName requires assumeRoleArn") {
+		t.Fatalf("TestSessionAttributes: unexpected error: %v", err)
+	}
+}
+
+// Make sure the sync policy is validated and applied.
+func TestSyncPolicy(t *testing.T) {
+
+	if _, err := NewServer(nil, nil, ServerOptions{SyncPolicy: "sometimes"}); err == nil {
+		t.Fatalf("TestSyncPolicy: expected error for bad policy")
+	}
+
+	dir := t.TempDir()
+	for policy, expected := range map[string]bool{"": true, SyncAlways: true, SyncNever: false, SyncAuto: !isTmpfs(dir)} {
+		svr, err := NewServer(nil, nil, ServerOptions{SyncPolicy: policy})
+		if err != nil {
+			t.Fatalf("TestSyncPolicy: got unexpected error %s", err.Error())
+		}
+		if svr.shouldSync(dir) != expected {
+			t.Fatalf("TestSyncPolicy: policy %q sync %v expected %v", policy, !expected, expected)
+		}
+	}
+
+	if err := syncDir(dir); err != nil {
+		t.Fatalf("TestSyncPolicy: got unexpected error %s", err.Error())
+	}
+}
+
+// Make sure oversized responses to the driver fail clearly or fall back to
+// writing the largest files directly.
+func TestMaxResponseSize(t *testing.T) {
+
+	dir := t.TempDir()
+	tst := testCase{
+		testName:   "Max Response Size",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret1", "objectType": "secretsmanager"},
+			{"objectName": "TestParm1", "objectType": "ssmparameter"},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("TestParm1"), Value: aws.String("parm1"), Version: aws.Int64(1)},
+				},
+			},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String(strings.Repeat("s", 1000)), VersionId: aws.String("1")},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		perms:   "420",
+	}
+
+	svr := newServerWithMocks(&tst, true)
+	svr.maxResponseSize = 500
+	_, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 500 bytes, largest files: TestSecret1 (1000 bytes), TestParm1 (5 bytes)") {
+		t.Fatalf("TestMaxResponseSize: unexpected error %v", err)
+	}
+
+	svr = newServerWithMocks(&tst, true)
+	svr.maxResponseSize = 500
+	svr.selfWriteFallback = true
+	rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestMaxResponseSize: got unexpected error %s", err.Error())
+	}
+	if len(rsp.Files) != 1 || rsp.Files[0].Path != "TestParm1" {
+		t.Fatalf("TestMaxResponseSize: unexpected files in response %+v", rsp.Files)
+	}
+	secret, err := ioutil.ReadFile(filepath.Join(dir, "TestSecret1"))
+	if err != nil || len(secret) != 1000 {
+		t.Fatalf("TestMaxResponseSize: large file not written: %v", err)
+	}
+
+	// Files without a fetched secret behind them fail cleanly.
+	rsp = &v1alpha1.MountResponse{Files: []*v1alpha1.File{{Path: "Unknown", Contents: make([]byte, 1000)}}}
+	err = svr.fitResponse(context.Background(), rsp, nil, 0644)
+	if err == nil || !strings.Contains(err.Error(), "Unknown can not be written directly") {
+		t.Fatalf("TestMaxResponseSize: unexpected error %v", err)
+	}
+}
+
+// Make sure files and versions are returned in the same order on every mount.
+func TestMountResponseOrder(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestMountResponseOrder")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	for i := 0; i < 10; i++ { // Map iteration order is random so try a few times.
+		svr := newServerWithMocks(&tst, true)
+		rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+		if err != nil {
+			t.Fatalf("TestMountResponseOrder: got unexpected error %s", err.Error())
+		}
+		if len(rsp.Files) != 2 || rsp.Files[0].Path != "TestParm1" || rsp.Files[1].Path != "TestSecret1" {
+			t.Fatalf("TestMountResponseOrder: files out of order: %+v", rsp.Files)
+		}
+		if len(rsp.ObjectVersion) != 2 || rsp.ObjectVersion[0].Id != "TestParm1" || rsp.ObjectVersion[1].Id != "TestSecret1" {
+			t.Fatalf("TestMountResponseOrder: versions out of order: %+v", rsp.ObjectVersion)
+		}
+	}
+}
+
+// Make sure objects with their own region are fetched separately for each region.
+func TestGroupByRegion(t *testing.T) {
+
+	descriptors := []*provider.SecretDescriptor{
+		{ObjectName: "a", Region: "us-east-1"},
+		{ObjectName: "b"},
+		{ObjectName: "c", Region: "eu-west-1"},
+		{ObjectName: "d", Region: "us-east-1"},
+		{ObjectName: "e"},
+	}
+	var got [][]string
+	for _, group := range groupByRegion(descriptors) {
+		var names []string
+		for _, descriptor := range group {
+			names = append(names, descriptor.ObjectName)
+		}
+		got = append(got, names)
+	}
+	expected := [][]string{{"b", "e"}, {"a", "d"}, {"c"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("TestGroupByRegion: expected %v but got %v", expected, got)
+	}
+
+	if groups := groupByRegion(descriptors[2:3]); len(groups) != 1 || groups[0][0].ObjectName != "c" {
+		t.Fatalf("TestGroupByRegion: unexpected groups %v", groups)
+	}
+}
+
+// Secret provider calling a function in place of AWS.
+type funcProvider func(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) ([]*provider.SecretValue, error)
+
+func (f funcProvider) GetSecretValues(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion, opts provider.FetchOptions) ([]*provider.SecretValue, error) {
+	return f(ctx, descriptors, curMap)
+}
+
+// Make sure the secret types are fetched at once and share the deadline.
+func TestFetchGroups(t *testing.T) {
+
+	groups := []fetchGroup{
+		{sType: provider.SecretsManager, descriptors: []*provider.SecretDescriptor{{ObjectName: "secret"}}},
+		{sType: provider.SSMParameter, descriptors: []*provider.SecretDescriptor{{ObjectName: "parameter"}}},
+	}
+	factory := func(smFetch, ssmFetch funcProvider) *provider.SecretProviderFactory {
+		return &provider.SecretProviderFactory{Providers: map[provider.SecretType]provider.SecretProvider{
+			provider.SecretsManager: smFetch,
+			provider.SSMParameter:   ssmFetch,
+		}}
+	}
+
+	// Each group waits for the other to start, which only works when they
+	// are fetched at the same time. Versions are merged from both groups.
+	smStarted, ssmStarted := make(chan struct{}), make(chan struct{})
+	fetch := func(started, other chan struct{}, name string) funcProvider {
+		return func(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) ([]*provider.SecretValue, error) {
+			close(started)
+			select {
+			case <-other:
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("%s fetched alone", name)
+			}
+			curMap[name] = &v1alpha1.ObjectVersion{Id: name, Version: "2"}
+			return []*provider.SecretValue{{Value: []byte(name), Descriptor: *descriptors[0]}}, nil
+		}
+	}
+	curMap := map[string]*v1alpha1.ObjectVersion{
+		"secret":    {Id: "secret", Version: "1"},
+		"parameter": {Id: "parameter", Version: "1"},
+	}
+	secrets, err := fetchGroups(context.Background(), factory(fetch(smStarted, ssmStarted, "secret"), fetch(ssmStarted, smStarted, "parameter")), groups, curMap, provider.FetchOptions{})
+	if err != nil {
+		t.Fatalf("TestFetchGroups: unexpected error %v", err)
+	}
+	if len(secrets) != 2 || string(secrets[0].Value) != "secret" || string(secrets[1].Value) != "parameter" {
+		t.Fatalf("TestFetchGroups: unexpected secrets %+v", secrets)
+	}
+	if curMap["secret"].Version != "2" || curMap["parameter"].Version != "2" {
+		t.Fatalf("TestFetchGroups: versions not merged %+v", curMap)
+	}
+
+	// The first failure stops the other groups and is returned.
+	blocked := func(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) ([]*provider.SecretValue, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	failed := func(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) ([]*provider.SecretValue, error) {
+		return nil, fmt.Errorf("parameter failed")
+	}
+	_, err = fetchGroups(context.Background(), factory(blocked, failed), groups, curMap, provider.FetchOptions{})
+	if err == nil || err.Error() != "parameter failed" {
+		t.Fatalf("TestFetchGroups: expected the parameter failure but got %v", err)
+	}
+
+	// A panic in one group fails the fetch instead of crashing the provider.
+	panicked := func(ctx context.Context, descriptors []*provider.SecretDescriptor, curMap map[string]*v1alpha1.ObjectVersion) ([]*provider.SecretValue, error) {
+		panic("boom")
+	}
+	_, err = fetchGroups(context.Background(), factory(blocked, panicked), groups, curMap, provider.FetchOptions{})
+	if err == nil || err.Error() != "internal error fetching ssmparameter objects" {
+		t.Fatalf("TestFetchGroups: expected the panic to fail the fetch but got %v", err)
+	}
+}
+
+// Make sure files are never written through a symbolic link out of the mount.
+func TestCheckWithinMount(t *testing.T) {
+
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.Symlink(outside, filepath.Join(dir, "link"))
+	os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "inside"))
+
+	for _, name := range []string{"secret", "sub/secret", "inside/secret", "link"} {
+		if err := checkWithinMount(dir, filepath.Join(dir, name)); err != nil {
+			t.Errorf("TestCheckWithinMount: unexpected error for %s: %v", name, err)
+		}
+	}
+
+	path := filepath.Join(dir, "link", "secret")
+	err := checkWithinMount(dir, path)
+	if err == nil || err.Error() != fmt.Sprintf("refusing to write %s outside of the mount point %s", path, dir) {
+		t.Fatalf("TestCheckWithinMount: unexpected error %v", err)
+	}
+
+	// The mount point itself may be reached through a link.
+	linkedMount := filepath.Join(outside, "mount")
+	os.Symlink(dir, linkedMount)
+	if err := checkWithinMount(linkedMount, filepath.Join(linkedMount, "sub", "secret")); err != nil {
+		t.Fatalf("TestCheckWithinMount: unexpected error for a linked mount point: %v", err)
+	}
+
+	// Mounts fail rather than write through the link.
+	tst := testCase{
+		testName:   "Symlink Escape",
+		attributes: map[string]string{"namespace": "fakeNS", "accName": "fakeSvcAcc", "podName": "fakePod", "nodeName": "fakeNode", "region": "us-west-2", "roleARN": "fakeRole", "pathTranslation": "False"},
+		mountObjs:  []map[string]interface{}{{"objectName": "TestSecret1", "objectType": "secretsmanager", "objectAlias": "link/secret"}},
+		gsvRsp:     []*secretsmanager.GetSecretValueOutput{{SecretString: aws.String("secret1"), VersionId: aws.String("1")}},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		perms:      "420",
+	}
+	svr := newServerWithMocks(&tst, false)
+	if _, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err == nil || !strings.Contains(err.Error(), "outside of the mount point") {
+		t.Fatalf("TestCheckWithinMount: unexpected mount error %v", err)
+	}
+	if files, _ := ioutil.ReadDir(outside); len(files) != 1 {
+		t.Fatalf("TestCheckWithinMount: files written outside of the mount: %v", files)
+	}
+}
+
+// Make sure preservePath keeps the parameter path as sub directories.
+func TestPreservePath(t *testing.T) {
+
+	tst := testCase{
+		testName:   "Preserve Path",
+		attributes: stdAttributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "/app/db/password", "objectType": "ssmparameter", "preservePath": true},
+		},
+		ssmRsp: []*ssm.GetParametersOutput{
+			{
+				Parameters: []*ssm.Parameter{
+					{Name: aws.String("/app/db/password"), Value: aws.String(strings.Repeat("p", 1000)), Version: aws.Int64(1)},
+				},
+			},
+		},
+		descRsp: []*secretsmanager.DescribeSecretOutput{},
+		perms:   "420",
+	}
+	ctx := context.Background()
+
+	svr := newServerWithMocks(&tst, true)
+	rsp, err := svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestPreservePath: got unexpected error %s", err.Error())
+	}
+	if len(rsp.Files) != 1 || rsp.Files[0].Path != "app/db/password" {
+		t.Fatalf("TestPreservePath: unexpected files in response %+v", rsp.Files)
+	}
+
+	// Files written by the fallback get their sub directories created.
+	dir := t.TempDir()
+	svr = newServerWithMocks(&tst, true)
+	svr.maxResponseSize = 500
+	svr.selfWriteFallback = true
+	if _, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err != nil {
+		t.Fatalf("TestPreservePath: got unexpected error %s", err.Error())
+	}
+	secret, err := ioutil.ReadFile(filepath.Join(dir, "app", "db", "password"))
+	if err != nil || len(secret) != 1000 {
+		t.Fatalf("TestPreservePath: file not written: %v", err)
+	}
+
+	// Never follow a link out of the mount point.
+	dir = t.TempDir()
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "app")); err != nil {
+		t.Fatalf("TestPreservePath: %v", err)
+	}
+	svr = newServerWithMocks(&tst, true)
+	svr.maxResponseSize = 500
+	svr.selfWriteFallback = true
+	_, err = svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "which is not a directory") {
+		t.Fatalf("TestPreservePath: expected the link to be refused, got %v", err)
+	}
+
+	svr = newServerWithMocks(&tst, false)
+	_, err = svr.Mount(ctx, buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "preservePath can only be used when the driver writes the secrets: app/db/password") {
+		t.Fatalf("TestPreservePath: expected an error when the provider writes, got %v", err)
+	}
+}
+
+// Make sure shared objects are merged ahead of the objects of the mount.
+func TestSharedObjects(t *testing.T) {
+
+	attributes := map[string]string{}
+	for k, v := range stdAttributes {
+		attributes[k] = v
+	}
+	attributes["sharedObjects"] = "- objectName: TestSecret1\n  objectType: secretsmanager\n---\n- objectName: TestSecret2\n  objectType: secretsmanager"
+	tst := testCase{
+		testName:   "Shared Objects",
+		attributes: attributes,
+		mountObjs: []map[string]interface{}{
+			{"objectName": "TestSecret2", "objectType": "secretsmanager"},
+		},
+		gsvRsp: []*secretsmanager.GetSecretValueOutput{
+			{SecretString: aws.String("secret1"), VersionId: aws.String("1")},
+			{SecretString: aws.String("secret2"), VersionId: aws.String("1")},
+		},
+		descRsp:    []*secretsmanager.DescribeSecretOutput{},
+		expSecrets: map[string]string{"TestSecret1": "secret1", "TestSecret2": "secret2"},
+		perms:      "420",
+	}
+	dir := t.TempDir()
+	svr := newServerWithMocks(&tst, false)
+	rsp, err := svr.Mount(context.Background(), buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{}))
+	if err != nil {
+		t.Fatalf("TestSharedObjects: got unexpected error %s", err.Error())
+	}
+	validateMounts(t, dir, tst, rsp)
+
+	attributes["sharedObjects"] = "- objectName: TestSecret2\n  objectType: ssmparameter"
+	svr = newServerWithMocks(&tst, false)
+	_, err = svr.Mount(context.Background(), buildMountReq(t.TempDir(), tst, []*v1alpha1.ObjectVersion{}))
+	if err == nil || !strings.Contains(err.Error(), "object TestSecret2 is defined differently in objects documents 1 and 2") {
+		t.Fatalf("TestSharedObjects: expected a conflict, got %v", err)
 	}
 }
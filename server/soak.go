@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+const (
+	soakNamespace = "soak-test"
+	soakSvcAcct   = "soak-test"
+	soakRegion    = "us-west-2"
+	soakRotation  = 10  // Rotate the synthetic secrets every this many passes
+	soakReport    = 100 // Log memory statistics every this many passes
+)
+
+// The objects mounted by each synthetic pod.
+const soakObjects = `
+- objectName: soak/secret1
+  objectType: secretsmanager
+  jmesPath:
+    - path: username
+      objectAlias: username
+    - path: password
+      objectAlias: password
+- objectName: soak/secret2
+  objectType: secretsmanager
+- objectName: soak/parameter1
+  objectType: ssmparameter
+- objectName: soak/parameter2
+  objectType: ssmparameter
+`
+
+// Private mock Secrets Manager backend used by the soak test.
+//
+// Every secret has a single version that changes each time the shared version
+// counter is bumped.
+//
+type soakSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	version *int64
+}
+
+func (m *soakSecretsManager) GetSecretValueWithContext(
+	ctx context.Context, input *secretsmanager.GetSecretValueInput, options ...request.Option,
+) (*secretsmanager.GetSecretValueOutput, error) {
+	ver := atomic.LoadInt64(m.version)
+	value := fmt.Sprintf(`{"username": "user-%d", "password": "password-%d"}`, ver, ver)
+	return &secretsmanager.GetSecretValueOutput{
+		Name:         input.SecretId,
+		SecretString: aws.String(value),
+		VersionId:    aws.String(fmt.Sprintf("v%d", ver)),
+	}, nil
+}
+
+func (m *soakSecretsManager) DescribeSecretWithContext(
+	ctx context.Context, input *secretsmanager.DescribeSecretInput, options ...request.Option,
+) (*secretsmanager.DescribeSecretOutput, error) {
+	ver := fmt.Sprintf("v%d", atomic.LoadInt64(m.version))
+	return &secretsmanager.DescribeSecretOutput{
+		Name:               input.SecretId,
+		VersionIdsToStages: map[string][]*string{ver: {aws.String("AWSCURRENT")}},
+	}, nil
+}
+
+// Private mock Parameter Store backend used by the soak test.
+type soakParameterStore struct {
+	ssmiface.SSMAPI
+	version *int64
+}
+
+func (m *soakParameterStore) GetParametersWithContext(
+	ctx context.Context, input *ssm.GetParametersInput, options ...request.Option,
+) (*ssm.GetParametersOutput, error) {
+	ver := atomic.LoadInt64(m.version)
+	rsp := &ssm.GetParametersOutput{}
+	for _, name := range input.Names {
+		rsp.Parameters = append(rsp.Parameters, &ssm.Parameter{
+			Name:    name,
+			Value:   aws.String(fmt.Sprintf("%s-%d", *name, ver)),
+			Version: aws.Int64(ver),
+		})
+	}
+	return rsp, nil
+}
+
+// Continuously simulate mounts and rotations against mock backends.
+//
+// This is a testing aid used to validate memory stability of the provider
+// over long periods (days) in pre-production clusters. Each pass mounts the
+// secrets of the given number of synthetic pods through the same Mount path
+// used by the driver, passing back the versions from the previous pass like
+// the rotation reconciler does. The mock secrets are rotated every few passes
+// and memory statistics are logged periodically. Secrets are written to a
+// temporary directory which is removed when the context is cancelled.
+//
+func RunSoakTest(ctx context.Context, interval time.Duration, pods int) error {
+
+	if interval <= 0 || pods <= 0 {
+		return fmt.Errorf("soak test interval and pod count must be positive")
+	}
+
+	dir, err := os.MkdirTemp("", "soak-test")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	version := int64(1)
+	factory := func(sessions []*session.Session, regions []string) *provider.SecretProviderFactory {
+		return &provider.SecretProviderFactory{
+			Providers: map[provider.SecretType]provider.SecretProvider{
+				provider.SecretsManager: provider.NewSecretsManagerProviderWithClients(provider.SecretsManagerClient{
+					Region: soakRegion,
+					Client: &soakSecretsManager{version: &version},
+				}),
+				provider.SSMParameter: provider.NewParameterStoreProviderWithClients(provider.ParameterStoreClient{
+					Region: soakRegion,
+					Client: &soakParameterStore{version: &version},
+				}),
+			},
+		}
+	}
+
+	// The service account only needs a role annotation since the mock
+	// backends never use the session credentials.
+	clientset := fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        soakSvcAcct,
+			Namespace:   soakNamespace,
+			Annotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/soak-test"},
+		},
+	})
+	svr, err := NewServer(factory, clientset.CoreV1(), ServerOptions{})
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Starting soak test with %d pods every %s in %s", pods, interval, dir)
+
+	curVersions := make([][]*v1alpha1.ObjectVersion, pods)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for pass := 1; ; pass++ {
+		select {
+		case <-ctx.Done():
+			klog.Infof("Soak test stopped after %d passes", pass-1)
+			return nil
+		case <-ticker.C:
+		}
+
+		if pass%soakRotation == 0 {
+			atomic.AddInt64(&version, 1)
+		}
+
+		for i := 0; i < pods; i++ {
+			rsp, err := svr.Mount(ctx, soakMountRequest(dir, i, curVersions[i]))
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return fmt.Errorf("soak test mount failed on pass %d: %w", pass, err)
+			}
+			curVersions[i] = rsp.GetObjectVersion()
+		}
+
+		if pass%soakReport == 0 {
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			klog.Infof("Soak test pass %d: heap %d bytes, %d objects, %d goroutines",
+				pass, mem.HeapAlloc, mem.HeapObjects, runtime.NumGoroutine())
+		}
+	}
+}
+
+// Private helper to build the mount request for a synthetic pod.
+func soakMountRequest(dir string, pod int, curVersions []*v1alpha1.ObjectVersion) *v1alpha1.MountRequest {
+
+	podName := fmt.Sprintf("soak-pod-%d", pod)
+	targetPath := filepath.Join(dir, podName)
+	os.MkdirAll(targetPath, 0755)
+
+	attrib, _ := json.Marshal(map[string]string{
+		namespaceAttrib: soakNamespace,
+		acctAttrib:      soakSvcAcct,
+		podnameAttrib:   podName,
+		regionAttrib:    soakRegion,
+		secProvAttrib:   soakObjects,
+	})
+
+	return &v1alpha1.MountRequest{
+		Attributes:           string(attrib),
+		TargetPath:           targetPath,
+		Permission:           "420",
+		CurrentObjectVersion: curVersions,
+	}
+}
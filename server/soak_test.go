@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Make sure the soak test runs mounts and rotations until cancelled.
+func TestSoakTest(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := RunSoakTest(ctx, time.Millisecond, 3)
+	if err != nil {
+		t.Fatalf("TestSoakTest: got unexpected error %s", err.Error())
+	}
+}
+
+// Make sure bad soak test settings are rejected.
+func TestSoakTestBadSettings(t *testing.T) {
+
+	err := RunSoakTest(context.Background(), 0, 3)
+	if err == nil {
+		t.Fatalf("TestSoakTestBadSettings: expected error")
+	}
+}
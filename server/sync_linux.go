@@ -0,0 +1,18 @@
+package server
+
+import "syscall"
+
+// Magic number identifying tmpfs in statfs (see statfs(2)).
+const tmpfsMagic = 0x01021994
+
+// Private helper to tell if a directory is on tmpfs (memory backed).
+//
+// Returns false when it can not be determined.
+//
+func isTmpfs(dir string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	return stat.Type == tmpfsMagic
+}
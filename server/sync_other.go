@@ -0,0 +1,11 @@
+//go:build !linux
+
+package server
+
+// Private helper to tell if a directory is on tmpfs (memory backed).
+//
+// Always false on platforms where this can not be determined.
+//
+func isTmpfs(dir string) bool {
+	return false
+}
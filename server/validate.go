@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/auth"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/pkg/version"
+	"github.com/aws/secrets-store-csi-driver-provider-aws/provider"
+)
+
+// Region used to validate SecretProviderClasses that do not give one.
+const defaultValidateRegion = "us-east-1"
+
+// Everything the validate command needs besides the manifests.
+//
+// The AWS checks only run when the client factories are set, using the
+// credentials of whoever runs the command (for example a CI role). They only
+// call DescribeSecret and DescribeParameters, so no secret values are read.
+//
+type ValidateConfig struct {
+	Region         string            // Used when a SecretProviderClass does not give a region
+	NodeLabels     map[string]string // Values of the node label placeholders in object names
+	CrossRegion    bool              // Allow objectName ARNs in another region than the SecretProviderClass
+	SecretsManager func(region string) secretsmanageriface.SecretsManagerAPI
+	SSM            func(region string) ssmiface.SSMAPI
+}
+
+// The parts of a SecretProviderClass manifest the provider reads.
+type spcManifest struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Provider   string            `json:"provider"`
+		Parameters map[string]string `json:"parameters"`
+	} `json:"spec"`
+}
+
+// Validate SecretProviderClass manifests offline and write a report.
+//
+// The manifests may hold several YAML documents. Documents that are not
+// SecretProviderClasses for the aws provider are skipped, and a document
+// without a kind is treated as the objects parameter itself. Each
+// SecretProviderClass is checked with the same code used at mount time (the
+// objects, regions, path translations, and objectsTemplate), and, when AWS
+// checks are configured, each object is looked up in AWS. Returns false if any
+// check failed, so the command can gate a CI pipeline.
+//
+func RunValidate(ctx context.Context, w io.Writer, manifests []byte, cfg ValidateConfig) bool {
+
+	var results []CheckResult
+	found := false
+	for i, doc := range splitYAMLDocuments(manifests) {
+		var spc spcManifest
+		if err := yaml.Unmarshal(doc, &spc); err != nil || len(spc.Kind) == 0 {
+			spc = spcManifest{Kind: "SecretProviderClass"}
+			spc.Metadata.Name = fmt.Sprintf("document %d", i+1)
+			spc.Spec.Provider = "aws"
+			spc.Spec.Parameters = map[string]string{secProvAttrib: string(doc)}
+		}
+		if spc.Kind != "SecretProviderClass" || spc.Spec.Provider != "aws" {
+			continue
+		}
+		found = true
+		results = append(results, validateSPC(ctx, spc.Metadata.Name, spc.Spec.Parameters, cfg)...)
+	}
+	if !found {
+		results = append(results, CheckResult{"Manifests", CheckFail, "no SecretProviderClass for the aws provider found"})
+	}
+
+	passed := true
+	fmt.Fprintf(w, "%s validate (version %s)\n", auth.ProviderName, version.Current())
+	for _, result := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", result.Status, result.Name, result.Detail)
+		if result.Status == CheckFail {
+			passed = false
+		}
+	}
+	if passed {
+		fmt.Fprintln(w, "Validation passed")
+	} else {
+		fmt.Fprintln(w, "Validation failed")
+	}
+	return passed
+}
+
+// Private helper to split a YAML stream into its non-empty documents.
+func splitYAMLDocuments(manifests []byte) (docs [][]byte) {
+
+	for _, doc := range bytes.Split(append([]byte("\n"), manifests...), []byte("\n---")) {
+		if len(bytes.TrimSpace(doc)) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// Private helper to check one SecretProviderClass.
+func validateSPC(ctx context.Context, name string, params map[string]string, cfg ValidateConfig) (results []CheckResult) {
+
+	region := params[regionAttrib]
+	if len(region) == 0 {
+		region = cfg.Region
+	}
+	if len(region) == 0 {
+		region = defaultValidateRegion
+		results = append(results, CheckResult{name, CheckWarn, fmt.Sprintf("no region given, validating with %s (use --region to change)", region)})
+	}
+	regions := []string{region}
+	if failover := params[failoverRegionAttrib]; len(failover) > 0 {
+		for _, r := range strings.Split(failover, ",") {
+			regions = append(regions, strings.TrimSpace(r))
+		}
+	}
+
+	endpoints := provider.MountEndpoints{SecretsManager: params[smEndpointAttrib], SSM: params[ssmEndpointAttrib]}
+	if err := validateMountEndpoints(endpoints, regions); err != nil {
+		return append(results, CheckResult{name, CheckFail, err.Error()})
+	}
+
+	objectSpec, err := provider.MergeObjectSpecs(params[sharedObjectsAttrib], params[secProvAttrib])
+	if err != nil {
+		return append(results, CheckResult{name, CheckFail, err.Error()})
+	}
+	if len(cfg.NodeLabels) > 0 {
+		expanded, err := provider.ExpandObjectNames(objectSpec, cfg.NodeLabels)
+		if err != nil {
+			return append(results, CheckResult{name, CheckFail, err.Error()})
+		}
+		objectSpec = expanded
+	}
+
+	mountDir := "/validate"
+	opts := provider.DescriptorOptions{AllowCrossRegionARNs: cfg.CrossRegion}
+	descriptors, err := provider.NewSecretDescriptorListWithOptions(mountDir, params[transAttrib], params[jmesTransAttrib], objectSpec, regions, opts)
+	if err != nil {
+		return append(results, CheckResult{name, CheckFail, err.Error()})
+	}
+	if err := validateMountEndpoints(endpoints, objectRegions(descriptors)); err != nil {
+		return append(results, CheckResult{name, CheckFail, err.Error()})
+	}
+	if _, err := provider.NewObjectTemplateList(mountDir, params[templatesAttrib]); err != nil {
+		return append(results, CheckResult{name, CheckFail, err.Error()})
+	}
+
+	count := 0
+	for _, group := range descriptors {
+		count += len(group)
+	}
+	results = append(results, CheckResult{name, CheckPass, fmt.Sprintf("%d objects are valid", count)})
+
+	if cfg.SecretsManager == nil || cfg.SSM == nil {
+		return results
+	}
+	for _, sType := range []provider.SecretType{provider.SecretsManager, provider.SSMParameter} {
+		for _, descriptor := range descriptors[sType] {
+			if len(descriptor.ObjectTags) > 0 {
+				results = append(results, CheckResult{fmt.Sprintf("%s/objectTags", name), CheckWarn, "objects selected by tags are not looked up"})
+				continue
+			}
+
+			// Objects with their own region are only fetched from that region.
+			lookupRegions := regions
+			if len(descriptor.Region) > 0 {
+				lookupRegions = []string{descriptor.Region}
+			}
+			for i, region := range lookupRegions {
+				results = append(results, checkObjectExists(ctx, name, sType, descriptor, i, region, cfg))
+			}
+		}
+	}
+	return results
+}
+
+// Private helper to look up an object (and its version) in one of the lookup
+// regions without reading its value. The failover object is looked up in
+// failover regions.
+func checkObjectExists(
+	ctx context.Context,
+	spcName string,
+	sType provider.SecretType,
+	descriptor *provider.SecretDescriptor,
+	failoverIndex int,
+	region string,
+	cfg ValidateConfig,
+) CheckResult {
+
+	objectName := descriptor.GetSecretName(failoverIndex)
+	name := fmt.Sprintf("%s/%s", spcName, objectName)
+
+	if sType == provider.SSMParameter {
+		found, err := describeParameter(ctx, cfg.SSM(region), objectName)
+		if err != nil {
+			return CheckResult{name, CheckFail, fmt.Sprintf("not found in %s: %v", region, err)}
+		}
+		if !found {
+			return CheckResult{name, CheckFail, fmt.Sprintf("not found in %s", region)}
+		}
+		return CheckResult{name, CheckPass, fmt.Sprintf("found in %s", region)}
+	}
+
+	rsp, err := cfg.SecretsManager(region).DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(objectName),
+	})
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("not found in %s: %v", region, err)}
+	}
+	if version := descriptor.GetObjectVersion(failoverIndex); len(version) > 0 {
+		if _, ok := rsp.VersionIdsToStages[version]; !ok {
+			return CheckResult{name, CheckFail, fmt.Sprintf("version %s not found in %s", version, region)}
+		}
+	}
+	if label := descriptor.GetObjectVersionLabel(failoverIndex); len(label) > 0 {
+		labelFound := false
+		for _, stages := range rsp.VersionIdsToStages {
+			for _, stage := range stages {
+				labelFound = labelFound || aws.StringValue(stage) == label
+			}
+		}
+		if !labelFound {
+			return CheckResult{name, CheckFail, fmt.Sprintf("version label %s not found in %s", label, region)}
+		}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("found in %s", region)}
+}
+
+// Private helper to look up a parameter with DescribeParameters, which (unlike
+// GetParameter) never returns the value of String and StringList parameters.
+// Parameters named by an ARN that are not found in the account are looked up
+// among the parameters shared with it.
+func describeParameter(ctx context.Context, client ssmiface.SSMAPI, objectName string) (bool, error) {
+
+	names, parameterARN := provider.ParameterNames(objectName)
+	input := &ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{Key: aws.String("Name"), Option: aws.String("Equals"), Values: aws.StringSlice(names)},
+		},
+	}
+	rsp, err := client.DescribeParametersWithContext(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	for _, param := range rsp.Parameters {
+		if len(parameterARN) == 0 || aws.StringValue(param.ARN) == parameterARN {
+			return true, nil
+		}
+	}
+	if len(parameterARN) == 0 {
+		return false, nil
+	}
+
+	input.ParameterFilters[0].Values = aws.StringSlice([]string{parameterARN})
+	input.Shared = aws.Bool(true)
+	rsp, err = client.DescribeParametersWithContext(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	return len(rsp.Parameters) > 0, nil
+}
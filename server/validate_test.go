@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+const validateManifests = `apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: app
+spec:
+  provider: aws
+  parameters:
+    region: us-west-2
+    objects: |
+      - objectName: "MySecret"
+        objectType: "secretsmanager"
+        objectVersionLabel: "AWSCURRENT"
+      - objectName: "MyParameter"
+        objectType: "ssmparameter"
+      - objectName: "MyRegionalParameter"
+        objectType: "ssmparameter"
+        region: "eu-west-1"
+---
+apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: other
+spec:
+  provider: azure
+`
+
+func TestRunValidate(t *testing.T) {
+
+	var out bytes.Buffer
+	if !RunValidate(context.Background(), &out, []byte(validateManifests), ValidateConfig{}) {
+		t.Fatalf("TestRunValidate: expected success but got %s", out.String())
+	}
+	if !strings.Contains(out.String(), "[PASS] app: 3 objects are valid") || strings.Contains(out.String(), "other") {
+		t.Fatalf("TestRunValidate: unexpected report %s", out.String())
+	}
+
+	// Raw objects specifications are validated too.
+	out.Reset()
+	if RunValidate(context.Background(), &out, []byte("- objectName: x\n  objectType: SecretsManger\n"), ValidateConfig{Region: "us-west-2"}) {
+		t.Fatalf("TestRunValidate: expected failure but got %s", out.String())
+	}
+	if !strings.Contains(out.String(), `[FAIL] document 1: Invalid objectType: SecretsManger (did you mean "secretsmanager"?)`) {
+		t.Fatalf("TestRunValidate: unexpected report %s", out.String())
+	}
+
+	// Nothing to validate.
+	out.Reset()
+	if RunValidate(context.Background(), &out, []byte("kind: ConfigMap\n"), ValidateConfig{}) {
+		t.Fatalf("TestRunValidate: expected failure without SecretProviderClasses but got %s", out.String())
+	}
+}
+
+func TestRunValidateCheckAWS(t *testing.T) {
+
+	sm := &MockSecretsManagerClient{descRsp: []*secretsmanager.DescribeSecretOutput{
+		{VersionIdsToStages: map[string][]*string{"v1": {aws.String("AWSPREVIOUS")}}},
+		{VersionIdsToStages: map[string][]*string{"v1": {aws.String("AWSCURRENT")}}},
+	}}
+	params := &mockDescribeParameters{MockParameterStoreClient: &MockParameterStoreClient{}, found: map[string]bool{
+		"MyParameter": true, "MyParameterBackup": true, "arn:aws:ssm:us-west-2:111122223333:parameter/shared/db": true,
+	}}
+	var regions []string
+	cfg := ValidateConfig{
+		SecretsManager: func(region string) secretsmanageriface.SecretsManagerAPI {
+			regions = append(regions, region)
+			return sm
+		},
+		SSM: func(region string) ssmiface.SSMAPI {
+			regions = append(regions, region)
+			return params
+		},
+	}
+
+	manifests := strings.Replace(validateManifests, `        objectType: "ssmparameter"
+      - objectName: "MyRegionalParameter"`, `        objectType: "ssmparameter"
+        objectAlias: "param"
+        failoverObject:
+          objectName: "MyParameterBackup"
+      - objectName: "arn:aws:ssm:us-west-2:111122223333:parameter/shared/db"
+        objectType: "ssmparameter"
+        objectAlias: "db"
+        region: "us-west-2"
+      - objectName: "MyRegionalParameter"`, 1)
+	manifests = strings.Replace(manifests, "    region: us-west-2\n", "    region: us-west-2\n    failoverRegion: us-east-1\n", 1)
+
+	var out bytes.Buffer
+	if RunValidate(context.Background(), &out, []byte(manifests), cfg) {
+		t.Fatalf("TestRunValidateCheckAWS: expected failure but got %s", out.String())
+	}
+	for _, line := range []string{
+		"[FAIL] app/MySecret: version label AWSCURRENT not found in us-west-2",
+		"[PASS] app/MySecret: found in us-east-1",
+		"[PASS] app/MyParameter: found in us-west-2",
+		"[PASS] app/MyParameterBackup: found in us-east-1",
+		"[PASS] app/arn:aws:ssm:us-west-2:111122223333:parameter/shared/db: found in us-west-2",
+		"[FAIL] app/MyRegionalParameter: not found in eu-west-1",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("TestRunValidateCheckAWS: expected %s in report %s", line, out.String())
+		}
+	}
+	if strings.Join(regions, ",") != "us-west-2,us-east-1,us-west-2,us-east-1,us-west-2,eu-west-1" {
+		t.Fatalf("TestRunValidateCheckAWS: unexpected regions %v", regions)
+	}
+}
+
+// Mock SSM client describing the parameters it knows, and failing any attempt
+// to read a value.
+type mockDescribeParameters struct {
+	*MockParameterStoreClient
+	found map[string]bool
+}
+
+func (m *mockDescribeParameters) DescribeParametersWithContext(ctx aws.Context, input *ssm.DescribeParametersInput, options ...request.Option) (*ssm.DescribeParametersOutput, error) {
+	rsp := &ssm.DescribeParametersOutput{}
+	for _, name := range input.ParameterFilters[0].Values {
+		if m.found[aws.StringValue(name)] && aws.BoolValue(input.Shared) == strings.HasPrefix(aws.StringValue(name), "arn:") {
+			rsp.Parameters = append(rsp.Parameters, &ssm.ParameterMetadata{Name: name})
+		}
+	}
+	return rsp, nil
+}
+
+func (m *mockDescribeParameters) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, options ...request.Option) (*ssm.GetParameterOutput, error) {
+	panic("GetParameter called by validate")
+}
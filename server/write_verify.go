@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/aws/secrets-store-csi-driver-provider-aws/utils"
+)
+
+// Private helper to hash the contents of a file.
+func contentHash(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Private helper to remember the hashes of the files sent to the driver for a
+// target path, or to forget them when the mount is not verified.
+//
+// Hashes of target paths that no longer exist (the pod is gone) are dropped
+// along with the saved mount requests (see pruneMounts).
+//
+func (s *CSIDriverProviderServer) recordDriverWrites(mountDir string, verify bool, files []*v1alpha1.File) {
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+
+	if !verify {
+		delete(s.writeHashes, mountDir)
+		return
+	}
+	if s.writeHashes == nil {
+		s.writeHashes = make(map[string]map[string]string)
+	}
+
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		hashes[file.Path] = contentHash(file.Contents)
+	}
+	s.writeHashes[mountDir] = hashes
+}
+
+// Private helper to check that the files the driver wrote for the last mount
+// of a target path still hold what the provider sent.
+//
+// When the driver writes the secrets the provider never sees the files, so a
+// write the driver got wrong (or a file changed on the node afterwards) would
+// go unnoticed. Mounts with verifyAfterWrite set are checked on the next
+// mount (such as the next rotation reconcile), before the driver rewrites
+// them. Missing and modified files are logged, counted, and reported in a
+// warning event on the pod, but do not fail the mount since it is about to
+// rewrite them.
+//
+func (s *CSIDriverProviderServer) verifyDriverWrites(ctx context.Context, nameSpace, podName, mountDir string) {
+
+	s.mountsMu.Lock()
+	hashes := s.writeHashes[mountDir]
+	s.mountsMu.Unlock()
+
+	var mismatches []string
+	for path, hash := range hashes {
+		contents, err := ioutil.ReadFile(filepath.Join(mountDir, path))
+		switch {
+		case os.IsNotExist(err):
+			utils.RecordWriteMismatch("missing")
+			mismatches = append(mismatches, path+" (missing)")
+		case err != nil:
+			utils.Warningf("Can not verify %s for pod %s in namespace %s: %v", path, podName, nameSpace, err)
+		case contentHash(contents) != hash:
+			utils.RecordWriteMismatch("modified")
+			mismatches = append(mismatches, path+" (modified)")
+		}
+	}
+	if len(mismatches) == 0 {
+		return
+	}
+
+	sort.Strings(mismatches)
+	msg := fmt.Sprintf("Mounted files do not match what was sent to the driver: %s", strings.Join(mismatches, ", "))
+	utils.Warningf("%s (pod %s in namespace %s)", msg, podName, nameSpace)
+	s.recordEvent(ctx, nameSpace, podName, corev1.EventTypeWarning, writeMismatchReason, msg)
+}
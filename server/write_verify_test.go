@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Private helper to build a mount request that verifies the driver's writes.
+func buildVerifyMountReq(dir string, tst testCase) *v1alpha1.MountRequest {
+
+	req := buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})
+	var attrib map[string]string
+	json.Unmarshal([]byte(req.Attributes), &attrib)
+	attrib[verifyWritesAttrib] = "true"
+	attr, _ := json.Marshal(attrib)
+	req.Attributes = string(attr)
+	return req
+}
+
+// Make sure files the driver wrote are checked on the next mount.
+func TestVerifyDriverWrites(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "TestVerifyDriverWrites")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir) // Cleanup
+
+	tst := mountTests[0]
+	svr := newServerWithMocks(&tst, true)
+	ctx := context.Background()
+
+	// Write the files like the driver would.
+	mount := func() []*v1alpha1.File {
+		rsp, err := svr.Mount(ctx, buildVerifyMountReq(dir, tst))
+		if err != nil {
+			t.Fatalf("TestVerifyDriverWrites: got unexpected error %s", err.Error())
+		}
+		for _, file := range rsp.Files {
+			if err := ioutil.WriteFile(filepath.Join(dir, file.Path), file.Contents, 0644); err != nil {
+				t.Fatalf("TestVerifyDriverWrites: got unexpected error %s", err.Error())
+			}
+		}
+		return rsp.Files
+	}
+
+	files := mount()
+	if len(files) < 2 {
+		t.Fatalf("TestVerifyDriverWrites: expected at least two files, got %d", len(files))
+	}
+	mount()
+	events, _ := svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 0 {
+		t.Fatalf("TestVerifyDriverWrites: unexpected events %+v", events.Items)
+	}
+
+	// Tamper with the files before the next mount.
+	ioutil.WriteFile(filepath.Join(dir, files[0].Path), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(dir, files[1].Path))
+	if _, err := svr.Mount(ctx, buildVerifyMountReq(dir, tst)); err != nil {
+		t.Fatalf("TestVerifyDriverWrites: got unexpected error %s", err.Error())
+	}
+	events, _ = svr.k8sClient.Events("fakeNS").List(ctx, metav1.ListOptions{})
+	if len(events.Items) != 1 || events.Items[0].Reason != writeMismatchReason ||
+		!strings.Contains(events.Items[0].Message, files[0].Path+" (modified)") ||
+		!strings.Contains(events.Items[0].Message, files[1].Path+" (missing)") {
+		t.Fatalf("TestVerifyDriverWrites: unexpected events %+v", events.Items)
+	}
+
+	// Nothing is checked once verification is turned off.
+	if _, err := svr.Mount(ctx, buildMountReq(dir, tst, []*v1alpha1.ObjectVersion{})); err != nil {
+		t.Fatalf("TestVerifyDriverWrites: got unexpected error %s", err.Error())
+	}
+	if len(svr.writeHashes) != 0 {
+		t.Fatalf("TestVerifyDriverWrites: expected the hashes to be dropped, got %v", svr.writeHashes)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Private helper to set an extended attribute on a file.
+//
+// Returns errXattrUnsupported when the file system does not support user
+// extended attributes (for example tmpfs before Linux 6.6).
+//
+func setXattr(path, name, value string) error {
+	err := syscall.Setxattr(path, name, []byte(value), 0)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return errXattrUnsupported
+	}
+	return err
+}
+
+// Private helper to read an extended attribute of a file.
+//
+// Returns an empty string when the attribute can not be read.
+//
+func getXattr(path, name string) string {
+	buf := make([]byte, 2048)
+	n, err := syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package server
+
+// Private helper to set an extended attribute on a file.
+//
+// Always unsupported on platforms other than Linux.
+//
+func setXattr(path, name, value string) error {
+	return errXattrUnsupported
+}
+
+// Private helper to read an extended attribute of a file.
+func getXattr(path, name string) string {
+	return ""
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"flag"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Value logged in place of sensitive settings.
+const Redacted = "<redacted>"
+
+// Prefixes of the environment variables that affect the provider.
+var configEnvPrefixes = []string{"AWS_", "NODE_NAME"}
+
+// Names of settings whose values are never logged.
+var sensitiveNameRE = regexp.MustCompile(`(?i)(secret|token|password|passwd|credential|key)`)
+
+// Log the effective configuration of the provider as one structured record.
+//
+// Every flag is logged with its value, split between flags set on the command
+// line and flags left at their defaults, so a misspelled Helm value or flag
+// that silently falls back to the default is easy to spot in support cases.
+// Environment variables that affect the provider (AWS_* and NODE_NAME) are
+// included. Settings whose names look sensitive (keys, tokens, secrets, and
+// passwords) are redacted, as are credentials embedded in URLs.
+//
+func LogEffectiveConfig(fs *flag.FlagSet, environ []string) {
+	set, defaults, env := effectiveConfig(fs, environ)
+	klog.InfoS("Effective configuration", "flags", set, "defaults", defaults, "env", env)
+}
+
+// Private helper to collect the flags set, flags defaulted, and the relevant
+// environment with sensitive values redacted.
+func effectiveConfig(fs *flag.FlagSet, environ []string) (set, defaults, env map[string]string) {
+
+	set, defaults, env = map[string]string{}, map[string]string{}, map[string]string{}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			set[f.Name] = redactValue(f.Name, f.Value.String())
+		} else {
+			defaults[f.Name] = redactValue(f.Name, f.Value.String())
+		}
+	})
+
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		for _, prefix := range configEnvPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				env[name] = redactValue(name, value)
+				break
+			}
+		}
+	}
+	return set, defaults, env
+}
+
+// Private helper to redact a sensitive setting, or the credentials in a URL.
+func redactValue(name, value string) string {
+
+	if sensitiveNameRE.MatchString(name) && len(value) > 0 {
+		return Redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = url.User("redacted")
+		return u.String()
+	}
+	return value
+}
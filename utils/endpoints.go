@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Service identifiers used in the endpoint override environment variables.
+const (
+	STSService            = "STS"
+	SecretsManagerService = "SECRETS_MANAGER"
+	SSMService            = "SSM"
+)
+
+// Environment variable used to override the endpoint of every service.
+const endpointURLEnv = "AWS_ENDPOINT_URL"
+
+// Placeholder replaced by the region in endpoint URLs given per mount.
+const EndpointRegionPlaceholder = "{region}"
+
+// Returns the endpoint override for a service, if any.
+//
+// Follows the AWS SDK convention: a service specific variable such as
+// AWS_ENDPOINT_URL_SECRETS_MANAGER takes precedence over AWS_ENDPOINT_URL.
+// Returns an empty string when the default endpoint should be used.
+//
+func GetEndpointOverride(service string) string {
+	if ep := os.Getenv(endpointURLEnv + "_" + service); len(ep) != 0 {
+		return ep
+	}
+	return os.Getenv(endpointURLEnv)
+}
+
+// Returns the endpoint override for a service in a region, if any.
+//
+// A region specific variable such as AWS_ENDPOINT_URL_SSM_EU_WEST_1 (the
+// region in upper case with dashes replaced by underscores) takes precedence
+// over the service wide overrides, so each region can use its own VPC
+// endpoint (AWS PrivateLink), for example when failing over to another region.
+//
+func GetRegionalEndpointOverride(service, region string) string {
+	if len(region) != 0 {
+		if ep := os.Getenv(regionalEndpointEnv(service, region)); len(ep) != 0 {
+			return ep
+		}
+	}
+	return GetEndpointOverride(service)
+}
+
+// Returns an endpoint URL given per mount for a region, replacing any
+// {region} placeholder with the region.
+//
+func ExpandEndpoint(ep, region string) string {
+	return strings.ReplaceAll(ep, EndpointRegionPlaceholder, region)
+}
+
+// Private helper to return the name of the region specific endpoint override
+// variable of a service.
+func regionalEndpointEnv(service, region string) string {
+	return endpointURLEnv + "_" + service + "_" + strings.ToUpper(strings.ReplaceAll(region, "-", "_"))
+}
+
+// Make sure the endpoint overrides do not send credentials or secrets in
+// plaintext.
+//
+// Overrides must be https URLs unless allowInsecure is set. This catches a
+// misconfigured AWS_ENDPOINT_URL before any request is made.
+//
+func ValidateEndpointOverrides(allowInsecure bool) error {
+
+	for _, service := range []string{STSService, SecretsManagerService, SSMService} {
+		if err := validateEndpointOverride(service, GetEndpointOverride(service), allowInsecure); err != nil {
+			return err
+		}
+
+		// Region specific overrides.
+		prefix := endpointURLEnv + "_" + service + "_"
+		for _, env := range os.Environ() {
+			name, ep, _ := strings.Cut(env, "=")
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if err := validateEndpointOverride(strings.TrimPrefix(name, endpointURLEnv+"_"), ep, allowInsecure); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Private helper to validate one endpoint override (if set).
+func validateEndpointOverride(name, ep string, allowInsecure bool) error {
+
+	if len(ep) == 0 {
+		return nil
+	}
+	epURL, err := url.Parse(ep)
+	if err != nil || len(epURL.Host) == 0 {
+		return fmt.Errorf("invalid endpoint override for %s: %s", name, ep)
+	}
+	if epURL.Scheme != "https" && !allowInsecure {
+		return fmt.Errorf("endpoint override for %s is not https: %s (use --allow-insecure-endpoints to allow)", name, ep)
+	}
+	return nil
+}
+
+// Make sure an endpoint URL given per mount (in the named attribute) is an
+// https URL of an AWS service endpoint in the partition of the region.
+//
+// Unlike the endpoint overrides of the provider, http and other hosts are
+// never allowed since anyone who can create a SecretProviderClass can set it,
+// and the requests are signed with the pod's credentials. The host must be in
+// the domain of the partition (such as amazonaws.com), which covers the
+// regional, FIPS and VPC (vpce.amazonaws.com) endpoints.
+//
+func ValidateEndpointURL(name, ep, region string) error {
+
+	epURL, err := url.Parse(ep)
+	if err != nil || len(epURL.Host) == 0 || epURL.Scheme != "https" {
+		return fmt.Errorf("%s must be an https URL: %s", name, ep)
+	}
+	if suffix := DNSSuffixOf(region); !strings.HasSuffix(strings.ToLower(epURL.Hostname()), "."+suffix) {
+		return fmt.Errorf("%s must be an endpoint in %s: %s", name, suffix, ep)
+	}
+	return nil
+}
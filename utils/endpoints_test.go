@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEndpointOverride(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "https://all.example.com")
+	t.Setenv("AWS_ENDPOINT_URL_SSM", "https://ssm.example.com")
+
+	assert.Equal(t, "https://ssm.example.com", GetEndpointOverride(SSMService))
+	assert.Equal(t, "https://all.example.com", GetEndpointOverride(SecretsManagerService))
+}
+
+func TestValidateEndpointOverrides_Secure(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	assert.Nil(t, ValidateEndpointOverrides(false))
+
+	t.Setenv("AWS_ENDPOINT_URL_STS", "https://sts.example.com")
+	assert.Nil(t, ValidateEndpointOverrides(false))
+}
+
+func TestValidateEndpointOverrides_Insecure(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", "http://localhost:4566")
+
+	assert.EqualError(t, ValidateEndpointOverrides(false),
+		"endpoint override for SECRETS_MANAGER is not https: http://localhost:4566 (use --allow-insecure-endpoints to allow)")
+	assert.Nil(t, ValidateEndpointOverrides(true))
+}
+
+func TestValidateEndpointOverrides_Invalid(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "localhost")
+
+	assert.EqualError(t, ValidateEndpointOverrides(true), "invalid endpoint override for STS: localhost")
+}
+
+func TestGetRegionalEndpointOverride(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "https://all.example.com")
+	t.Setenv("AWS_ENDPOINT_URL_SSM", "https://ssm.example.com")
+	t.Setenv("AWS_ENDPOINT_URL_SSM_EU_WEST_1", "https://vpce-1.ssm.eu-west-1.vpce.amazonaws.com")
+
+	assert.Equal(t, "https://vpce-1.ssm.eu-west-1.vpce.amazonaws.com", GetRegionalEndpointOverride(SSMService, "eu-west-1"))
+	assert.Equal(t, "https://ssm.example.com", GetRegionalEndpointOverride(SSMService, "us-east-1"))
+	assert.Equal(t, "https://all.example.com", GetRegionalEndpointOverride(SecretsManagerService, "eu-west-1"))
+}
+
+func TestValidateEndpointOverrides_Regional(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_STS_US_EAST_1", "http://localhost:4566")
+
+	assert.EqualError(t, ValidateEndpointOverrides(false),
+		"endpoint override for STS_US_EAST_1 is not https: http://localhost:4566 (use --allow-insecure-endpoints to allow)")
+	assert.Nil(t, ValidateEndpointOverrides(true))
+}
+
+func TestValidateEndpointURL(t *testing.T) {
+	assert.Nil(t, ValidateEndpointURL("secretsManagerEndpointUrl", ExpandEndpoint("https://vpce-1.secretsmanager.{region}.vpce.amazonaws.com", "us-east-1"), "us-east-1"))
+	assert.Nil(t, ValidateEndpointURL("ssmEndpointUrl", "https://ssm-fips.us-east-1.amazonaws.com:443", "us-east-1"))
+	assert.Nil(t, ValidateEndpointURL("ssmEndpointUrl", "https://vpce-1.ssm.cn-north-1.vpce.amazonaws.com.cn", "cn-north-1"))
+	assert.EqualError(t, ValidateEndpointURL("ssmEndpointUrl", "http://localhost:4566", "us-east-1"), "ssmEndpointUrl must be an https URL: http://localhost:4566")
+	assert.EqualError(t, ValidateEndpointURL("ssmEndpointUrl", "localhost", "us-east-1"), "ssmEndpointUrl must be an https URL: localhost")
+	assert.EqualError(t, ValidateEndpointURL("ssmEndpointUrl", "https://ssm.example.com", "us-east-1"), "ssmEndpointUrl must be an endpoint in amazonaws.com: https://ssm.example.com")
+	assert.EqualError(t, ValidateEndpointURL("ssmEndpointUrl", "https://amazonaws.com.example.com", "us-east-1"), "ssmEndpointUrl must be an endpoint in amazonaws.com: https://amazonaws.com.example.com")
+	assert.EqualError(t, ValidateEndpointURL("ssmEndpointUrl", "https://ssm.us-east-1.amazonaws.com", "cn-north-1"), "ssmEndpointUrl must be an endpoint in amazonaws.com.cn: https://ssm.us-east-1.amazonaws.com")
+}
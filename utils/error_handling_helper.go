@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
@@ -25,3 +26,54 @@ func IsFatalError(errMsg error) bool {
 	}
 	return false
 }
+
+//Helper method to find the AWS request ID of a failed request, if any
+func GetRequestID(errMsg error) string {
+
+	if reqErr, ok := errMsg.(awserr.RequestFailure); ok && len(reqErr.RequestID()) > 0 {
+		return reqErr.RequestID()
+	}
+	if reqErr, ok := errMsg.(awserr.Error); ok {
+		if reqErr.OrigErr() != nil {
+			return GetRequestID(reqErr.OrigErr())
+		}
+	}
+	if errors.Unwrap(errMsg) != nil {
+		return GetRequestID(errors.Unwrap(errMsg))
+	}
+	return ""
+}
+
+//Helper method to tag an error with the region and AWS request ID (when known)
+func WithRequestContext(region, requestID string, errMsg error) error {
+	if len(requestID) == 0 {
+		requestID = GetRequestID(errMsg)
+	}
+	if len(requestID) == 0 {
+		return fmt.Errorf("%s: %w", region, errMsg)
+	}
+	return fmt.Errorf("%s (request id: %s): %w", region, requestID, errMsg)
+}
+
+//Helper method to find the AWS error code of a failed request, if any
+//
+// The innermost code is returned since wrapping errors (for example from the
+// credential providers) carry a generic code around the service's error.
+//
+func GetErrorCode(errMsg error) string {
+
+	var code string
+	if reqErr, ok := errMsg.(awserr.Error); ok {
+		code = reqErr.Code()
+		if reqErr.OrigErr() != nil {
+			if inner := GetErrorCode(reqErr.OrigErr()); len(inner) > 0 {
+				return inner
+			}
+		}
+		return code
+	}
+	if errors.Unwrap(errMsg) != nil {
+		return GetErrorCode(errors.Unwrap(errMsg))
+	}
+	return ""
+}
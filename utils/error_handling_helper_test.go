@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -43,3 +45,41 @@ func TestIsFatalError_WrapperWithoutOriginError_nonFatal(t *testing.T) {
 
 	assert.Equal(t, false, fatalError)
 }
+
+func TestGetRequestID_WrappedRequestFailure(t *testing.T) {
+	innerErr := WrapAwsError{code: "AccessDenied", message: "Not authorized to perform sts:AssumeRoleWithWebIdentity", err: nil}
+	awsRequestError := awserr.NewRequestFailure(innerErr, 403, "someId")
+	returnedErr := WrapAwsError{code: "WebIdentityErr", message: "failed to retrieve credentials", err: awsRequestError}
+
+	assert.Equal(t, "someId", GetRequestID(fmt.Errorf("wrapped: %w", returnedErr)))
+}
+
+func TestGetRequestID_NoRequestID(t *testing.T) {
+	assert.Equal(t, "", GetRequestID(fmt.Errorf("network down")))
+}
+
+func TestWithRequestContext(t *testing.T) {
+	awsRequestError := awserr.NewRequestFailure(awserr.New("InternalServiceError", "Server error", nil), 500, "someId")
+
+	err := WithRequestContext("us-west-2", "", awsRequestError)
+	assert.True(t, strings.HasPrefix(err.Error(), "us-west-2 (request id: someId): "))
+	assert.Equal(t, false, IsFatalError(err))
+
+	err = WithRequestContext("us-west-2", "otherId", fmt.Errorf("Invalid parameters"))
+	assert.Equal(t, "us-west-2 (request id: otherId): Invalid parameters", err.Error())
+
+	err = WithRequestContext("us-west-2", "", fmt.Errorf("network down"))
+	assert.Equal(t, "us-west-2: network down", err.Error())
+}
+
+func TestGetErrorCode_WrappedRequestFailure(t *testing.T) {
+	innerErr := awserr.New("AccessDeniedException", "Not authorized to perform secretsmanager:GetSecretValue", nil)
+	awsRequestError := awserr.NewRequestFailure(innerErr, 400, "someId")
+	returnedErr := awserr.New("SharedCredsLoad", "failed", awsRequestError)
+
+	assert.Equal(t, "AccessDeniedException", GetErrorCode(fmt.Errorf("wrapped: %w", returnedErr)))
+}
+
+func TestGetErrorCode_NoCode(t *testing.T) {
+	assert.Equal(t, "", GetErrorCode(fmt.Errorf("network down")))
+}
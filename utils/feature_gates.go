@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The name of a feature that can be turned on or off with --feature-gates.
+type Feature string
+
+// Features that can be toggled at runtime.
+//
+// New features that may be risky should be added here (off by default) so
+// they can ship dark and be enabled per cluster.
+//
+const (
+	// Record the origin of written files in extended attributes.
+	FileProvenanceXattrs Feature = "FileProvenanceXattrs"
+
+	// Copy mounted values into a Kubernetes Secret named by the mount.
+	KubernetesSecretSync Feature = "KubernetesSecretSync"
+
+	// Skip fetching objects that have not been modified since they were mounted.
+	LastModifiedGating Feature = "LastModifiedGating"
+
+	// Serve the experimental gRPC method fetching a single object on demand.
+	OnDemandFetch Feature = "OnDemandFetch"
+
+	// Annotate pods with a summary of the secret versions they were mounted with.
+	PodAuditAnnotation Feature = "PodAuditAnnotation"
+)
+
+// The default state and maturity of a feature.
+type FeatureSpec struct {
+	Default    bool   // Whether the feature is on when not set
+	PreRelease string // Alpha, Beta, or GA
+}
+
+// Maturity levels of a feature.
+const (
+	Alpha = "ALPHA"
+	Beta  = "BETA"
+	GA    = ""
+)
+
+// Private table of the features known to this provider.
+var defaultFeatures = map[Feature]FeatureSpec{
+	FileProvenanceXattrs: {Default: false, PreRelease: Alpha},
+	KubernetesSecretSync: {Default: false, PreRelease: Alpha},
+	LastModifiedGating:   {Default: false, PreRelease: Alpha},
+	OnDemandFetch:        {Default: false, PreRelease: Alpha},
+	PodAuditAnnotation:   {Default: false, PreRelease: Alpha},
+}
+
+// A set of features along with their current state.
+//
+// FeatureGate implements flag.Value so it can be set from the command line
+// using the Kubernetes convention: a comma separated list of Feature=bool
+// pairs, for example --feature-gates=KubernetesSecretSync=true,PodAuditAnnotation=false
+//
+type FeatureGate struct {
+	mu      sync.RWMutex
+	known   map[Feature]FeatureSpec
+	enabled map[Feature]bool
+}
+
+// The feature gate used by the provider (set from --feature-gates).
+var DefaultFeatureGate = NewFeatureGate(defaultFeatures)
+
+// Factory method to create a feature gate for the given known features.
+func NewFeatureGate(known map[Feature]FeatureSpec) *FeatureGate {
+	return &FeatureGate{known: known, enabled: make(map[Feature]bool)}
+}
+
+// Parse and apply a comma separated list of Feature=bool pairs.
+//
+// Unknown features and values that are not booleans are rejected. Nothing
+// is applied if any of the pairs are invalid.
+//
+func (f *FeatureGate) Set(value string) error {
+
+	updates := make(map[Feature]bool)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("missing bool value for feature gate %s", kv[0])
+		}
+		name := Feature(strings.TrimSpace(kv[0]))
+		if _, ok := f.known[name]; !ok {
+			return fmt.Errorf("unrecognized feature gate: %s", name)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s=%s: %w", name, kv[1], err)
+		}
+		updates[name] = enabled
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, enabled := range updates {
+		f.enabled[name] = enabled
+	}
+	return nil
+}
+
+// Returns the features that have been explicitly set, in Feature=bool form.
+func (f *FeatureGate) String() string {
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var pairs []string
+	for name, enabled := range f.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", name, enabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Returns true if the feature is turned on.
+//
+// Features that were not set use their default. Unknown features are always
+// off.
+//
+func (f *FeatureGate) Enabled(name Feature) bool {
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if enabled, ok := f.enabled[name]; ok {
+		return enabled
+	}
+	return f.known[name].Default
+}
+
+// Returns the names of the known features that are turned on, sorted.
+func (f *FeatureGate) EnabledFeatures() []string {
+
+	var features []string
+	for name := range f.known {
+		if f.Enabled(name) {
+			features = append(features, string(name))
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// Returns a description of each known feature for use in help text.
+func (f *FeatureGate) KnownFeatures() []string {
+
+	var features []string
+	for name, spec := range f.known {
+		features = append(features, fmt.Sprintf("%s=true|false (%s - default=%t)", name, spec.PreRelease, spec.Default))
+	}
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureGate_Defaults(t *testing.T) {
+	gate := NewFeatureGate(map[Feature]FeatureSpec{
+		"On":  {Default: true, PreRelease: Beta},
+		"Off": {Default: false, PreRelease: Alpha},
+	})
+
+	assert.Equal(t, true, gate.Enabled("On"))
+	assert.Equal(t, false, gate.Enabled("Off"))
+	assert.Equal(t, false, gate.Enabled("Unknown"))
+	assert.Equal(t, "", gate.String())
+}
+
+func TestFeatureGate_Set(t *testing.T) {
+	gate := NewFeatureGate(defaultFeatures)
+
+	err := gate.Set("LastModifiedGating=true, PodAuditAnnotation=false")
+	assert.Nil(t, err)
+	assert.Equal(t, true, gate.Enabled(LastModifiedGating))
+	assert.Equal(t, false, gate.Enabled(PodAuditAnnotation))
+	assert.Equal(t, "LastModifiedGating=true,PodAuditAnnotation=false", gate.String())
+	assert.Equal(t, []string{"LastModifiedGating"}, gate.EnabledFeatures())
+}
+
+func TestFeatureGate_SetInvalid(t *testing.T) {
+	gate := NewFeatureGate(defaultFeatures)
+
+	assert.EqualError(t, gate.Set("PodAuditAnnotation=true,NoSuchFeature=true"), "unrecognized feature gate: NoSuchFeature")
+	assert.EqualError(t, gate.Set("PodAuditAnnotation"), "missing bool value for feature gate PodAuditAnnotation")
+	assert.ErrorContains(t, gate.Set("PodAuditAnnotation=maybe"), "invalid value of PodAuditAnnotation=maybe")
+
+	// Nothing is applied when part of the value is bad.
+	assert.Equal(t, false, gate.Enabled(PodAuditAnnotation))
+}
+
+func TestFeatureGate_KnownFeatures(t *testing.T) {
+	assert.Equal(t, []string{
+		"FileProvenanceXattrs=true|false (ALPHA - default=false)",
+		"KubernetesSecretSync=true|false (ALPHA - default=false)",
+		"LastModifiedGating=true|false (ALPHA - default=false)",
+		"OnDemandFetch=true|false (ALPHA - default=false)",
+		"PodAuditAnnotation=true|false (ALPHA - default=false)",
+	}, DefaultFeatureGate.KnownFeatures())
+}
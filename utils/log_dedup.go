@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Most distinct messages tracked at once. Once reached, new messages are
+// logged as is rather than growing the map without bound.
+const maxDedupEntries = 10000
+
+// Request IDs differ on every AWS call, so they are masked when comparing
+// messages. Matches both "(request id: <id>)" from WithRequestContext and the
+// SDK's "request id: <id>".
+var requestIDRE = regexp.MustCompile(`request id: [0-9A-Za-z-]+`)
+
+// Severities of deduplicated messages.
+const (
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// Suppresses repeated identical log messages.
+//
+// During an outage every mount and rotation can fail with the same error,
+// flooding the node logs. The first occurrence of a message is logged right
+// away and identical messages within the window are only counted. When the
+// window ends the count is logged once (for example "repeated 240x in last
+// 1m0s"). A window of 0 turns deduplication off.
+//
+type LogDeduplicator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*dedupEntry
+	now     func() time.Time
+	emit    func(severity, msg string)
+}
+
+// Private tracking of one message within the current window.
+type dedupEntry struct {
+	severity string
+	first    time.Time
+	repeats  int
+}
+
+// The deduplicator used by the package level logging functions (off until a
+// window is set).
+var DefaultLogDeduplicator = NewLogDeduplicator(0)
+
+// Create a deduplicator with the given window (0 to log every message).
+//
+func NewLogDeduplicator(window time.Duration) *LogDeduplicator {
+	return &LogDeduplicator{
+		window:  window,
+		entries: make(map[string]*dedupEntry),
+		now:     time.Now,
+		emit:    emitLog,
+	}
+}
+
+// Private helper to write a message to klog, attributed to the caller of the
+// logging function.
+func emitLog(severity, msg string) {
+	if severity == severityError {
+		klog.ErrorDepth(3, msg)
+	} else {
+		klog.WarningDepth(3, msg)
+	}
+}
+
+// Change the deduplication window (0 to log every message). Counts of
+// suppressed messages are logged first.
+//
+func (d *LogDeduplicator) SetWindow(window time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.flushLocked(true)
+	d.window = window
+}
+
+// Log an error unless it repeats a recent identical error.
+//
+func (d *LogDeduplicator) Errorf(format string, args ...interface{}) {
+	d.log(severityError, fmt.Sprintf(format, args...))
+}
+
+// Log a warning unless it repeats a recent identical warning.
+//
+func (d *LogDeduplicator) Warningf(format string, args ...interface{}) {
+	d.log(severityWarning, fmt.Sprintf(format, args...))
+}
+
+// Private helper to log a message or count it as a repeat.
+func (d *LogDeduplicator) log(severity, msg string) {
+
+	d.mu.Lock()
+	if d.window <= 0 {
+		d.mu.Unlock()
+		d.emit(severity, msg)
+		return
+	}
+
+	now := d.now()
+	key := severity + "\x00" + requestIDRE.ReplaceAllString(msg, "request id: *")
+	entry := d.entries[key]
+	if entry != nil && now.Sub(entry.first) < d.window {
+		entry.repeats++
+		d.mu.Unlock()
+		return
+	}
+
+	summary := ""
+	if entry != nil && entry.repeats > 0 {
+		summary = repeatSummary(msg, entry.repeats, d.window)
+	}
+	if entry != nil || len(d.entries) < maxDedupEntries {
+		d.entries[key] = &dedupEntry{severity: severity, first: now}
+	}
+	d.mu.Unlock()
+
+	if len(summary) > 0 {
+		d.emit(severity, summary)
+	}
+	d.emit(severity, msg)
+}
+
+// Log the counts of messages whose window has ended and forget them.
+//
+// Called periodically by Run so repeats are reported even when a message
+// stops occurring.
+//
+func (d *LogDeduplicator) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.flushLocked(false)
+}
+
+// Private helper to flush the entries whose window ended (or all of them).
+// Must be called with the lock held.
+func (d *LogDeduplicator) flushLocked(all bool) {
+
+	now := d.now()
+	for key, entry := range d.entries {
+		if !all && now.Sub(entry.first) < d.window {
+			continue
+		}
+		if entry.repeats > 0 {
+			d.emit(entry.severity, repeatSummary(key[len(entry.severity)+1:], entry.repeats, d.window))
+		}
+		delete(d.entries, key)
+	}
+}
+
+// Private helper to describe a repeated message.
+func repeatSummary(msg string, repeats int, window time.Duration) string {
+	return fmt.Sprintf("%s (repeated %dx in last %s)", msg, repeats, window)
+}
+
+// Periodically report the counts of suppressed messages until the context is
+// cancelled.
+//
+func (d *LogDeduplicator) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Flush()
+		}
+	}
+}
+
+// Remembers what was already reported.
+//
+// Warnings about something that does not change between mounts (for example a
+// parameter in the advanced tier) would otherwise be logged and recorded as
+// pod events on every mount and rotation. The zero value is ready to use.
+//
+type ReportedSet struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // When each key was last reported
+	now  func() time.Time     // Clock (time.Now when nil)
+}
+
+// Tell if a key is reported for the first time, and remember it.
+//
+// Once maxDedupEntries keys are remembered, new keys are always reported
+// rather than growing the set without bound.
+//
+func (r *ReportedSet) First(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.seen[key]; ok {
+		return false
+	}
+	r.rememberLocked(key)
+	return true
+}
+
+// Tell if a key was not reported within the interval, and remember when it
+// is reported.
+//
+// Use for warnings about something that gets more urgent over time (for
+// example a parameter about to expire), which should be repeated now and then
+// rather than on every mount.
+//
+func (r *ReportedSet) Every(key string, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.seen[key]; ok && r.clock().Sub(last) < interval {
+		return false
+	}
+	r.rememberLocked(key)
+	return true
+}
+
+// Private helper to remember when a key was reported. Must be called with the
+// lock held.
+func (r *ReportedSet) rememberLocked(key string) {
+	if r.seen == nil {
+		r.seen = make(map[string]time.Time)
+	}
+	if _, ok := r.seen[key]; ok || len(r.seen) < maxDedupEntries {
+		r.seen[key] = r.clock()
+	}
+}
+
+// Private helper to read the clock of the set.
+func (r *ReportedSet) clock() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// Log an error with the default deduplicator.
+//
+// Use for errors that can repeat on every mount, such as AWS or Kubernetes
+// API failures during an outage.
+//
+func Errorf(format string, args ...interface{}) {
+	DefaultLogDeduplicator.log(severityError, fmt.Sprintf(format, args...))
+}
+
+// Log a warning with the default deduplicator.
+//
+func Warningf(format string, args ...interface{}) {
+	DefaultLogDeduplicator.log(severityWarning, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Private helper to create a deduplicator with a fake clock that records the
+// messages it logs.
+func newTestDeduplicator(window time.Duration) (*LogDeduplicator, *time.Time, *[]string) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var logged []string
+	d := NewLogDeduplicator(window)
+	d.now = func() time.Time { return now }
+	d.emit = func(severity, msg string) { logged = append(logged, severity+": "+msg) }
+	return d, &now, &logged
+}
+
+func TestLogDeduplicator(t *testing.T) {
+
+	d, now, logged := newTestDeduplicator(time.Minute)
+
+	for i := 0; i < 5; i++ {
+		d.Errorf("Failed fetching secret %s: %s", "db", "throttled")
+	}
+	d.Warningf("Failed fetching secret %s: %s", "db", "throttled") // Other severity
+	d.Errorf("Failed fetching secret %s: %s", "api", "throttled")
+	assert.Equal(t, []string{
+		"error: Failed fetching secret db: throttled",
+		"warning: Failed fetching secret db: throttled",
+		"error: Failed fetching secret api: throttled",
+	}, *logged)
+
+	// The repeats are counted once the window ends.
+	*logged = nil
+	*now = now.Add(30 * time.Second)
+	d.Flush()
+	assert.Empty(t, *logged)
+	*now = now.Add(30 * time.Second)
+	d.Flush()
+	assert.Equal(t, []string{"error: Failed fetching secret db: throttled (repeated 4x in last 1m0s)"}, *logged)
+
+	// A message in a new window is logged again.
+	*logged = nil
+	d.Errorf("Failed fetching secret db: throttled")
+	assert.Equal(t, []string{"error: Failed fetching secret db: throttled"}, *logged)
+
+	// Repeats are also counted when the message comes back before a flush.
+	*logged = nil
+	d.Errorf("Failed fetching secret db: throttled")
+	*now = now.Add(2 * time.Minute)
+	d.Errorf("Failed fetching secret db: throttled")
+	assert.Equal(t, []string{
+		"error: Failed fetching secret db: throttled (repeated 1x in last 1m0s)",
+		"error: Failed fetching secret db: throttled",
+	}, *logged)
+}
+
+// Make sure messages that only differ by their AWS request id are repeats.
+func TestLogDeduplicator_RequestID(t *testing.T) {
+
+	d, now, logged := newTestDeduplicator(time.Minute)
+
+	d.Errorf("us-west-2 (request id: 1a2b-3c): Failed fetching secret db: throttled, status code: 400, request id: 1a2b-3c")
+	d.Errorf("us-west-2 (request id: 4d5e-6f): Failed fetching secret db: throttled, status code: 400, request id: 4d5e-6f")
+	assert.Equal(t, []string{
+		"error: us-west-2 (request id: 1a2b-3c): Failed fetching secret db: throttled, status code: 400, request id: 1a2b-3c",
+	}, *logged)
+
+	*logged = nil
+	*now = now.Add(time.Minute)
+	d.Flush()
+	assert.Equal(t, []string{
+		"error: us-west-2 (request id: *): Failed fetching secret db: throttled, status code: 400, request id: * (repeated 1x in last 1m0s)",
+	}, *logged)
+}
+
+func TestLogDeduplicator_Disabled(t *testing.T) {
+
+	d, _, logged := newTestDeduplicator(0)
+	d.Errorf("same")
+	d.Errorf("same")
+	assert.Equal(t, []string{"error: same", "error: same"}, *logged)
+
+	// Turning it off reports the pending repeats.
+	d.SetWindow(time.Minute)
+	d.Errorf("same")
+	d.Errorf("same")
+	d.SetWindow(0)
+	assert.Equal(t, []string{"error: same", "error: same", "error: same", "error: same (repeated 1x in last 1m0s)"}, *logged)
+}
+
+func TestLogDeduplicator_Run(t *testing.T) {
+
+	d, now, logged := newTestDeduplicator(time.Minute)
+	d.Errorf("same")
+	d.Errorf("same")
+	*now = now.Add(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(*logged) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestReportedSet(t *testing.T) {
+
+	var reported ReportedSet
+	assert.True(t, reported.First("a"))
+	assert.False(t, reported.First("a"))
+	assert.True(t, reported.First("b"))
+}
+
+func TestReportedSetEvery(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reported := ReportedSet{now: func() time.Time { return now }}
+	assert.True(t, reported.Every("a", time.Hour))
+	assert.False(t, reported.Every("a", time.Hour))
+	assert.True(t, reported.Every("b", time.Hour))
+
+	now = now.Add(time.Hour)
+	assert.True(t, reported.Every("a", time.Hour))
+	assert.False(t, reported.Every("a", time.Hour))
+	assert.False(t, reported.First("a"))
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Prefix of all provider metric names.
+const metricPrefix = "secrets_store_csi_driver_provider_aws_"
+
+// Error code label used when a failure has no AWS error code (for example a
+// cancelled request).
+const unknownErrorCode = "Unknown"
+
+// Default histogram buckets for AWS API call latencies, in seconds.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// How a Secrets Manager secret (or, for FetchUnmodified and FetchUnmoved, an
+// SSM parameter) was mounted (see RecordFetchDecision).
+const (
+	FetchInitial    = "initial"    // No version was mounted, so the secret was fetched
+	FetchChanged    = "changed"    // The mounted version was not current, so the secret was fetched
+	FetchReloaded   = "reloaded"   // The mounted version was current and was read back from the mount
+	FetchRefetched  = "refetched"  // The mounted version was current but had to be fetched again
+	FetchUnmodified = "unmodified" // The parameter was not modified since it was mounted and was read back
+	FetchUnmoved    = "unmoved"    // The label of the parameter was still on the mounted version, which was read back
+)
+
+// Why a response was dropped from the secret cache (see RecordCacheEviction).
+const (
+	CacheEvictedSize    = "size"    // Least recently used, to stay under the size limit
+	CacheEvictedExpired = "expired" // Older than the TTL
+)
+
+// Histogram buckets for SSM GetParameters batch sizes (at most 10).
+var batchSizeBuckets = []float64{1, 2, 4, 6, 8, 10}
+
+// Registry of the provider metrics.
+//
+// A registry of our own rather than the default one, so only the provider
+// metrics are served and tests can read them without global side effects.
+//
+var registry = prometheus.NewRegistry()
+
+// Private helper to create and register a counter with labels.
+func newCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: metricPrefix + name, Help: help}, labels)
+	registry.MustRegister(c)
+	return c
+}
+
+// Private helper to create and register a gauge without labels.
+func newGauge(name, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: metricPrefix + name, Help: help})
+	registry.MustRegister(g)
+	return g
+}
+
+// Private helper to create and register a histogram with labels.
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: metricPrefix + name, Help: help, Buckets: buckets}, labels)
+	registry.MustRegister(h)
+	return h
+}
+
+// The provider metrics.
+var (
+	mountRequests = newCounterVec("mount_requests_total",
+		"Mount requests by result (success or error).", "result")
+	apiCallDuration = newHistogramVec("api_call_duration_seconds",
+		"Latency of AWS API calls by object type, operation, and region.", latencyBuckets, "object_type", "operation", "region")
+	fetchErrors = newCounterVec("fetch_errors_total",
+		"Failed AWS requests by object type, region, AWS error code, and HTTP status class.", "object_type", "region", "code", "class")
+	batchSizes = newHistogramVec("ssm_batch_size",
+		"Number of parameters in each SSM GetParameters call.", batchSizeBuckets)
+	failoverActivations = newCounterVec("failover_activations_total",
+		"Objects that started being served from the failover region, by object type.", "object_type")
+	fetchDecisions = newCounterVec("secretsmanager_fetch_decisions_total",
+		"Secrets Manager secrets mounted by region and whether they were fetched (initial, changed, or refetched) or reloaded from the mount.", "region", "decision")
+	writeMismatches = newCounterVec("write_mismatches_total",
+		"Files written by the driver that were missing or modified when verified on the next mount.", "kind")
+	cacheEvictions = newCounterVec("secret_cache_evictions_total",
+		"Responses dropped from the secret cache by reason (size or expired).", "reason")
+	cacheBytes = newGauge("secret_cache_bytes",
+		"Estimated bytes held by the secret cache.")
+	cacheEntries = newGauge("secret_cache_entries",
+		"Responses held by the secret cache.")
+	frozen = newGauge("frozen",
+		"1 while the provider is frozen for incident response and fetches nothing, otherwise 0.")
+	deprecations = newCounterVec("deprecated_fields_total",
+		"Pods first mounting a deprecated SecretProviderClass field, by field.", "field")
+	parametersExpiring = newCounterVec("ssm_parameters_expiring_total",
+		"SSM parameters fetched within the expiry warning window of their Expiration policy, by region.", "region")
+)
+
+// Count a mount request by its result.
+func RecordMount(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	mountRequests.WithLabelValues(result).Inc()
+}
+
+// Record the latency of an AWS API call.
+func ObserveAPICall(objectType, operation, region string, duration time.Duration) {
+	apiCallDuration.WithLabelValues(objectType, operation, region).Observe(duration.Seconds())
+}
+
+// Count a failed call to an AWS service.
+//
+// Failures are counted by object type (secretsmanager or ssmparameter),
+// region, AWS error code, and HTTP status class (4XX, 5XX, or other) so IAM
+// problems (AccessDeniedException), missing secrets
+// (ResourceNotFoundException), and throttling (ThrottlingException) can be
+// told apart. The code is taken from the error unless one is given.
+//
+func RecordFetchError(objectType, region, code string, err error) {
+	if len(code) == 0 {
+		code = GetErrorCode(err)
+	}
+	if len(code) == 0 {
+		code = unknownErrorCode
+	}
+	fetchErrors.WithLabelValues(objectType, region, code, getStatusClass(err)).Inc()
+}
+
+// Record the number of parameters in an SSM batch.
+func ObserveBatchSize(size int) {
+	batchSizes.WithLabelValues().Observe(float64(size))
+}
+
+// Count an object that started being served from the failover region.
+func RecordFailover(objectType string) {
+	failoverActivations.WithLabelValues(objectType).Inc()
+}
+
+// Count how a Secrets Manager secret was mounted.
+//
+// On rotation reconciles most secrets should be reloaded from the mount after
+// a DescribeSecret call. A high rate of initial or refetched decisions during
+// reconciles points to a misconfiguration (such as the driver not passing back
+// the mounted versions, or writeParent being false) that makes every
+// reconcile call GetSecretValue for every secret. The region tells the primary
+// and failover regions apart.
+//
+func RecordFetchDecision(region, decision string) {
+	fetchDecisions.WithLabelValues(region, decision).Inc()
+}
+
+// Count a file written by the driver that did not match what was sent to it
+// (kind is missing or modified).
+func RecordWriteMismatch(kind string) {
+	writeMismatches.WithLabelValues(kind).Inc()
+}
+
+// Count a response dropped from the secret cache (reason is size or
+// expired).
+//
+// A steady rate of size evictions means the cache limit is too small for the
+// secrets mounted on the node, so mounts call AWS more often than the TTL
+// suggests.
+//
+func RecordCacheEviction(reason string) {
+	cacheEvictions.WithLabelValues(reason).Inc()
+}
+
+// Record the number of responses and estimated bytes held by the secret cache.
+func SetCacheSize(entries int, bytes int64) {
+	cacheEntries.Set(float64(entries))
+	cacheBytes.Set(float64(bytes))
+}
+
+// Record whether the provider is frozen.
+func SetFrozen(isFrozen bool) {
+	var value float64
+	if isFrozen {
+		value = 1
+	}
+	frozen.Set(value)
+}
+
+// Count a pod mounting a deprecated field for the first time.
+func RecordDeprecation(field string) {
+	deprecations.WithLabelValues(field).Inc()
+}
+
+// Count an SSM parameter fetched within the expiry warning window of its
+// Expiration policy.
+func RecordParameterExpiring(region string) {
+	parametersExpiring.WithLabelValues(region).Inc()
+}
+
+// Register more metrics to serve with the provider metrics.
+func RegisterMetrics(collectors ...prometheus.Collector) {
+	registry.MustRegister(collectors...)
+}
+
+// Write all the provider metrics in the Prometheus text format.
+func WriteMetrics(w io.Writer) error {
+
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a handler serving the provider metrics (see RegisterMetrics).
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Private helper to find the HTTP status class (4XX or 5XX) of a failed
+// request, or other when there was no HTTP response.
+//
+func getStatusClass(errMsg error) string {
+
+	if reqErr, ok := errMsg.(awserr.RequestFailure); ok && reqErr.StatusCode() >= 400 {
+		return fmt.Sprintf("%dXX", reqErr.StatusCode()/100)
+	}
+	if reqErr, ok := errMsg.(awserr.Error); ok && reqErr.OrigErr() != nil {
+		return getStatusClass(reqErr.OrigErr())
+	}
+	if errors.Unwrap(errMsg) != nil {
+		return getStatusClass(errors.Unwrap(errMsg))
+	}
+	return "other"
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestMetrics(t *testing.T) {
+
+	throttled := awserr.NewRequestFailure(awserr.New("ThrottlingException", "Rate exceeded", nil), 400, "someId")
+	RecordFetchError("secretsmanager", "us-west-2", "", fmt.Errorf("wrapped: %w", throttled))
+	RecordFetchError("secretsmanager", "us-west-2", "", throttled)
+	RecordFetchError("ssmparameter", "us-east-1", "", fmt.Errorf("network down"))
+	RecordMount(nil)
+	RecordMount(fmt.Errorf("failed"))
+	ObserveAPICall("secretsmanager", "GetSecretValue", "us-west-2", 30*time.Millisecond)
+	ObserveBatchSize(3)
+	RecordFailover("ssmparameter")
+	RecordFetchDecision("us-west-2", FetchReloaded)
+	RecordFetchDecision("us-west-2", FetchReloaded)
+	RecordCacheEviction(CacheEvictedSize)
+	SetCacheSize(2, 1024)
+
+	var out strings.Builder
+	if err := WriteMetrics(&out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	metrics := out.String()
+
+	for _, line := range []string{
+		"# TYPE secrets_store_csi_driver_provider_aws_fetch_errors_total counter\n",
+		`secrets_store_csi_driver_provider_aws_fetch_errors_total{class="4XX",code="ThrottlingException",object_type="secretsmanager",region="us-west-2"} 2` + "\n",
+		`secrets_store_csi_driver_provider_aws_fetch_errors_total{class="other",code="Unknown",object_type="ssmparameter",region="us-east-1"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_mount_requests_total{result="error"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_mount_requests_total{result="success"} 1` + "\n",
+		"# TYPE secrets_store_csi_driver_provider_aws_api_call_duration_seconds histogram\n",
+		`secrets_store_csi_driver_provider_aws_api_call_duration_seconds_bucket{object_type="secretsmanager",operation="GetSecretValue",region="us-west-2",le="0.025"} 0` + "\n",
+		`secrets_store_csi_driver_provider_aws_api_call_duration_seconds_bucket{object_type="secretsmanager",operation="GetSecretValue",region="us-west-2",le="0.05"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_api_call_duration_seconds_bucket{object_type="secretsmanager",operation="GetSecretValue",region="us-west-2",le="+Inf"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_api_call_duration_seconds_count{object_type="secretsmanager",operation="GetSecretValue",region="us-west-2"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_ssm_batch_size_bucket{le="4"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_ssm_batch_size_sum 3` + "\n",
+		`secrets_store_csi_driver_provider_aws_failover_activations_total{object_type="ssmparameter"} 1` + "\n",
+		`secrets_store_csi_driver_provider_aws_secretsmanager_fetch_decisions_total{decision="reloaded",region="us-west-2"} 2` + "\n",
+		`secrets_store_csi_driver_provider_aws_secret_cache_evictions_total{reason="size"} 1` + "\n",
+		"# TYPE secrets_store_csi_driver_provider_aws_secret_cache_bytes gauge\n",
+		"secrets_store_csi_driver_provider_aws_secret_cache_bytes 1024\n",
+		"secrets_store_csi_driver_provider_aws_secret_cache_entries 2\n",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Fatalf("Missing %q in metrics:\n%s", line, metrics)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time of the last successful mount (Unix nanoseconds, 0 for never).
+var lastMountSuccess atomic.Int64
+
+// Start times of the mounts in progress, by mount ID.
+var (
+	mountsMu       sync.Mutex
+	mountsInFlight = make(map[uint64]time.Time)
+	lastMountID    uint64
+)
+
+// Record the start of a mount. The returned function records its result.
+//
+// A mount still in progress long after every request deadline points to a
+// wedged provider, and the time of the last successful mount shows whether
+// the provider still serves mounts (see the health endpoint).
+//
+func StartMount() func(err error) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+
+	lastMountID++
+	id := lastMountID
+	mountsInFlight[id] = time.Now()
+	return func(err error) {
+		if err == nil {
+			lastMountSuccess.Store(time.Now().UnixNano())
+		}
+		mountsMu.Lock()
+		defer mountsMu.Unlock()
+		delete(mountsInFlight, id)
+	}
+}
+
+// Returns the time of the last successful mount (zero if there was none).
+func LastMountSuccess() time.Time {
+	nanos := lastMountSuccess.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Returns the start of the oldest mount in progress (zero if there is none).
+func OldestMountInProgress() (oldest time.Time) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+
+	for _, start := range mountsInFlight {
+		if oldest.IsZero() || start.Before(oldest) {
+			oldest = start
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartMount(t *testing.T) {
+
+	lastMountSuccess.Store(0)
+	assert.True(t, OldestMountInProgress().IsZero())
+
+	failed := StartMount()
+	succeeded := StartMount()
+	assert.WithinDuration(t, time.Now(), OldestMountInProgress(), time.Second)
+
+	failed(fmt.Errorf("denied"))
+	assert.True(t, LastMountSuccess().IsZero())
+	assert.False(t, OldestMountInProgress().IsZero())
+
+	succeeded(nil)
+	assert.WithinDuration(t, time.Now(), LastMountSuccess(), time.Second)
+	assert.True(t, OldestMountInProgress().IsZero())
+}
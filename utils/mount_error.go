@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Categories of mount failures, so the driver and pod events can tell what
+// action to take.
+const (
+	ErrorInvalidConfiguration = "InvalidConfiguration" // The SecretProviderClass or mount request is invalid
+	ErrorAccessDenied         = "AccessDenied"         // The role can not access the object (or its KMS key)
+	ErrorNotFound             = "NotFound"             // The object (or version) does not exist
+	ErrorThrottled            = "Throttled"            // The service throttled the request
+	ErrorRejected             = "Rejected"             // The service rejected the request for another reason
+	ErrorUnavailable          = "Unavailable"          // The service could not be reached or failed
+	ErrorCancelled            = "Cancelled"            // The mount was cancelled or timed out
+	ErrorUnknown              = "Unknown"
+)
+
+// AWS error codes of access failures.
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"UnrecognizedClientException": true,
+	"InvalidClientTokenId":        true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidIdentityToken":        true,
+	"KMSAccessDeniedException":    true,
+}
+
+// AWS error codes of missing objects.
+var notFoundCodes = map[string]bool{
+	"ResourceNotFoundException":     true,
+	"ParameterNotFound":             true,
+	"ParameterVersionNotFound":      true,
+	"ParameterVersionLabelNotFound": true,
+}
+
+// An error fetching a single object (or batch of objects).
+//
+// Carries the object and region so they can be reported as structured
+// details. The message is that of the wrapped error.
+//
+type ObjectError struct {
+	ObjectType string // secretsmanager or ssmparameter
+	ObjectName string // Object name (or comma separated names of a batch)
+	Region     string // Region of the failed request (empty when all regions failed)
+	Err        error
+}
+
+func (e *ObjectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+// Tag an error with the object being fetched.
+//
+// Errors already tagged with an object are returned unchanged.
+//
+func WithObject(objectType, objectName, region string, err error) error {
+	var objErr *ObjectError
+	if err == nil || errors.As(err, &objErr) {
+		return err
+	}
+	return &ObjectError{ObjectType: objectType, ObjectName: objectName, Region: region, Err: err}
+}
+
+// Returns the object an error was tagged with, if any.
+func GetObjectError(err error) *ObjectError {
+	var objErr *ObjectError
+	if errors.As(err, &objErr) {
+		return objErr
+	}
+	return nil
+}
+
+// Private error type with a known category.
+type categorizedError struct {
+	category string
+	err      error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+// Mark an error with its category when it can not be found from the error
+// itself (for example errors detected by the provider).
+//
+func WithCategory(category string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category, err}
+}
+
+// Mark an error as caused by an invalid SecretProviderClass or mount request.
+func InvalidConfiguration(err error) error {
+	return WithCategory(ErrorInvalidConfiguration, err)
+}
+
+// Private error type joining the errors of several regions.
+type regionErrors []error
+
+func (e regionErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e regionErrors) Unwrap() []error {
+	return e
+}
+
+// Join the errors from each region into one error (messages separated by
+// semicolons) that keeps the AWS error details of every region.
+//
+func JoinRegionErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return regionErrors(errs)
+}
+
+// Returns the category of a mount failure.
+//
+// When the regions failed in different ways the most actionable category is
+// used (for example AccessDenied rather than Unavailable).
+//
+func ErrorCategory(err error) string {
+
+	var catErr *categorizedError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &catErr):
+		return catErr.category
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return ErrorCancelled
+	}
+
+	if joined, ok := err.(regionErrors); ok {
+		return joinedCategory(joined)
+	}
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		return joinedCategory(multi.Unwrap())
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return awsErrorCategory(aerr)
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		return ErrorCategory(inner)
+	}
+	return ErrorUnknown
+}
+
+// Private helper to pick the most actionable category of several errors.
+func joinedCategory(errs []error) string {
+
+	rank := []string{ErrorInvalidConfiguration, ErrorAccessDenied, ErrorNotFound, ErrorRejected,
+		ErrorThrottled, ErrorUnavailable, ErrorCancelled, ErrorUnknown}
+	best := len(rank)
+	for _, err := range errs {
+		category := ErrorCategory(err)
+		for i := 0; i < best; i++ {
+			if rank[i] == category {
+				best = i
+			}
+		}
+	}
+	if best == len(rank) {
+		return ErrorUnknown
+	}
+	return rank[best]
+}
+
+// Private helper to find the category of an AWS error.
+func awsErrorCategory(err awserr.Error) string {
+
+	code := GetErrorCode(err)
+	switch {
+	case accessDeniedCodes[code]:
+		return ErrorAccessDenied
+	case notFoundCodes[code]:
+		return ErrorNotFound
+	case request.IsErrorThrottle(err) || code == "ThrottlingException":
+		return ErrorThrottled
+	case code == request.CanceledErrorCode:
+		return ErrorCancelled
+	case code == request.ErrCodeRequestError || code == request.ErrCodeResponseTimeout ||
+		getStatusClass(err) == "5XX" || request.IsErrorRetryable(err):
+		return ErrorUnavailable
+	case getStatusClass(err) == "4XX":
+		return ErrorRejected
+	}
+	return ErrorUnknown
+}
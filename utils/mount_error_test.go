@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCategory(t *testing.T) {
+
+	newErr := func(code string, status int) error {
+		return awserr.NewRequestFailure(awserr.New(code, "message", nil), status, "someId")
+	}
+
+	for expected, err := range map[string]error{
+		ErrorAccessDenied:         newErr("AccessDeniedException", 400),
+		ErrorNotFound:             newErr("ResourceNotFoundException", 400),
+		ErrorThrottled:            newErr("ThrottlingException", 400),
+		ErrorRejected:             newErr("ValidationException", 400),
+		ErrorUnavailable:          newErr("InternalServiceError", 500),
+		ErrorCancelled:            fmt.Errorf("wrapped: %w", context.Canceled),
+		ErrorInvalidConfiguration: InvalidConfiguration(fmt.Errorf("bad attribute")),
+		ErrorUnknown:              fmt.Errorf("something else"),
+	} {
+		assert.Equal(t, expected, ErrorCategory(fmt.Errorf("region: %w", err)))
+	}
+	assert.Equal(t, ErrorUnavailable, ErrorCategory(awserr.New(request.ErrCodeRequestError, "send request failed", nil)))
+	assert.Equal(t, "", ErrorCategory(nil))
+}
+
+func TestJoinRegionErrors(t *testing.T) {
+
+	denied := awserr.NewRequestFailure(awserr.New("AccessDeniedException", "denied", nil), 400, "id1")
+	down := awserr.NewRequestFailure(awserr.New("InternalServiceError", "down", nil), 500, "id2")
+
+	err := JoinRegionErrors([]error{fmt.Errorf("us-west-2: %w", down), fmt.Errorf("us-east-1: %w", denied)})
+	assert.Contains(t, err.Error(), "us-west-2: InternalServiceError: down")
+	assert.Contains(t, err.Error(), "; us-east-1: AccessDeniedException: denied")
+	assert.Equal(t, ErrorAccessDenied, ErrorCategory(fmt.Errorf("all regions: %w", err)))
+	assert.Nil(t, JoinRegionErrors(nil))
+}
+
+func TestWithObject(t *testing.T) {
+
+	inner := awserr.NewRequestFailure(awserr.New("ParameterNotFound", "missing", nil), 400, "id1")
+	err := WithObject("ssmparameter", "param1", "us-west-2", inner)
+	assert.Equal(t, inner.Error(), err.Error())
+
+	// The first object wins.
+	err = WithObject("secretsmanager", "other", "", fmt.Errorf("wrapped: %w", err))
+	objErr := GetObjectError(err)
+	assert.NotNil(t, objErr)
+	assert.Equal(t, "ssmparameter", objErr.ObjectType)
+	assert.Equal(t, "param1", objErr.ObjectName)
+	assert.Equal(t, "us-west-2", objErr.Region)
+	assert.Equal(t, ErrorNotFound, ErrorCategory(err))
+
+	assert.Nil(t, GetObjectError(fmt.Errorf("no object")))
+	assert.Nil(t, WithObject("ssmparameter", "param1", "", nil))
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"k8s.io/klog/v2"
+)
+
+// Partitions with FIPS endpoints for Secrets Manager, SSM, and STS.
+var fipsPartitions = map[string]bool{
+	endpoints.AwsPartitionID:      true,
+	endpoints.AwsUsGovPartitionID: true,
+}
+
+// Partitions already warned about using standard instead of FIPS endpoints.
+var fipsFallbacks ReportedSet
+
+// Returns the partition (such as aws, aws-cn, or aws-us-gov) of a region.
+//
+// Returns an empty string for regions the SDK does not recognize, so callers
+// can skip partition checks instead of rejecting new or test regions.
+//
+func PartitionOf(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.ID()
+	}
+	return ""
+}
+
+// Returns the domain of the service endpoints of a region (such as
+// amazonaws.com, or amazonaws.com.cn in China).
+//
+// Returns amazonaws.com for regions the SDK does not recognize.
+//
+func DNSSuffixOf(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.DNSSuffix()
+	}
+	return "amazonaws.com"
+}
+
+// Returns the IDs of the partitions known to the SDK (aws, aws-cn,
+// aws-us-gov, and the isolated partitions).
+//
+func Partitions() []string {
+	var ids []string
+	for _, partition := range endpoints.DefaultPartitions() {
+		ids = append(ids, partition.ID())
+	}
+	return ids
+}
+
+// Returns true when two regions are in the same partition (or either
+// partition is unknown). Credentials and ARNs never work across partitions.
+//
+func SamePartition(region1, region2 string) bool {
+	partition1, partition2 := PartitionOf(region1), PartitionOf(region2)
+	return len(partition1) == 0 || len(partition2) == 0 || partition1 == partition2
+}
+
+// Returns the client configuration for a service in a region.
+//
+// Applies any endpoint override for the service in the region. The default
+// endpoints already follow the partition of the region (for example
+// amazonaws.com.cn in China), but FIPS endpoints only exist in the aws and
+// aws-us-gov partitions. When FIPS endpoints are requested
+// (AWS_USE_FIPS_ENDPOINT) for a region in another partition, they are turned
+// off for that region so one provider configuration works in every partition.
+// Since that may matter for compliance, a warning is logged the first time it
+// happens in each partition.
+//
+func ServiceConfig(service, region string) *aws.Config {
+
+	cfg := aws.NewConfig().
+		WithRegion(region).
+		WithEndpoint(GetRegionalEndpointOverride(service, region))
+	if partition := PartitionOf(region); len(partition) > 0 && !fipsPartitions[partition] {
+		if strings.EqualFold(os.Getenv("AWS_USE_FIPS_ENDPOINT"), "true") && fipsFallbacks.First(partition) {
+			klog.Warningf("FIPS endpoints do not exist in the %s partition, using the standard endpoints for region %s and the rest of the partition", partition, region)
+		}
+		cfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateDisabled
+	}
+	return cfg
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionOf(t *testing.T) {
+	assert.Equal(t, "aws", PartitionOf("us-west-2"))
+	assert.Equal(t, "aws-cn", PartitionOf("cn-north-1"))
+	assert.Equal(t, "aws-us-gov", PartitionOf("us-gov-west-1"))
+	assert.Equal(t, "", PartitionOf("fakeRegion"))
+
+	assert.True(t, SamePartition("cn-north-1", "cn-northwest-1"))
+	assert.False(t, SamePartition("cn-north-1", "us-east-1"))
+	assert.True(t, SamePartition("fakeRegion", "us-east-1"))
+}
+
+func TestServiceConfigFIPS(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", "")
+	t.Setenv("AWS_USE_FIPS_ENDPOINT", "true")
+	sess := session.Must(session.NewSession())
+
+	endpoint := func(region string) string {
+		return secretsmanager.New(sess, ServiceConfig(SecretsManagerService, region)).Endpoint
+	}
+	assert.Equal(t, "https://secretsmanager-fips.us-gov-west-1.amazonaws.com", endpoint("us-gov-west-1"))
+	assert.Equal(t, "https://secretsmanager-fips.us-east-1.amazonaws.com", endpoint("us-east-1"))
+	assert.Equal(t, "https://secretsmanager.cn-north-1.amazonaws.com.cn", endpoint("cn-north-1"))
+	assert.False(t, fipsFallbacks.First("aws-cn"), "Expected the fallback to be reported")
+
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", "https://sm.example.com")
+	assert.Equal(t, "https://sm.example.com", endpoint("cn-north-1"))
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// A Kubernetes client rate limiter whose QPS and burst can be changed while
+// the provider runs.
+//
+// It implements the client-go flowcontrol.RateLimiter interface and is used
+// instead of the client's default token bucket so the --qps and --burst limits
+// can be reloaded from the configuration file.
+//
+type AdjustableRateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// Create a rate limiter allowing qps requests per second with bursts of up to
+// burst requests.
+//
+func NewAdjustableRateLimiter(qps float32, burst int) *AdjustableRateLimiter {
+	return &AdjustableRateLimiter{limiter: rate.NewLimiter(rate.Limit(qps), burst)}
+}
+
+// Change the QPS and burst of the limiter. Requests already waiting are
+// rescheduled using the new limits.
+//
+func (r *AdjustableRateLimiter) SetRate(qps float32, burst int) {
+	r.limiter.SetLimit(rate.Limit(qps))
+	r.limiter.SetBurst(burst)
+}
+
+func (r *AdjustableRateLimiter) TryAccept() bool { return r.limiter.Allow() }
+
+func (r *AdjustableRateLimiter) Accept() { r.limiter.Wait(context.Background()) }
+
+func (r *AdjustableRateLimiter) Wait(ctx context.Context) error { return r.limiter.Wait(ctx) }
+
+func (r *AdjustableRateLimiter) QPS() float32 { return float32(r.limiter.Limit()) }
+
+func (r *AdjustableRateLimiter) Stop() {}
+
+// Return the current burst of the limiter.
+//
+func (r *AdjustableRateLimiter) Burst() int { return r.limiter.Burst() }
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"testing"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var _ flowcontrol.RateLimiter = &AdjustableRateLimiter{}
+
+func TestAdjustableRateLimiter(t *testing.T) {
+
+	limiter := NewAdjustableRateLimiter(1, 2)
+	if limiter.QPS() != 1 || limiter.Burst() != 2 {
+		t.Fatalf("Unexpected limits %v %d", limiter.QPS(), limiter.Burst())
+	}
+	if !limiter.TryAccept() || !limiter.TryAccept() || limiter.TryAccept() {
+		t.Fatalf("Expected a burst of 2")
+	}
+
+	limiter.SetRate(1000, 5)
+	if limiter.QPS() != 1000 || limiter.Burst() != 5 {
+		t.Fatalf("Limits not changed %v %d", limiter.QPS(), limiter.Burst())
+	}
+	limiter.Accept() // Does not block for long at the new rate
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Time of the last successful STS call (Unix nanoseconds, 0 for never).
+var lastSTSSuccess atomic.Int64
+
+// Record the result of a call to STS.
+//
+// The provider calls STS to get the credentials of every mount, so the time
+// of the last successful call shows whether AWS credentials can still be
+// obtained (see the health endpoint).
+//
+func RecordSTSCall(err error) {
+	if err == nil {
+		lastSTSSuccess.Store(time.Now().UnixNano())
+	}
+}
+
+// Returns the time of the last successful STS call (zero if there was none).
+func LastSTSSuccess() time.Time {
+	nanos := lastSTSSuccess.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordSTSCall(t *testing.T) {
+
+	lastSTSSuccess.Store(0)
+	assert.True(t, LastSTSSuccess().IsZero())
+
+	RecordSTSCall(fmt.Errorf("denied"))
+	assert.True(t, LastSTSSuccess().IsZero())
+
+	RecordSTSCall(nil)
+	assert.WithinDuration(t, time.Now(), LastSTSSuccess(), time.Second)
+}